@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlistConfig 对应前端 UserConfig.storage.alist。Token 为空时使用用户名和密码登录
+type AlistConfig struct {
+	URL            string `json:"url"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	Token          string `json:"token,omitempty"`
+	RootPath       string `json:"rootPath"`
+	NamingStrategy string `json:"namingStrategy"`
+}
+
+// Alist 登录令牌默认 48 小时有效，按服务器和用户名缓存，收到 401 时重新登录
+var alistTokens = struct {
+	sync.Mutex
+	m map[string]string
+}{m: map[string]string{}}
+
+func init() {
+	RegisterStorage("alist", func(a *App, config StorageConfig) (StorageProvider, error) {
+		if config.Alist == nil || config.Alist.URL == "" {
+			return nil, fmt.Errorf("alist: %w", errStorageNotConfigured)
+		}
+		return NewAlistStorage(*config.Alist)
+	})
+}
+
+// AlistStorage 通过 Alist 的 /api/fs 接口访问其挂载的任意存储（阿里云盘、115、OneDrive 等）
+type AlistStorage struct {
+	config AlistConfig
+	base   string
+	root   string
+	http   *http.Client
+}
+
+func NewAlistStorage(config AlistConfig) (*AlistStorage, error) {
+	base, err := url.Parse(strings.TrimRight(config.URL, "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("invalid alist url: %q", config.URL)
+	}
+	root := config.RootPath
+	if root == "" {
+		root = AppName
+	}
+	return &AlistStorage{
+		config: config,
+		base:   base.String(),
+		root:   "/" + strings.Trim(root, "/"),
+		http:   &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+func (s *AlistStorage) Name() string {
+	return "alist"
+}
+
+func (s *AlistStorage) fullPath(p string) string {
+	clean := cleanRemotePath(p)
+	if clean == "" {
+		return s.root
+	}
+	return path.Join(s.root, clean)
+}
+
+func (s *AlistStorage) tokenKey() string {
+	return s.base + "\x00" + s.config.Username
+}
+
+// token 返回可用的令牌，force 为 true 时丢弃缓存重新登录
+func (s *AlistStorage) token(force bool) (string, error) {
+	if s.config.Token != "" {
+		return s.config.Token, nil
+	}
+	alistTokens.Lock()
+	defer alistTokens.Unlock()
+	if token := alistTokens.m[s.tokenKey()]; token != "" && !force {
+		return token, nil
+	}
+
+	body, _ := json.Marshal(map[string]string{"username": s.config.Username, "password": s.config.Password})
+	resp, err := s.http.Post(s.base+"/api/auth/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("alist login: %w", err)
+	}
+	if result.Code != http.StatusOK || result.Data.Token == "" {
+		return "", fmt.Errorf("alist login failed: %s", result.Message)
+	}
+	alistTokens.m[s.tokenKey()] = result.Data.Token
+	return result.Data.Token, nil
+}
+
+// alistError 把 Alist 响应中的 code 和 message 转为错误
+func alistError(op, p string, code int, message string) error {
+	switch {
+	case code == http.StatusOK:
+		return nil
+	case strings.Contains(message, "not found") || strings.Contains(message, "not exist"):
+		return fmt.Errorf("alist %s %s: %w", op, p, os.ErrNotExist)
+	case strings.Contains(message, "exist"):
+		return fmt.Errorf("alist %s %s: %w", op, p, os.ErrExist)
+	}
+	return fmt.Errorf("alist %s %s failed: code=%d, message=%s", op, p, code, message)
+}
+
+// call 调用 JSON 接口，令牌失效时重新登录一次
+func (s *AlistStorage) call(endpoint, p string, params interface{}, data interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		token, err := s.token(attempt > 0)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest("POST", s.base+endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := s.http.Do(req)
+		if err != nil {
+			return err
+		}
+		var result struct {
+			Code    int             `json:"code"`
+			Message string          `json:"message"`
+			Data    json.RawMessage `json:"data"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("alist %s: HTTP %d", endpoint, resp.StatusCode)
+		}
+		if result.Code == http.StatusUnauthorized && attempt == 0 && s.config.Token == "" {
+			continue
+		}
+		if err := alistError(strings.TrimPrefix(endpoint, "/api/fs/"), p, result.Code, result.Message); err != nil {
+			return err
+		}
+		if data != nil && len(result.Data) > 0 {
+			return json.Unmarshal(result.Data, data)
+		}
+		return nil
+	}
+}
+
+type alistObject struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	IsDir    bool   `json:"is_dir"`
+	Modified string `json:"modified"`
+	RawURL   string `json:"raw_url"`
+}
+
+func (o alistObject) remoteFile(dir string) RemoteFile {
+	f := RemoteFile{
+		Path:  cleanRemotePath(dir + "/" + o.Name),
+		Name:  o.Name,
+		Size:  o.Size,
+		IsDir: o.IsDir,
+	}
+	if t, err := time.Parse(time.RFC3339, o.Modified); err == nil {
+		f.Modified = t.UnixMilli()
+	}
+	return f
+}
+
+func (s *AlistStorage) List(dir string) ([]RemoteFile, error) {
+	var data struct {
+		Content []alistObject `json:"content"`
+	}
+	err := s.call("/api/fs/list", dir, map[string]interface{}{
+		"path": s.fullPath(dir), "password": "", "page": 1, "per_page": 0, "refresh": false,
+	}, &data)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]RemoteFile, 0, len(data.Content))
+	for _, o := range data.Content {
+		list = append(list, o.remoteFile(dir))
+	}
+	return list, nil
+}
+
+func (s *AlistStorage) get(p string) (alistObject, error) {
+	var obj alistObject
+	err := s.call("/api/fs/get", p, map[string]string{"path": s.fullPath(p), "password": ""}, &obj)
+	return obj, err
+}
+
+func (s *AlistStorage) Stat(p string) (RemoteFile, error) {
+	obj, err := s.get(p)
+	if err != nil {
+		return RemoteFile{}, err
+	}
+	f := obj.remoteFile(path.Dir("/" + cleanRemotePath(p)))
+	f.Path = cleanRemotePath(p)
+	return f, nil
+}
+
+// Open 通过 /api/fs/get 返回的 raw_url 下载，raw_url 是否支持 Range 取决于后端存储
+func (s *AlistStorage) Open(p string, offset, length int64) (io.ReadCloser, error) {
+	obj, err := s.get(p)
+	if err != nil {
+		return nil, err
+	}
+	if obj.IsDir || obj.RawURL == "" {
+		return nil, fmt.Errorf("alist open %s: no raw url", p)
+	}
+	req, err := http.NewRequest("GET", obj.RawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if rangeHeader := byteRange(offset, length); rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("alist download %s failed: HTTP %d", p, resp.StatusCode)
+	}
+	return rangeBody(resp, offset, length)
+}
+
+// Put 使用流式上传接口 /api/fs/put，父目录由 Alist 自动创建
+func (s *AlistStorage) Put(p string, r io.ReadSeeker, policy UploadPolicy, progress ProgressFunc) (string, error) {
+	target := cleanRemotePath(p)
+	switch policy {
+	case UploadRename:
+		var err error
+		if target, err = freeRemoteName(s.Stat, target); err != nil {
+			return "", err
+		}
+	case UploadFail:
+		if _, err := s.Stat(target); err == nil {
+			return "", fmt.Errorf("alist put %s: %w", p, os.ErrExist)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	size, err := seekerSize(r)
+	if err != nil {
+		return "", err
+	}
+	start, _ := r.Seek(0, io.SeekCurrent)
+
+	for attempt := 0; ; attempt++ {
+		token, err := s.token(attempt > 0)
+		if err != nil {
+			return "", err
+		}
+		req, err := http.NewRequest("PUT", s.base+"/api/fs/put", newProgressReader(r, size, progress))
+		if err != nil {
+			return "", err
+		}
+		req.ContentLength = size
+		req.Header.Set("Authorization", token)
+		req.Header.Set("File-Path", url.PathEscape(s.fullPath(target)))
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("As-Task", "false")
+		resp, err := s.http.Do(req)
+		if err != nil {
+			return "", err
+		}
+		var result struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("alist put %s: HTTP %d", p, resp.StatusCode)
+		}
+		if result.Code == http.StatusUnauthorized && attempt == 0 && s.config.Token == "" {
+			if _, err := r.Seek(start, io.SeekStart); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if err := alistError("put", p, result.Code, result.Message); err != nil {
+			return "", err
+		}
+		return target, nil
+	}
+}
+
+// Mkdir 由 Alist 逐级创建目录
+func (s *AlistStorage) Mkdir(dir string) error {
+	err := s.call("/api/fs/mkdir", dir, map[string]string{"path": s.fullPath(dir)}, nil)
+	if errors.Is(err, os.ErrExist) {
+		return nil
+	}
+	return err
+}
+
+// Move 组合 /api/fs/move 和 /api/fs/rename：先在原目录改名，再移动到目标目录
+func (s *AlistStorage) Move(from, to string, overwrite bool) error {
+	from, to = cleanRemotePath(from), cleanRemotePath(to)
+	if _, err := s.Stat(to); err == nil {
+		if !overwrite {
+			return fmt.Errorf("alist move %s: %w", from, os.ErrExist)
+		}
+		if err := s.Delete(to); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	fromDir, fromName := path.Split("/" + from)
+	toDir, toName := path.Split("/" + to)
+	if fromName != toName {
+		if err := s.call("/api/fs/rename", from, map[string]string{"path": s.fullPath(from), "name": toName}, nil); err != nil {
+			return err
+		}
+	}
+	if fromDir == toDir {
+		return nil
+	}
+	if err := s.Mkdir(toDir); err != nil {
+		return err
+	}
+	return s.call("/api/fs/move", from, map[string]interface{}{
+		"src_dir": s.fullPath(fromDir),
+		"dst_dir": s.fullPath(toDir),
+		"names":   []string{toName},
+	}, nil)
+}
+
+func (s *AlistStorage) Delete(p string) error {
+	dir, name := path.Split("/" + cleanRemotePath(p))
+	if name == "" {
+		return errors.New("refusing to delete storage root")
+	}
+	err := s.call("/api/fs/remove", p, map[string]interface{}{
+		"dir":   s.fullPath(dir),
+		"names": []string{name},
+	}, nil)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Quota Alist 没有统一的容量接口
+func (s *AlistStorage) Quota() (StorageQuota, error) {
+	return StorageQuota{}, nil
+}
+
+// VerifyAlist 测试 Alist 登录并确保根目录存在
+func (a *App) VerifyAlist(config AlistConfig) string {
+	s, err := NewAlistStorage(config)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if _, err := s.token(true); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if err := s.Mkdir(""); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Annotation 是一条高亮或笔记。EPUB 使用 CFI 范围定位，PDF 使用页码和四边形坐标
+type Annotation struct {
+	ID           string `json:"id"`
+	EbookID      string `json:"ebookId"`
+	ChapterIndex int    `json:"chapterIndex"`
+	ChapterTitle string `json:"chapterTitle,omitempty"`
+	CFIRange     string `json:"cfiRange,omitempty"`
+	Page         int    `json:"page,omitempty"`
+	// Quads 每项 8 个数，依次为四个角的 x、y（PDF 坐标）
+	Quads     [][]float64 `json:"quads,omitempty"`
+	Text      string      `json:"text"`
+	Note      string      `json:"note,omitempty"`
+	Color     string      `json:"color"`
+	DeviceID  string      `json:"deviceId,omitempty"`
+	CreatedAt int64       `json:"createdAt"`
+	UpdatedAt int64       `json:"updatedAt"`
+	Deleted   bool        `json:"deleted,omitempty"`
+}
+
+const defaultAnnotationColor = "#ffeb3b"
+
+func newAnnotationSet(dir string, db *LibraryDB) *RecordSet[Annotation] {
+	return NewRecordSet[Annotation]("annotation", newDBTable(db, dbAnnotations),
+		filepath.Join(dir, "annotations.json"),
+		filepath.Join(dir, "sync", "annotations-base.json"))
+}
+
+// sortAnnotations 按书中位置排序：先章节或页码，再按创建时间
+func sortAnnotations(list []Annotation) {
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.ChapterIndex != b.ChapterIndex {
+			return a.ChapterIndex < b.ChapterIndex
+		}
+		if a.Page != b.Page {
+			return a.Page < b.Page
+		}
+		return a.CreatedAt < b.CreatedAt
+	})
+}
+
+func (a *App) bookAnnotations(ebookID string) []Annotation {
+	list := a.annotations.Filter(func(item *Annotation) bool {
+		return item.EbookID == ebookID && !item.Deleted
+	})
+	sortAnnotations(list)
+	return list
+}
+
+// SaveAnnotation 新建或更新标注，ID 为空时新建；返回保存后的标注
+func (a *App) SaveAnnotation(annotation Annotation) string {
+	if annotation.EbookID == "" {
+		return `{"error": "ebookId is required"}`
+	}
+	if annotation.CFIRange == "" && annotation.Page <= 0 {
+		return `{"error": "cfiRange or page is required"}`
+	}
+
+	now := time.Now().UnixMilli()
+	if annotation.ID == "" {
+		annotation.ID = newID()
+		annotation.CreatedAt = now
+	} else if existing, ok := a.annotations.Get(annotation.ID); ok {
+		annotation.CreatedAt = existing.CreatedAt
+	}
+	if annotation.CreatedAt == 0 {
+		annotation.CreatedAt = now
+	}
+	if annotation.Color == "" {
+		annotation.Color = defaultAnnotationColor
+	}
+	if annotation.Page > 0 && annotation.ChapterIndex == 0 {
+		annotation.ChapterIndex = annotation.Page
+	}
+	annotation.DeviceID = a.settings.Device().ID
+	annotation.UpdatedAt = now
+	annotation.Deleted = false
+
+	if err := a.annotations.Put(annotation.ID, &annotation); err != nil {
+		log.Printf("[Annotations] 保存标注失败: %v", err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(annotation)
+}
+
+func (a *App) DeleteAnnotation(id string) string {
+	annotation, ok := a.annotations.Get(id)
+	if !ok || annotation.Deleted {
+		return `{"error": "annotation not found"}`
+	}
+	annotation.Deleted = true
+	annotation.UpdatedAt = time.Now().UnixMilli()
+	if err := a.annotations.Put(id, annotation); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
+
+func (a *App) GetAnnotation(id string) *Annotation {
+	annotation, ok := a.annotations.Get(id)
+	if !ok || annotation.Deleted {
+		return nil
+	}
+	return annotation
+}
+
+func (a *App) ListAnnotations(ebookId string) []Annotation {
+	return a.bookAnnotations(ebookId)
+}
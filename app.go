@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -59,9 +60,27 @@ func (lt *LoggingTransport) RoundTrip(req *http.Request) (*http.Response, error)
 }
 
 type App struct {
-	ctx    context.Context
-	config *Config
-	client *http.Client
+	ctx         context.Context
+	config      *Config
+	client      *http.Client
+	store       *BookStore
+	settings    *ConfigStore
+	db          *LibraryDB
+	progress    *ProgressJournal
+	library     *Library
+	devices     *DeviceRegistry
+	stats       *StatsLog
+	sync        *SyncEngine
+	annotations *RecordSet[Annotation]
+	bookmarks   *RecordSet[Bookmark]
+	collections *SmartCollections
+	opds        *OPDSCatalogStore
+	opdsServer  *OPDSServer
+	watcher     *FolderWatcher
+	folderSync  *FolderSync
+	dedupe      *Deduper
+	metadata    *MetadataService
+	links       *DeepLinkQueue
 }
 
 type Config struct {
@@ -73,23 +92,80 @@ func NewApp() *App {
 		Transport: http.DefaultTransport,
 	}
 
-	return &App{
+	dataDir := appDataDir()
+	db, err := OpenLibraryDB(filepath.Join(dataDir, "library.db"))
+	if err != nil {
+		log.Fatalf("[LibraryDB] 打开书库数据库失败: %v", err)
+	}
+	app := &App{
 		config: &Config{
 			Port: 3001,
 		},
 		client: &http.Client{
 			Transport: loggingTransport,
 		},
-	}
+		store:       NewBookStore(filepath.Join(dataDir, "books")),
+		settings:    NewConfigStore(dataDir),
+		db:          db,
+		progress:    NewProgressJournal(db, filepath.Join(dataDir, "progress.jsonl")),
+		library:     NewLibrary(dataDir, db),
+		devices:     NewDeviceRegistry(dataDir),
+		annotations: newAnnotationSet(dataDir, db),
+		bookmarks:   newBookmarkSet(dataDir, db),
+		opds:        NewOPDSCatalogStore(filepath.Join(dataDir, "opds.json")),
+		links:       &DeepLinkQueue{},
+	}
+	app.collections = NewSmartCollections(app, newCollectionSet(dataDir, db))
+	app.library.onChange = app.collections.invalidate
+	app.stats = NewStatsLog(filepath.Join(dataDir, "stats"), app.settings.Device().ID)
+	app.sync = NewSyncEngine(app, filepath.Join(dataDir, "sync"))
+	app.opdsServer = NewOPDSServer(app, filepath.Join(dataDir, "opds-server.json"))
+	app.watcher = NewFolderWatcher(app, filepath.Join(dataDir, "watch.json"))
+	app.folderSync = NewFolderSync(app, filepath.Join(dataDir, "sync", "folder-base.json"))
+	app.dedupe = NewDeduper(app, filepath.Join(dataDir, "fingerprints.json"))
+	app.metadata = NewMetadataService(app, dataDir)
+	return app
 }
 
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 	log.Println("Neat Reader starting...")
+	a.sync.Start()
+	if err := a.opdsServer.Start(); err != nil {
+		log.Printf("[OPDS Server] 启动失败: %v", err)
+	}
+	a.watcher.Start()
+	a.openDeepLinks(os.Args[1:])
 }
 
 func (a *App) shutdown(ctx context.Context) {
 	log.Println("Neat Reader shutting down...")
+	a.sync.Stop()
+	a.opdsServer.Stop()
+	a.watcher.Stop()
+	if err := a.stats.End(""); err != nil {
+		log.Printf("[Stats] 保存阅读会话失败: %v", err)
+	}
+	if err := a.db.Close(); err != nil {
+		log.Printf("[LibraryDB] 关闭数据库失败: %v", err)
+	}
+}
+
+// jsonResult 把结果编码为绑定方法返回的 JSON 字符串
+func jsonResult(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		// 编码 map[string]string 不会失败，错误信息中的引号也会被转义
+		data, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	return string(data)
+}
+
+// emit 向前端发送事件，启动前调用时忽略
+func (a *App) emit(event string, data ...interface{}) {
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, event, data...)
+	}
 }
 
 func (a *App) GetHealth() string {
@@ -122,7 +198,7 @@ func (a *App) UploadFile(fileName string, fileData []byte, accessToken string) s
 	return result
 }
 
-func (a *App) singleUpload(accessToken, filePath string, file *os.File) string {
+func (a *App) singleUpload(accessToken, filePath string, file io.Reader) string {
 	baiduPath := getBaiduPath(filePath)
 	log.Printf("[SingleUpload] 百度路径: %s", baiduPath)
 
@@ -403,10 +479,7 @@ func (a *App) OpenDirectory() string {
 	if err != nil {
 		return fmt.Sprintf(`{"error": "%v"}`, err)
 	}
-	if path == "" {
-		return `{"path": ""}`
-	}
-	return fmt.Sprintf(`{"path": "%s"}`, path)
+	return jsonResult(map[string]string{"path": path})
 }
 
 func (a *App) ReadFile(path string) []byte {
@@ -430,3 +503,55 @@ func (a *App) SelectFile() string {
 	}
 	return fmt.Sprintf(`{"path": "%s"}`, filePath)
 }
+
+// SelectBookFiles 弹出多选文件框，只显示支持导入的电子书格式
+func (a *App) SelectBookFiles() string {
+	paths, err := runtime.OpenMultipleFilesDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "选择电子书",
+		Filters: []runtime.FileFilter{{DisplayName: "电子书 (*.epub;*.pdf;*.txt)", Pattern: "*.epub;*.pdf;*.txt"}},
+	})
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if paths == nil {
+		paths = []string{}
+	}
+	return jsonResult(map[string]interface{}{"paths": paths})
+}
+
+// StoreBookFile 从本地路径读取并保存书籍文件，文件内容不经过前端。
+// EPUB 会先检查并修复，check 为检查结果，前端通过 url 读取保存后的文件
+func (a *App) StoreBookFile(id string, filePath string) string {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	fileName := filepath.Base(filePath)
+	data, report, err := a.checkBookFile(id, fileName, data)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	path, err := a.store.Save(id, fileName, data)
+	if err != nil {
+		log.Printf("[Store] 保存书籍失败: %s, %v", id, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	log.Printf("[Store] 书籍已保存: %s -> %s", id, path)
+	result := map[string]interface{}{
+		"url":      "/books/" + url.PathEscape(id),
+		"path":     path,
+		"fileName": fileName,
+		"size":     len(data),
+	}
+	if report != nil {
+		result["check"] = report
+	}
+	return jsonResult(result)
+}
+
+func (a *App) RemoveStoredBook(id string) string {
+	if err := a.store.Remove(id); err != nil && !os.IsNotExist(err) {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
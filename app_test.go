@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+// newTestApp 在临时目录中创建只包含书库和文件存储的 App，不启动同步和文件监视
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := OpenLibraryDB(filepath.Join(dir, "library.db"))
+	if err != nil {
+		t.Fatalf("open library db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &App{
+		store:    NewBookStore(filepath.Join(dir, "books")),
+		settings: NewConfigStore(dir),
+		db:       db,
+		library:  NewLibrary(dir, db),
+		opds:     NewOPDSCatalogStore(filepath.Join(dir, "opds.json")),
+		links:    &DeepLinkQueue{},
+	}
+}
+
+// decodeResult 解析绑定方法返回的 JSON，包含 error 字段时测试失败
+func decodeResult(t *testing.T, result string, v interface{}) {
+	t.Helper()
+	var e struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(result), &e); err != nil {
+		t.Fatalf("invalid result %s: %v", result, err)
+	}
+	if e.Error != "" {
+		t.Fatalf("unexpected error: %s", e.Error)
+	}
+	if v != nil {
+		if err := json.Unmarshal([]byte(result), v); err != nil {
+			t.Fatalf("decode result %s: %v", result, err)
+		}
+	}
+}
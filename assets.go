@@ -0,0 +1,207 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 可以通过 /books/{id}/res/{path} 访问内部资源的归档格式
+var archiveExts = map[string]bool{
+	".epub": true,
+	".zip":  true,
+	".cbz":  true,
+}
+
+// 最多缓存的简繁转换结果数量，一般只有正在阅读的一两本书
+const maxZhCacheEntries = 4
+
+// zhCacheEntry 转换后的整本书，文件修改时间变化后失效
+type zhCacheEntry struct {
+	modTime time.Time
+	data    []byte
+}
+
+// BookAssetHandler 为前端提供书籍文件的流式访问：
+//
+//	/books/{id}             整本书，支持 HTTP Range
+//	/books/{id}/res/{path}  EPUB 或压缩包内的单个文件
+//
+// 两者都可以加上 ?zh=s2t|s2tw|t2s 查询参数，返回简繁转换后的内容
+type BookAssetHandler struct {
+	store *BookStore
+
+	zhMu    sync.Mutex
+	zhCache map[string]zhCacheEntry
+}
+
+func NewBookAssetHandler(store *BookStore) *BookAssetHandler {
+	return &BookAssetHandler{store: store, zhCache: map[string]zhCacheEntry{}}
+}
+
+func (h *BookAssetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/books/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/books/")
+	id, resPath, _ := strings.Cut(rest, "/")
+
+	filePath, err := h.store.Path(id)
+	if err != nil {
+		log.Printf("[Assets] 书籍不存在: %s, %v", id, err)
+		http.NotFound(w, r)
+		return
+	}
+
+	var conv *zhConverter
+	if mode := r.URL.Query().Get("zh"); mode != "" {
+		if conv, err = chineseConverter(mode); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch {
+	case resPath == "" && conv != nil:
+		h.serveConvertedBook(w, r, filePath, r.URL.Query().Get("zh"), conv)
+	case resPath == "":
+		h.serveBook(w, r, filePath)
+	case strings.HasPrefix(resPath, "res/"):
+		h.serveResource(w, r, filePath, strings.TrimPrefix(resPath, "res/"), conv)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *BookAssetHandler) serveBook(w http.ResponseWriter, r *http.Request, filePath string) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// serveConvertedBook 返回简繁转换后的整本书，结果按文件和转换方式缓存
+func (h *BookAssetHandler) serveConvertedBook(w http.ResponseWriter, r *http.Request, filePath, mode string, conv *zhConverter) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	key := filePath + "?zh=" + mode
+	h.zhMu.Lock()
+	entry, ok := h.zhCache[key]
+	h.zhMu.Unlock()
+	if !ok || !entry.modTime.Equal(info.ModTime()) {
+		data, err := convertBookChinese(filePath, conv)
+		if err != nil {
+			log.Printf("[Assets] 简繁转换失败: %s, %v", filePath, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entry = zhCacheEntry{modTime: info.ModTime(), data: data}
+		h.zhMu.Lock()
+		if len(h.zhCache) >= maxZhCacheEntries {
+			for k := range h.zhCache {
+				delete(h.zhCache, k)
+				break
+			}
+		}
+		h.zhCache[key] = entry
+		h.zhMu.Unlock()
+	}
+
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), bytes.NewReader(entry.data))
+}
+
+func (h *BookAssetHandler) serveResource(w http.ResponseWriter, r *http.Request, filePath, name string, conv *zhConverter) {
+	if !archiveExts[strings.ToLower(filepath.Ext(filePath))] {
+		http.Error(w, "book is not an archive", http.StatusBadRequest)
+		return
+	}
+
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		log.Printf("[Assets] 打开归档失败: %s, %v", filePath, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer zr.Close()
+
+	entry := findZipEntry(&zr.Reader, name)
+	if entry == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	rc, err := entry.Open()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if conv != nil {
+		if converted := conv.convertEntry(entry.Name, data); converted != nil {
+			data = converted
+		}
+	}
+
+	w.Header().Set("Accept-Ranges", "bytes")
+	http.ServeContent(w, r, path.Base(name), entry.Modified, bytes.NewReader(data))
+}
+
+// findZipEntry 按路径查找归档条目，找不到时忽略大小写再试一次
+func findZipEntry(zr *zip.Reader, name string) *zip.File {
+	for _, f := range zr.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	for _, f := range zr.File {
+		if strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// BaiduFile 对应百度网盘文件列表接口返回的单个条目
+type BaiduFile struct {
+	FsId           int64  `json:"fs_id"`
+	Path           string `json:"path"`
+	ServerFilename string `json:"server_filename"`
+	Size           int64  `json:"size"`
+	ServerMtime    int64  `json:"server_mtime"`
+	ServerCtime    int64  `json:"server_ctime"`
+	IsDir          int    `json:"isdir"`
+	Category       int    `json:"category"`
+	MD5            string `json:"md5"`
+	Dlink          string `json:"dlink,omitempty"`
+}
+
+// 百度网盘 errno：-8 表示文件或目录已存在，-9 表示不存在
+const (
+	baiduErrnoExist    = -8
+	baiduErrnoNotExist = -9
+)
+
+// 上传接口 error_code：31061 表示文件已存在
+const baiduUploadErrExist = 31061
+
+// baiduListDir 列出目录下的全部文件，自动翻页
+func (a *App) baiduListDir(accessToken, dir string) ([]BaiduFile, error) {
+	const limit = 1000
+	var files []BaiduFile
+
+	for start := 0; ; start += limit {
+		params := url.Values{}
+		params.Set("method", "list")
+		params.Set("access_token", accessToken)
+		params.Set("dir", dir)
+		params.Set("order", "name")
+		params.Set("start", fmt.Sprintf("%d", start))
+		params.Set("limit", fmt.Sprintf("%d", limit))
+
+		resp, err := a.client.Get("https://pan.baidu.com/rest/2.0/xpan/file?" + params.Encode())
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		var listResp struct {
+			Errno int         `json:"errno"`
+			List  []BaiduFile `json:"list"`
+		}
+		if err := json.Unmarshal(body, &listResp); err != nil {
+			return nil, err
+		}
+		if listResp.Errno == baiduErrnoNotExist {
+			return nil, os.ErrNotExist
+		}
+		if listResp.Errno != 0 {
+			return nil, fmt.Errorf("list %s failed: errno=%d", dir, listResp.Errno)
+		}
+
+		files = append(files, listResp.List...)
+		if len(listResp.List) < limit {
+			return files, nil
+		}
+	}
+}
+
+// baiduStat 查找网盘上的单个文件，不存在时返回 os.ErrNotExist
+func (a *App) baiduStat(accessToken, fullPath string) (*BaiduFile, error) {
+	files, err := a.baiduListDir(accessToken, path.Dir(fullPath))
+	if err != nil {
+		return nil, err
+	}
+	name := path.Base(fullPath)
+	for i := range files {
+		if files[i].ServerFilename == name {
+			return &files[i], nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// baiduDlink 通过 filemetas 获取文件的下载链接
+func (a *App) baiduDlink(accessToken string, fsId int64) (string, error) {
+	params := url.Values{}
+	params.Set("access_token", accessToken)
+	params.Set("fsids", fmt.Sprintf("[%d]", fsId))
+	params.Set("dlink", "1")
+
+	resp, err := a.client.Get("https://pan.baidu.com/rest/2.0/xpan/multimedia?method=filemetas&" + params.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var metaResp struct {
+		Errno int         `json:"errno"`
+		List  []BaiduFile `json:"list"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metaResp); err != nil {
+		return "", err
+	}
+	if metaResp.Errno != 0 {
+		return "", fmt.Errorf("filemetas failed: errno=%d", metaResp.Errno)
+	}
+	if len(metaResp.List) == 0 || metaResp.List[0].Dlink == "" {
+		return "", fmt.Errorf("no dlink for fs_id %d", fsId)
+	}
+	return metaResp.List[0].Dlink, nil
+}
+
+// baiduOpen 打开网盘文件用于读取，rangeHeader 非空时按 Range 请求
+func (a *App) baiduOpen(accessToken, fullPath, rangeHeader string) (*http.Response, error) {
+	file, err := a.baiduStat(accessToken, fullPath)
+	if err != nil {
+		return nil, err
+	}
+	dlink, err := a.baiduDlink(accessToken, file.FsId)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s&access_token=%s", dlink, accessToken), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "pan.baidu.com")
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+
+	// 下载内容可能很大，不经过 LoggingTransport
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("download %s failed: HTTP %d", fullPath, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// ensureBaiduToken 返回可用的访问令牌，临近过期且配置了 AppKey 时自动刷新
+func (a *App) ensureBaiduToken() (string, error) {
+	bp := a.settings.Config().Storage.Baidupan
+	if bp == nil || bp.AccessToken == "" {
+		return "", fmt.Errorf("baidupan is not authorized")
+	}
+
+	expiresSoon := bp.Expiration > 0 && time.Now().Add(5*time.Minute).UnixMilli() > bp.Expiration
+	if !expiresSoon {
+		return bp.AccessToken, nil
+	}
+	if bp.RefreshToken == "" || bp.AppKey == "" || bp.SecretKey == "" {
+		return "", fmt.Errorf("baidupan token expired")
+	}
+
+	log.Printf("[Baidu] 访问令牌即将过期，开始刷新")
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal([]byte(a.RefreshToken(bp.RefreshToken, bp.AppKey, bp.SecretKey)), &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("refresh token failed: %s %s", token.Error, token.ErrorDescription)
+	}
+
+	err := a.settings.UpdateBaidupan(func(bp *BaidupanConfig) {
+		bp.AccessToken = token.AccessToken
+		if token.RefreshToken != "" {
+			bp.RefreshToken = token.RefreshToken
+		}
+		bp.Expiration = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second).UnixMilli()
+	})
+	if err != nil {
+		log.Printf("[Baidu] 保存刷新后的令牌失败: %v", err)
+	}
+	a.emit("config:baidupan-token", a.settings.Config().Storage.Baidupan)
+	return token.AccessToken, nil
+}
+
+func init() {
+	RegisterStorage("baidupan", func(a *App, config StorageConfig) (StorageProvider, error) {
+		if config.Baidupan == nil || config.Baidupan.AccessToken == "" {
+			return nil, fmt.Errorf("baidupan: %w", errStorageNotConfigured)
+		}
+		return &BaiduStorage{app: a}, nil
+	})
+}
+
+// BaiduStorage 是百度网盘的 StorageProvider，根目录为 /apps/<AppName>，每次调用时检查令牌是否需要刷新
+type BaiduStorage struct {
+	app *App
+}
+
+func (s *BaiduStorage) Name() string {
+	return "baidupan"
+}
+
+func (s *BaiduStorage) fullPath(p string) string {
+	return getBaiduPath(cleanRemotePath(p))
+}
+
+func (s *BaiduStorage) remoteFile(f BaiduFile) RemoteFile {
+	rel := strings.TrimPrefix(strings.TrimPrefix(f.Path, getBaiduPath("")), "/")
+	return RemoteFile{
+		Path:     rel,
+		Name:     f.ServerFilename,
+		Size:     f.Size,
+		IsDir:    f.IsDir == 1,
+		Modified: f.ServerMtime * 1000,
+		ETag:     f.MD5,
+	}
+}
+
+func (s *BaiduStorage) List(dir string) ([]RemoteFile, error) {
+	token, err := s.app.ensureBaiduToken()
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.app.baiduListDir(token, s.fullPath(dir))
+	if err != nil {
+		return nil, err
+	}
+	list := make([]RemoteFile, 0, len(files))
+	for _, f := range files {
+		list = append(list, s.remoteFile(f))
+	}
+	return list, nil
+}
+
+func (s *BaiduStorage) Stat(p string) (RemoteFile, error) {
+	if cleanRemotePath(p) == "" {
+		return RemoteFile{IsDir: true}, nil
+	}
+	token, err := s.app.ensureBaiduToken()
+	if err != nil {
+		return RemoteFile{}, err
+	}
+	file, err := s.app.baiduStat(token, s.fullPath(p))
+	if err != nil {
+		return RemoteFile{}, err
+	}
+	return s.remoteFile(*file), nil
+}
+
+func (s *BaiduStorage) Open(p string, offset, length int64) (io.ReadCloser, error) {
+	token, err := s.app.ensureBaiduToken()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.app.baiduOpen(token, s.fullPath(p), byteRange(offset, length))
+	if err != nil {
+		return nil, err
+	}
+	return rangeBody(resp, offset, length)
+}
+
+// Put 以流式 multipart 上传，父目录由网盘自动创建
+func (s *BaiduStorage) Put(p string, r io.ReadSeeker, policy UploadPolicy, progress ProgressFunc) (string, error) {
+	token, err := s.app.ensureBaiduToken()
+	if err != nil {
+		return "", err
+	}
+	size, err := seekerSize(r)
+	if err != nil {
+		return "", err
+	}
+	fullPath := s.fullPath(p)
+	uploadDomain, err := s.app.getUploadDomain(token, fullPath)
+	if err != nil {
+		return "", fmt.Errorf("get upload domain: %w", err)
+	}
+
+	ondup := "overwrite"
+	switch policy {
+	case UploadRename:
+		ondup = "newcopy"
+	case UploadFail:
+		ondup = "fail"
+	}
+	uploadURL := fmt.Sprintf("%s/rest/2.0/pcs/file?method=upload&access_token=%s&path=%s&ondup=%s",
+		uploadDomain, token, url.QueryEscape(fullPath), ondup)
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		part, err := writer.CreateFormFile("file", "upload")
+		if err == nil {
+			_, err = io.Copy(part, newProgressReader(r, size, progress))
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	// 上传内容可能很大，不经过 LoggingTransport
+	resp, err := http.Post(uploadURL, writer.FormDataContentType(), pr)
+	if err != nil {
+		pr.CloseWithError(err)
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var uploadResp struct {
+		Path      string `json:"path"`
+		ErrorCode int    `json:"error_code"`
+		ErrorMsg  string `json:"error_msg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&uploadResp); err != nil {
+		return "", fmt.Errorf("unexpected upload response: HTTP %d", resp.StatusCode)
+	}
+	switch {
+	case uploadResp.ErrorCode == baiduUploadErrExist:
+		return "", fmt.Errorf("upload %s: %w", p, os.ErrExist)
+	case uploadResp.ErrorCode != 0:
+		return "", fmt.Errorf("upload failed: error_code=%d, error_msg=%s", uploadResp.ErrorCode, uploadResp.ErrorMsg)
+	}
+	return s.remoteFile(BaiduFile{Path: uploadResp.Path}).Path, nil
+}
+
+// baiduErrno 把接口返回的 errno 转为错误
+func baiduErrno(op, p string, errno int) error {
+	switch errno {
+	case 0:
+		return nil
+	case baiduErrnoExist:
+		return fmt.Errorf("%s %s: %w", op, p, os.ErrExist)
+	case baiduErrnoNotExist:
+		return fmt.Errorf("%s %s: %w", op, p, os.ErrNotExist)
+	}
+	return fmt.Errorf("%s %s failed: errno=%d", op, p, errno)
+}
+
+// baiduPost 调用 xpan/file 的写操作接口
+func (s *BaiduStorage) baiduPost(method string, query, form url.Values) (int, error) {
+	token, err := s.app.ensureBaiduToken()
+	if err != nil {
+		return 0, err
+	}
+	query.Set("method", method)
+	query.Set("access_token", token)
+	resp, err := s.app.client.PostForm("https://pan.baidu.com/rest/2.0/xpan/file?"+query.Encode(), form)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Errno int `json:"errno"`
+		Info  []struct {
+			Errno int `json:"errno"`
+		} `json:"info"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	// 批量操作的具体错误在 info 中
+	if result.Errno != 0 && len(result.Info) > 0 && result.Info[0].Errno != 0 {
+		return result.Info[0].Errno, nil
+	}
+	return result.Errno, nil
+}
+
+func (s *BaiduStorage) Mkdir(dir string) error {
+	fullPath := s.fullPath(dir)
+	form := url.Values{}
+	form.Set("path", fullPath)
+	form.Set("isdir", "1")
+	form.Set("rtype", "0")
+	errno, err := s.baiduPost("create", url.Values{}, form)
+	if err != nil {
+		return err
+	}
+	if errno == baiduErrnoExist {
+		return nil
+	}
+	return baiduErrno("mkdir", dir, errno)
+}
+
+func (s *BaiduStorage) Move(from, to string, overwrite bool) error {
+	if err := s.Mkdir(path.Dir("/" + to)); err != nil {
+		return err
+	}
+	ondup := "fail"
+	if overwrite {
+		ondup = "overwrite"
+	}
+	target := s.fullPath(to)
+	filelist, _ := json.Marshal([]map[string]string{{
+		"path":    s.fullPath(from),
+		"dest":    path.Dir(target),
+		"newname": path.Base(target),
+		"ondup":   ondup,
+	}})
+	form := url.Values{}
+	form.Set("async", "0")
+	form.Set("filelist", string(filelist))
+	errno, err := s.baiduPost("filemanager", url.Values{"opera": {"move"}}, form)
+	if err != nil {
+		return err
+	}
+	return baiduErrno("move", from, errno)
+}
+
+func (s *BaiduStorage) Delete(p string) error {
+	filelist, _ := json.Marshal([]string{s.fullPath(p)})
+	form := url.Values{}
+	form.Set("async", "0")
+	form.Set("filelist", string(filelist))
+	errno, err := s.baiduPost("filemanager", url.Values{"opera": {"delete"}}, form)
+	if err != nil {
+		return err
+	}
+	if errno == baiduErrnoNotExist {
+		return nil
+	}
+	return baiduErrno("delete", p, errno)
+}
+
+func (s *BaiduStorage) Quota() (StorageQuota, error) {
+	token, err := s.app.ensureBaiduToken()
+	if err != nil {
+		return StorageQuota{}, err
+	}
+	resp, err := s.app.client.Get("https://pan.baidu.com/api/quota?checkfree=1&access_token=" + url.QueryEscape(token))
+	if err != nil {
+		return StorageQuota{}, err
+	}
+	defer resp.Body.Close()
+	var quota struct {
+		Errno int   `json:"errno"`
+		Total int64 `json:"total"`
+		Used  int64 `json:"used"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&quota); err != nil {
+		return StorageQuota{}, err
+	}
+	if err := baiduErrno("quota", "", quota.Errno); err != nil {
+		return StorageQuota{}, err
+	}
+	return StorageQuota{Total: quota.Total, Used: quota.Used}, nil
+}
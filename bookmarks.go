@@ -0,0 +1,185 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 自动截取的书签上下文长度（字符）
+const bookmarkSnippetLength = 80
+
+// Bookmark 是书中的一个命名位置。EPUB 使用 CFI，PDF 使用页码
+type Bookmark struct {
+	ID           string  `json:"id"`
+	EbookID      string  `json:"ebookId"`
+	Label        string  `json:"label"`
+	CFI          string  `json:"cfi,omitempty"`
+	Page         int     `json:"page,omitempty"`
+	ChapterIndex int     `json:"chapterIndex"`
+	ChapterTitle string  `json:"chapterTitle,omitempty"`
+	Position     float64 `json:"position"`
+	Snippet      string  `json:"snippet,omitempty"`
+	DeviceID     string  `json:"deviceId,omitempty"`
+	CreatedAt    int64   `json:"createdAt"`
+	UpdatedAt    int64   `json:"updatedAt"`
+	Deleted      bool    `json:"deleted,omitempty"`
+}
+
+func newBookmarkSet(dir string, db *LibraryDB) *RecordSet[Bookmark] {
+	return NewRecordSet[Bookmark]("bookmark", newDBTable(db, dbBookmarks),
+		filepath.Join(dir, "bookmarks.json"),
+		filepath.Join(dir, "sync", "bookmarks-base.json"))
+}
+
+func (a *App) bookBookmarks(ebookID string) []Bookmark {
+	list := a.bookmarks.Filter(func(item *Bookmark) bool {
+		return item.EbookID == ebookID && !item.Deleted
+	})
+	sort.Slice(list, func(i, j int) bool {
+		x, y := list[i], list[j]
+		if x.ChapterIndex != y.ChapterIndex {
+			return x.ChapterIndex < y.ChapterIndex
+		}
+		if x.Position != y.Position {
+			return x.Position < y.Position
+		}
+		return x.CreatedAt < y.CreatedAt
+	})
+	return list
+}
+
+// captureSnippet 从本地保存的 EPUB 中截取书签位置附近的文字，失败时返回空
+func (a *App) captureSnippet(ebookID, cfi string) string {
+	path, err := a.store.Path(ebookID)
+	if err != nil || !strings.EqualFold(filepath.Ext(path), ".epub") {
+		return ""
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return ""
+	}
+	defer zr.Close()
+	snippet, err := epubSnippetAt(&zr.Reader, cfi, bookmarkSnippetLength)
+	if err != nil {
+		log.Printf("[Bookmarks] 截取书签上下文失败: %s, %v", ebookID, err)
+	}
+	return snippet
+}
+
+// defaultBookmarkLabel 依次使用章节名、上下文开头或页码作为书签名
+func defaultBookmarkLabel(b Bookmark) string {
+	if b.ChapterTitle != "" {
+		return b.ChapterTitle
+	}
+	if b.Snippet != "" {
+		runes := []rune(b.Snippet)
+		if len(runes) > 20 {
+			return string(runes[:20]) + "…"
+		}
+		return b.Snippet
+	}
+	if b.Page > 0 {
+		return fmt.Sprintf("第 %d 页", b.Page)
+	}
+	return time.UnixMilli(b.CreatedAt).Format("2006-01-02 15:04")
+}
+
+// AddBookmark 新建书签，未提供上下文时从书中自动截取；返回保存后的书签
+func (a *App) AddBookmark(bookmark Bookmark) string {
+	if bookmark.EbookID == "" {
+		return `{"error": "ebookId is required"}`
+	}
+	if bookmark.CFI == "" && bookmark.Page <= 0 {
+		return `{"error": "cfi or page is required"}`
+	}
+
+	now := time.Now().UnixMilli()
+	bookmark.ID = newID()
+	bookmark.CreatedAt = now
+	bookmark.UpdatedAt = now
+	bookmark.DeviceID = a.settings.Device().ID
+	bookmark.Deleted = false
+	if bookmark.Page > 0 && bookmark.ChapterIndex == 0 {
+		bookmark.ChapterIndex = bookmark.Page
+	}
+	if bookmark.Snippet == "" && bookmark.CFI != "" {
+		bookmark.Snippet = a.captureSnippet(bookmark.EbookID, bookmark.CFI)
+	}
+	if strings.TrimSpace(bookmark.Label) == "" {
+		bookmark.Label = defaultBookmarkLabel(bookmark)
+	}
+
+	if err := a.bookmarks.Put(bookmark.ID, &bookmark); err != nil {
+		log.Printf("[Bookmarks] 保存书签失败: %v", err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(bookmark)
+}
+
+func (a *App) RenameBookmark(id string, label string) string {
+	bookmark, ok := a.bookmarks.Get(id)
+	if !ok || bookmark.Deleted {
+		return `{"error": "bookmark not found"}`
+	}
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return `{"error": "label is required"}`
+	}
+	bookmark.Label = label
+	bookmark.UpdatedAt = time.Now().UnixMilli()
+	if err := a.bookmarks.Put(id, bookmark); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
+
+func (a *App) DeleteBookmark(id string) string {
+	bookmark, ok := a.bookmarks.Get(id)
+	if !ok || bookmark.Deleted {
+		return `{"error": "bookmark not found"}`
+	}
+	bookmark.Deleted = true
+	bookmark.UpdatedAt = time.Now().UnixMilli()
+	if err := a.bookmarks.Put(id, bookmark); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
+
+func (a *App) ListBookmarks(ebookId string) []Bookmark {
+	return a.bookBookmarks(ebookId)
+}
+
+// JumpToBookmark 把阅读进度移到书签位置并返回该进度，供前端跳转。
+// 跳转是用户主动行为，即使位置靠前也会同步到其他设备
+func (a *App) JumpToBookmark(id string) string {
+	bookmark, ok := a.bookmarks.Get(id)
+	if !ok || bookmark.Deleted {
+		return `{"error": "bookmark not found"}`
+	}
+	device := a.settings.Device()
+	progress := ReadingProgress{
+		EbookID:      bookmark.EbookID,
+		ChapterIndex: bookmark.ChapterIndex,
+		ChapterTitle: bookmark.ChapterTitle,
+		Position:     bookmark.Position,
+		CFI:          bookmark.CFI,
+		Timestamp:    time.Now().UnixMilli(),
+		DeviceID:     device.ID,
+		DeviceName:   device.Name,
+		Explicit:     true,
+	}
+	if previous := a.progress.Get(bookmark.EbookID); previous != nil {
+		progress.ReadingTime = previous.ReadingTime
+	}
+	if err := a.progress.Record(progress); err != nil {
+		log.Printf("[Bookmarks] 跳转书签时保存进度失败: %v", err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(progress)
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"embed"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// 简繁转换词典取自 OpenCC（Apache-2.0，见 opencc/NOTICE），每行 "原文\t默认译文 其他候选"
+//
+//go:embed opencc/*.txt
+var openccDicts embed.FS
+
+// ChineseConversion 对应前端可选的简繁转换方式
+type ChineseConversion struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Language string `json:"language"`
+}
+
+// 与 OpenCC 的配置相同，每一步是一组按优先级排列的词典，词组在前、单字在后
+var chineseConfigs = []struct {
+	ChineseConversion
+	suffix string     // 转换后书名没有变化时追加的标记
+	steps  [][]string // 依次执行的转换步骤
+}{
+	{ChineseConversion{"s2t", "简体 → 繁体", "zh-Hant"}, "（繁體）", [][]string{{"STPhrases.txt", "STCharacters.txt"}}},
+	{ChineseConversion{"s2tw", "简体 → 台湾正体", "zh-TW"}, "（正體）", [][]string{{"STPhrases.txt", "STCharacters.txt"}, {"TWVariants.txt"}}},
+	{ChineseConversion{"t2s", "繁体 → 简体", "zh-CN"}, "（简体）", [][]string{{"TSPhrases.txt", "TSCharacters.txt"}}},
+}
+
+// zhDictGroup 合并后的一组词典，按最长前缀匹配，同样长度时排在前面的词典优先
+type zhDictGroup struct {
+	entries map[string]string
+	maxLen  int // 最长词条的字数
+}
+
+// zhConverter 一种简繁转换方式
+type zhConverter struct {
+	language string
+	suffix   string
+	steps    []*zhDictGroup
+}
+
+var (
+	zhConvertersMu sync.Mutex
+	zhConverters   = map[string]*zhConverter{}
+	zhDictGroups   = map[string]*zhDictGroup{}
+)
+
+// loadZhDict 读取词典文件，只取每行的第一个候选
+func loadZhDict(name string, group *zhDictGroup) error {
+	data, err := openccDicts.ReadFile("opencc/" + name)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, values, ok := strings.Cut(line, "\t")
+		value, _, _ := strings.Cut(values, " ")
+		if !ok || key == "" || value == "" {
+			continue
+		}
+		if _, exists := group.entries[key]; exists {
+			continue
+		}
+		group.entries[key] = value
+		if n := utf8.RuneCountInString(key); n > group.maxLen {
+			group.maxLen = n
+		}
+	}
+	return scanner.Err()
+}
+
+// chineseConverter 返回指定方式的转换器，词典在第一次使用时加载
+func chineseConverter(mode string) (*zhConverter, error) {
+	zhConvertersMu.Lock()
+	defer zhConvertersMu.Unlock()
+	if c, ok := zhConverters[mode]; ok {
+		return c, nil
+	}
+	for _, config := range chineseConfigs {
+		if config.ID != mode {
+			continue
+		}
+		c := &zhConverter{language: config.Language, suffix: config.suffix}
+		for _, names := range config.steps {
+			key := strings.Join(names, "+")
+			group, ok := zhDictGroups[key]
+			if !ok {
+				group = &zhDictGroup{entries: map[string]string{}}
+				for _, name := range names {
+					if err := loadZhDict(name, group); err != nil {
+						return nil, fmt.Errorf("load %s: %w", name, err)
+					}
+				}
+				zhDictGroups[key] = group
+			}
+			c.steps = append(c.steps, group)
+		}
+		zhConverters[mode] = c
+		return c, nil
+	}
+	return nil, fmt.Errorf("unknown conversion: %s", mode)
+}
+
+// isCJKRune 粗略判断是否可能出现在词典中，用来跳过 ASCII 等无需查表的字符
+func isCJKRune(r rune) bool {
+	return r >= 0x2E80
+}
+
+// convert 从左到右做最大正向匹配，没有匹配的字符原样保留
+func (g *zhDictGroup) convert(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(runes); {
+		if !isCJKRune(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+		// 词条只由汉字和全角符号组成，匹配长度不超过当前这一段
+		end := i
+		for end < len(runes) && end-i < g.maxLen && isCJKRune(runes[end]) {
+			end++
+		}
+		matched := false
+		for n := end - i; n > 0; n-- {
+			if v, ok := g.entries[string(runes[i:i+n])]; ok {
+				b.WriteString(v)
+				i += n
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			b.WriteRune(runes[i])
+			i++
+		}
+	}
+	return b.String()
+}
+
+// Convert 转换纯文本
+func (c *zhConverter) Convert(s string) string {
+	for _, step := range c.steps {
+		s = step.convert(s)
+	}
+	return s
+}
+
+// ConvertMarkup 只转换 XML/HTML 标签之间的文字，标签、属性和文件名保持不变
+func (c *zhConverter) ConvertMarkup(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for s != "" {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			b.WriteString(c.Convert(s))
+			break
+		}
+		b.WriteString(c.Convert(s[:i]))
+		j := strings.IndexByte(s[i:], '>')
+		if j < 0 {
+			b.WriteString(s[i:])
+			break
+		}
+		b.WriteString(s[i : i+j+1])
+		s = s[i+j+1:]
+	}
+	return b.String()
+}
+
+// zhMarkupExts 需要转换的 EPUB 内部文件
+var zhMarkupExts = map[string]bool{
+	".xhtml": true,
+	".html":  true,
+	".htm":   true,
+	".ncx":   true,
+	".opf":   true,
+}
+
+// convertEntry 转换归档中的单个文件，不需要转换时返回 nil
+func (c *zhConverter) convertEntry(name string, data []byte) []byte {
+	ext := strings.ToLower(path.Ext(name))
+	if !zhMarkupExts[ext] && ext != ".txt" {
+		return nil
+	}
+	if !utf8.Valid(data) {
+		return nil
+	}
+	if ext == ".txt" {
+		return []byte(c.Convert(string(data)))
+	}
+	return []byte(c.ConvertMarkup(string(data)))
+}
+
+// setOPFLanguage 把中文的 dc:language 改为转换后的语言，其他语言保持不变
+func setOPFLanguage(opf, language string) string {
+	m := opfMetadataPattern.FindStringSubmatchIndex(opf)
+	if m == nil {
+		return opf
+	}
+	prefix := "dc"
+	if p := opfDCPrefixPattern.FindStringSubmatch(opf); p != nil {
+		prefix = p[1]
+	}
+	metadata := opf[m[4]:m[5]]
+	lang := dcElementPattern(prefix, "language").FindStringSubmatch(metadata)
+	if lang == nil || !strings.HasPrefix(strings.ToLower(strings.TrimSpace(lang[2])), "zh") {
+		return opf
+	}
+	metadata = setDCElement(metadata, prefix, "language", language, false)
+	return opf[:m[4]] + metadata + opf[m[5]:]
+}
+
+// convertEpubChinese 生成内容经过简繁转换的 EPUB
+func convertEpubChinese(zr *zip.Reader, c *zhConverter) ([]byte, error) {
+	opfPath, err := epubOPFPath(zr)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		data, err := readZipFile(zr, f.Name)
+		if err != nil {
+			return nil, err
+		}
+		converted := c.convertEntry(f.Name, data)
+		if converted == nil {
+			continue
+		}
+		if f.Name == opfPath {
+			converted = []byte(setOPFLanguage(string(converted), c.language))
+		}
+		files[f.Name] = converted
+	}
+	var buf bytes.Buffer
+	if err := writeEpubArchive(&buf, zr, files); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// convertBookChinese 转换整本书，目前支持 EPUB 和 TXT，TXT 统一输出为 UTF-8
+func convertBookChinese(filePath string, c *zhConverter) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".epub":
+		zr, err := zip.OpenReader(filePath)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return convertEpubChinese(&zr.Reader, c)
+	case ".txt":
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		text, _ := decodeText(data)
+		return []byte(c.Convert(string(text))), nil
+	default:
+		return nil, fmt.Errorf("conversion is only supported for epub and txt books")
+	}
+}
+
+// GetChineseConversions 返回可选的简繁转换方式
+func (a *App) GetChineseConversions() []ChineseConversion {
+	conversions := make([]ChineseConversion, 0, len(chineseConfigs))
+	for _, config := range chineseConfigs {
+		conversions = append(conversions, config.ChineseConversion)
+	}
+	return conversions
+}
+
+// ConvertChineseBook 对书籍做简繁转换，结果作为一本新书加入书库，原书保持不变
+func (a *App) ConvertChineseBook(ebookId, mode string) string {
+	book, ok := a.library.Book(ebookId)
+	if !ok {
+		return `{"error": "book not found"}`
+	}
+	c, err := chineseConverter(mode)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	localPath, err := a.store.Path(book.ID)
+	if err != nil {
+		return `{"error": "book file not found"}`
+	}
+	data, err := convertBookChinese(localPath, c)
+	if err != nil {
+		log.Printf("[Chinese] 转换失败: %s, %v", book.Title, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+
+	title := c.Convert(book.Title)
+	if title == book.Title {
+		title += c.suffix
+	}
+	ext := strings.ToLower(filepath.Ext(localPath))
+	id := newID()
+	if _, err := a.store.Save(id, sanitizeFileName(title)+ext, data); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	ebook := EbookMetadata{
+		ID:            id,
+		Title:         title,
+		Author:        c.Convert(book.Author),
+		Cover:         book.Cover,
+		Path:          id,
+		Format:        book.Format,
+		Size:          int64(len(data)),
+		TotalChapters: book.TotalChapters,
+		StorageType:   "local",
+		CategoryID:    book.CategoryID,
+		Tags:          book.Tags,
+		Series:        c.Convert(book.Series),
+		SeriesIndex:   book.SeriesIndex,
+		Publisher:     c.Convert(book.Publisher),
+		PublishedDate: book.PublishedDate,
+		Description:   c.Convert(book.Description),
+		AddedAt:       time.Now().UnixMilli(),
+	}
+	if err := a.library.PutBook(ebook); err != nil {
+		a.store.Remove(id)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	log.Printf("[Chinese] 已转换 (%s): %s -> %s (%d bytes)", mode, book.Title, ebook.Title, len(data))
+	a.emit("library:book-added", ebook)
+	a.emit("library:changed")
+	return jsonResult(ebook)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+const (
+	testSimplified  = "她的头发很长，皇后住在乾隆年间的宫里，后来喝了一杯茶。"
+	testTraditional = "她的頭髮很長，皇后住在乾隆年間的宮裏，後來喝了一杯茶。"
+	testTaiwan      = "她的頭髮很長，皇后住在乾隆年間的宮裡，後來喝了一杯茶。"
+)
+
+func TestChineseConversion(t *testing.T) {
+	// 头发/頭髮、乾隆、皇后 都需要词组才能转换正确，逐字转换会得到 頭發、干隆、皇後
+	for _, c := range []struct{ mode, in, want string }{
+		{"s2t", testSimplified, testTraditional},
+		{"s2tw", testSimplified, testTaiwan},
+		{"t2s", testTraditional, testSimplified},
+	} {
+		conv, err := chineseConverter(c.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := conv.Convert(c.in); got != c.want {
+			t.Errorf("%s:\n got %s\nwant %s", c.mode, got, c.want)
+		}
+	}
+}
+
+func TestChineseBookConversion(t *testing.T) {
+	app := newTestApp(t)
+	book := EbookMetadata{ID: "zh", Title: "乾隆皇后", Author: "佚名", Path: "zh", Format: "txt", StorageType: "local"}
+	if _, err := app.store.Save(book.ID, "book.txt", []byte(testSimplified)); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.library.PutBook(book); err != nil {
+		t.Fatal(err)
+	}
+
+	// 阅读器通过 /books/{id}?zh= 读取转换后的内容
+	handler := NewBookAssetHandler(app.store)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/books/zh?zh=s2t", nil))
+	if body, _ := io.ReadAll(rec.Body); rec.Code != 200 || string(body) != testTraditional {
+		t.Fatalf("converted book = %d %s", rec.Code, body)
+	}
+
+	var converted EbookMetadata
+	decodeResult(t, app.ConvertChineseBook(book.ID, "s2tw"), &converted)
+	if converted.Title != "乾隆皇后（正體）" {
+		t.Errorf("title = %s", converted.Title)
+	}
+	p, err := app.store.Path(converted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(p); err != nil || string(data) != testTaiwan {
+		t.Errorf("converted file = %s, %v", data, err)
+	}
+}
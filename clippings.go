@@ -0,0 +1,610 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ImportedHighlight 是从其他阅读器导入、尚未关联到书库的一条高亮
+type ImportedHighlight struct {
+	Title     string
+	Author    string
+	Text      string
+	Note      string
+	Page      int
+	Location  string
+	Chapter   string
+	Color     string
+	CreatedAt int64
+}
+
+// Kindle 条目类型在各语言下的关键字
+var (
+	kindleHighlightWords = []string{"Highlight", "标注", "標註", "ハイライト", "Markierung", "surlignement", "subrayado", "evidenziazione", "destaque"}
+	kindleNoteWords      = []string{"Note", "笔记", "筆記", "メモ", "Notiz", "note", "nota"}
+	kindleBookmarkWords  = []string{"Bookmark", "书签", "書籤", "ブックマーク", "Lesezeichen", "signet", "marcador", "segnalibro"}
+)
+
+var (
+	kindleTitleAuthorRe = regexp.MustCompile(`^(.*?)\s*\(([^()]*)\)\s*$`)
+	kindlePageRe        = regexp.MustCompile(`(?i)(?:page|第|Seite|la page|página|pagina)\s*(\d+)|(\d+)\s*(?:页|頁|ページ)`)
+	kindleLocationRe    = regexp.MustCompile(`(?i)(?:Location|位置|Position|emplacement|posición|posizione)\s*(?:No\.|#)?\s*(\d+(?:-\d+)?)`)
+	kindleAddedRe       = regexp.MustCompile(`(?i)(?:Added on|添加于|新增於|作成日[:：]?|Hinzugefügt am|Ajouté le|Añadido el|Aggiunto il|Adicionado:?)\s*(.+)$`)
+)
+
+var kindleMonthNames = map[string]int{
+	"january": 1, "february": 2, "march": 3, "april": 4, "may": 5, "june": 6,
+	"july": 7, "august": 8, "september": 9, "october": 10, "november": 11, "december": 12,
+	"januar": 1, "februar": 2, "märz": 3, "mai": 5, "juni": 6, "juli": 7, "oktober": 10, "dezember": 12,
+	"janvier": 1, "février": 2, "mars": 3, "avril": 4, "juin": 6, "juillet": 7, "août": 8,
+	"septembre": 9, "octobre": 10, "novembre": 11, "décembre": 12,
+	"enero": 1, "febrero": 2, "marzo": 3, "abril": 4, "mayo": 5, "junio": 6, "julio": 7,
+	"agosto": 8, "septiembre": 9, "octubre": 10, "noviembre": 11, "diciembre": 12,
+	"gennaio": 1, "febbraio": 2, "aprile": 4, "maggio": 5, "giugno": 6, "luglio": 7,
+	"settembre": 9, "ottobre": 10, "dicembre": 12,
+}
+
+var (
+	clippingTimeRe    = regexp.MustCompile(`(\d{1,2}):(\d{2})(?::(\d{2}))?\s*(AM|PM|am|pm)?`)
+	clippingCJKDateRe = regexp.MustCompile(`(\d{4})\s*年\s*(\d{1,2})\s*月\s*(\d{1,2})\s*日`)
+	clippingNumberRe  = regexp.MustCompile(`\d+`)
+	clippingWordRe    = regexp.MustCompile(`\p{L}+`)
+)
+
+// parseClippingDate 解析各语言 Kindle 的“添加于”日期，按本地时区处理
+func parseClippingDate(s string) (time.Time, bool) {
+	var year, month, day int
+
+	if m := clippingCJKDateRe.FindStringSubmatch(s); m != nil {
+		year, _ = strconv.Atoi(m[1])
+		month, _ = strconv.Atoi(m[2])
+		day, _ = strconv.Atoi(m[3])
+	} else {
+		for _, w := range clippingWordRe.FindAllString(s, -1) {
+			if n, ok := kindleMonthNames[strings.ToLower(w)]; ok {
+				month = n
+				break
+			}
+		}
+		datePart := clippingTimeRe.ReplaceAllString(s, "")
+		for _, n := range clippingNumberRe.FindAllString(datePart, -1) {
+			v, _ := strconv.Atoi(n)
+			switch {
+			case len(n) == 4:
+				year = v
+			case day == 0:
+				day = v
+			}
+		}
+	}
+	if year == 0 || month == 0 || day == 0 {
+		return time.Time{}, false
+	}
+
+	var hour, minute, second int
+	if m := clippingTimeRe.FindStringSubmatch(s); m != nil {
+		hour, _ = strconv.Atoi(m[1])
+		minute, _ = strconv.Atoi(m[2])
+		second, _ = strconv.Atoi(m[3])
+		pm := strings.EqualFold(m[4], "PM") || strings.Contains(s, "下午") || strings.Contains(s, "午後")
+		am := strings.EqualFold(m[4], "AM") || strings.Contains(s, "上午") || strings.Contains(s, "午前")
+		if pm && hour < 12 {
+			hour += 12
+		}
+		if am && hour == 12 {
+			hour = 0
+		}
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, second, 0, time.Local), true
+}
+
+func containsAny(s string, words []string) bool {
+	for _, w := range words {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// kindleClipping 是 My Clippings.txt 中的一个条目
+type kindleClipping struct {
+	ImportedHighlight
+	kind string // highlight | note | bookmark
+}
+
+// locationRange 解析 “180-182” 形式的位置
+func locationRange(loc string) (int, int) {
+	start, end, found := strings.Cut(loc, "-")
+	s, _ := strconv.Atoi(start)
+	if !found {
+		return s, s
+	}
+	e, _ := strconv.Atoi(end)
+	if e < s {
+		// Kindle 有时把 1234-56 简写为后几位
+		prefix := start[:max(0, len(start)-len(end))]
+		e, _ = strconv.Atoi(prefix + end)
+	}
+	return s, e
+}
+
+// ParseKindleClippings 解析 Kindle 的 My Clippings.txt，笔记会合并到位置相同的高亮上
+func ParseKindleClippings(r io.Reader) ([]ImportedHighlight, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var clippings []kindleClipping
+	var block []string
+	flush := func() {
+		if c, ok := parseKindleBlock(block); ok {
+			clippings = append(clippings, c)
+		}
+		block = block[:0]
+	}
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), "\ufeff")
+		if strings.HasPrefix(line, "==========") {
+			flush()
+			continue
+		}
+		block = append(block, line)
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var highlights []ImportedHighlight
+	index := map[string][]int{}
+	var notes []kindleClipping
+	for _, c := range clippings {
+		switch c.kind {
+		case "highlight":
+			index[c.Title] = append(index[c.Title], len(highlights))
+			highlights = append(highlights, c.ImportedHighlight)
+		case "note":
+			notes = append(notes, c)
+		}
+	}
+
+	for _, n := range notes {
+		_, noteLoc := locationRange(n.Location)
+		attached := false
+		for _, i := range index[n.Title] {
+			start, end := locationRange(highlights[i].Location)
+			if noteLoc >= start && noteLoc <= end || (n.Page > 0 && n.Page == highlights[i].Page && n.Location == "") {
+				if highlights[i].Note != "" {
+					highlights[i].Note += "\n"
+				}
+				highlights[i].Note += n.Text
+				attached = true
+				break
+			}
+		}
+		if !attached {
+			h := n.ImportedHighlight
+			h.Note, h.Text = h.Text, ""
+			highlights = append(highlights, h)
+		}
+	}
+	return highlights, nil
+}
+
+func parseKindleBlock(lines []string) (kindleClipping, bool) {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	if len(lines) < 2 {
+		return kindleClipping{}, false
+	}
+
+	var c kindleClipping
+	header := strings.TrimSpace(lines[0])
+	if m := kindleTitleAuthorRe.FindStringSubmatch(header); m != nil {
+		c.Title, c.Author = strings.TrimSpace(m[1]), strings.TrimSpace(m[2])
+	} else {
+		c.Title = header
+	}
+
+	meta := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(lines[1]), "-"))
+	switch {
+	case containsAny(meta, kindleBookmarkWords):
+		c.kind = "bookmark"
+	case containsAny(meta, kindleHighlightWords):
+		c.kind = "highlight"
+	case containsAny(meta, kindleNoteWords):
+		c.kind = "note"
+	default:
+		c.kind = "highlight"
+	}
+
+	metaHead := meta
+	if m := kindleAddedRe.FindStringSubmatchIndex(meta); m != nil {
+		metaHead = meta[:m[0]]
+		if t, ok := parseClippingDate(meta[m[2]:m[3]]); ok {
+			c.CreatedAt = t.UnixMilli()
+		}
+	}
+	if m := kindleLocationRe.FindStringSubmatch(metaHead); m != nil {
+		c.Location = m[1]
+		metaHead = strings.Replace(metaHead, m[0], "", 1)
+	}
+	if m := kindlePageRe.FindStringSubmatch(metaHead); m != nil {
+		if m[1] != "" {
+			c.Page, _ = strconv.Atoi(m[1])
+		} else {
+			c.Page, _ = strconv.Atoi(m[2])
+		}
+	}
+
+	c.Text = strings.TrimSpace(strings.Join(lines[2:], "\n"))
+	if c.Text == "" && c.kind != "bookmark" {
+		return kindleClipping{}, false
+	}
+	return c, true
+}
+
+// parseLuaTable 解析 KOReader sidecar 使用的 Lua 表（return { ... }），
+// 数组部分返回 []interface{}，其余返回 map[string]interface{}
+func parseLuaTable(src string) (interface{}, error) {
+	p := &luaParser{src: src}
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], "return") {
+		p.pos += len("return")
+	}
+	p.skipSpace()
+	return p.value()
+}
+
+type luaParser struct {
+	src string
+	pos int
+}
+
+func (p *luaParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("lua: offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *luaParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], "--"):
+			if end := strings.IndexByte(p.src[p.pos:], '\n'); end >= 0 {
+				p.pos += end + 1
+			} else {
+				p.pos = len(p.src)
+			}
+		case unicode.IsSpace(rune(p.src[p.pos])):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *luaParser) value() (interface{}, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("unexpected end of input")
+	}
+	switch c := p.src[p.pos]; {
+	case c == '{':
+		return p.table()
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '-' || c >= '0' && c <= '9':
+		return p.number()
+	default:
+		word := p.ident()
+		switch word {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "nil":
+			return nil, nil
+		}
+		return nil, p.errorf("unexpected token %q", word)
+	}
+}
+
+func (p *luaParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *luaParser) number() (interface{}, error) {
+	start := p.pos
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-xXabcdefABCDEF", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	text := p.src[start:p.pos]
+	if n, err := strconv.ParseInt(text, 0, 64); err == nil {
+		return float64(n), nil
+	}
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, p.errorf("bad number %q", text)
+	}
+	return n, nil
+}
+
+func (p *luaParser) str() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return b.String(), nil
+		case c == '\\' && p.pos+1 < len(p.src):
+			p.pos++
+			e := p.src[p.pos]
+			switch e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '\n':
+				b.WriteByte('\n')
+			case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+				end := p.pos
+				for end < len(p.src) && end < p.pos+3 && p.src[end] >= '0' && p.src[end] <= '9' {
+					end++
+				}
+				n, _ := strconv.Atoi(p.src[p.pos:end])
+				b.WriteByte(byte(n))
+				p.pos = end - 1
+			default:
+				b.WriteByte(e)
+			}
+			p.pos++
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *luaParser) table() (interface{}, error) {
+	p.pos++ // {
+	hash := map[string]interface{}{}
+	var array []interface{}
+
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("unterminated table")
+		}
+		if p.src[p.pos] == '}' {
+			p.pos++
+			break
+		}
+
+		var key string
+		hasKey := false
+		switch c := p.src[p.pos]; {
+		case c == '[':
+			p.pos++
+			k, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace()
+			if p.pos >= len(p.src) || p.src[p.pos] != ']' {
+				return nil, p.errorf("expected ]")
+			}
+			p.pos++
+			key, hasKey = fmt.Sprint(k), true
+			if f, ok := k.(float64); ok {
+				key = strconv.FormatFloat(f, 'f', -1, 64)
+			}
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			save := p.pos
+			word := p.ident()
+			p.skipSpace()
+			if p.pos < len(p.src) && p.src[p.pos] == '=' {
+				key, hasKey = word, true
+			} else {
+				p.pos = save
+			}
+		}
+
+		if hasKey {
+			p.skipSpace()
+			if p.pos >= len(p.src) || p.src[p.pos] != '=' {
+				return nil, p.errorf("expected =")
+			}
+			p.pos++
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if hasKey {
+			hash[key] = v
+		} else {
+			array = append(array, v)
+		}
+
+		p.skipSpace()
+		if p.pos < len(p.src) && (p.src[p.pos] == ',' || p.src[p.pos] == ';') {
+			p.pos++
+		}
+	}
+
+	// KOReader 把数组写成 [1] = ...，[2] = ... 的形式，这里统一转为数组
+	if len(array) == 0 && len(hash) > 0 {
+		list := make([]interface{}, 0, len(hash))
+		for i := 1; ; i++ {
+			v, ok := hash[strconv.Itoa(i)]
+			if !ok {
+				break
+			}
+			list = append(list, v)
+		}
+		if len(list) == len(hash) {
+			return list, nil
+		}
+	}
+	if len(hash) == 0 {
+		return array, nil
+	}
+	return hash, nil
+}
+
+func luaString(m map[string]interface{}, key string) string {
+	switch v := m[key].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+func luaInt(m map[string]interface{}, key string) int {
+	switch v := m[key].(type) {
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	return 0
+}
+
+func luaList(v interface{}) []interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		return t
+	case map[string]interface{}:
+		// 旧版 highlight 表以页码为键
+		list := make([]interface{}, 0, len(t))
+		for _, item := range t {
+			list = append(list, item)
+		}
+		return list
+	}
+	return nil
+}
+
+// ParseKOReaderSidecar 解析 KOReader 的 metadata.*.lua，兼容新版 annotations 和旧版 highlight 表
+func ParseKOReaderSidecar(src string) ([]ImportedHighlight, error) {
+	v, err := parseLuaTable(src)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("sidecar is not a table")
+	}
+
+	var title, author string
+	for _, key := range []string{"doc_props", "stats"} {
+		if props, ok := root[key].(map[string]interface{}); ok {
+			if title == "" {
+				title = luaString(props, "title")
+			}
+			if author == "" {
+				author = luaString(props, "authors")
+			}
+		}
+	}
+
+	toHighlight := func(item map[string]interface{}) ImportedHighlight {
+		h := ImportedHighlight{
+			Title:   title,
+			Author:  author,
+			Text:    strings.TrimSpace(luaString(item, "text")),
+			Note:    strings.TrimSpace(luaString(item, "note")),
+			Chapter: luaString(item, "chapter"),
+			Color:   luaString(item, "color"),
+			Page:    luaInt(item, "pageno"),
+		}
+		if h.Page == 0 {
+			h.Page = luaInt(item, "page")
+		}
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", luaString(item, "datetime"), time.Local); err == nil {
+			h.CreatedAt = t.UnixMilli()
+		}
+		return h
+	}
+
+	var highlights []ImportedHighlight
+	if annotations := luaList(root["annotations"]); annotations != nil {
+		for _, a := range annotations {
+			if item, ok := a.(map[string]interface{}); ok && luaString(item, "text") != "" {
+				// 没有 pos0 的条目是书签
+				if _, hasPos := item["pos0"]; hasPos || luaString(item, "drawer") != "" {
+					highlights = append(highlights, toHighlight(item))
+				}
+			}
+		}
+		return highlights, nil
+	}
+
+	notes := map[string]string{}
+	for _, b := range luaList(root["bookmarks"]) {
+		if item, ok := b.(map[string]interface{}); ok {
+			// 旧版书签中 notes 为高亮原文，text 为用户笔记或自动生成的摘要
+			if luaString(item, "notes") != "" && luaString(item, "text") != "" {
+				notes[luaString(item, "datetime")] = luaString(item, "text")
+			}
+		}
+	}
+	for page, group := range asMap(root["highlight"]) {
+		for _, h := range luaList(group) {
+			item, ok := h.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			hl := toHighlight(item)
+			if hl.Page == 0 {
+				hl.Page, _ = strconv.Atoi(page)
+			}
+			if note, ok := notes[luaString(item, "datetime")]; ok && !strings.Contains(note, hl.Text) {
+				hl.Note = note
+			}
+			highlights = append(highlights, hl)
+		}
+	}
+	return highlights, nil
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return t
+	case []interface{}:
+		m := make(map[string]interface{}, len(t))
+		for i, item := range t {
+			m[strconv.Itoa(i+1)] = item
+		}
+		return m
+	}
+	return nil
+}
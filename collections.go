@@ -0,0 +1,405 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SmartRule 是智能书单的一条规则。
+// field 可以是 title、author、format、tag、series、category、storageType、status、progress、addedAt、lastRead；
+// op 为 eq、ne、contains、gt、gte、lt、lte。
+// addedAt 和 lastRead 的 value 可以是 today、thisWeek、thisMonth、thisYear、最近 N 天（如 30d）或日期（2006-01-02）
+type SmartRule struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+// SmartCollection 是按规则自动筛选书籍的书单，match 为 all 时需满足全部规则，any 时满足任一规则
+type SmartCollection struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	Color     string      `json:"color,omitempty"`
+	Match     string      `json:"match"`
+	Rules     []SmartRule `json:"rules"`
+	Sort      string      `json:"sort,omitempty"` // 与 BookQuery.Sort 相同
+	Desc      bool        `json:"desc,omitempty"`
+	CreatedAt int64       `json:"createdAt"`
+	UpdatedAt int64       `json:"updatedAt"`
+	Deleted   bool        `json:"deleted,omitempty"`
+}
+
+// SmartCollectionView 是返回给前端的书单及其当前包含的书籍
+type SmartCollectionView struct {
+	SmartCollection
+	BookIDs []string `json:"bookIds"`
+}
+
+func newCollectionSet(dir string, db *LibraryDB) *RecordSet[SmartCollection] {
+	return NewRecordSet[SmartCollection]("collection", newDBTable(db, dbCollections),
+		filepath.Join(dir, "collections.json"),
+		filepath.Join(dir, "sync", "collections-base.json"))
+}
+
+var recentDaysPattern = regexp.MustCompile(`^(\d+)d$`)
+
+// ruleTime 把日期规则的值解析为毫秒时间戳
+func ruleTime(value string, now time.Time) (int64, error) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch value {
+	case "today":
+		return day.UnixMilli(), nil
+	case "thisWeek":
+		// 以周一为一周的开始
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset).UnixMilli(), nil
+	case "thisMonth":
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).UnixMilli(), nil
+	case "thisYear":
+		return time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location()).UnixMilli(), nil
+	}
+	if m := recentDaysPattern.FindStringSubmatch(value); m != nil {
+		days, _ := strconv.Atoi(m[1])
+		return now.AddDate(0, 0, -days).UnixMilli(), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, now.Location())
+	if err != nil {
+		return 0, fmt.Errorf("invalid date %q", value)
+	}
+	return t.UnixMilli(), nil
+}
+
+var compareOps = map[string]bool{"eq": true, "ne": true, "gt": true, "gte": true, "lt": true, "lte": true}
+
+func compareOp(op string, c int) bool {
+	switch op {
+	case "eq":
+		return c == 0
+	case "ne":
+		return c != 0
+	case "gt":
+		return c > 0
+	case "gte":
+		return c >= 0
+	case "lt":
+		return c < 0
+	case "lte":
+		return c <= 0
+	}
+	return false
+}
+
+// validateRule 检查规则的字段、操作符和值
+func validateRule(r SmartRule) error {
+	switch r.Field {
+	case "title", "author", "format", "series", "storageType":
+		if r.Op != "eq" && r.Op != "ne" && r.Op != "contains" {
+			return fmt.Errorf("%s does not support %s", r.Field, r.Op)
+		}
+	case "tag", "category", "status":
+		if r.Op != "eq" && r.Op != "ne" {
+			return fmt.Errorf("%s does not support %s", r.Field, r.Op)
+		}
+	case "progress":
+		if _, err := strconv.ParseFloat(r.Value, 64); err != nil {
+			return fmt.Errorf("invalid progress %q", r.Value)
+		}
+		if !compareOps[r.Op] {
+			return fmt.Errorf("unknown op %q", r.Op)
+		}
+	case "addedAt", "lastRead":
+		if _, err := ruleTime(r.Value, time.Now()); err != nil {
+			return err
+		}
+		if !compareOps[r.Op] {
+			return fmt.Errorf("unknown op %q", r.Op)
+		}
+	default:
+		return fmt.Errorf("unknown field %q", r.Field)
+	}
+	return nil
+}
+
+func matchString(op, actual, value string) bool {
+	a, v := strings.ToLower(actual), strings.ToLower(value)
+	switch op {
+	case "eq":
+		return a == v
+	case "ne":
+		return a != v
+	case "contains":
+		return strings.Contains(a, v)
+	}
+	return false
+}
+
+// matchRule 判断书籍是否满足规则，categories 用于同时检查分类的 bookIds
+func matchRule(r SmartRule, book *EbookMetadata, categories map[string]*BookCategory, now time.Time) bool {
+	switch r.Field {
+	case "title":
+		return matchString(r.Op, book.Title, r.Value)
+	case "author":
+		return matchString(r.Op, book.Author, r.Value)
+	case "format":
+		return matchString(r.Op, book.Format, r.Value)
+	case "series":
+		return matchString(r.Op, book.Series, r.Value)
+	case "storageType":
+		return matchString(r.Op, book.StorageType, r.Value)
+	case "tag":
+		has := false
+		for _, tag := range book.Tags {
+			if strings.EqualFold(tag, r.Value) {
+				has = true
+				break
+			}
+		}
+		return has == (r.Op == "eq")
+	case "category":
+		in := book.CategoryID == r.Value
+		if c := categories[r.Value]; c != nil && !c.Deleted && containsString(c.BookIDs, book.ID) {
+			in = true
+		}
+		return in == (r.Op == "eq")
+	case "status":
+		return (bookStatus(book) == r.Value) == (r.Op == "eq")
+	case "progress":
+		value, err := strconv.ParseFloat(r.Value, 64)
+		if err != nil {
+			return false
+		}
+		return compareOp(r.Op, compareNumbers(book.ReadingProgress, value))
+	case "addedAt", "lastRead":
+		value, err := ruleTime(r.Value, now)
+		if err != nil {
+			return false
+		}
+		actual := book.AddedAt
+		if r.Field == "lastRead" {
+			actual = book.LastRead
+		}
+		return compareOp(r.Op, compareNumbers(actual, value))
+	}
+	return false
+}
+
+// Matches 判断书籍是否属于书单，没有规则的书单不包含任何书
+func (c *SmartCollection) Matches(book *EbookMetadata, categories map[string]*BookCategory, now time.Time) bool {
+	if len(c.Rules) == 0 {
+		return false
+	}
+	matchAny := c.Match == "any"
+	for _, r := range c.Rules {
+		if matchRule(r, book, categories, now) == matchAny {
+			return matchAny
+		}
+	}
+	return !matchAny
+}
+
+// Evaluate 返回属于书单的书籍 ID，按书单的排序方式排列
+func (c *SmartCollection) Evaluate(state LibraryState, now time.Time) []string {
+	var books []EbookMetadata
+	for _, b := range state.Books {
+		if !b.Deleted && c.Matches(b, state.Categories, now) {
+			books = append(books, *b)
+		}
+	}
+	sortBooks(books, c.Sort, c.Desc)
+	ids := make([]string, len(books))
+	for i, b := range books {
+		ids[i] = b.ID
+	}
+	return ids
+}
+
+// SmartCollections 保存智能书单，并在书库或书单变化后重新计算成员，
+// 有变化时向前端发送 collections:changed 事件
+type SmartCollections struct {
+	app     *App
+	set     *RecordSet[SmartCollection]
+	mu      sync.Mutex
+	members map[string][]string
+	timer   *time.Timer
+}
+
+func NewSmartCollections(app *App, set *RecordSet[SmartCollection]) *SmartCollections {
+	return &SmartCollections{app: app, set: set, members: map[string][]string{}}
+}
+
+// invalidate 在书库变化后延迟重新计算，合并短时间内的多次变更。不会阻塞调用方
+func (s *SmartCollections) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timer = time.AfterFunc(300*time.Millisecond, func() { s.refresh() })
+}
+
+// refresh 重新计算全部书单，返回最新结果
+func (s *SmartCollections) refresh() []SmartCollectionView {
+	views := s.evaluate()
+	members := make(map[string][]string, len(views))
+	for _, v := range views {
+		members[v.ID] = v.BookIDs
+	}
+
+	s.mu.Lock()
+	changed := !reflect.DeepEqual(s.members, members)
+	s.members = members
+	s.mu.Unlock()
+
+	if changed {
+		log.Printf("[Collections] 智能书单已更新，共 %d 个", len(views))
+		s.app.emit("collections:changed")
+	}
+	return views
+}
+
+func (s *SmartCollections) evaluate() []SmartCollectionView {
+	state := s.app.library.Snapshot()
+	now := time.Now()
+	collections := s.set.Filter(func(c *SmartCollection) bool { return !c.Deleted })
+	sort.Slice(collections, func(i, j int) bool {
+		if collections[i].CreatedAt != collections[j].CreatedAt {
+			return collections[i].CreatedAt < collections[j].CreatedAt
+		}
+		return collections[i].ID < collections[j].ID
+	})
+	views := make([]SmartCollectionView, len(collections))
+	for i := range collections {
+		views[i] = SmartCollectionView{
+			SmartCollection: collections[i],
+			BookIDs:         collections[i].Evaluate(state, now),
+		}
+	}
+	return views
+}
+
+// normalizeTags 去掉空白和重复的标签，保留原有顺序
+func normalizeTags(tags []string) []string {
+	var result []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+// ListSmartCollections 返回全部智能书单及其当前包含的书籍
+func (a *App) ListSmartCollections() string {
+	return jsonResult(map[string]interface{}{"collections": a.collections.refresh()})
+}
+
+// SaveSmartCollection 新建或更新智能书单，ID 为空时新建；返回保存后的书单
+func (a *App) SaveSmartCollection(collection SmartCollection) string {
+	collection.Name = strings.TrimSpace(collection.Name)
+	if collection.Name == "" {
+		return `{"error": "name is required"}`
+	}
+	if collection.Match != "any" {
+		collection.Match = "all"
+	}
+	for _, r := range collection.Rules {
+		if err := validateRule(r); err != nil {
+			return jsonResult(map[string]string{"error": err.Error()})
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	if collection.ID == "" {
+		collection.ID = newID()
+		collection.CreatedAt = now
+	} else if existing, ok := a.collections.set.Get(collection.ID); ok {
+		collection.CreatedAt = existing.CreatedAt
+	}
+	if collection.CreatedAt == 0 {
+		collection.CreatedAt = now
+	}
+	collection.UpdatedAt = now
+	collection.Deleted = false
+
+	if err := a.collections.set.Put(collection.ID, &collection); err != nil {
+		log.Printf("[Collections] 保存智能书单失败: %v", err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	for _, v := range a.collections.refresh() {
+		if v.ID == collection.ID {
+			return jsonResult(v)
+		}
+	}
+	return jsonResult(SmartCollectionView{SmartCollection: collection, BookIDs: []string{}})
+}
+
+func (a *App) DeleteSmartCollection(id string) string {
+	collection, ok := a.collections.set.Get(id)
+	if !ok || collection.Deleted {
+		return `{"error": "collection not found"}`
+	}
+	collection.Deleted = true
+	collection.UpdatedAt = time.Now().UnixMilli()
+	if err := a.collections.set.Put(id, collection); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	a.collections.refresh()
+	return `{"success": true}`
+}
+
+// PreviewSmartCollection 按规则计算书单包含的书籍但不保存，用于编辑时预览
+func (a *App) PreviewSmartCollection(collection SmartCollection) string {
+	for _, r := range collection.Rules {
+		if err := validateRule(r); err != nil {
+			return jsonResult(map[string]string{"error": err.Error()})
+		}
+	}
+	return jsonResult(map[string]interface{}{
+		"bookIds": collection.Evaluate(a.library.Snapshot(), time.Now()),
+	})
+}
+
+// SetBookTags 替换书籍的标签
+func (a *App) SetBookTags(ebookId string, tags []string) string {
+	book, ok := a.library.Book(ebookId)
+	if !ok {
+		return `{"error": "book not found"}`
+	}
+	book.Tags = normalizeTags(tags)
+	if err := a.library.PutBook(book); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	a.emit("library:changed")
+	return jsonResult(book)
+}
+
+// SetBookSeries 设置书籍所属的系列和序号，series 为空时移出系列
+func (a *App) SetBookSeries(ebookId string, series string, index float64) string {
+	book, ok := a.library.Book(ebookId)
+	if !ok {
+		return `{"error": "book not found"}`
+	}
+	book.Series = strings.TrimSpace(series)
+	book.SeriesIndex = index
+	if book.Series == "" {
+		book.SeriesIndex = 0
+	}
+	if err := a.library.PutBook(book); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	a.emit("library:changed")
+	return jsonResult(book)
+}
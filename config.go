@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"sync"
+	"time"
+)
+
+// BaidupanConfig 对应前端 UserConfig.storage.baidupan
+type BaidupanConfig struct {
+	AccessToken    string `json:"accessToken"`
+	RefreshToken   string `json:"refreshToken"`
+	Expiration     int64  `json:"expiration"`
+	RootPath       string `json:"rootPath"`
+	UserID         string `json:"userId"`
+	NamingStrategy string `json:"namingStrategy"`
+	AppKey         string `json:"appKey,omitempty"`
+	SecretKey      string `json:"secretKey,omitempty"`
+}
+
+// StorageConfig 中 Default 选择默认的云存储（"local" 表示不使用），
+// Sync、Library 可以分别为同步数据和书籍文件指定其他存储
+type StorageConfig struct {
+	Default      string               `json:"default"`
+	Sync         string               `json:"sync,omitempty"`
+	Library      string               `json:"library,omitempty"`
+	LocalPath    string               `json:"localPath"`
+	AutoSync     bool                 `json:"autoSync"`
+	SyncInterval int                  `json:"syncInterval"` // 分钟
+	Baidupan     *BaidupanConfig      `json:"baidupan"`
+	WebDAV       *WebDAVConfig        `json:"webdav,omitempty"`
+	Folder       *FolderStorageConfig `json:"folder,omitempty"`
+	Alist        *AlistConfig         `json:"alist,omitempty"`
+	S3           *S3Config            `json:"s3,omitempty"`
+}
+
+// namingStrategy 返回指定存储的文件命名策略
+func (c StorageConfig) namingStrategy(name string) string {
+	switch {
+	case name == "baidupan" && c.Baidupan != nil:
+		return c.Baidupan.NamingStrategy
+	case name == "webdav" && c.WebDAV != nil:
+		return c.WebDAV.NamingStrategy
+	case name == "folder" && c.Folder != nil:
+		return c.Folder.NamingStrategy
+	case name == "alist" && c.Alist != nil:
+		return c.Alist.NamingStrategy
+	case name == "s3" && c.S3 != nil:
+		return c.S3.NamingStrategy
+	}
+	return ""
+}
+
+// UserConfig 对应前端的 UserConfig，后端只关心 storage 部分，其余原样保存
+type UserConfig struct {
+	Storage StorageConfig   `json:"storage"`
+	Reader  json.RawMessage `json:"reader,omitempty"`
+	UI      json.RawMessage `json:"ui,omitempty"`
+}
+
+// DeviceInfo 对应前端的 DeviceInfo
+type DeviceInfo struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Platform string `json:"platform"`
+	LastSync int64  `json:"lastSync"`
+}
+
+func defaultUserConfig() UserConfig {
+	return UserConfig{
+		Storage: StorageConfig{
+			Default:      "local",
+			AutoSync:     true,
+			SyncInterval: 15,
+		},
+	}
+}
+
+// ConfigStore 在后端保存用户配置和本机设备信息，使同步任务在阅读页关闭时也能运行
+type ConfigStore struct {
+	mu     sync.RWMutex
+	dir    string
+	config UserConfig
+	device DeviceInfo
+}
+
+func NewConfigStore(dir string) *ConfigStore {
+	cs := &ConfigStore{dir: dir, config: defaultUserConfig()}
+
+	if err := readJSONFile(cs.configPath(), &cs.config); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Config] 读取用户配置失败: %v", err)
+	}
+
+	if err := readJSONFile(cs.devicePath(), &cs.device); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Config] 读取设备信息失败: %v", err)
+	}
+	if cs.device.ID == "" {
+		hostname, _ := os.Hostname()
+		if hostname == "" {
+			hostname = "本地设备"
+		}
+		cs.device = DeviceInfo{
+			ID:       newID(),
+			Name:     hostname,
+			Type:     "desktop",
+			Platform: goruntime.GOOS,
+		}
+		if err := writeJSONFile(cs.devicePath(), cs.device); err != nil {
+			log.Printf("[Config] 保存设备信息失败: %v", err)
+		}
+	}
+
+	return cs
+}
+
+func (cs *ConfigStore) configPath() string {
+	return filepath.Join(cs.dir, "config.json")
+}
+
+func (cs *ConfigStore) devicePath() string {
+	return filepath.Join(cs.dir, "device.json")
+}
+
+func (cs *ConfigStore) Config() UserConfig {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.config
+}
+
+// SetConfig 保存前端的配置。后端刷新过百度网盘令牌而前端的令牌更旧时保留后端的令牌，
+// 否则前端推送的旧配置会覆盖刷新后的令牌，旧的 refresh token 已经失效
+func (cs *ConfigStore) SetConfig(config UserConfig) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cur, bp := cs.config.Storage.Baidupan, config.Storage.Baidupan; cur != nil && bp != nil && cur.Expiration > bp.Expiration {
+		merged := *bp
+		merged.AccessToken = cur.AccessToken
+		merged.RefreshToken = cur.RefreshToken
+		merged.Expiration = cur.Expiration
+		config.Storage.Baidupan = &merged
+	}
+	cs.config = config
+	return writeJSONFile(cs.configPath(), cs.config)
+}
+
+// UpdateBaidupan 在刷新令牌等场景下只修改百度网盘配置
+func (cs *ConfigStore) UpdateBaidupan(fn func(bp *BaidupanConfig)) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.config.Storage.Baidupan == nil {
+		return fmt.Errorf("baidupan is not configured")
+	}
+	bp := *cs.config.Storage.Baidupan
+	fn(&bp)
+	cs.config.Storage.Baidupan = &bp
+	return writeJSONFile(cs.configPath(), cs.config)
+}
+
+func (cs *ConfigStore) Device() DeviceInfo {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.device
+}
+
+func (cs *ConfigStore) UpdateDevice(fn func(d *DeviceInfo)) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	fn(&cs.device)
+	return writeJSONFile(cs.devicePath(), cs.device)
+}
+
+// SyncInterval 返回同步间隔，未配置时默认 15 分钟
+func (cs *ConfigStore) SyncInterval() time.Duration {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	if cs.config.Storage.SyncInterval <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(cs.config.Storage.SyncInterval) * time.Minute
+}
@@ -0,0 +1,760 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ConvertOptions 是转换为 EPUB 时的选项，空字段使用从文件中识别出的值
+type ConvertOptions struct {
+	Title    string `json:"title"`
+	Author   string `json:"author"`
+	Language string `json:"language"`
+	// Theme 为内置样式的 ID，CSS 追加在主题样式之后
+	Theme string `json:"theme"`
+	CSS   string `json:"css"`
+}
+
+// ConvertTheme 是一个内置的排版样式
+type ConvertTheme struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// convertChapter 是一章内容，Body 为 XHTML 片段
+type convertChapter struct {
+	Title string
+	Body  string
+}
+
+// convertResource 是章节引用的图片等文件，Name 相对于 OEBPS 目录
+type convertResource struct {
+	Name      string
+	MediaType string
+	Data      []byte
+}
+
+// convertBook 是转换出的书籍内容
+type convertBook struct {
+	Title     string
+	Author    string
+	Language  string
+	Chapters  []convertChapter
+	Resources []convertResource
+}
+
+const defaultConvertTheme = "classic"
+
+// convertBaseCSS 是所有主题共用的样式
+const convertBaseCSS = `img, svg { max-width: 100%; height: auto; }
+pre { white-space: pre-wrap; word-wrap: break-word; font-family: monospace; font-size: 0.9em; }
+code { font-family: monospace; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #999; padding: 0.3em 0.6em; }
+blockquote { margin: 1em 1.5em; padding-left: 0.8em; border-left: 3px solid #ccc; color: #555; }
+.cover { margin: 0; padding: 0; text-align: center; }
+.cover img { height: 100%; }
+`
+
+var convertThemes = []struct {
+	ConvertTheme
+	css string
+}{
+	{ConvertTheme{ID: "classic", Name: "经典衬线"}, `body { font-family: "Songti SC", "Noto Serif CJK SC", "Source Han Serif SC", serif; line-height: 1.8; margin: 0 1em; }
+p { text-indent: 2em; margin: 0.3em 0; text-align: justify; }
+h1 { font-size: 1.5em; text-align: center; margin: 2em 0 1.5em; }
+h2 { font-size: 1.25em; margin: 1.5em 0 1em; }
+`},
+	{ConvertTheme{ID: "modern", Name: "现代无衬线"}, `body { font-family: "PingFang SC", "Noto Sans CJK SC", "Microsoft YaHei", sans-serif; line-height: 1.7; margin: 0 1em; }
+p { margin: 0.8em 0; }
+h1 { font-size: 1.6em; margin: 1.5em 0 1em; padding-bottom: 0.3em; border-bottom: 1px solid #ddd; }
+h2 { font-size: 1.3em; margin: 1.3em 0 0.8em; }
+`},
+	{ConvertTheme{ID: "compact", Name: "紧凑"}, `body { font-family: serif; line-height: 1.5; margin: 0 0.5em; }
+p { text-indent: 2em; margin: 0; }
+h1 { font-size: 1.3em; text-align: center; margin: 1em 0; }
+h2 { font-size: 1.15em; margin: 1em 0 0.5em; }
+`},
+}
+
+// convertThemeCSS 返回主题样式，未知的主题使用默认主题
+func convertThemeCSS(id string) string {
+	for _, t := range convertThemes {
+		if t.ID == id {
+			return t.css
+		}
+	}
+	return convertThemeCSS(defaultConvertTheme)
+}
+
+// txtChapterPattern 匹配 TXT 中的章节标题行，如“第十二章 归来”“Chapter 3”“楔子”
+var txtChapterPattern = regexp.MustCompile(`^(?:第[0-9０-９零〇一二两三四五六七八九十百千万]+[章节回卷集部篇]|(?i:chapter|part)\s*[0-9ivxlc]+\b|(?:序章|序言|序|前言|楔子|引子|尾声|后记|番外)(?:$|[\s:：　]))`)
+
+// txtChunkRunes 是没有章节标题的 TXT 每一部分的大致字数
+const txtChunkRunes = 8000
+
+// detectTxtChapterTitle 判断一行是否为章节标题
+func detectTxtChapterTitle(line string) bool {
+	return utf8.RuneCountInString(line) <= 30 && txtChapterPattern.MatchString(line)
+}
+
+// txtChapters 按章节标题行拆分 TXT，每个非空行为一段。
+// 没有识别出章节时按字数拆分，避免单个文档过大
+func txtChapters(text, title string) []convertChapter {
+	text = strings.TrimPrefix(text, "\uFEFF")
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+
+	var chapters []convertChapter
+	var body strings.Builder
+	current, runes, detected := "", 0, false
+	flush := func() {
+		if body.Len() > 0 || current != "" {
+			chapters = append(chapters, convertChapter{Title: current, Body: body.String()})
+		}
+		body.Reset()
+		runes = 0
+	}
+	lines := strings.Split(text, "\n")
+	for _, line := range lines {
+		if detectTxtChapterTitle(strings.TrimSpace(line)) {
+			detected = true
+			break
+		}
+	}
+	for _, line := range lines {
+		line = strings.TrimFunc(line, unicode.IsSpace)
+		if line == "" {
+			continue
+		}
+		if detected && detectTxtChapterTitle(line) {
+			flush()
+			current = line
+			continue
+		}
+		if !detected && runes >= txtChunkRunes {
+			flush()
+		}
+		body.WriteString("<p>" + escapeXMLText(line) + "</p>\n")
+		runes += utf8.RuneCountInString(line)
+	}
+	flush()
+
+	for i := range chapters {
+		switch {
+		case chapters[i].Title != "":
+		case detected:
+			chapters[i].Title = "前言"
+		case len(chapters) == 1:
+			chapters[i].Title = title
+		default:
+			chapters[i].Title = fmt.Sprintf("第 %d 部分", i+1)
+		}
+		chapters[i].Body = "<h1>" + escapeXMLText(chapters[i].Title) + "</h1>\n" + chapters[i].Body
+	}
+	return chapters
+}
+
+// splitFrontMatter 去掉 Markdown 开头的 YAML front matter，返回其中的简单键值
+func splitFrontMatter(text string) (string, map[string]string) {
+	meta := map[string]string{}
+	rest, ok := strings.CutPrefix(strings.TrimPrefix(text, "\uFEFF"), "---\n")
+	if !ok {
+		return text, meta
+	}
+	header, body, ok := strings.Cut(rest, "\n---")
+	if !ok {
+		return text, meta
+	}
+	for _, line := range strings.Split(header, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if ok {
+			meta[strings.ToLower(strings.TrimSpace(key))] = strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+	}
+	_, body, _ = strings.Cut(body, "\n")
+	return body, meta
+}
+
+// markdownToHTML 用 GFM 扩展渲染 Markdown
+func markdownToHTML(text string) (string, error) {
+	md := goldmark.New(
+		goldmark.WithExtensions(extension.GFM, extension.Footnote),
+		goldmark.WithRendererOptions(gmhtml.WithXHTML()),
+	)
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(text), &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// nodeText 返回节点下的全部文字，空白压缩为一个空格
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// headingLevel 返回 h1–h6 的级别，其他节点返回 0
+func headingLevel(n *html.Node) int {
+	if n.Type != html.ElementNode {
+		return 0
+	}
+	switch n.DataAtom {
+	case atom.H1:
+		return 1
+	case atom.H2:
+		return 2
+	case atom.H3:
+		return 3
+	case atom.H4:
+		return 4
+	case atom.H5:
+		return 5
+	case atom.H6:
+		return 6
+	}
+	return 0
+}
+
+// htmlResources 把章节中引用的本地图片收进 EPUB
+type htmlResources struct {
+	dir       string
+	resources []convertResource
+	names     map[string]string // 本地路径 -> EPUB 内名称
+}
+
+// maxConvertResourceSize 是单个嵌入图片的大小上限
+const maxConvertResourceSize = 20 << 20
+
+// embed 读取相对于源文件的图片，返回章节中应使用的地址；不是本地文件时返回空
+func (r *htmlResources) embed(src string) string {
+	if src == "" || strings.HasPrefix(src, "#") || strings.HasPrefix(src, "//") {
+		return ""
+	}
+	if u, err := url.Parse(src); err != nil || u.Scheme != "" {
+		return ""
+	}
+	if unescaped, err := url.PathUnescape(strings.SplitN(src, "?", 2)[0]); err == nil {
+		src = unescaped
+	}
+	local := filepath.Join(r.dir, filepath.FromSlash(src))
+	if name, ok := r.names[local]; ok {
+		return "../" + name
+	}
+	info, err := os.Stat(local)
+	if err != nil || info.IsDir() || info.Size() > maxConvertResourceSize {
+		return ""
+	}
+	data, err := os.ReadFile(local)
+	if err != nil {
+		return ""
+	}
+	mediaType := mime.TypeByExtension(strings.ToLower(filepath.Ext(local)))
+	if mediaType == "" {
+		mediaType = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return ""
+	}
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+	name := fmt.Sprintf("images/img%03d%s", len(r.resources)+1, strings.ToLower(filepath.Ext(local)))
+	r.resources = append(r.resources, convertResource{Name: name, MediaType: mediaType, Data: data})
+	r.names[local] = name
+	return "../" + name
+}
+
+// cleanHTML 删除脚本等不能放进 EPUB 的元素，并替换本地图片的地址
+func cleanHTML(n *html.Node, res *htmlResources) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode {
+			switch c.DataAtom {
+			case atom.Script, atom.Noscript, atom.Style, atom.Iframe, atom.Object, atom.Embed, atom.Form:
+				n.RemoveChild(c)
+				c = next
+				continue
+			case atom.Img:
+				for i, attr := range c.Attr {
+					if attr.Key == "src" {
+						if embedded := res.embed(attr.Val); embedded != "" {
+							c.Attr[i].Val = embedded
+						}
+					}
+				}
+			}
+			// XHTML 中属性名必须合法，去掉事件处理等属性
+			attrs := c.Attr[:0]
+			for _, attr := range c.Attr {
+				if attr.Namespace == "" && !strings.HasPrefix(attr.Key, "on") && !strings.ContainsAny(attr.Key, `"'<>/=`) {
+					attrs = append(attrs, attr)
+				}
+			}
+			c.Attr = attrs
+		}
+		if c.Type == html.CommentNode {
+			n.RemoveChild(c)
+		} else {
+			cleanHTML(c, res)
+		}
+		c = next
+	}
+}
+
+// contentRoot 跳过只有一个子元素的 div、main、article 等外层容器，返回包含标题的一层
+func contentRoot(body *html.Node) *html.Node {
+	root := body
+	for {
+		var only *html.Node
+		count := 0
+		for c := root.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode {
+				only = c
+				count++
+			} else if c.Type == html.TextNode && strings.TrimSpace(c.Data) != "" {
+				return root
+			}
+		}
+		if count != 1 {
+			return root
+		}
+		switch only.DataAtom {
+		case atom.Div, atom.Main, atom.Article, atom.Section:
+			root = only
+		default:
+			return root
+		}
+	}
+}
+
+// htmlChapters 在正文最外层按标题拆分章节：选出现至少两次的最高一级标题，
+// 第一个标题之前的内容单独成章
+func htmlChapters(doc *html.Node, title string, res *htmlResources) []convertChapter {
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return nil
+	}
+	cleanHTML(body, res)
+	root := contentRoot(body)
+
+	split := 0
+	for level := 1; level <= 3 && split == 0; level++ {
+		count := 0
+		for c := root.FirstChild; c != nil; c = c.NextSibling {
+			if headingLevel(c) == level {
+				count++
+			}
+		}
+		if count >= 2 {
+			split = level
+		}
+	}
+
+	var chapters []convertChapter
+	var buf bytes.Buffer
+	current, hasContent := "", false
+	flush := func() {
+		if hasContent {
+			chapters = append(chapters, convertChapter{Title: current, Body: buf.String()})
+		}
+		buf.Reset()
+		hasContent = false
+	}
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if split > 0 && headingLevel(c) == split {
+			flush()
+			current = nodeText(c)
+		}
+		if current == "" && headingLevel(c) > 0 {
+			current = nodeText(c)
+		}
+		if c.Type == html.ElementNode || strings.TrimSpace(c.Data) != "" {
+			hasContent = true
+		}
+		html.Render(&buf, c)
+	}
+	flush()
+
+	for i := range chapters {
+		if chapters[i].Title == "" {
+			if len(chapters) == 1 {
+				chapters[i].Title = title
+			} else {
+				chapters[i].Title = fmt.Sprintf("第 %d 部分", i+1)
+			}
+		}
+		// html.Render 输出的 HTML 转义和空元素写法与 XHTML 兼容，这里只修正遗留的实体
+		if checkXMLWellFormed([]byte("<div>"+chapters[i].Body+"</div>")) != nil {
+			chapters[i].Body, _ = fixXMLReferences(chapters[i].Body)
+		}
+	}
+	return chapters
+}
+
+// detectLanguage 根据是否含有汉字粗略判断语言
+func detectLanguage(chapters []convertChapter) string {
+	for _, ch := range chapters {
+		for _, r := range ch.Body {
+			if unicode.Is(unicode.Han, r) {
+				return "zh"
+			}
+		}
+	}
+	return "en"
+}
+
+// coverColors 是生成封面的配色，按书名哈希选择
+var coverColors = [][2]string{
+	{"#2f4858", "#f6ae2d"},
+	{"#5c3c92", "#f2d0a4"},
+	{"#1b4332", "#d8f3dc"},
+	{"#7f2f2f", "#f4e1c1"},
+	{"#33415c", "#e0e1dd"},
+	{"#6b4226", "#f1dca7"},
+}
+
+// wrapCoverTitle 按显示宽度把书名拆成多行，汉字计 1，其他字符计 0.55；
+// 英文单词尽量不拆开
+func wrapCoverTitle(title string, width float64, maxLines int) []string {
+	var lines []string
+	var line []rune
+	w := 0.0
+	runeWidth := func(r rune) float64 {
+		if r > 0x2E80 {
+			return 1
+		}
+		return 0.55
+	}
+	for _, r := range strings.TrimSpace(title) {
+		if w+runeWidth(r) > width && len(line) > 0 {
+			cut := len(line)
+			if r < 0x80 && !unicode.IsSpace(r) {
+				for i := len(line) - 1; i > 0; i-- {
+					if unicode.IsSpace(line[i]) {
+						cut = i
+						break
+					}
+				}
+			}
+			lines = append(lines, strings.TrimSpace(string(line[:cut])))
+			line = append([]rune{}, []rune(strings.TrimLeftFunc(string(line[cut:]), unicode.IsSpace))...)
+			w = 0
+			for _, c := range line {
+				w += runeWidth(c)
+			}
+		}
+		if len(line) == 0 && unicode.IsSpace(r) {
+			continue
+		}
+		line = append(line, r)
+		w += runeWidth(r)
+	}
+	if len(line) > 0 {
+		lines = append(lines, string(line))
+	}
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		last := []rune(lines[maxLines-1])
+		lines[maxLines-1] = string(last[:len(last)-1]) + "…"
+	}
+	return lines
+}
+
+// generateCoverSVG 生成带书名和作者的 SVG 封面
+func generateCoverSVG(title, author string) []byte {
+	h := fnv.New32a()
+	h.Write([]byte(title))
+	colors := coverColors[h.Sum32()%uint32(len(coverColors))]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="600" height="800" viewBox="0 0 600 800">
+  <rect width="600" height="800" fill="%s"/>
+  <rect x="40" y="40" width="520" height="720" fill="none" stroke="%s" stroke-width="3"/>
+  <rect x="40" y="560" width="520" height="4" fill="%s"/>
+`, colors[0], colors[1], colors[1])
+	lines := wrapCoverTitle(title, 8, 5)
+	y := 300 - (len(lines)-1)*36
+	for _, line := range lines {
+		fmt.Fprintf(&b, `  <text x="300" y="%d" text-anchor="middle" font-family="serif" font-size="56" font-weight="bold" fill="%s">%s</text>
+`, y, colors[1], escapeXMLText(line))
+		y += 72
+	}
+	if author != "" {
+		fmt.Fprintf(&b, `  <text x="300" y="650" text-anchor="middle" font-family="sans-serif" font-size="30" fill="%s">%s</text>
+`, colors[1], escapeXMLText(author))
+	}
+	b.WriteString("</svg>\n")
+	return []byte(b.String())
+}
+
+// buildConvertedEpub 打包 EPUB 3，同时带有 nav.xhtml 和 toc.ncx 以兼容旧阅读器
+func buildConvertedEpub(book convertBook, css string) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if err := writeEpubMimetype(zw); err != nil {
+		return nil, err
+	}
+	modified := time.Now()
+	write := func(name string, data []byte) error {
+		return writeZipEntry(zw, zip.FileHeader{Name: name, Modified: modified}, data)
+	}
+	if err := write("META-INF/container.xml", []byte(fmt.Sprintf(epubContainerXML, "OEBPS/content.opf"))); err != nil {
+		return nil, err
+	}
+
+	cover := generateCoverSVG(book.Title, book.Author)
+	page := func(title, body string) []byte {
+		return []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="` + book.Language + `" lang="` + book.Language + `">
+<head>
+  <meta charset="utf-8"/>
+  <title>` + escapeXMLText(title) + `</title>
+  <link rel="stylesheet" type="text/css" href="../styles/book.css"/>
+</head>
+<body>
+` + body + `
+</body>
+</html>
+`)
+	}
+
+	var manifest, spine strings.Builder
+	item := func(id, href, mediaType, properties string) {
+		fmt.Fprintf(&manifest, "\n    <item id=\"%s\" href=\"%s\" media-type=\"%s\"", id, escapeXMLText(href), mediaType)
+		if properties != "" {
+			fmt.Fprintf(&manifest, " properties=\"%s\"", properties)
+		}
+		manifest.WriteString("/>")
+	}
+	item("nav", "nav.xhtml", "application/xhtml+xml", "nav")
+	item("ncx", "toc.ncx", "application/x-dtbncx+xml", "")
+	item("css", "styles/book.css", "text/css", "")
+	item("cover-image", "images/cover.svg", "image/svg+xml", "cover-image")
+	item("cover", "text/cover.xhtml", "application/xhtml+xml", "")
+	spine.WriteString("\n    <itemref idref=\"cover\" linear=\"no\"/>")
+
+	files := map[string][]byte{
+		"OEBPS/styles/book.css":  []byte(css),
+		"OEBPS/images/cover.svg": cover,
+		"OEBPS/text/cover.xhtml": page(book.Title, `<div class="cover"><img src="../images/cover.svg" alt="`+escapeXMLText(book.Title)+`"/></div>`),
+	}
+	names := []string{"OEBPS/styles/book.css", "OEBPS/images/cover.svg", "OEBPS/text/cover.xhtml"}
+	toc := make([]epubTOCEntry, 0, len(book.Chapters))
+	for i, ch := range book.Chapters {
+		id := fmt.Sprintf("chapter%03d", i+1)
+		href := "text/" + id + ".xhtml"
+		item(id, href, "application/xhtml+xml", "")
+		fmt.Fprintf(&spine, "\n    <itemref idref=\"%s\"/>", id)
+		files["OEBPS/"+href] = page(ch.Title, ch.Body)
+		names = append(names, "OEBPS/"+href)
+		toc = append(toc, epubTOCEntry{Title: ch.Title, Href: href})
+	}
+	for i, res := range book.Resources {
+		item(fmt.Sprintf("res%03d", i+1), res.Name, res.MediaType, "")
+		files["OEBPS/"+res.Name] = res.Data
+		names = append(names, "OEBPS/"+res.Name)
+	}
+
+	uid := "urn:uuid:" + newID()
+	opf := `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid" xml:lang="` + book.Language + `">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="bookid">` + uid + `</dc:identifier>
+    <dc:title>` + escapeXMLText(book.Title) + `</dc:title>
+    <dc:creator>` + escapeXMLText(book.Author) + `</dc:creator>
+    <dc:language>` + book.Language + `</dc:language>
+    <meta property="dcterms:modified">` + modified.UTC().Format("2006-01-02T15:04:05Z") + `</meta>
+    <meta name="cover" content="cover-image"/>
+  </metadata>
+  <manifest>` + manifest.String() + `
+  </manifest>
+  <spine toc="ncx">` + spine.String() + `
+  </spine>
+</package>
+`
+	if err := write("OEBPS/content.opf", []byte(opf)); err != nil {
+		return nil, err
+	}
+	if err := write("OEBPS/nav.xhtml", buildEpubNav(book.Title, toc)); err != nil {
+		return nil, err
+	}
+	if err := write("OEBPS/toc.ncx", buildEpubNCX(uid, book.Title, toc)); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if err := write(name, files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readConvertSource 读取 TXT、Markdown 或 HTML 文件并拆分章节
+func readConvertSource(p string, options ConvertOptions) (convertBook, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return convertBook{}, err
+	}
+	book := convertBook{
+		Title:  strings.TrimSuffix(filepath.Base(p), filepath.Ext(p)),
+		Author: "未知作者",
+	}
+
+	ext := strings.ToLower(filepath.Ext(p))
+	switch ext {
+	case ".txt":
+		text, _ := decodeText(data)
+		if options.Title != "" {
+			book.Title = options.Title
+		}
+		book.Chapters = txtChapters(string(text), book.Title)
+	case ".md", ".markdown", ".html", ".htm", ".xhtml":
+		var source string
+		titled := false
+		if ext == ".md" || ext == ".markdown" {
+			text, _ := decodeText(data)
+			body, meta := splitFrontMatter(string(text))
+			if meta["title"] != "" {
+				book.Title, titled = meta["title"], true
+			}
+			if meta["author"] != "" {
+				book.Author = meta["author"]
+			}
+			rendered, err := markdownToHTML(body)
+			if err != nil {
+				return convertBook{}, err
+			}
+			source = "<html><head></head><body>" + rendered + "</body></html>"
+		} else {
+			text, _ := decodeXHTML(data)
+			source = string(text)
+		}
+		doc, err := html.Parse(strings.NewReader(source))
+		if err != nil {
+			return convertBook{}, err
+		}
+		if t := findElement(doc, atom.Title); t != nil && nodeText(t) != "" {
+			book.Title = nodeText(t)
+		} else if h := findElement(doc, atom.H1); h != nil && nodeText(h) != "" && !titled {
+			book.Title = nodeText(h)
+		}
+		if options.Title != "" {
+			book.Title = options.Title
+		}
+		res := &htmlResources{dir: filepath.Dir(p), names: map[string]string{}}
+		book.Chapters = htmlChapters(doc, book.Title, res)
+		book.Resources = res.resources
+	default:
+		return convertBook{}, fmt.Errorf("unsupported file type: %s", ext)
+	}
+	if len(book.Chapters) == 0 {
+		return convertBook{}, fmt.Errorf("no content in %s", filepath.Base(p))
+	}
+	if options.Author != "" {
+		book.Author = options.Author
+	}
+	book.Language = options.Language
+	if book.Language == "" {
+		book.Language = detectLanguage(book.Chapters)
+	}
+	return book, nil
+}
+
+// GetConvertThemes 返回转换 EPUB 时可选的内置样式
+func (a *App) GetConvertThemes() []ConvertTheme {
+	themes := make([]ConvertTheme, len(convertThemes))
+	for i, t := range convertThemes {
+		themes[i] = t.ConvertTheme
+	}
+	return themes
+}
+
+// ConvertToEpub 把 TXT、Markdown 或单文件 HTML 转换为 EPUB 3 并加入书库。
+// TXT 按章节标题拆分，Markdown 和 HTML 按标题拆分，目录同时生成 nav.xhtml 和 toc.ncx
+func (a *App) ConvertToEpub(path string, options ConvertOptions) string {
+	book, err := readConvertSource(path, options)
+	if err != nil {
+		log.Printf("[Convert] 读取失败: %s, %v", path, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	css := convertBaseCSS + convertThemeCSS(options.Theme)
+	if options.CSS != "" {
+		css += "\n" + options.CSS + "\n"
+	}
+	data, err := buildConvertedEpub(book, css)
+	if err != nil {
+		log.Printf("[Convert] 生成 EPUB 失败: %s, %v", path, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+
+	id := newID()
+	if _, err := a.store.Save(id, sanitizeFileName(book.Title)+".epub", data); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	ebook := EbookMetadata{
+		ID:            id,
+		Title:         book.Title,
+		Author:        book.Author,
+		Cover:         "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString(generateCoverSVG(book.Title, book.Author)),
+		Path:          id,
+		Format:        "epub",
+		Size:          int64(len(data)),
+		TotalChapters: len(book.Chapters),
+		StorageType:   "local",
+		AddedAt:       time.Now().UnixMilli(),
+	}
+	if err := a.library.PutBook(ebook); err != nil {
+		a.store.Remove(id)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	log.Printf("[Convert] 已转换: %s -> %s (%d 章, %d bytes)", filepath.Base(path), ebook.Title, len(book.Chapters), len(data))
+	a.emit("library:book-added", ebook)
+	a.emit("library:changed")
+	return jsonResult(ebook)
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// 重复判定的依据，按可信程度从高到低
+const (
+	DuplicateByHash  = "hash"
+	DuplicateByISBN  = "isbn"
+	DuplicateByTitle = "title"
+)
+
+// bookFingerprint 是书籍文件的指纹，本地文件按大小和修改时间缓存
+type bookFingerprint struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+	MD5     string `json:"md5,omitempty"`
+	ISBN    string `json:"isbn,omitempty"`
+	// Remote 表示 MD5 来自云端文件信息，本地没有副本
+	Remote bool `json:"remote,omitempty"`
+}
+
+// DuplicateBook 是重复组中的一本书，ReadingTime 为累计阅读秒数
+type DuplicateBook struct {
+	EbookMetadata
+	MD5         string `json:"md5,omitempty"`
+	ISBN        string `json:"isbn,omitempty"`
+	HasLocal    bool   `json:"hasLocal"`
+	ReadingTime int64  `json:"readingTime"`
+	Annotations int    `json:"annotations"`
+	Bookmarks   int    `json:"bookmarks"`
+}
+
+// DuplicateGroup 是一组重复的书。Reason 为组内最强的判定依据，
+// KeepID 是建议保留的书（阅读最多的一本）
+type DuplicateGroup struct {
+	ID     string          `json:"id"`
+	Reason string          `json:"reason"`
+	KeepID string          `json:"keepId"`
+	Books  []DuplicateBook `json:"books"`
+}
+
+// Deduper 计算书库中书籍的指纹并找出重复
+type Deduper struct {
+	app  *App
+	path string
+
+	mu           sync.Mutex
+	fingerprints map[string]bookFingerprint
+}
+
+func NewDeduper(app *App, path string) *Deduper {
+	d := &Deduper{app: app, path: path, fingerprints: map[string]bookFingerprint{}}
+	if err := readJSONFile(path, &d.fingerprints); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Dedupe] 读取指纹缓存失败: %v", err)
+	}
+	return d
+}
+
+// fingerprint 计算书籍的指纹：有本地文件时计算 MD5 并读取 EPUB 中的 ISBN，
+// 只在云端的书使用云端提供的 MD5
+func (d *Deduper) fingerprint(book EbookMetadata) (bookFingerprint, bool) {
+	cached, ok := d.fingerprints[book.ID]
+	if p, err := d.app.store.Path(book.ID); err == nil {
+		info, err := os.Stat(p)
+		if err != nil {
+			return bookFingerprint{}, false
+		}
+		if ok && !cached.Remote && cached.Size == info.Size() && cached.ModTime == info.ModTime().UnixMilli() {
+			return cached, true
+		}
+		sum, err := md5File(p)
+		if err != nil {
+			log.Printf("[Dedupe] 计算哈希失败: %s, %v", book.ID, err)
+			return bookFingerprint{}, false
+		}
+		fp := bookFingerprint{Size: info.Size(), ModTime: info.ModTime().UnixMilli(), MD5: sum}
+		if strings.EqualFold(book.Format, "epub") {
+			fp.ISBN = epubISBN(p)
+		}
+		d.fingerprints[book.ID] = fp
+		return fp, true
+	}
+
+	if ok && cached.Remote {
+		return cached, true
+	}
+	fp := bookFingerprint{Remote: true}
+	switch {
+	case book.RemotePath != "":
+		storage, err := d.app.storageProvider(bookStorageName(book))
+		if err != nil {
+			return bookFingerprint{}, false
+		}
+		info, err := storage.Stat(book.RemotePath)
+		if err != nil {
+			return bookFingerprint{}, false
+		}
+		fp.Size, fp.MD5 = info.Size, remoteMD5(info)
+	case book.BaidupanPath != "":
+		token, err := d.app.ensureBaiduToken()
+		if err != nil {
+			return bookFingerprint{}, false
+		}
+		info, err := d.app.baiduStat(token, book.BaidupanPath)
+		if err != nil {
+			return bookFingerprint{}, false
+		}
+		fp.Size, fp.MD5 = info.Size, strings.ToLower(info.MD5)
+	default:
+		return bookFingerprint{}, false
+	}
+	d.fingerprints[book.ID] = fp
+	return fp, true
+}
+
+var isbnPattern = regexp.MustCompile(`(?i)(97[89][\d-]{10,14}|\d[\d-]{8,12}[\dx])`)
+
+// epubISBN 从 OPF 的 dc:identifier 中找出 ISBN，统一为 13 位
+func epubISBN(p string) string {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return ""
+	}
+	defer zr.Close()
+	opfPath, err := epubOPFPath(&zr.Reader)
+	if err != nil {
+		return ""
+	}
+	data, err := readZipFile(&zr.Reader, opfPath)
+	if err != nil {
+		return ""
+	}
+	var opf struct {
+		Identifiers []string `xml:"metadata>identifier"`
+	}
+	if err := xml.Unmarshal(data, &opf); err != nil {
+		return ""
+	}
+	for _, id := range opf.Identifiers {
+		if isbn := normalizeISBN(isbnPattern.FindString(id)); isbn != "" {
+			return isbn
+		}
+	}
+	return ""
+}
+
+// normalizeISBN 去掉分隔符并把 ISBN-10 转为 ISBN-13，校验失败时返回空
+func normalizeISBN(s string) string {
+	s = strings.ToUpper(strings.ReplaceAll(s, "-", ""))
+	switch len(s) {
+	case 10:
+		sum := 0
+		for i, c := range s {
+			v := int(c - '0')
+			if c == 'X' && i == 9 {
+				v = 10
+			} else if c < '0' || c > '9' {
+				return ""
+			}
+			sum += v * (10 - i)
+		}
+		if sum%11 != 0 {
+			return ""
+		}
+		s = "978" + s[:9]
+		return s + isbn13CheckDigit(s)
+	case 13:
+		for _, c := range s {
+			if c < '0' || c > '9' {
+				return ""
+			}
+		}
+		if isbn13CheckDigit(s[:12]) != s[12:] {
+			return ""
+		}
+		return s
+	}
+	return ""
+}
+
+func isbn13CheckDigit(s string) string {
+	sum := 0
+	for i, c := range s {
+		v := int(c - '0')
+		if i%2 == 1 {
+			v *= 3
+		}
+		sum += v
+	}
+	return fmt.Sprint((10 - sum%10) % 10)
+}
+
+var titleNoisePattern = regexp.MustCompile(`[(（\[【][^)）\]】]*[)）\]】]`)
+
+// normalizeTitleKey 把书名和作者规整为比较用的键：去掉括号内的版本、副本等说明、标点和大小写
+func normalizeTitleKey(title, author string) string {
+	t := normalizeText(title)
+	if t == "" {
+		return ""
+	}
+	a := normalizeText(author)
+	if isUnknownAuthor(author) {
+		a = ""
+	}
+	return t + "|" + a
+}
+
+// isUnknownAuthor 判断作者是否为导入时填入的占位值
+func isUnknownAuthor(author string) bool {
+	switch normalizeText(author) {
+	case "", "未知作者", "未知", "unknown", "unknownauthor":
+		return true
+	}
+	return false
+}
+
+// normalizeText 去掉括号中的版本说明、标点和空白，转为小写
+func normalizeText(s string) string {
+	s = titleNoisePattern.ReplaceAllString(s, "")
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// readingTime 返回书的累计阅读秒数，优先使用阅读会话，没有会话时使用进度中的记录
+func (a *App) readingTime(ebookID string, sessions []ReadingSession) int64 {
+	var total time.Duration
+	for _, s := range sessions {
+		if s.EbookID == ebookID {
+			total += s.Duration()
+		}
+	}
+	if total > 0 {
+		return int64(total.Seconds())
+	}
+	if p := a.progress.Get(ebookID); p != nil {
+		return p.ReadingTime
+	}
+	return 0
+}
+
+// readMore 判断 x 是否比 y 读得更多：先比阅读时间，再比进度和最近阅读时间
+func (x DuplicateBook) readMore(y DuplicateBook) bool {
+	if x.ReadingTime != y.ReadingTime {
+		return x.ReadingTime > y.ReadingTime
+	}
+	if x.ReadingProgress != y.ReadingProgress {
+		return x.ReadingProgress > y.ReadingProgress
+	}
+	if x.LastRead != y.LastRead {
+		return x.LastRead > y.LastRead
+	}
+	return x.AddedAt < y.AddedAt
+}
+
+// Report 找出书库中的重复书籍：内容哈希相同、ISBN 相同或书名作者相同的书归为一组
+func (d *Deduper) Report() ([]DuplicateGroup, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	books := d.app.library.Books()
+	sessions := d.app.stats.Sessions()
+	entries := make([]DuplicateBook, len(books))
+	parent := make([]int, len(books))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	// 按三种键分别合并，记录每对合并时使用的依据
+	reasons := map[[2]int]string{}
+	keys := map[string]map[string]int{DuplicateByHash: {}, DuplicateByISBN: {}, DuplicateByTitle: {}}
+	union := func(kind, key string, i int) {
+		if key == "" {
+			return
+		}
+		j, ok := keys[kind][key]
+		if !ok {
+			keys[kind][key] = i
+			return
+		}
+		ri, rj := find(i), find(j)
+		pair := [2]int{min(i, j), max(i, j)}
+		if _, seen := reasons[pair]; !seen {
+			reasons[pair] = kind
+		}
+		if ri != rj {
+			parent[ri] = rj
+		}
+	}
+
+	live := map[string]bool{}
+	for i, book := range books {
+		live[book.ID] = true
+		entry := DuplicateBook{EbookMetadata: book}
+		if fp, ok := d.fingerprint(book); ok {
+			entry.MD5, entry.ISBN, entry.HasLocal = fp.MD5, fp.ISBN, !fp.Remote
+		}
+		entry.ReadingTime = d.app.readingTime(book.ID, sessions)
+		entry.Annotations = len(d.app.bookAnnotations(book.ID))
+		entry.Bookmarks = len(d.app.bookBookmarks(book.ID))
+		entries[i] = entry
+		union(DuplicateByHash, entry.MD5, i)
+		union(DuplicateByISBN, entry.ISBN, i)
+		union(DuplicateByTitle, normalizeTitleKey(book.Title, book.Author), i)
+	}
+	for id := range d.fingerprints {
+		if !live[id] {
+			delete(d.fingerprints, id)
+		}
+	}
+	if err := writeJSONFile(d.path, d.fingerprints); err != nil {
+		log.Printf("[Dedupe] 保存指纹缓存失败: %v", err)
+	}
+
+	members := map[int][]int{}
+	for i := range entries {
+		members[find(i)] = append(members[find(i)], i)
+	}
+	rank := map[string]int{DuplicateByHash: 0, DuplicateByISBN: 1, DuplicateByTitle: 2}
+	var groups []DuplicateGroup
+	for _, idx := range members {
+		if len(idx) < 2 {
+			continue
+		}
+		group := DuplicateGroup{Reason: DuplicateByTitle}
+		in := map[int]bool{}
+		for _, i := range idx {
+			in[i] = true
+		}
+		for pair, kind := range reasons {
+			if in[pair[0]] && rank[kind] < rank[group.Reason] {
+				group.Reason = kind
+			}
+		}
+		for _, i := range idx {
+			group.Books = append(group.Books, entries[i])
+		}
+		sort.Slice(group.Books, func(i, j int) bool { return group.Books[i].readMore(group.Books[j]) })
+		group.KeepID = group.Books[0].ID
+		group.ID = group.KeepID
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if rank[groups[i].Reason] != rank[groups[j].Reason] {
+			return rank[groups[i].Reason] < rank[groups[j].Reason]
+		}
+		return groups[i].Books[0].Title < groups[j].Books[0].Title
+	})
+	return groups, nil
+}
+
+// Merge 保留 keepID，删除 removeIDs。阅读最多的一本不是 keepID 时，
+// 把它的阅读进度转移到 keepID；所有被删除副本的标注和书签都转移到 keepID
+func (d *Deduper) Merge(keepID string, removeIDs []string, deleteRemote bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	keep, ok := d.app.library.Book(keepID)
+	if !ok {
+		return fmt.Errorf("book not found: %s", keepID)
+	}
+	sessions := d.app.stats.Sessions()
+	best := DuplicateBook{EbookMetadata: keep, ReadingTime: d.app.readingTime(keepID, sessions)}
+	var removed []EbookMetadata
+	for _, id := range removeIDs {
+		if id == keepID {
+			continue
+		}
+		book, ok := d.app.library.Book(id)
+		if !ok {
+			return fmt.Errorf("book not found: %s", id)
+		}
+		removed = append(removed, book)
+		candidate := DuplicateBook{EbookMetadata: book, ReadingTime: d.app.readingTime(id, sessions)}
+		if candidate.readMore(best) {
+			best = candidate
+		}
+	}
+
+	if best.ID != keepID {
+		if err := d.transferReading(best.EbookMetadata, keep); err != nil {
+			return err
+		}
+		log.Printf("[Dedupe] 已把 %s 的阅读记录转移到 %s", best.ID, keepID)
+	}
+	for _, book := range removed {
+		if err := d.moveNotes(book.ID, keepID); err != nil {
+			return err
+		}
+		if err := d.app.deleteBook(book, deleteRemote); err != nil {
+			return err
+		}
+	}
+	d.app.emit("library:changed")
+	return nil
+}
+
+// transferReading 把 from 的阅读进度转移到 to
+func (d *Deduper) transferReading(from, to EbookMetadata) error {
+	now := time.Now().UnixMilli()
+	if p := d.app.progress.Get(from.ID); p != nil {
+		p.EbookID = to.ID
+		p.Timestamp = now
+		p.DeviceID = d.app.settings.Device().ID
+		p.DeviceName = d.app.settings.Device().Name
+		// 转移后的进度可能比原进度靠前，需要允许回退
+		p.Explicit = true
+		if err := d.app.progress.Record(*p); err != nil {
+			return err
+		}
+	}
+
+	to.ReadingProgress = from.ReadingProgress
+	to.LastRead = max(to.LastRead, from.LastRead)
+	return d.app.library.PutBook(to)
+}
+
+// moveNotes 把 fromID 的标注和书签转移到 toID，toID 原有的标注和书签保留
+func (d *Deduper) moveNotes(fromID, toID string) error {
+	now := time.Now().UnixMilli()
+	for _, item := range d.app.bookAnnotations(fromID) {
+		item.EbookID, item.UpdatedAt = toID, now
+		if err := d.app.annotations.Put(item.ID, &item); err != nil {
+			return err
+		}
+	}
+	for _, item := range d.app.bookBookmarks(fromID) {
+		item.EbookID, item.UpdatedAt = toID, now
+		if err := d.app.bookmarks.Put(item.ID, &item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteBook 从书库删除书籍和本地文件，deleteRemote 时同时删除云端文件
+func (a *App) deleteBook(book EbookMetadata, deleteRemote bool) error {
+	if deleteRemote {
+		switch {
+		case book.RemotePath != "":
+			storage, err := a.storageProvider(bookStorageName(book))
+			if err != nil {
+				return err
+			}
+			if err := storage.Delete(book.RemotePath); err != nil {
+				return err
+			}
+		case book.BaidupanPath != "":
+			storage, err := a.storageProvider("baidupan")
+			if err != nil {
+				return err
+			}
+			rel, ok := strings.CutPrefix(book.BaidupanPath, getBaiduPath("")+"/")
+			if !ok {
+				return fmt.Errorf("baidupan path outside app folder: %s", book.BaidupanPath)
+			}
+			if err := storage.Delete(rel); err != nil {
+				return err
+			}
+		}
+	}
+	if err := a.store.Remove(book.ID); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := a.library.DeleteBook(book.ID); err != nil {
+		return err
+	}
+	log.Printf("[Dedupe] 已删除书籍: %s %s", book.ID, book.Title)
+	a.emit("library:book-removed", book.ID)
+	return nil
+}
+
+// FindDuplicates 返回书库中的重复书籍分组
+func (a *App) FindDuplicates() string {
+	groups, err := a.dedupe.Report()
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if groups == nil {
+		groups = []DuplicateGroup{}
+	}
+	return jsonResult(map[string]interface{}{"groups": groups})
+}
+
+// MergeDuplicates 保留一本并删除其余副本，阅读记录取自阅读最多的副本
+func (a *App) MergeDuplicates(keepId string, removeIds []string, deleteRemote bool) string {
+	if err := a.dedupe.Merge(keepId, removeIds, deleteRemote); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
+
+// DeleteDuplicate 直接删除一个副本，不转移阅读记录
+func (a *App) DeleteDuplicate(ebookId string, deleteRemote bool) string {
+	book, ok := a.library.Book(ebookId)
+	if !ok {
+		return `{"error": "book not found"}`
+	}
+	if err := a.deleteBook(book, deleteRemote); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	a.emit("library:changed")
+	return `{"success": true}`
+}
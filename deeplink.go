@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/wailsapp/wails/v2/pkg/options"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// deepLinkScheme 导出的标注中跳转链接使用的协议，在 wails.json 中注册，
+// 链接形如 neatreader://book/{id}?cfi=...&page=...
+const deepLinkScheme = "neatreader"
+
+// DeepLink 是解析后的跳转链接
+type DeepLink struct {
+	EbookID string `json:"ebookId"`
+	CFI     string `json:"cfi,omitempty"`
+	Page    int    `json:"page,omitempty"`
+}
+
+func (l DeepLink) String() string {
+	params := url.Values{}
+	if l.CFI != "" {
+		params.Set("cfi", l.CFI)
+	}
+	if l.Page > 0 {
+		params.Set("page", strconv.Itoa(l.Page))
+	}
+	return fmt.Sprintf("%s://book/%s?%s", deepLinkScheme, url.PathEscape(l.EbookID), params.Encode())
+}
+
+func parseDeepLink(raw string) (DeepLink, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return DeepLink{}, err
+	}
+	if u.Scheme != deepLinkScheme || u.Host != "book" {
+		return DeepLink{}, fmt.Errorf("unsupported link: %s", raw)
+	}
+	link := DeepLink{
+		EbookID: strings.Trim(u.Path, "/"),
+		CFI:     u.Query().Get("cfi"),
+	}
+	if link.EbookID == "" {
+		return DeepLink{}, fmt.Errorf("missing book id: %s", raw)
+	}
+	if page := u.Query().Get("page"); page != "" {
+		if link.Page, err = strconv.Atoi(page); err != nil {
+			return DeepLink{}, fmt.Errorf("invalid page: %s", page)
+		}
+	}
+	return link, nil
+}
+
+// DeepLinkQueue 保存还没有被前端处理的跳转链接。链接可能在前端加载完成前到达，
+// 所以先保存，再发送 app:open-link 通知前端来取
+type DeepLinkQueue struct {
+	mu      sync.Mutex
+	pending *DeepLink
+}
+
+func (q *DeepLinkQueue) push(link DeepLink) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = &link
+}
+
+func (q *DeepLinkQueue) take() *DeepLink {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	link := q.pending
+	q.pending = nil
+	return link
+}
+
+// openDeepLinks 处理命令行参数或系统传入的链接，其他参数忽略
+func (a *App) openDeepLinks(args []string) {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, deepLinkScheme+"://") {
+			continue
+		}
+		link, err := parseDeepLink(arg)
+		if err != nil {
+			log.Printf("[DeepLink] 无法解析链接: %v", err)
+			continue
+		}
+		log.Printf("[DeepLink] 打开链接: %s", arg)
+		a.links.push(link)
+		if a.ctx != nil {
+			runtime.WindowUnminimise(a.ctx)
+			runtime.WindowShow(a.ctx)
+		}
+		a.emit("app:open-link")
+	}
+}
+
+// onSecondInstanceLaunch 在 Windows 和 Linux 上，系统通过启动新进程打开链接，
+// 单实例锁把参数转交给已经运行的实例
+func (a *App) onSecondInstanceLaunch(data options.SecondInstanceData) {
+	a.openDeepLinks(data.Args)
+}
+
+// onURLOpen 在 macOS 上由系统直接传入链接
+func (a *App) onURLOpen(rawURL string) {
+	a.openDeepLinks([]string{rawURL})
+}
+
+// TakeDeepLink 返回并清除等待处理的跳转链接，没有时返回 nil
+func (a *App) TakeDeepLink() *DeepLink {
+	return a.links.take()
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 同一本书两次进度间隔超过该时间即视为新的阅读会话
+const sessionGap = 30 * time.Minute
+
+// 每台设备保留的最近会话数
+const maxDeviceSessions = 200
+
+var errDeviceRevoked = errors.New("this device has been revoked")
+
+// DeviceSession 是某台设备在某本书上最近一次阅读会话
+type DeviceSession struct {
+	EbookID      string  `json:"ebookId"`
+	ChapterIndex int     `json:"chapterIndex"`
+	ChapterTitle string  `json:"chapterTitle"`
+	Position     float64 `json:"position"`
+	CFI          string  `json:"cfi"`
+	StartedAt    int64   `json:"startedAt"`
+	UpdatedAt    int64   `json:"updatedAt"`
+}
+
+// DeviceRecord 是设备登记表中的一项，保存在同步清单中
+type DeviceRecord struct {
+	ID        string                    `json:"id"`
+	Name      string                    `json:"name"`
+	Type      string                    `json:"type"`
+	Platform  string                    `json:"platform"`
+	LastSync  int64                     `json:"lastSync"`
+	Revoked   bool                      `json:"revoked,omitempty"`
+	UpdatedAt int64                     `json:"updatedAt"`
+	Sessions  map[string]*DeviceSession `json:"sessions,omitempty"`
+}
+
+// ContinueHint 提示用户从其他设备上的位置继续阅读
+type ContinueHint struct {
+	DeviceID     string  `json:"deviceId"`
+	DeviceName   string  `json:"deviceName"`
+	Platform     string  `json:"platform"`
+	ChapterIndex int     `json:"chapterIndex"`
+	ChapterTitle string  `json:"chapterTitle"`
+	Position     float64 `json:"position"`
+	CFI          string  `json:"cfi"`
+	UpdatedAt    int64   `json:"updatedAt"`
+}
+
+// DeviceRegistry 维护所有设备的登记信息，与书库一样通过三方合并同步
+type DeviceRegistry struct {
+	mu      sync.RWMutex
+	dir     string
+	devices map[string]*DeviceRecord
+	base    map[string]*DeviceRecord
+}
+
+func NewDeviceRegistry(dir string) *DeviceRegistry {
+	r := &DeviceRegistry{
+		dir:     dir,
+		devices: map[string]*DeviceRecord{},
+		base:    map[string]*DeviceRecord{},
+	}
+	if err := readJSONFile(r.statePath(), &r.devices); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Devices] 读取设备登记失败: %v", err)
+	}
+	if err := readJSONFile(r.basePath(), &r.base); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Devices] 读取设备同步基线失败: %v", err)
+	}
+	if r.devices == nil {
+		r.devices = map[string]*DeviceRecord{}
+	}
+	if r.base == nil {
+		r.base = map[string]*DeviceRecord{}
+	}
+	return r
+}
+
+func (r *DeviceRegistry) statePath() string {
+	return filepath.Join(r.dir, "devices.json")
+}
+
+func (r *DeviceRegistry) basePath() string {
+	return filepath.Join(r.dir, "sync", "devices-base.json")
+}
+
+func (r *DeviceRegistry) saveLocked() error {
+	return writeJSONFile(r.statePath(), r.devices)
+}
+
+// recordLocked 返回本机的登记项，不存在时按设备信息创建
+func (r *DeviceRegistry) recordLocked(info DeviceInfo) *DeviceRecord {
+	rec := r.devices[info.ID]
+	if rec == nil {
+		rec = &DeviceRecord{
+			ID:       info.ID,
+			Name:     info.Name,
+			Type:     info.Type,
+			Platform: info.Platform,
+		}
+		r.devices[info.ID] = rec
+	}
+	return rec
+}
+
+// Touch 在同步前更新本机的登记信息
+func (r *DeviceRegistry) Touch(info DeviceInfo, lastSync int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec := r.recordLocked(info)
+	rec.Type = info.Type
+	rec.Platform = info.Platform
+	rec.LastSync = lastSync
+	rec.UpdatedAt = time.Now().UnixMilli()
+	return r.saveLocked()
+}
+
+// RecordSession 根据本机保存的阅读进度更新该书的阅读会话
+func (r *DeviceRegistry) RecordSession(info DeviceInfo, p ReadingProgress) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec := r.recordLocked(info)
+	if rec.Sessions == nil {
+		rec.Sessions = map[string]*DeviceSession{}
+	}
+
+	now := p.Timestamp
+	if now == 0 {
+		now = time.Now().UnixMilli()
+	}
+	s := rec.Sessions[p.EbookID]
+	if s == nil || time.Duration(now-s.UpdatedAt)*time.Millisecond > sessionGap {
+		s = &DeviceSession{EbookID: p.EbookID, StartedAt: now}
+		rec.Sessions[p.EbookID] = s
+	}
+	s.ChapterIndex = p.ChapterIndex
+	s.ChapterTitle = p.ChapterTitle
+	s.Position = p.Position
+	s.CFI = p.CFI
+	s.UpdatedAt = now
+	rec.UpdatedAt = time.Now().UnixMilli()
+
+	if len(rec.Sessions) > maxDeviceSessions {
+		sessions := make([]*DeviceSession, 0, len(rec.Sessions))
+		for _, s := range rec.Sessions {
+			sessions = append(sessions, s)
+		}
+		sort.Slice(sessions, func(i, j int) bool { return sessions[i].UpdatedAt > sessions[j].UpdatedAt })
+		for _, s := range sessions[maxDeviceSessions:] {
+			delete(rec.Sessions, s.EbookID)
+		}
+	}
+	return r.saveLocked()
+}
+
+func (r *DeviceRegistry) List() []DeviceRecord {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]DeviceRecord, 0, len(r.devices))
+	for _, d := range r.devices {
+		cp := *d
+		cp.Sessions = nil
+		list = append(list, cp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastSync > list[j].LastSync })
+	return list
+}
+
+func (r *DeviceRegistry) Get(id string) (DeviceRecord, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	d := r.devices[id]
+	if d == nil {
+		return DeviceRecord{}, false
+	}
+	return *d, true
+}
+
+func (r *DeviceRegistry) update(id string, fn func(d *DeviceRecord)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.devices[id]
+	if d == nil {
+		return fmt.Errorf("device %s not found", id)
+	}
+	fn(d)
+	d.UpdatedAt = time.Now().UnixMilli()
+	return r.saveLocked()
+}
+
+func (r *DeviceRegistry) Rename(id, name string) error {
+	return r.update(id, func(d *DeviceRecord) { d.Name = name })
+}
+
+func (r *DeviceRegistry) SetRevoked(id string, revoked bool) error {
+	return r.update(id, func(d *DeviceRecord) { d.Revoked = revoked })
+}
+
+// ContinueHints 返回其他设备上这本书最近的阅读位置，最新的在前
+func (r *DeviceRegistry) ContinueHints(selfID, ebookID string) []ContinueHint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var hints []ContinueHint
+	for _, d := range r.devices {
+		if d.ID == selfID || d.Revoked {
+			continue
+		}
+		s := d.Sessions[ebookID]
+		if s == nil {
+			continue
+		}
+		hints = append(hints, ContinueHint{
+			DeviceID:     d.ID,
+			DeviceName:   d.Name,
+			Platform:     d.Platform,
+			ChapterIndex: s.ChapterIndex,
+			ChapterTitle: s.ChapterTitle,
+			Position:     s.Position,
+			CFI:          s.CFI,
+			UpdatedAt:    s.UpdatedAt,
+		})
+	}
+	sort.Slice(hints, func(i, j int) bool { return hints[i].UpdatedAt > hints[j].UpdatedAt })
+	return hints
+}
+
+func (r *DeviceRegistry) Snapshot() map[string]*DeviceRecord {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return copyDeviceRecords(r.devices)
+}
+
+func copyDeviceRecords(devices map[string]*DeviceRecord) map[string]*DeviceRecord {
+	cp := make(map[string]*DeviceRecord, len(devices))
+	for id, d := range devices {
+		dd := *d
+		if d.Sessions != nil {
+			dd.Sessions = make(map[string]*DeviceSession, len(d.Sessions))
+			for bookID, s := range d.Sessions {
+				ss := *s
+				dd.Sessions[bookID] = &ss
+			}
+		}
+		cp[id] = &dd
+	}
+	return cp
+}
+
+// MergeRemote 与远端的设备登记做三方合并，返回本地是否变化
+func (r *DeviceRegistry) MergeRemote(remote map[string]*DeviceRecord) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if remote == nil {
+		remote = map[string]*DeviceRecord{}
+	}
+	merged, _, err := mergeRecordSets("device", r.base, r.devices, remote)
+	if err != nil {
+		return false, err
+	}
+	changed := !jsonEqual(r.devices, merged)
+	r.devices = merged
+	if changed {
+		return true, r.saveLocked()
+	}
+	return false, nil
+}
+
+// CommitBase 把已上传到远端的设备登记记为新的基线
+func (r *DeviceRegistry) CommitBase(uploaded map[string]*DeviceRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.base = copyDeviceRecords(uploaded)
+	return writeJSONFile(r.basePath(), r.base)
+}
+
+func (a *App) ListDevices() []DeviceRecord {
+	return a.devices.List()
+}
+
+func (a *App) RenameDevice(deviceId string, name string) string {
+	if name == "" {
+		return `{"error": "name is required"}`
+	}
+	if err := a.devices.Rename(deviceId, name); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if deviceId == a.settings.Device().ID {
+		a.settings.UpdateDevice(func(d *DeviceInfo) { d.Name = name })
+	}
+	return `{"success": true}`
+}
+
+// RevokeDevice 吊销其他设备，被吊销的设备下次同步时会停止同步
+func (a *App) RevokeDevice(deviceId string) string {
+	if deviceId == a.settings.Device().ID {
+		return `{"error": "cannot revoke the current device"}`
+	}
+	if err := a.devices.SetRevoked(deviceId, true); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	log.Printf("[Devices] 设备已吊销: %s", deviceId)
+	return `{"success": true}`
+}
+
+// RestoreDevice 恢复被吊销的设备。只能在其他设备上操作，否则被吊销的设备可以自行恢复，吊销就失去了意义
+func (a *App) RestoreDevice(deviceId string) string {
+	if deviceId == a.settings.Device().ID {
+		return `{"error": "cannot restore the current device"}`
+	}
+	if err := a.devices.SetRevoked(deviceId, false); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
+
+// GetContinueReading 返回其他设备上这本书的阅读位置，用于“从某设备继续阅读”
+func (a *App) GetContinueReading(ebookId string) []ContinueHint {
+	return a.devices.ContinueHints(a.settings.Device().ID, ebookId)
+}
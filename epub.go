@@ -0,0 +1,414 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// epubPackage 是 OPF 文件中与定位相关的部分
+type epubPackage struct {
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// epubSpineItem 是按阅读顺序排列的一个内容文档
+type epubSpineItem struct {
+	Index int // 在 spine 中的位置，用于生成 CFI
+	IDRef string
+	Path  string // 归档内的完整路径
+}
+
+// readZipFile 读取归档中的文件
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	f := findZipEntry(zr, name)
+	if f == nil {
+		return nil, fmt.Errorf("%s: not found in archive", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// epubOPFPath 通过 META-INF/container.xml 找到 OPF 文件
+func epubOPFPath(zr *zip.Reader) (string, error) {
+	data, err := readZipFile(zr, "META-INF/container.xml")
+	if err != nil {
+		return "", err
+	}
+	var container struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := xml.Unmarshal(data, &container); err != nil {
+		return "", err
+	}
+	if len(container.Rootfiles) == 0 || container.Rootfiles[0].FullPath == "" {
+		return "", fmt.Errorf("container.xml has no rootfile")
+	}
+	return container.Rootfiles[0].FullPath, nil
+}
+
+// epubSpine 返回 EPUB 的阅读顺序
+func epubSpine(zr *zip.Reader) ([]epubSpineItem, error) {
+	opfPath, err := epubOPFPath(zr)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readZipFile(zr, opfPath)
+	if err != nil {
+		return nil, err
+	}
+	var pkg epubPackage
+	if err := xml.Unmarshal(data, &pkg); err != nil {
+		return nil, err
+	}
+
+	hrefs := make(map[string]string, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		hrefs[item.ID] = item.Href
+	}
+	base := path.Dir(opfPath)
+	spine := make([]epubSpineItem, 0, len(pkg.Spine))
+	for i, ref := range pkg.Spine {
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+		spine = append(spine, epubSpineItem{Index: i, IDRef: ref.IDRef, Path: path.Join(base, href)})
+	}
+	return spine, nil
+}
+
+// cfiTextNode 是内容文档中的一个文本节点及其 CFI 路径
+type cfiTextNode struct {
+	path  string // 相对文档根元素的步进，如 /4/2/1
+	start int    // 在 epubDocText.text 中的字节偏移
+	text  string
+}
+
+// epubDocText 是一个内容文档 body 中的纯文本，用于按文字定位
+type epubDocText struct {
+	heading string
+	text    string
+	nodes   []cfiTextNode
+	// 规范化后的文本及每个字符在 text 中的字节偏移
+	search  []rune
+	offsets []int
+}
+
+// extractEpubDocText 遍历 XHTML，记录 body 中每个文本节点的 CFI 路径。
+// 元素按 2、4、6… 编号，元素之间的文本节点按奇数编号，与 EPUB CFI 规范一致
+func extractEpubDocText(data []byte) (*epubDocText, error) {
+	d := xml.NewDecoder(strings.NewReader(string(data)))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	type frame struct {
+		path     string
+		elements int
+		name     string
+	}
+	var stack []frame
+	doc := &epubDocText{}
+	var b strings.Builder
+	inBody, skip, inHeading := 0, 0, 0
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			if len(stack) == 0 {
+				stack = append(stack, frame{name: name})
+				continue
+			}
+			parent := &stack[len(stack)-1]
+			parent.elements++
+			stack = append(stack, frame{path: fmt.Sprintf("%s/%d", parent.path, parent.elements*2), name: name})
+			switch name {
+			case "body":
+				inBody++
+			case "script", "style":
+				skip++
+			case "h1", "h2", "h3":
+				inHeading++
+			}
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			switch stack[len(stack)-1].name {
+			case "body":
+				inBody--
+			case "script", "style":
+				skip--
+			case "h1", "h2", "h3":
+				inHeading--
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) == 0 || inBody == 0 || skip > 0 {
+				continue
+			}
+			top := stack[len(stack)-1]
+			nodePath := fmt.Sprintf("%s/%d", top.path, top.elements*2+1)
+			text := string(t)
+			if inHeading > 0 && doc.heading == "" && strings.TrimSpace(text) != "" {
+				doc.heading = strings.Join(strings.Fields(text), " ")
+			}
+			// 注释等会把同一个文本节点拆成多段，这里合并
+			if n := len(doc.nodes); n > 0 && doc.nodes[n-1].path == nodePath {
+				doc.nodes[n-1].text += text
+			} else {
+				doc.nodes = append(doc.nodes, cfiTextNode{path: nodePath, start: b.Len(), text: text})
+			}
+			b.WriteString(text)
+		}
+	}
+	doc.text = b.String()
+	doc.search, doc.offsets = normalizeForSearch(doc.text)
+	return doc, nil
+}
+
+// normalizeForSearch 去掉空白并转小写，返回规范化文本以及每个字符在原文中的字节偏移
+func normalizeForSearch(s string) ([]rune, []int) {
+	var runes []rune
+	var offsets []int
+	for i, r := range s {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		runes = append(runes, unicode.ToLower(r))
+		offsets = append(offsets, i)
+	}
+	return runes, offsets
+}
+
+func indexRunes(haystack, needle []rune) int {
+	if len(needle) == 0 {
+		return -1
+	}
+outer:
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		for j, r := range needle {
+			if haystack[i+j] != r {
+				continue outer
+			}
+		}
+		return i
+	}
+	return -1
+}
+
+// find 在文档中查找文字，返回原文中的字节范围 [start, end)
+func (doc *epubDocText) find(text string) (int, int, bool) {
+	hay, offsets := doc.search, doc.offsets
+	needle, _ := normalizeForSearch(text)
+	if len(needle) == 0 {
+		return 0, 0, false
+	}
+
+	i := indexRunes(hay, needle)
+	length := len(needle)
+	if i < 0 && len(needle) > 40 {
+		// 其他阅读器导出的长高亮常有断行或标点差异，退而只匹配开头
+		i = indexRunes(hay, needle[:40])
+		length = min(len(needle), len(hay)-i)
+	}
+	if i < 0 {
+		return 0, 0, false
+	}
+	last := i + length - 1
+	_, size := utf8.DecodeRuneInString(doc.text[offsets[last]:])
+	return offsets[i], offsets[last] + size, true
+}
+
+// point 把原文字节偏移转为 “文本节点路径:UTF-16 偏移”
+func (doc *epubDocText) point(offset int, atEnd bool) (string, int) {
+	for i, node := range doc.nodes {
+		nodeEnd := node.start + len(node.text)
+		inside := offset >= node.start && offset < nodeEnd
+		if atEnd {
+			inside = offset > node.start && offset <= nodeEnd
+		}
+		if inside || i == len(doc.nodes)-1 {
+			prefix := node.text[:min(max(offset-node.start, 0), len(node.text))]
+			return node.path, len(utf16.Encode([]rune(prefix)))
+		}
+	}
+	return "", 0
+}
+
+// rangeCFI 生成 epubcfi(/6/N[idref]!/公共路径,/起点,/终点)
+func (doc *epubDocText) rangeCFI(spineIndex int, idref string, start, end int) string {
+	startPath, startOffset := doc.point(start, false)
+	endPath, endOffset := doc.point(end, true)
+	startSteps := strings.Split(strings.TrimPrefix(startPath, "/"), "/")
+	endSteps := strings.Split(strings.TrimPrefix(endPath, "/"), "/")
+
+	common := 0
+	for common < len(startSteps)-1 && common < len(endSteps)-1 && startSteps[common] == endSteps[common] {
+		common++
+	}
+	parent := ""
+	if common > 0 {
+		parent = "/" + strings.Join(startSteps[:common], "/")
+	}
+	spineStep := fmt.Sprintf("/6/%d", (spineIndex+1)*2)
+	if idref != "" {
+		spineStep += "[" + idref + "]"
+	}
+	return fmt.Sprintf("epubcfi(%s!%s,/%s:%d,/%s:%d)", spineStep, parent,
+		strings.Join(startSteps[common:], "/"), startOffset,
+		strings.Join(endSteps[common:], "/"), endOffset)
+}
+
+// epubLocation 是文字在 EPUB 中的定位结果
+type epubLocation struct {
+	SpineIndex   int
+	ChapterTitle string
+	CFIRange     string
+}
+
+// epubLocator 缓存一本 EPUB 各章节的文本，用于批量定位
+type epubLocator struct {
+	spine []epubSpineItem
+	docs  []*epubDocText
+}
+
+func newEpubLocator(zr *zip.Reader) (*epubLocator, error) {
+	spine, err := epubSpine(zr)
+	if err != nil {
+		return nil, err
+	}
+	l := &epubLocator{spine: spine, docs: make([]*epubDocText, len(spine))}
+	for i, item := range spine {
+		data, err := readZipFile(zr, item.Path)
+		if err != nil {
+			continue
+		}
+		if doc, err := extractEpubDocText(data); err == nil {
+			l.docs[i] = doc
+		}
+	}
+	return l, nil
+}
+
+// Locate 按阅读顺序查找文字所在的章节并生成 CFI 范围
+func (l *epubLocator) Locate(text string) (epubLocation, bool) {
+	for i, doc := range l.docs {
+		if doc == nil {
+			continue
+		}
+		start, end, ok := doc.find(text)
+		if !ok {
+			continue
+		}
+		return epubLocation{
+			SpineIndex:   l.spine[i].Index,
+			ChapterTitle: doc.heading,
+			CFIRange:     doc.rangeCFI(l.spine[i].Index, l.spine[i].IDRef, start, end),
+		}, true
+	}
+	return epubLocation{}, false
+}
+
+var cfiAssertionRe = regexp.MustCompile(`\[[^\]]*\]`)
+
+// parseCFIPoint 拆出 CFI 起点的 spine 位置、文档内路径和 UTF-16 字符偏移。
+// 范围 CFI 取父路径加起点
+func parseCFIPoint(cfi string) (spineIndex int, docPath string, offset int, err error) {
+	cfi = strings.TrimSuffix(strings.TrimPrefix(cfi, "epubcfi("), ")")
+	cfi = cfiAssertionRe.ReplaceAllString(cfi, "")
+	if parts := strings.Split(cfi, ","); len(parts) == 3 {
+		cfi = parts[0] + parts[1]
+	}
+	pkgPath, local, ok := strings.Cut(cfi, "!")
+	if !ok {
+		return 0, "", 0, fmt.Errorf("invalid cfi: %s", cfi)
+	}
+	steps := strings.Split(strings.TrimPrefix(pkgPath, "/"), "/")
+	if len(steps) != 2 {
+		return 0, "", 0, fmt.Errorf("invalid cfi: %s", cfi)
+	}
+	step, err := strconv.Atoi(steps[1])
+	if err != nil || step < 2 {
+		return 0, "", 0, fmt.Errorf("invalid cfi: %s", cfi)
+	}
+	if path, off, ok := strings.Cut(local, ":"); ok {
+		local = path
+		offset, _ = strconv.Atoi(off)
+	}
+	return step/2 - 1, local, offset, nil
+}
+
+// textAt 返回 CFI 位置之后的 n 个字符，路径指向元素时取其中第一个文本节点
+func (doc *epubDocText) textAt(docPath string, offset, n int) string {
+	for _, node := range doc.nodes {
+		if node.path != docPath && !strings.HasPrefix(node.path, docPath+"/") {
+			continue
+		}
+		if node.path != docPath {
+			offset = 0
+		}
+		units := utf16.Encode([]rune(node.text))
+		start := node.start + len(string(utf16.Decode(units[:min(offset, len(units))])))
+		runes := []rune(doc.text[start:])
+		return strings.Join(strings.Fields(string(runes[:min(n, len(runes))])), " ")
+	}
+	return ""
+}
+
+// epubSnippetAt 读取 EPUB 中 CFI 所在位置附近的文字
+func epubSnippetAt(zr *zip.Reader, cfi string, n int) (string, error) {
+	spineIndex, docPath, offset, err := parseCFIPoint(cfi)
+	if err != nil {
+		return "", err
+	}
+	spine, err := epubSpine(zr)
+	if err != nil {
+		return "", err
+	}
+	for _, item := range spine {
+		if item.Index != spineIndex {
+			continue
+		}
+		data, err := readZipFile(zr, item.Path)
+		if err != nil {
+			return "", err
+		}
+		doc, err := extractEpubDocText(data)
+		if err != nil {
+			return "", err
+		}
+		return doc.textAt(docPath, offset, n), nil
+	}
+	return "", fmt.Errorf("spine item %d not found", spineIndex)
+}
@@ -0,0 +1,715 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// EpubIssue 是检查 EPUB 时发现的一个问题
+type EpubIssue struct {
+	// Kind 为 mimetype、container、manifest、spine、encoding、xhtml 或 toc
+	Kind    string `json:"kind"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+	Fixed   bool   `json:"fixed"`
+}
+
+// EpubCheckReport 是一次检查的结果，Repaired 表示文件已被改写
+type EpubCheckReport struct {
+	Issues   []EpubIssue `json:"issues"`
+	Repaired bool        `json:"repaired"`
+}
+
+func (r *EpubCheckReport) add(kind, p string, fixed bool, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, EpubIssue{Kind: kind, Path: p, Message: fmt.Sprintf(format, args...), Fixed: fixed})
+}
+
+// epubItem 是 OPF manifest 中的一项
+type epubItem struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+}
+
+// epubCheckPackage 是检查需要的 OPF 内容
+type epubCheckPackage struct {
+	Version     string     `xml:"version,attr"`
+	Titles      []string   `xml:"metadata>title"`
+	Identifiers []string   `xml:"metadata>identifier"`
+	Manifest    []epubItem `xml:"manifest>item"`
+	Spine       struct {
+		Toc   string `xml:"toc,attr"`
+		Items []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+// epubTOCEntry 是生成目录时的一项，Href 相对于目录文件
+type epubTOCEntry struct {
+	Title string
+	Href  string
+}
+
+const epubContainerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="%s" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+var (
+	opfSpinePattern    = regexp.MustCompile(`(?s)<((?:[\w.-]+:)?spine)\b([^>]*?)(?:/>|>(.*?)</(?:[\w.-]+:)?spine\s*>)`)
+	opfSpineOpen       = regexp.MustCompile(`<(?:[\w.-]+:)?spine\b[^>]*>`)
+	opfPackageEnd      = regexp.MustCompile(`</(?:[\w.-]+:)?package\s*>`)
+	xmlDeclEncoding    = regexp.MustCompile(`^(\s*<\?xml\b[^>]*?\bencoding\s*=\s*["'])([^"']+)(["'])`)
+	htmlMetaCharset    = regexp.MustCompile(`(?i)(<meta\b[^>]*?charset\s*=\s*["']?)([\w.:-]+)`)
+	htmlEntityRef      = regexp.MustCompile(`&([A-Za-z][A-Za-z0-9]*);`)
+	xmlReferencePrefix = regexp.MustCompile(`^(?:[A-Za-z][A-Za-z0-9]*|#[0-9]+|#[xX][0-9A-Fa-f]+);`)
+	htmlTitlePattern   = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	navTOCPattern      = regexp.MustCompile(`(?s)<nav\b[^>]*epub:type\s*=\s*["'][^"']*\btoc\b[^"']*["'][^>]*>.*?<a\b`)
+)
+
+// isXHTMLMediaType 判断 manifest 条目是否为内容文档
+func isXHTMLMediaType(mediaType string) bool {
+	return mediaType == "application/xhtml+xml" || mediaType == "text/html"
+}
+
+// hasProperty 判断以空格分隔的 properties 中是否包含 name
+func hasProperty(properties, name string) bool {
+	for _, p := range strings.Fields(properties) {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// relativeHref 返回从 fromDir 指向归档内 target 的相对路径
+func relativeHref(fromDir, target string) string {
+	if fromDir == "." || fromDir == "" {
+		return target
+	}
+	from := strings.Split(fromDir, "/")
+	to := strings.Split(target, "/")
+	i := 0
+	for i < len(from) && i < len(to)-1 && from[i] == to[i] {
+		i++
+	}
+	return strings.Repeat("../", len(from)-i) + strings.Join(to[i:], "/")
+}
+
+// manifestHrefPath 返回 manifest 条目在归档内的完整路径
+func manifestHrefPath(base, href string) string {
+	if i := strings.IndexAny(href, "#?"); i >= 0 {
+		href = href[:i]
+	}
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	return path.Join(base, href)
+}
+
+// removeManifestItem 从 OPF 中删除指定 ID 的 manifest 条目
+func removeManifestItem(opf, id string) string {
+	item := regexp.MustCompile(`\s*<(?:[\w.-]+:)?item\b[^>]*\bid\s*=\s*["']` + regexp.QuoteMeta(id) + `["'][^>]*>(?:\s*</(?:[\w.-]+:)?item\s*>)?`)
+	return item.ReplaceAllString(opf, "")
+}
+
+// removeSpineItemref 从 OPF 中删除引用指定 ID 的 itemref
+func removeSpineItemref(opf, idref string) string {
+	itemref := regexp.MustCompile(`\s*<(?:[\w.-]+:)?itemref\b[^>]*\bidref\s*=\s*["']` + regexp.QuoteMeta(idref) + `["'][^>]*>(?:\s*</(?:[\w.-]+:)?itemref\s*>)?`)
+	return itemref.ReplaceAllString(opf, "")
+}
+
+// addManifestItem 在 manifest 末尾添加一个条目
+func addManifestItem(opf, item string) (string, error) {
+	loc := opfManifestEnd.FindStringIndex(opf)
+	if loc == nil {
+		return "", fmt.Errorf("package document has no manifest element")
+	}
+	return appendXMLElement(opf[:loc[0]], item) + opf[loc[0]:], nil
+}
+
+// detectXHTMLEncoding 返回文档声明的编码，先看 XML 声明，再看 HTML 的 meta
+func detectXHTMLEncoding(data []byte) string {
+	if m := xmlDeclEncoding.FindSubmatch(data); m != nil {
+		return string(m[2])
+	}
+	head := data
+	if len(head) > 2048 {
+		head = head[:2048]
+	}
+	if m := htmlMetaCharset.FindSubmatch(head); m != nil {
+		return string(m[2])
+	}
+	return ""
+}
+
+// decodeWith 用指定编码解码，返回结果和替换字符的数量
+func decodeWith(enc encoding.Encoding, data []byte) ([]byte, int) {
+	out, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, len(data)
+	}
+	return out, bytes.Count(out, []byte("\uFFFD")) - bytes.Count(data, []byte("\uFFFD"))
+}
+
+// decodeText 把编码未知的文本转为 UTF-8：有 UTF-16 BOM 时按 UTF-16，合法的 UTF-8 原样返回，
+// 否则在 GB18030 和 Big5 中选择替换字符较少的一个。返回的 from 为识别出的编码，已是 UTF-8 时为空
+func decodeText(data []byte) (out []byte, from string) {
+	if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF}) {
+		if out, bad := decodeWith(unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), data); bad == 0 {
+			return out, "UTF-16"
+		}
+	}
+	if utf8.Valid(data) {
+		return data, ""
+	}
+	gbk, gbkBad := decodeWith(simplifiedchinese.GB18030, data)
+	big5, big5Bad := decodeWith(traditionalchinese.Big5, data)
+	if big5 != nil && big5Bad < gbkBad {
+		return big5, "Big5"
+	}
+	if gbk != nil {
+		return gbk, "GB18030"
+	}
+	return []byte(strings.ToValidUTF8(string(data), "\uFFFD")), "UTF-8"
+}
+
+// decodeXHTML 把文档转为 UTF-8。声明了其他编码时，内容本身是合法的 UTF-8 就只改正声明，
+// 否则按声明解码；没有可用的声明时按 decodeText 识别。返回的 from 为原编码，不需要修改时为空
+func decodeXHTML(data []byte) (out []byte, from string) {
+	name := detectXHTMLEncoding(data)
+	if name != "" && !bytes.HasPrefix(data, []byte{0xFF, 0xFE}) && !bytes.HasPrefix(data, []byte{0xFE, 0xFF}) {
+		if enc, err := htmlindex.Get(name); err == nil {
+			if canonical, _ := htmlindex.Name(enc); canonical != "utf-8" {
+				if utf8.Valid(data) {
+					return data, name
+				}
+				if out, _ := decodeWith(enc, data); out != nil {
+					return out, name
+				}
+			}
+		}
+	}
+	return decodeText(data)
+}
+
+// fixXMLReferences 把 XML 不认识的 HTML 命名实体换成数字引用，并转义孤立的 &。
+// 返回修改的处数
+func fixXMLReferences(s string) (string, int) {
+	changed := 0
+	s = htmlEntityRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[1 : len(ref)-1]
+		switch name {
+		case "amp", "lt", "gt", "quot", "apos":
+			return ref
+		}
+		if v, ok := xml.HTMLEntity[name]; ok {
+			changed++
+			var b strings.Builder
+			for _, r := range v {
+				fmt.Fprintf(&b, "&#%d;", r)
+			}
+			return b.String()
+		}
+		return ref
+	})
+
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '&')
+		if i < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i+1])
+		s = s[i+1:]
+		if !xmlReferencePrefix.MatchString(s) {
+			b.WriteString("amp;")
+			changed++
+		}
+	}
+	return b.String(), changed
+}
+
+// checkXMLWellFormed 以严格模式解析文档，返回第一个错误
+func checkXMLWellFormed(data []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = true
+	for {
+		if _, err := d.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// repairXHTML 修复内容文档的编码和实体引用，文档没有问题时返回 nil
+func repairXHTML(p string, data []byte, report *EpubCheckReport) []byte {
+	out, from := decodeXHTML(data)
+	changed := false
+	if from != "" {
+		out = xmlDeclEncoding.ReplaceAll(out, []byte("${1}UTF-8${3}"))
+		out = htmlMetaCharset.ReplaceAll(out, []byte("${1}utf-8"))
+		report.add("encoding", p, true, "已从 %s 转换为 UTF-8", from)
+		changed = true
+	}
+	if err := checkXMLWellFormed(out); err != nil {
+		fixed, n := fixXMLReferences(string(out))
+		if n > 0 {
+			out = []byte(fixed)
+			changed = true
+		}
+		if err := checkXMLWellFormed(out); err != nil {
+			if n > 0 {
+				report.add("xhtml", p, false, "已修正 %d 处实体引用，仍无法解析: %v", n, err)
+			} else {
+				report.add("xhtml", p, false, "无法解析: %v", err)
+			}
+		} else {
+			report.add("xhtml", p, true, "已修正 %d 处实体引用", n)
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return out
+}
+
+// epubDocTitle 返回内容文档的标题：第一个 h1–h6，其次 <title>
+func epubDocTitle(data []byte) string {
+	if doc, err := extractEpubDocText(data); err == nil && doc.heading != "" {
+		return doc.heading
+	}
+	if m := htmlTitlePattern.FindSubmatch(data); m != nil {
+		return strings.Join(strings.Fields(string(m[1])), " ")
+	}
+	return ""
+}
+
+// buildEpubNav 生成 EPUB 3 的导航文档
+func buildEpubNav(title string, entries []epubTOCEntry) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head>
+  <meta charset="utf-8"/>
+  <title>` + escapeXMLText(title) + `</title>
+</head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>目录</h1>
+    <ol>
+`)
+	for _, e := range entries {
+		fmt.Fprintf(&b, "      <li><a href=\"%s\">%s</a></li>\n", escapeXMLText(e.Href), escapeXMLText(e.Title))
+	}
+	b.WriteString(`    </ol>
+  </nav>
+</body>
+</html>
+`)
+	return []byte(b.String())
+}
+
+// buildEpubNCX 生成 EPUB 2 的 NCX 目录
+func buildEpubNCX(uid, title string, entries []epubTOCEntry) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head>
+    <meta name="dtb:uid" content="` + escapeXMLText(uid) + `"/>
+    <meta name="dtb:depth" content="1"/>
+    <meta name="dtb:totalPageCount" content="0"/>
+    <meta name="dtb:maxPageNumber" content="0"/>
+  </head>
+  <docTitle><text>` + escapeXMLText(title) + `</text></docTitle>
+  <navMap>
+`)
+	for i, e := range entries {
+		fmt.Fprintf(&b, "    <navPoint id=\"navpoint-%d\" playOrder=\"%d\">\n", i+1, i+1)
+		fmt.Fprintf(&b, "      <navLabel><text>%s</text></navLabel>\n", escapeXMLText(e.Title))
+		fmt.Fprintf(&b, "      <content src=\"%s\"/>\n", escapeXMLText(e.Href))
+		b.WriteString("    </navPoint>\n")
+	}
+	b.WriteString(`  </navMap>
+</ncx>
+`)
+	return []byte(b.String())
+}
+
+// checkEpub 检查 EPUB 的结构并尽量修复：mimetype、container.xml、manifest 中缺失的文件、
+// spine 中未知的 ID、内容文档的编码和实体，以及缺失或为空的目录。
+// 有修改时返回重新打包的数据，否则返回原数据；无法修复时返回错误
+func checkEpub(data []byte) ([]byte, *EpubCheckReport, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a zip archive: %w", err)
+	}
+	report := &EpubCheckReport{Issues: []EpubIssue{}}
+	files := map[string][]byte{}
+	rewrite := false
+
+	// 归档按名称精确查找，epubjs 区分大小写
+	entries := make(map[string]*zip.File, len(zr.File))
+	folded := make(map[string]string, len(zr.File))
+	var opfCandidates []string
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		entries[f.Name] = f
+		if _, ok := folded[strings.ToLower(f.Name)]; !ok {
+			folded[strings.ToLower(f.Name)] = f.Name
+		}
+		if strings.EqualFold(path.Ext(f.Name), ".opf") {
+			opfCandidates = append(opfCandidates, f.Name)
+		}
+	}
+	sort.Strings(opfCandidates)
+	read := func(name string) ([]byte, error) {
+		if data, ok := files[name]; ok && data != nil {
+			return data, nil
+		}
+		f := entries[name]
+		if f == nil {
+			return nil, fmt.Errorf("%s: not found in archive", name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+
+	// mimetype 必须是第一个条目、不压缩、内容正确
+	if len(zr.File) == 0 || zr.File[0].Name != "mimetype" || zr.File[0].Method != zip.Store {
+		report.add("mimetype", "mimetype", true, "mimetype 不是第一个不压缩的条目")
+		rewrite = true
+	} else if content, err := read("mimetype"); err != nil || strings.TrimSpace(string(content)) != epubMimetype || len(content) != len(epubMimetype) {
+		report.add("mimetype", "mimetype", true, "mimetype 内容不正确")
+		rewrite = true
+	}
+
+	// container.xml 指向 OPF
+	const containerPath = "META-INF/container.xml"
+	opfPath := ""
+	if content, err := read(containerPath); err != nil {
+		if actual, ok := folded[strings.ToLower(containerPath)]; ok {
+			files[actual] = nil
+		}
+		report.add("container", containerPath, true, "缺少 container.xml")
+	} else {
+		var container struct {
+			Rootfiles []struct {
+				FullPath string `xml:"full-path,attr"`
+			} `xml:"rootfiles>rootfile"`
+		}
+		switch {
+		case xml.Unmarshal(content, &container) != nil:
+			report.add("container", containerPath, true, "container.xml 无法解析")
+		case len(container.Rootfiles) == 0 || container.Rootfiles[0].FullPath == "":
+			report.add("container", containerPath, true, "container.xml 没有指定 OPF 文件")
+		case entries[container.Rootfiles[0].FullPath] != nil:
+			opfPath = container.Rootfiles[0].FullPath
+		default:
+			report.add("container", containerPath, true, "container.xml 指向不存在的 %s", container.Rootfiles[0].FullPath)
+		}
+	}
+	if opfPath == "" {
+		if len(opfCandidates) == 0 {
+			return nil, report, fmt.Errorf("no package document (.opf) in archive")
+		}
+		opfPath = opfCandidates[0]
+		files[containerPath] = []byte(fmt.Sprintf(epubContainerXML, escapeXMLText(opfPath)))
+	}
+
+	content, err := read(opfPath)
+	if err != nil {
+		return nil, report, err
+	}
+	opfConverted := false
+	if out, from := decodeXHTML(content); from != "" {
+		content = xmlDeclEncoding.ReplaceAll(out, []byte("${1}UTF-8${3}"))
+		opfConverted = true
+		report.add("encoding", opfPath, true, "已从 %s 转换为 UTF-8", from)
+	}
+	var pkg epubCheckPackage
+	if err := xml.Unmarshal(content, &pkg); err != nil {
+		return nil, report, fmt.Errorf("parse %s: %w", opfPath, err)
+	}
+	opf := string(content)
+	base := path.Dir(opfPath)
+	epub3 := strings.HasPrefix(pkg.Version, "3")
+
+	// manifest 中的文件必须存在；只是大小写不同的改正 href，找不到的删除。
+	// 目录文件留给后面的目录检查处理
+	var navItem, ncxItem *epubItem
+	manifest := map[string]epubItem{}
+	var items []epubItem
+	for i := range pkg.Manifest {
+		item := pkg.Manifest[i]
+		if item.ID == "" {
+			continue
+		}
+		switch {
+		case hasProperty(item.Properties, "nav"):
+			navItem = &pkg.Manifest[i]
+		case item.MediaType == "application/x-dtbncx+xml" && (pkg.Spine.Toc == "" || pkg.Spine.Toc == item.ID):
+			ncxItem = &pkg.Manifest[i]
+		}
+		full := manifestHrefPath(base, item.Href)
+		if entries[full] == nil && !strings.Contains(item.Href, "://") {
+			if actual, ok := folded[strings.ToLower(full)]; ok && (base == "." || strings.EqualFold(actual[:len(base)+1], base+"/")) {
+				href := actual
+				if base != "." {
+					href = actual[len(base)+1:]
+				}
+				item.Href = (&url.URL{Path: href}).EscapedPath()
+				opf = setManifestAttr(opf, item.ID, "href", item.Href)
+				report.add("manifest", item.Href, true, "已改正大小写不符的路径 %s", full)
+			} else if &pkg.Manifest[i] != navItem && &pkg.Manifest[i] != ncxItem {
+				opf = removeManifestItem(opf, item.ID)
+				report.add("manifest", full, true, "已删除指向不存在文件的条目 %s", item.ID)
+				continue
+			}
+		}
+		manifest[item.ID] = item
+		items = append(items, item)
+	}
+
+	// spine 只能引用 manifest 中的 ID
+	var spine []epubItem
+	for _, ref := range pkg.Spine.Items {
+		item, ok := manifest[ref.IDRef]
+		if !ok {
+			opf = removeSpineItemref(opf, ref.IDRef)
+			report.add("spine", "", true, "已删除引用未知 ID 的 itemref %s", ref.IDRef)
+			continue
+		}
+		spine = append(spine, item)
+	}
+	if len(spine) == 0 {
+		var refs strings.Builder
+		for _, item := range items {
+			if isXHTMLMediaType(item.MediaType) && !hasProperty(item.Properties, "nav") {
+				spine = append(spine, item)
+				fmt.Fprintf(&refs, "\n    <itemref idref=\"%s\"/>", escapeXMLText(item.ID))
+			}
+		}
+		if len(spine) == 0 {
+			return nil, report, fmt.Errorf("no content documents in %s", opfPath)
+		}
+		if m := opfSpinePattern.FindStringSubmatchIndex(opf); m != nil {
+			opf = opf[:m[0]] + "<" + opf[m[2]:m[3]] + opf[m[4]:m[5]] + ">" + refs.String() + "\n  </" + opf[m[2]:m[3]] + ">" + opf[m[1]:]
+		} else if loc := opfPackageEnd.FindStringIndex(opf); loc != nil {
+			opf = appendXMLElement(opf[:loc[0]], "<spine>"+refs.String()+"\n  </spine>") + opf[loc[0]:]
+		}
+		report.add("spine", "", true, "spine 为空，已按 manifest 顺序重建")
+	}
+
+	// 内容文档的编码和实体引用
+	for _, item := range items {
+		if !isXHTMLMediaType(item.MediaType) {
+			continue
+		}
+		full := manifestHrefPath(base, item.Href)
+		doc, err := read(full)
+		if err != nil {
+			continue
+		}
+		if fixed := repairXHTML(full, doc, report); fixed != nil {
+			files[full] = fixed
+		}
+	}
+
+	// 目录：EPUB 3 需要导航文档，EPUB 2 需要 NCX；缺失或没有条目时按标题重新生成
+	tocValid := func(item *epubItem, valid func([]byte) bool) bool {
+		if item == nil {
+			return false
+		}
+		doc, err := read(manifestHrefPath(base, item.Href))
+		return err == nil && valid(doc)
+	}
+	navValid := tocValid(navItem, navTOCPattern.Match)
+	ncxValid := tocValid(ncxItem, func(doc []byte) bool { return bytes.Contains(doc, []byte("<navPoint")) })
+	needNav := epub3 && !navValid
+	needNCX := !ncxValid && (!epub3 || !navValid || ncxItem != nil)
+	if needNav || needNCX {
+		title := ""
+		if len(pkg.Titles) > 0 {
+			title = strings.TrimSpace(pkg.Titles[0])
+		}
+		var toc []epubTOCEntry
+		for i, item := range spine {
+			doc, err := read(manifestHrefPath(base, item.Href))
+			if err != nil {
+				continue
+			}
+			heading := epubDocTitle(doc)
+			if heading == "" || heading == title {
+				heading = fmt.Sprintf("第 %d 节", i+1)
+			}
+			toc = append(toc, epubTOCEntry{Title: heading, Href: manifestHrefPath(base, item.Href)})
+		}
+		ids := func(prefix string) string {
+			id := prefix
+			for i := 2; ; i++ {
+				if _, ok := manifest[id]; !ok {
+					return id
+				}
+				id = fmt.Sprintf("%s-%d", prefix, i)
+			}
+		}
+		newPath := func(name string) string {
+			p := path.Join(base, name)
+			ext := path.Ext(name)
+			for i := 2; entries[p] != nil || files[p] != nil; i++ {
+				p = path.Join(base, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), i, ext))
+			}
+			return p
+		}
+		relative := func(dir string) []epubTOCEntry {
+			out := make([]epubTOCEntry, len(toc))
+			for i, e := range toc {
+				out[i] = epubTOCEntry{Title: e.Title, Href: relativeHref(dir, e.Href)}
+			}
+			return out
+		}
+
+		if needNav {
+			var p string
+			if navItem != nil {
+				p = manifestHrefPath(base, navItem.Href)
+			} else {
+				p = newPath("nav.xhtml")
+				id := ids("nav")
+				manifest[id] = epubItem{ID: id}
+				if opf, err = addManifestItem(opf, fmt.Sprintf(`<item id="%s" href="%s" media-type="application/xhtml+xml" properties="nav"/>`, id, escapeXMLText(relativeHref(base, p)))); err != nil {
+					return nil, report, err
+				}
+			}
+			files[p] = buildEpubNav(title, relative(path.Dir(p)))
+			report.add("toc", p, true, "已根据章节标题重新生成导航文档")
+		}
+		if needNCX {
+			uid := "urn:uuid:" + newID()
+			if len(pkg.Identifiers) > 0 && strings.TrimSpace(pkg.Identifiers[0]) != "" {
+				uid = strings.TrimSpace(pkg.Identifiers[0])
+			}
+			var p, id string
+			if ncxItem != nil {
+				p, id = manifestHrefPath(base, ncxItem.Href), ncxItem.ID
+			} else {
+				p, id = newPath("toc.ncx"), ids("ncx")
+				manifest[id] = epubItem{ID: id}
+				if opf, err = addManifestItem(opf, fmt.Sprintf(`<item id="%s" href="%s" media-type="application/x-dtbncx+xml"/>`, id, escapeXMLText(relativeHref(base, p)))); err != nil {
+					return nil, report, err
+				}
+			}
+			opf = opfSpineOpen.ReplaceAllStringFunc(opf, func(tag string) string {
+				return setTagAttr(tag, "toc", id)
+			})
+			files[p] = buildEpubNCX(uid, title, relative(path.Dir(p)))
+			report.add("toc", p, true, "已根据章节标题重新生成 NCX 目录")
+		}
+	}
+
+	if opfConverted || opf != string(content) {
+		files[opfPath] = []byte(opf)
+	}
+	if !rewrite && len(files) == 0 {
+		return data, report, nil
+	}
+	var buf bytes.Buffer
+	if err := writeEpubArchive(&buf, zr, files); err != nil {
+		return nil, report, err
+	}
+	report.Repaired = true
+	return buf.Bytes(), report, nil
+}
+
+// checkBookFile 在书籍入库前检查 EPUB，返回修复后的数据；其他格式原样返回。
+// 发现问题时记录日志并通知前端
+func (a *App) checkBookFile(id, fileName string, data []byte) ([]byte, *EpubCheckReport, error) {
+	if !strings.EqualFold(filepath.Ext(fileName), ".epub") {
+		return data, nil, nil
+	}
+	fixed, report, err := checkEpub(data)
+	if err != nil {
+		log.Printf("[EPUB] 文件无法使用: %s, %v", fileName, err)
+		return nil, report, fmt.Errorf("invalid epub: %w", err)
+	}
+	if len(report.Issues) == 0 {
+		return data, report, nil
+	}
+	for _, issue := range report.Issues {
+		log.Printf("[EPUB] %s: [%s] %s %s (fixed=%v)", fileName, issue.Kind, issue.Path, issue.Message, issue.Fixed)
+	}
+	a.emit("epub:checked", map[string]interface{}{
+		"ebookId": id, "fileName": fileName, "report": report,
+	})
+	return fixed, report, nil
+}
+
+// CheckEpub 检查书库中的 EPUB，repair 为 true 时保存修复后的文件
+func (a *App) CheckEpub(ebookId string, repair bool) string {
+	book, ok := a.library.Book(ebookId)
+	if !ok {
+		return `{"error": "book not found"}`
+	}
+	if !strings.EqualFold(book.Format, "epub") {
+		return `{"error": "only epub books can be checked"}`
+	}
+	localPath, err := a.store.Path(book.ID)
+	if err != nil {
+		return `{"error": "book file not found"}`
+	}
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	fixed, report, err := checkEpub(data)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if !repair || !report.Repaired {
+		report.Repaired = false
+		return jsonResult(report)
+	}
+	if _, err := a.store.Save(book.ID, filepath.Base(localPath), fixed); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	book.Size = int64(len(fixed))
+	if err := a.library.PutBook(book); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	log.Printf("[EPUB] 已修复: %s, %d 个问题", book.Title, len(report.Issues))
+	a.emit("library:changed")
+	return jsonResult(report)
+}
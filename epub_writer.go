@@ -0,0 +1,520 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const epubMimetype = "application/epub+zip"
+
+// writeEpubMimetype 写入 mimetype 条目。OCF 要求它是归档的第一个条目、不压缩且没有扩展字段
+func writeEpubMimetype(zw *zip.Writer) error {
+	data := []byte(epubMimetype)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(len(data)),
+		UncompressedSize64: uint64(len(data)),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// epubMetadataEdit 是要写回 EPUB 的元数据，空字段保持文件中的原值
+type epubMetadataEdit struct {
+	Title       string
+	Author      string
+	Publisher   string
+	Description string
+	ISBN        string
+	Cover       []byte
+}
+
+// epubOPFInfo 是 OPF 中查找封面需要的部分
+type epubOPFInfo struct {
+	Version string `xml:"version,attr"`
+	Metas   []struct {
+		Name    string `xml:"name,attr"`
+		Content string `xml:"content,attr"`
+	} `xml:"metadata>meta"`
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+}
+
+var (
+	opfMetadataPattern = regexp.MustCompile(`(?s)(<(?:[\w.-]+:)?metadata\b[^>]*>)(.*?)(</(?:[\w.-]+:)?metadata\s*>)`)
+	opfDCPrefixPattern = regexp.MustCompile(`xmlns:([\w.-]+)\s*=\s*["']http://purl\.org/dc/elements/1\.1/["']`)
+	opfManifestEnd     = regexp.MustCompile(`</(?:[\w.-]+:)?manifest\s*>`)
+	opfModifiedPattern = regexp.MustCompile(`(?s)(<(?:[\w.-]+:)?meta\b[^>]*property\s*=\s*["']dcterms:modified["'][^>]*>).*?(</(?:[\w.-]+:)?meta\s*>)`)
+	xmlIDAttrPattern   = regexp.MustCompile(`\bid\s*=\s*["']([^"']*)["']`)
+)
+
+func escapeXMLText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// dcElementPattern 匹配元数据中的 Dublin Core 元素，包括自闭合的写法
+func dcElementPattern(prefix, name string) *regexp.Regexp {
+	tag := regexp.QuoteMeta(prefix + ":" + name)
+	return regexp.MustCompile(`(?s)<` + tag + `\b([^>]*?)(?:/>|>(.*?)</` + tag + `\s*>)`)
+}
+
+// setDCElement 把第一个同名元素的内容替换为 value，保留其属性；没有时追加。
+// single 为 true 时删除其余同名元素以及引用它们的 refines 元数据
+func setDCElement(metadata, prefix, name, value string, single bool) string {
+	re := dcElementPattern(prefix, name)
+	matches := re.FindAllStringSubmatchIndex(metadata, -1)
+	element := func(attrs string) string {
+		return "<" + prefix + ":" + name + attrs + ">" + escapeXMLText(value) + "</" + prefix + ":" + name + ">"
+	}
+	if len(matches) == 0 {
+		return appendXMLElement(metadata, element(""))
+	}
+
+	var b strings.Builder
+	var removedIDs []string
+	last := 0
+	for i, m := range matches {
+		b.WriteString(metadata[last:m[0]])
+		attrs := metadata[m[2]:m[3]]
+		switch {
+		case i == 0:
+			b.WriteString(element(attrs))
+		case single:
+			if id := xmlIDAttrPattern.FindStringSubmatch(attrs); id != nil {
+				removedIDs = append(removedIDs, id[1])
+			}
+		default:
+			b.WriteString(metadata[m[0]:m[1]])
+		}
+		last = m[1]
+	}
+	b.WriteString(metadata[last:])
+	result := b.String()
+	for _, id := range removedIDs {
+		refines := regexp.MustCompile(`(?s)\s*<(?:[\w.-]+:)?meta\b[^>]*refines\s*=\s*["']#` + regexp.QuoteMeta(id) + `["'][^>]*?(?:/>|>.*?</(?:[\w.-]+:)?meta\s*>)`)
+		result = refines.ReplaceAllString(result, "")
+	}
+	return result
+}
+
+// addISBNIdentifier 在没有相同 ISBN 的标识符时添加一个 urn:isbn 标识符
+func addISBNIdentifier(metadata, prefix, isbn string) string {
+	for _, m := range dcElementPattern(prefix, "identifier").FindAllStringSubmatch(metadata, -1) {
+		value := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(m[2])), "urn:isbn:")
+		if normalizeISBN(value) == isbn {
+			return metadata
+		}
+	}
+	return appendXMLElement(metadata, "<"+prefix+":identifier>urn:isbn:"+isbn+"</"+prefix+":identifier>")
+}
+
+// appendXMLElement 在元素内容末尾追加子元素，保留原有的结尾空白
+func appendXMLElement(content, element string) string {
+	body := strings.TrimRight(content, " \t\r\n")
+	return body + "\n    " + element + content[len(body):]
+}
+
+// setManifestAttr 修改 manifest 中指定 ID 的条目的属性，属性不存在时添加
+func setManifestAttr(opf, id, attr, value string) string {
+	item := regexp.MustCompile(`<(?:[\w.-]+:)?item\b[^>]*\bid\s*=\s*["']` + regexp.QuoteMeta(id) + `["'][^>]*>`)
+	return item.ReplaceAllStringFunc(opf, func(tag string) string {
+		return setTagAttr(tag, attr, value)
+	})
+}
+
+// setTagAttr 修改开始标签中的属性，属性不存在时添加
+func setTagAttr(tag, attr, value string) string {
+	attrPattern := regexp.MustCompile(`\s` + regexp.QuoteMeta(attr) + `\s*=\s*["'][^"']*["']`)
+	if attrPattern.MatchString(tag) {
+		return attrPattern.ReplaceAllString(tag, ` `+attr+`="`+value+`"`)
+	}
+	end := strings.LastIndex(tag, "/>")
+	if end < 0 {
+		end = len(tag) - 1
+	}
+	return tag[:end] + ` ` + attr + `="` + value + `"` + tag[end:]
+}
+
+// coverExtension 按图片类型返回封面的扩展名
+func coverExtension(mediaType string) string {
+	switch mediaType {
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	}
+	return ".jpg"
+}
+
+// rewriteEpubMetadata 在原文件上改写 OPF 元数据和封面，其余条目原样复制，
+// 写入临时文件后替换原文件
+func rewriteEpubMetadata(p string, edit epubMetadataEdit) error {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	opfPath, err := epubOPFPath(&zr.Reader)
+	if err != nil {
+		return err
+	}
+	data, err := readZipFile(&zr.Reader, opfPath)
+	if err != nil {
+		return err
+	}
+	var info epubOPFInfo
+	if err := xml.Unmarshal(data, &info); err != nil {
+		return fmt.Errorf("parse %s: %w", opfPath, err)
+	}
+	opf := string(data)
+	if !opfMetadataPattern.MatchString(opf) {
+		return fmt.Errorf("%s has no metadata element", opfPath)
+	}
+
+	prefix := "dc"
+	if m := opfDCPrefixPattern.FindStringSubmatch(opf); m != nil {
+		prefix = m[1]
+	}
+	epub3 := strings.HasPrefix(info.Version, "3")
+
+	// 封面：优先 EPUB 3 的 cover-image 属性，其次 EPUB 2 的 <meta name="cover">
+	replaced := map[string][]byte{}
+	coverMeta := ""
+	if len(edit.Cover) > 0 {
+		mediaType := http.DetectContentType(edit.Cover)
+		if !strings.HasPrefix(mediaType, "image/") {
+			return fmt.Errorf("cover is not an image")
+		}
+		coverID := ""
+		for _, item := range info.Manifest {
+			if strings.Contains(" "+item.Properties+" ", " cover-image ") {
+				coverID = item.ID
+			}
+		}
+		if coverID == "" {
+			for _, meta := range info.Metas {
+				if meta.Name == "cover" {
+					coverID = meta.Content
+				}
+			}
+		}
+		coverHref := ""
+		for _, item := range info.Manifest {
+			if item.ID == coverID && strings.HasPrefix(item.MediaType, "image/") {
+				coverHref = item.Href
+				if item.MediaType != mediaType {
+					opf = setManifestAttr(opf, coverID, "media-type", mediaType)
+				}
+			}
+		}
+		if coverHref != "" {
+			href, err := url.PathUnescape(coverHref)
+			if err != nil {
+				href = coverHref
+			}
+			full := path.Join(path.Dir(opfPath), href)
+			if f := findZipEntry(&zr.Reader, full); f != nil {
+				full = f.Name
+			}
+			replaced[full] = edit.Cover
+		} else {
+			ids := map[string]bool{}
+			for _, item := range info.Manifest {
+				ids[item.ID] = true
+			}
+			coverID = "cover-image"
+			for i := 2; ids[coverID]; i++ {
+				coverID = fmt.Sprintf("cover-image-%d", i)
+			}
+			coverHref = "cover" + coverExtension(mediaType)
+			for i := 2; findZipEntry(&zr.Reader, path.Join(path.Dir(opfPath), coverHref)) != nil; i++ {
+				coverHref = fmt.Sprintf("cover-%d%s", i, coverExtension(mediaType))
+			}
+			item := `<item id="` + coverID + `" href="` + coverHref + `" media-type="` + mediaType + `"`
+			if epub3 {
+				item += ` properties="cover-image"`
+			}
+			loc := opfManifestEnd.FindStringIndex(opf)
+			if loc == nil {
+				return fmt.Errorf("%s has no manifest element", opfPath)
+			}
+			opf = appendXMLElement(opf[:loc[0]], item+"/>") + opf[loc[0]:]
+			coverMeta = `<meta name="cover" content="` + coverID + `"/>`
+			replaced[path.Join(path.Dir(opfPath), coverHref)] = edit.Cover
+		}
+	}
+
+	opf = opfMetadataPattern.ReplaceAllStringFunc(opf, func(block string) string {
+		m := opfMetadataPattern.FindStringSubmatch(block)
+		open, metadata, end := m[1], m[2], m[3]
+		if !strings.Contains(open+opf[:strings.Index(opf, open)], "http://purl.org/dc/elements/1.1/") {
+			open = strings.TrimSuffix(open, ">") + ` xmlns:` + prefix + `="http://purl.org/dc/elements/1.1/">`
+		}
+		if edit.Title != "" {
+			metadata = setDCElement(metadata, prefix, "title", edit.Title, false)
+		}
+		if edit.Author != "" {
+			metadata = setDCElement(metadata, prefix, "creator", edit.Author, true)
+		}
+		if edit.Publisher != "" {
+			metadata = setDCElement(metadata, prefix, "publisher", edit.Publisher, true)
+		}
+		if edit.Description != "" {
+			metadata = setDCElement(metadata, prefix, "description", edit.Description, true)
+		}
+		if isbn := normalizeISBN(edit.ISBN); isbn != "" {
+			metadata = addISBNIdentifier(metadata, prefix, isbn)
+		}
+		if coverMeta != "" {
+			metadata = appendXMLElement(metadata, coverMeta)
+		}
+		// EPUB 3 要求修改后更新 dcterms:modified
+		if epub3 {
+			modified := time.Now().UTC().Format("2006-01-02T15:04:05Z")
+			if opfModifiedPattern.MatchString(metadata) {
+				metadata = opfModifiedPattern.ReplaceAllString(metadata, "${1}"+modified+"${2}")
+			} else {
+				metadata = appendXMLElement(metadata, `<meta property="dcterms:modified">`+modified+"</meta>")
+			}
+		}
+		return open + metadata + end
+	})
+
+	replaced[opfPath] = []byte(opf)
+	return replaceEpubArchive(p, zr, replaced)
+}
+
+// writeEpubArchive 重新打包 EPUB：mimetype 放在最前且不压缩，files 中的条目替换为新内容，
+// 值为 nil 的条目被删除，归档中没有的条目按名称顺序追加到末尾，其余条目原样复制
+func writeEpubArchive(w io.Writer, zr *zip.Reader, files map[string][]byte) error {
+	zw := zip.NewWriter(w)
+	if err := writeEpubMimetype(zw); err != nil {
+		return err
+	}
+	written := map[string]bool{"mimetype": true}
+	for _, f := range zr.File {
+		if written[f.Name] {
+			continue
+		}
+		written[f.Name] = true
+		data, ok := files[f.Name]
+		switch {
+		case !ok:
+			if err := zw.Copy(f); err != nil {
+				return err
+			}
+		case data != nil:
+			if err := writeZipEntry(zw, f.FileHeader, data); err != nil {
+				return err
+			}
+		}
+	}
+	var added []string
+	for name, data := range files {
+		if !written[name] && data != nil {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		if err := writeZipEntry(zw, zip.FileHeader{Name: name}, files[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// replaceEpubArchive 把重新打包的 EPUB 写入临时文件后替换原文件，替换前关闭 zr
+func replaceEpubArchive(p string, zr *zip.ReadCloser, files map[string][]byte) error {
+	tmp := p + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = writeEpubArchive(out, &zr.Reader, files)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	zr.Close()
+	if err := os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// writeZipEntry 以原条目的名称和时间写入新内容
+func writeZipEntry(zw *zip.Writer, fh zip.FileHeader, data []byte) error {
+	header := &zip.FileHeader{Name: fh.Name, Method: zip.Deflate, Modified: fh.Modified}
+	if header.Modified.IsZero() {
+		header.Modified = time.Now()
+	}
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, bytes.NewReader(data))
+	return err
+}
+
+// decodeCoverDataURL 解析 data URL 形式的封面，其他形式返回 nil
+func decodeCoverDataURL(cover string) []byte {
+	rest, ok := strings.CutPrefix(cover, "data:")
+	if !ok {
+		return nil
+	}
+	meta, payload, ok := strings.Cut(rest, ",")
+	if !ok || !strings.HasSuffix(meta, ";base64") {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// epubCover 返回 EPUB 当前的封面图片，用于判断封面是否需要写回
+func epubCover(zr *zip.Reader) []byte {
+	opfPath, err := epubOPFPath(zr)
+	if err != nil {
+		return nil
+	}
+	data, err := readZipFile(zr, opfPath)
+	if err != nil {
+		return nil
+	}
+	var info epubOPFInfo
+	if err := xml.Unmarshal(data, &info); err != nil {
+		return nil
+	}
+	coverID := ""
+	for _, meta := range info.Metas {
+		if meta.Name == "cover" {
+			coverID = meta.Content
+		}
+	}
+	for _, item := range info.Manifest {
+		if strings.Contains(" "+item.Properties+" ", " cover-image ") || item.ID == coverID {
+			href, err := url.PathUnescape(item.Href)
+			if err != nil {
+				href = item.Href
+			}
+			cover, _ := readZipFile(zr, path.Join(path.Dir(opfPath), href))
+			return cover
+		}
+	}
+	return nil
+}
+
+// WriteEpubMetadata 把书库中的书名、作者、出版社、简介、ISBN 和封面写回 EPUB 文件。
+// upload 为 true 时再上传到百度网盘：已有网盘路径的覆盖原文件，否则按普通上传处理
+func (a *App) WriteEpubMetadata(ebookId string, upload bool) string {
+	book, ok := a.library.Book(ebookId)
+	if !ok {
+		return `{"error": "book not found"}`
+	}
+	if !strings.EqualFold(book.Format, "epub") {
+		return `{"error": "only epub books can be written"}`
+	}
+	localPath, err := a.store.Path(book.ID)
+	if err != nil {
+		return `{"error": "book file not found"}`
+	}
+
+	edit := epubMetadataEdit{
+		Title:       book.Title,
+		Publisher:   book.Publisher,
+		Description: book.Description,
+		ISBN:        book.ISBN,
+	}
+	if !isUnknownAuthor(book.Author) {
+		edit.Author = book.Author
+	}
+	if cover := decodeCoverDataURL(book.Cover); cover != nil {
+		if zr, err := zip.OpenReader(localPath); err == nil {
+			if !bytes.Equal(epubCover(&zr.Reader), cover) {
+				edit.Cover = cover
+			}
+			zr.Close()
+		}
+	}
+	if err := rewriteEpubMetadata(localPath, edit); err != nil {
+		log.Printf("[EPUB] 写入元数据失败: %s, %v", book.Title, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if info, err := os.Stat(localPath); err == nil {
+		book.Size = info.Size()
+		if err := a.library.PutBook(book); err != nil {
+			return jsonResult(map[string]string{"error": err.Error()})
+		}
+	}
+	log.Printf("[EPUB] 已写入元数据: %s", book.Title)
+
+	if !upload {
+		a.emit("library:changed")
+		return jsonResult(map[string]interface{}{"success": true, "size": book.Size})
+	}
+	// 没有网盘路径的书走普通的上传流程
+	if book.BaidupanPath == "" {
+		a.emit("library:changed")
+		return a.StorageUploadBook("baidupan", book.ID)
+	}
+	remotePath, err := a.overwriteBaiduBook(book, localPath)
+	if err != nil {
+		log.Printf("[EPUB] 上传到百度网盘失败: %s, %v", book.Title, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	a.emit("library:changed")
+	return jsonResult(map[string]string{"storage": "baidupan", "path": remotePath})
+}
+
+// overwriteBaiduBook 用本地文件覆盖书籍在百度网盘中的原文件，返回相对路径
+func (a *App) overwriteBaiduBook(book EbookMetadata, localPath string) (string, error) {
+	rel, ok := strings.CutPrefix(book.BaidupanPath, getBaiduPath("")+"/")
+	if !ok {
+		return "", fmt.Errorf("baidupan path outside app folder: %s", book.BaidupanPath)
+	}
+	storage, err := a.storageProvider("baidupan")
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return storage.Put(rel, f, UploadOverwrite, nil)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// 导出格式及对应的扩展名
+var exportFormats = map[string]string{
+	"markdown": ".md",
+	"html":     ".html",
+	"anki":     ".csv",
+}
+
+// annotationChapter 是按章节分组后的标注
+type annotationChapter struct {
+	Title       string
+	Annotations []Annotation
+}
+
+func groupAnnotationsByChapter(list []Annotation) []annotationChapter {
+	sortAnnotations(list)
+	var chapters []annotationChapter
+	for _, item := range list {
+		title := annotationChapterTitle(item)
+		if n := len(chapters); n > 0 && chapters[n-1].Title == title {
+			chapters[n-1].Annotations = append(chapters[n-1].Annotations, item)
+			continue
+		}
+		chapters = append(chapters, annotationChapter{Title: title, Annotations: []Annotation{item}})
+	}
+	return chapters
+}
+
+func annotationChapterTitle(item Annotation) string {
+	if item.ChapterTitle != "" {
+		return item.ChapterTitle
+	}
+	if item.Page > 0 {
+		return fmt.Sprintf("第 %d 页", item.Page)
+	}
+	return fmt.Sprintf("第 %d 章", item.ChapterIndex+1)
+}
+
+// annotationLink 生成打开书中对应位置的深链接，由 deeplink.go 处理
+func annotationLink(item Annotation) string {
+	return DeepLink{EbookID: item.EbookID, CFI: item.CFIRange, Page: item.Page}.String()
+}
+
+func yamlQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ").Replace(s) + `"`
+}
+
+// renderAnnotationsMarkdown 输出适合 Obsidian 的 Markdown：YAML 头信息、按章节的二级标题、
+// 引用块形式的高亮以及块 ID，便于在笔记中引用单条高亮
+func renderAnnotationsMarkdown(book EbookMetadata, list []Annotation) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "---\ntitle: %s\nauthor: %s\nsource: neat-reader\nbook-id: %s\nexported: %s\nhighlights: %d\n---\n\n",
+		yamlQuote(book.Title), yamlQuote(book.Author), book.ID, time.Now().Format("2006-01-02"), len(list))
+	fmt.Fprintf(&b, "# %s\n\n", book.Title)
+	if book.Author != "" {
+		fmt.Fprintf(&b, "作者：%s\n\n", book.Author)
+	}
+
+	for _, chapter := range groupAnnotationsByChapter(list) {
+		fmt.Fprintf(&b, "## %s\n\n", chapter.Title)
+		for _, item := range chapter.Annotations {
+			for _, line := range strings.Split(strings.TrimSpace(item.Text), "\n") {
+				fmt.Fprintf(&b, "> %s\n", line)
+			}
+			fmt.Fprintf(&b, "> — [跳转](%s) ^%s\n\n", annotationLink(item), item.ID[:min(8, len(item.ID))])
+			if note := strings.TrimSpace(item.Note); note != "" {
+				fmt.Fprintf(&b, "%s\n\n", note)
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+var annotationsHTMLTemplate = template.Must(template.New("annotations").Funcs(template.FuncMap{
+	"link": func(item Annotation) template.URL { return template.URL(annotationLink(item)) },
+	"css":  func(color string) template.CSS { return template.CSS(color) },
+	"date": func(ms int64) string { return time.UnixMilli(ms).Format("2006-01-02 15:04") },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Book.Title}} - 笔记</title>
+<style>
+body { max-width: 760px; margin: 40px auto; padding: 0 20px; font-family: -apple-system, "PingFang SC", "Microsoft YaHei", sans-serif; color: #333; line-height: 1.7; }
+h1 { margin-bottom: 4px; }
+.author { color: #888; margin-bottom: 32px; }
+h2 { border-bottom: 1px solid #eee; padding-bottom: 6px; margin-top: 40px; }
+blockquote { margin: 16px 0 4px; padding: 8px 16px; border-left: 4px solid; background: #fafafa; }
+.note { margin: 4px 0 0 20px; color: #555; }
+.meta { font-size: 12px; color: #aaa; margin-left: 20px; }
+.meta a { color: #aaa; }
+</style>
+</head>
+<body>
+<h1>{{.Book.Title}}</h1>
+{{if .Book.Author}}<div class="author">{{.Book.Author}}</div>{{end}}
+{{range .Chapters}}
+<h2>{{.Title}}</h2>
+{{range .Annotations}}
+<blockquote style="border-color: {{css .Color}}">{{.Text}}</blockquote>
+{{if .Note}}<p class="note">{{.Note}}</p>{{end}}
+<div class="meta">{{date .CreatedAt}} · <a href="{{link .}}">跳转</a></div>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+func renderAnnotationsHTML(book EbookMetadata, list []Annotation) ([]byte, error) {
+	var b bytes.Buffer
+	err := annotationsHTMLTemplate.Execute(&b, map[string]interface{}{
+		"Book":     book,
+		"Chapters": groupAnnotationsByChapter(list),
+	})
+	return b.Bytes(), err
+}
+
+// renderAnnotationsAnki 输出 Anki 可直接导入的 CSV：正面为高亮，背面为笔记和出处
+func renderAnnotationsAnki(book EbookMetadata, list []Annotation) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("#separator:Comma\n#html:true\n#tags column:3\n")
+
+	tag := "neat-reader::" + strings.Join(strings.Fields(book.Title), "_")
+	w := csv.NewWriter(&b)
+	sortAnnotations(list)
+	for _, item := range list {
+		back := template.HTMLEscapeString(item.Note)
+		source := template.HTMLEscapeString(fmt.Sprintf("%s · %s", book.Title, annotationChapterTitle(item)))
+		if back != "" {
+			back += "<br><br>"
+		}
+		back += "<small>" + source + "</small>"
+		front := strings.ReplaceAll(template.HTMLEscapeString(item.Text), "\n", "<br>")
+		if err := w.Write([]string{front, back, tag}); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+func (a *App) renderAnnotationsExport(ebookID, format string) (string, []byte, error) {
+	ext, ok := exportFormats[format]
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+	book, ok := a.library.Book(ebookID)
+	if !ok {
+		return "", nil, fmt.Errorf("book %s not found", ebookID)
+	}
+	list := a.bookAnnotations(ebookID)
+	if len(list) == 0 {
+		return "", nil, fmt.Errorf("book has no annotations")
+	}
+
+	var data []byte
+	var err error
+	switch format {
+	case "markdown":
+		data = renderAnnotationsMarkdown(book, list)
+	case "html":
+		data, err = renderAnnotationsHTML(book, list)
+	case "anki":
+		data, err = renderAnnotationsAnki(book, list)
+	}
+	return sanitizeFileName(book.Title) + ext, data, err
+}
+
+// sanitizeFileName 去掉文件名中各系统不允许的字符
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || r < 32 {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" {
+		name = "untitled"
+	}
+	return name
+}
+
+// ExportAnnotations 导出一本书的标注，format 为 markdown、html 或 anki，通过保存对话框写入文件
+func (a *App) ExportAnnotations(ebookId string, format string) string {
+	fileName, data, err := a.renderAnnotationsExport(ebookId, format)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+
+	path, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "导出笔记",
+		DefaultFilename: fileName,
+	})
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if path == "" {
+		return `{"path": ""}`
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		log.Printf("[Export] 写入导出文件失败: %v", err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	log.Printf("[Export] 笔记已导出: %s", path)
+	return jsonResult(map[string]string{"path": path})
+}
+
+// UploadAnnotationsExport 导出标注并上传到云端存储的 exports 目录
+func (a *App) UploadAnnotationsExport(ebookId string, format string) string {
+	fileName, data, err := a.renderAnnotationsExport(ebookId, format)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	storage, err := a.syncStorage()
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	relativePath := "exports/" + fileName
+	if err := writeRemoteFile(storage, relativePath, data); err != nil {
+		log.Printf("[Export] 上传导出文件失败: %v", err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(map[string]string{"path": relativePath})
+}
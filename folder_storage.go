@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FolderStorageConfig 对应前端 UserConfig.storage.folder，可以指向 Dropbox、Syncthing 等客户端同步的目录
+type FolderStorageConfig struct {
+	Path           string `json:"path"`
+	NamingStrategy string `json:"namingStrategy"`
+}
+
+func init() {
+	RegisterStorage("folder", func(a *App, config StorageConfig) (StorageProvider, error) {
+		if config.Folder == nil || config.Folder.Path == "" {
+			return nil, fmt.Errorf("folder: %w", errStorageNotConfigured)
+		}
+		return &FolderStorage{root: config.Folder.Path}, nil
+	})
+}
+
+// FolderStorage 把本地目录作为存储使用
+type FolderStorage struct {
+	root string
+}
+
+func (s *FolderStorage) Name() string {
+	return "folder"
+}
+
+// fullPath 把存储中的路径转换为本地路径。cleanRemotePath 只处理 “/” 分隔的 “..”，
+// Windows 上 “..\x” 会原样保留并被 filepath.Join 解析到根目录之外，这里统一拒绝
+func (s *FolderStorage) fullPath(p string) (string, error) {
+	root := filepath.Clean(s.root)
+	full := filepath.Join(root, filepath.FromSlash(cleanRemotePath(p)))
+	rel, err := filepath.Rel(root, full)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q is outside the storage folder: %w", p, os.ErrInvalid)
+	}
+	return full, nil
+}
+
+func (s *FolderStorage) remoteFile(p string, info os.FileInfo) RemoteFile {
+	f := RemoteFile{
+		Path:     cleanRemotePath(p),
+		Name:     info.Name(),
+		IsDir:    info.IsDir(),
+		Modified: info.ModTime().UnixMilli(),
+	}
+	if !f.IsDir {
+		f.Size = info.Size()
+	}
+	return f
+}
+
+func (s *FolderStorage) List(dir string) ([]RemoteFile, error) {
+	full, err := s.fullPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(full)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]RemoteFile, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, s.remoteFile(cleanRemotePath(dir)+"/"+entry.Name(), info))
+	}
+	return list, nil
+}
+
+func (s *FolderStorage) Stat(p string) (RemoteFile, error) {
+	full, err := s.fullPath(p)
+	if err != nil {
+		return RemoteFile{}, err
+	}
+	info, err := os.Stat(full)
+	if err != nil {
+		return RemoteFile{}, err
+	}
+	return s.remoteFile(p, info), nil
+}
+
+func (s *FolderStorage) Open(p string, offset, length int64) (io.ReadCloser, error) {
+	full, err := s.fullPath(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(full)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+// Put 先写入临时文件再重命名，避免其他同步客户端读到写了一半的文件
+func (s *FolderStorage) Put(p string, r io.ReadSeeker, policy UploadPolicy, progress ProgressFunc) (string, error) {
+	target := cleanRemotePath(p)
+	full, err := s.fullPath(target)
+	if err != nil {
+		return "", err
+	}
+	switch policy {
+	case UploadRename:
+		if target, err = freeRemoteName(s.Stat, target); err != nil {
+			return "", err
+		}
+		if full, err = s.fullPath(target); err != nil {
+			return "", err
+		}
+	case UploadFail:
+		if _, err := s.Stat(target); err == nil {
+			return "", fmt.Errorf("put %s: %w", p, os.ErrExist)
+		}
+	}
+	size, err := seekerSize(r)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(full), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, newProgressReader(r, size, progress)); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), full); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+func (s *FolderStorage) Mkdir(dir string) error {
+	full, err := s.fullPath(dir)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(full, 0755)
+}
+
+func (s *FolderStorage) Move(from, to string, overwrite bool) error {
+	source, err := s.fullPath(from)
+	if err != nil {
+		return err
+	}
+	target, err := s.fullPath(to)
+	if err != nil {
+		return err
+	}
+	if !overwrite {
+		if _, err := os.Stat(target); err == nil {
+			return fmt.Errorf("move %s: %w", from, os.ErrExist)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Rename(source, target)
+}
+
+func (s *FolderStorage) Delete(p string) error {
+	full, err := s.fullPath(p)
+	if err != nil {
+		return err
+	}
+	if full == filepath.Clean(s.root) {
+		return errors.New("refusing to delete storage root")
+	}
+	return os.RemoveAll(full)
+}
+
+// Quota 本地目录不统计空间
+func (s *FolderStorage) Quota() (StorageQuota, error) {
+	return StorageQuota{}, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestFolderStorageStaysInsideRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "storage")
+	s := &FolderStorage{root: root}
+
+	// “/” 分隔的 “..” 由 cleanRemotePath 限制在根目录内
+	target, err := s.Put("../../books/a.epub", strings.NewReader("abc"), UploadOverwrite, nil)
+	if err != nil || target != "books/a.epub" {
+		t.Fatalf("put = %q, %v", target, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "books", "a.epub")); err != nil {
+		t.Fatalf("file not written inside root: %v", err)
+	}
+
+	if runtime.GOOS != "windows" {
+		return
+	}
+	// Windows 上反斜杠也是分隔符，逃出根目录的路径必须被拒绝
+	outside := filepath.Join(dir, "outside.epub")
+	if err := os.WriteFile(outside, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{`..\outside.epub`, `books\..\..\outside.epub`} {
+		if _, err := s.Put(p, strings.NewReader("x"), UploadOverwrite, nil); !errors.Is(err, os.ErrInvalid) {
+			t.Fatalf("put %s: %v, want ErrInvalid", p, err)
+		}
+		if err := s.Move("books/a.epub", p, true); !errors.Is(err, os.ErrInvalid) {
+			t.Fatalf("move to %s: %v, want ErrInvalid", p, err)
+		}
+		if err := s.Delete(p); !errors.Is(err, os.ErrInvalid) {
+			t.Fatalf("delete %s: %v, want ErrInvalid", p, err)
+		}
+	}
+	if data, err := os.ReadFile(outside); err != nil || string(data) != "keep" {
+		t.Fatalf("file outside root changed: %q, %v", data, err)
+	}
+}
+
+func TestStorageListErrors(t *testing.T) {
+	app := newTestApp(t)
+	// 错误信息由 %q 格式化，结果仍应是合法的 JSON
+	for _, name := range []string{"", "missing"} {
+		var result struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(app.StorageList(name, "")), &result); err != nil {
+			t.Fatalf("storage %q: invalid result: %v", name, err)
+		}
+		if !strings.Contains(result.Error, `"`+name+`"`) {
+			t.Fatalf("storage %q: error = %q", name, result.Error)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// 书库目录在存储中的位置，百度网盘上即 /apps/Neat Reader/books
+	folderSyncRemoteDir = "books"
+	// 删除数量超过基线的该比例时暂停删除，防止误删整个目录
+	folderSyncMaxDeleteRatio = 0.2
+)
+
+// 文件夹同步的操作类型
+const (
+	FolderSyncUpload       = "upload"
+	FolderSyncDownload     = "download"
+	FolderSyncDeleteLocal  = "delete-local"
+	FolderSyncDeleteRemote = "delete-remote"
+	FolderSyncConflict     = "conflict"
+)
+
+// FolderSyncAction 是一次同步计划中的一项操作，执行失败时记录 error
+type FolderSyncAction struct {
+	Op     string `json:"op"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+	Error  string `json:"error,omitempty"`
+}
+
+// FolderSyncPlan 是对比本地目录和存储得到的操作列表。
+// DeletesBlocked 表示删除数量超过安全阈值，需要确认后强制执行
+type FolderSyncPlan struct {
+	LocalPath      string             `json:"localPath"`
+	Storage        string             `json:"storage"`
+	Actions        []FolderSyncAction `json:"actions"`
+	DeletesBlocked bool               `json:"deletesBlocked"`
+	DryRun         bool               `json:"dryRun"`
+	Failed         int                `json:"failed"`
+}
+
+// folderSyncEntry 是上次同步后两侧文件的状态，用于判断哪一侧发生了变化
+type folderSyncEntry struct {
+	LocalSize      int64  `json:"localSize"`
+	LocalModTime   int64  `json:"localModTime"`
+	LocalMD5       string `json:"localMd5"`
+	RemoteSize     int64  `json:"remoteSize"`
+	RemoteETag     string `json:"remoteEtag,omitempty"`
+	RemoteModified int64  `json:"remoteModified"`
+}
+
+type folderSyncLocal struct {
+	size    int64
+	modTime int64
+	md5     string
+}
+
+// FolderSync 让 storage.localPath 与存储中的 books 目录保持一致
+type FolderSync struct {
+	app  *App
+	path string
+	mu   sync.Mutex
+}
+
+func NewFolderSync(app *App, path string) *FolderSync {
+	return &FolderSync{app: app, path: path}
+}
+
+func (s *FolderSync) loadBase() map[string]folderSyncEntry {
+	base := map[string]folderSyncEntry{}
+	if err := readJSONFile(s.path, &base); err != nil && !os.IsNotExist(err) {
+		log.Printf("[FolderSync] 读取同步基线失败: %v", err)
+	}
+	return base
+}
+
+// Run 生成同步计划，dryRun 时只返回计划不执行；force 时忽略删除安全阈值
+func (s *FolderSync) Run(dryRun, force bool) (*FolderSyncPlan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config := s.app.settings.Config().Storage
+	if config.LocalPath == "" {
+		return nil, errors.New("storage.localPath is not configured")
+	}
+	storage, err := s.app.storageProvider(config.libraryStorageName())
+	if err != nil {
+		return nil, err
+	}
+	base := s.loadBase()
+	// 同步过的目录不存在时多半是改名或换了账号，不能当作书籍已全部删除
+	if _, err := os.Stat(config.LocalPath); os.IsNotExist(err) && len(base) > 0 {
+		return nil, fmt.Errorf("local folder %s does not exist", config.LocalPath)
+	}
+	if err := os.MkdirAll(config.LocalPath, 0o755); err != nil {
+		return nil, err
+	}
+	local, err := s.scanLocal(config.LocalPath, base)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := listRemoteBooks(storage, folderSyncRemoteDir)
+	if errors.Is(err, os.ErrNotExist) && len(base) == 0 {
+		remote, err = map[string]RemoteFile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list remote folder %s: %w", folderSyncRemoteDir, err)
+	}
+
+	plan := &FolderSyncPlan{LocalPath: config.LocalPath, Storage: storage.Name(), DryRun: dryRun}
+	plan.Actions = planFolderSync(storage.Name(), local, remote, base)
+	deletes := 0
+	for _, action := range plan.Actions {
+		if action.Op == FolderSyncDeleteLocal || action.Op == FolderSyncDeleteRemote {
+			deletes++
+		}
+	}
+	plan.DeletesBlocked = !force && deletes > 0 && float64(deletes) > folderSyncMaxDeleteRatio*float64(len(base))
+
+	// 更新不需要操作的文件的基线：两侧都已删除的清除，内容一致的记录当前状态
+	for rel, b := range base {
+		_, hasLocal := local[rel]
+		_, hasRemote := remote[rel]
+		if !hasLocal && !hasRemote {
+			delete(base, rel)
+		} else if l, ok := local[rel]; ok && l.md5 == b.LocalMD5 {
+			b.LocalSize, b.LocalModTime = l.size, l.modTime
+			base[rel] = b
+		}
+	}
+	for rel, l := range local {
+		if r, ok := remote[rel]; ok {
+			if _, known := base[rel]; !known && sameFolderSyncFile(storage.Name(), l, r) {
+				base[rel] = newFolderSyncEntry(l, r)
+			}
+		}
+	}
+	if dryRun {
+		return plan, nil
+	}
+
+	for i := range plan.Actions {
+		action := &plan.Actions[i]
+		if plan.DeletesBlocked && (action.Op == FolderSyncDeleteLocal || action.Op == FolderSyncDeleteRemote) {
+			continue
+		}
+		if err := s.apply(storage, config.LocalPath, action, local, remote, base); err != nil {
+			log.Printf("[FolderSync] %s %s 失败: %v", action.Op, action.Path, err)
+			action.Error = err.Error()
+			plan.Failed++
+		}
+	}
+	if err := writeJSONFile(s.path, base); err != nil {
+		return plan, err
+	}
+	log.Printf("[FolderSync] 同步完成: %d 项操作，%d 项失败", len(plan.Actions), plan.Failed)
+	return plan, nil
+}
+
+// scanLocal 列出本地目录中的书籍，大小和修改时间未变时沿用基线中的 MD5
+func (s *FolderSync) scanLocal(root string, base map[string]folderSyncEntry) (map[string]folderSyncLocal, error) {
+	files := map[string]folderSyncLocal{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != root {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !watchableFormat(p) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		f := folderSyncLocal{size: info.Size(), modTime: info.ModTime().UnixMilli()}
+		if b, ok := base[rel]; ok && b.LocalSize == f.size && b.LocalModTime == f.modTime {
+			f.md5 = b.LocalMD5
+		} else if f.md5, err = md5File(p); err != nil {
+			return err
+		}
+		files[rel] = f
+		return nil
+	})
+	return files, err
+}
+
+func md5File(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// listRemoteBooks 递归列出存储目录中的书籍，键为相对 dir 的路径。
+// dir 不存在时返回 os.ErrNotExist，遍历中途消失的子目录跳过
+func listRemoteBooks(storage StorageProvider, dir string) (map[string]RemoteFile, error) {
+	files := map[string]RemoteFile{}
+	var walk func(string) error
+	walk = func(d string) error {
+		list, err := storage.List(d)
+		if errors.Is(err, os.ErrNotExist) && d != dir {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, f := range list {
+			if strings.HasPrefix(f.Name, ".") {
+				continue
+			}
+			if f.IsDir {
+				if err := walk(f.Path); err != nil {
+					return err
+				}
+				continue
+			}
+			if watchableFormat(f.Name) {
+				files[strings.TrimPrefix(f.Path, dir+"/")] = f
+			}
+		}
+		return nil
+	}
+	return files, walk(dir)
+}
+
+// remoteMD5 返回可以当作 MD5 使用的 ETag。百度网盘列表中的 md5 对部分文件做过变换，只在相同时才可信
+func remoteMD5(f RemoteFile) string {
+	if len(f.ETag) != 32 {
+		return ""
+	}
+	if _, err := hex.DecodeString(f.ETag); err != nil {
+		return ""
+	}
+	return strings.ToLower(f.ETag)
+}
+
+// sameFolderSyncFile 判断没有基线时两侧文件是否相同
+func sameFolderSyncFile(storageName string, l folderSyncLocal, r RemoteFile) bool {
+	if l.size != r.Size {
+		return false
+	}
+	sum := remoteMD5(r)
+	if sum == "" || sum == l.md5 {
+		return true
+	}
+	return storageName == "baidupan"
+}
+
+func newFolderSyncEntry(l folderSyncLocal, r RemoteFile) folderSyncEntry {
+	return folderSyncEntry{
+		LocalSize:      l.size,
+		LocalModTime:   l.modTime,
+		LocalMD5:       l.md5,
+		RemoteSize:     r.Size,
+		RemoteETag:     r.ETag,
+		RemoteModified: r.Modified,
+	}
+}
+
+// planFolderSync 以上次同步的基线做三方比较，只有一侧变化时同步到另一侧，两侧都变化时记为冲突
+func planFolderSync(storageName string, local map[string]folderSyncLocal, remote map[string]RemoteFile, base map[string]folderSyncEntry) []FolderSyncAction {
+	paths := map[string]bool{}
+	for rel := range local {
+		paths[rel] = true
+	}
+	for rel := range remote {
+		paths[rel] = true
+	}
+	for rel := range base {
+		paths[rel] = true
+	}
+
+	var actions []FolderSyncAction
+	for rel := range paths {
+		l, hasLocal := local[rel]
+		r, hasRemote := remote[rel]
+		b, hasBase := base[rel]
+
+		localChanged := hasBase && hasLocal && l.md5 != b.LocalMD5
+		remoteChanged := hasBase && hasRemote && (r.Size != b.RemoteSize ||
+			(r.ETag != "" && r.ETag != b.RemoteETag) || (r.ETag == "" && r.Modified != b.RemoteModified))
+
+		switch {
+		case hasLocal && hasRemote && !hasBase:
+			if !sameFolderSyncFile(storageName, l, r) {
+				actions = append(actions, FolderSyncAction{Op: FolderSyncConflict, Path: rel, Size: l.size, Reason: "两侧都有同名文件且内容不同"})
+			}
+		case hasLocal && hasRemote:
+			switch {
+			case localChanged && remoteChanged:
+				actions = append(actions, FolderSyncAction{Op: FolderSyncConflict, Path: rel, Size: l.size, Reason: "两侧都修改了文件"})
+			case localChanged:
+				actions = append(actions, FolderSyncAction{Op: FolderSyncUpload, Path: rel, Size: l.size, Reason: "本地文件已修改"})
+			case remoteChanged:
+				actions = append(actions, FolderSyncAction{Op: FolderSyncDownload, Path: rel, Size: r.Size, Reason: "远端文件已修改"})
+			}
+		case hasLocal && !hasBase:
+			actions = append(actions, FolderSyncAction{Op: FolderSyncUpload, Path: rel, Size: l.size, Reason: "本地新增"})
+		case hasRemote && !hasBase:
+			actions = append(actions, FolderSyncAction{Op: FolderSyncDownload, Path: rel, Size: r.Size, Reason: "远端新增"})
+		case hasLocal:
+			// 远端已删除，本地修改过的文件重新上传而不是删除
+			if localChanged {
+				actions = append(actions, FolderSyncAction{Op: FolderSyncUpload, Path: rel, Size: l.size, Reason: "远端已删除但本地有修改"})
+			} else {
+				actions = append(actions, FolderSyncAction{Op: FolderSyncDeleteLocal, Path: rel, Size: l.size, Reason: "远端已删除"})
+			}
+		case hasRemote:
+			if remoteChanged {
+				actions = append(actions, FolderSyncAction{Op: FolderSyncDownload, Path: rel, Size: r.Size, Reason: "本地已删除但远端有修改"})
+			} else {
+				actions = append(actions, FolderSyncAction{Op: FolderSyncDeleteRemote, Path: rel, Size: r.Size, Reason: "本地已删除"})
+			}
+		}
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		if actions[i].Op != actions[j].Op {
+			return actions[i].Op < actions[j].Op
+		}
+		return actions[i].Path < actions[j].Path
+	})
+	return actions
+}
+
+// apply 执行单项操作并更新基线
+func (s *FolderSync) apply(storage StorageProvider, root string, action *FolderSyncAction, local map[string]folderSyncLocal, remote map[string]RemoteFile, base map[string]folderSyncEntry) error {
+	localPath := filepath.Join(root, filepath.FromSlash(action.Path))
+	remotePath := path.Join(folderSyncRemoteDir, action.Path)
+
+	switch action.Op {
+	case FolderSyncUpload:
+		f, err := os.Open(localPath)
+		if err != nil {
+			return err
+		}
+		_, err = storage.Put(remotePath, f, UploadOverwrite, nil)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		info, err := storage.Stat(remotePath)
+		if err != nil {
+			return err
+		}
+		base[action.Path] = newFolderSyncEntry(local[action.Path], info)
+	case FolderSyncDownload:
+		l, err := downloadToFile(storage, remotePath, localPath)
+		if err != nil {
+			return err
+		}
+		base[action.Path] = newFolderSyncEntry(l, remote[action.Path])
+	case FolderSyncDeleteLocal:
+		if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		delete(base, action.Path)
+	case FolderSyncDeleteRemote:
+		if err := storage.Delete(remotePath); err != nil {
+			return err
+		}
+		delete(base, action.Path)
+	}
+	return nil
+}
+
+// downloadToFile 先写入临时文件再重命名，返回写入后的本地文件状态
+func downloadToFile(storage StorageProvider, remotePath, localPath string) (folderSyncLocal, error) {
+	rc, err := storage.Open(remotePath, 0, -1)
+	if err != nil {
+		return folderSyncLocal{}, err
+	}
+	defer rc.Close()
+	if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+		return folderSyncLocal{}, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), ".download-*")
+	if err != nil {
+		return folderSyncLocal{}, err
+	}
+	defer os.Remove(tmp.Name())
+	h := md5.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), rc); err != nil {
+		tmp.Close()
+		return folderSyncLocal{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return folderSyncLocal{}, err
+	}
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		return folderSyncLocal{}, err
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return folderSyncLocal{}, err
+	}
+	return folderSyncLocal{size: info.Size(), modTime: info.ModTime().UnixMilli(), md5: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// PlanFolderSync 返回本地书库目录与存储 books 目录的同步计划，不做任何修改
+func (a *App) PlanFolderSync() string {
+	plan, err := a.folderSync.Run(true, false)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(plan)
+}
+
+// RunFolderSync 执行文件夹同步，force 为 true 时忽略删除安全阈值
+func (a *App) RunFolderSync(force bool) string {
+	plan, err := a.folderSync.Run(false, force)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(plan)
+}
@@ -27,9 +27,20 @@ export interface EbookMetadata {
   lastRead: number;
   totalChapters: number;
   readingProgress: number;
-  storageType: 'local' | 'synced' | 'baidupan';
+  storageType: 'local' | 'synced' | 'baidupan' | 'webdav' | 'folder' | 'alist' | 's3';
   baidupanPath?: string;
+  remotePath?: string; // 存储中的相对路径
+  remoteStorage?: string; // remotePath 所在的存储，缺省为 webdav
+  sourcePath?: string; // 从监视文件夹导入时的原始文件
+  missing?: boolean; // 原始文件已不在监视文件夹中
   categoryId?: string;
+  tags?: string[];
+  series?: string;
+  seriesIndex?: number; // 在系列中的序号
+  isbn?: string;
+  publisher?: string;
+  publishedDate?: string;
+  description?: string;
   addedAt: number;
 }
 
@@ -49,7 +60,9 @@ export interface ReadingProgress {
 // 定义用户配置类型
 export interface UserConfig {
   storage: {
-    default: 'local' | 'baidupan';
+    default: 'local' | 'baidupan' | 'webdav' | 'folder' | 'alist' | 's3';
+    sync?: string; // 同步数据使用的存储，缺省为 default
+    library?: string; // 上传书籍使用的存储，缺省为 default
     localPath: string;
     autoSync: boolean;
     syncInterval: number;
@@ -63,6 +76,35 @@ export interface UserConfig {
       appKey?: string;
       secretKey?: string;
     } | null;
+    webdav?: {
+      url: string;
+      username: string;
+      password: string;
+      rootPath: string;
+      namingStrategy: string; // 同 baidupan.namingStrategy
+    } | null;
+    folder?: {
+      path: string;
+      namingStrategy: string;
+    } | null;
+    alist?: {
+      url: string;
+      username: string;
+      password: string;
+      token?: string; // 可选的固定令牌，为空时用用户名密码登录
+      rootPath: string;
+      namingStrategy: string;
+    } | null;
+    s3?: {
+      endpoint: string; // 如 https://s3.us-east-1.amazonaws.com 或 MinIO 地址
+      region: string;
+      bucket: string;
+      accessKeyId: string;
+      secretAccessKey: string;
+      prefix: string;
+      virtualHostStyle?: boolean;
+      namingStrategy: string;
+    } | null;
   };
   reader: {
     fontSize: number;
@@ -74,6 +116,7 @@ export interface UserConfig {
     lineHeight: number;
     paragraphSpacing: number;
     autoSaveInterval: number;
+    chineseConversion?: string; // 阅读时的简繁转换方式，为空时显示原文
   };
   ui: {
     viewMode: 'grid' | 'list';
@@ -186,65 +229,25 @@ export const useEbookStore = defineStore('ebook', () => {
   const loadBooks = async () => {
     try {
       console.log('开始加载书籍列表...');
-      const savedBooks = await localforage.getItem<EbookMetadata[]>('books');
+      books.value = await wails.getBooks();
+      console.log('成功加载书籍列表，书籍数量:', books.value.length);
       
-      if (savedBooks) {
-        console.log('成功加载书籍列表，书籍数量:', savedBooks.length);
-        books.value = savedBooks;
-        
-        // 为EPUB书籍重新生成封面（并行处理）
-        await Promise.all(books.value.map(async (book) => {
-          if (book.cover && book.cover.startsWith('blob:')) {
-            console.log('清除失效的 blob 封面链接:', book.id);
-            book.cover = '';
-          }
-          
-          if (book.format === 'epub' && !book.cover) {
-            try {
-              console.log('为书籍重新生成封面:', book.id);
-              const fileContent = await localforage.getItem<ArrayBuffer>(`ebook_content_${book.id}`);
-              if (fileContent) {
-                const epubBook = ePub(fileContent as ArrayBuffer);
-                await new Promise((resolve, reject) => {
-                  epubBook.ready.then(resolve).catch(reject);
-                });
-                const coverUrl = await epubBook.coverUrl();
-                if (coverUrl) {
-                  if (coverUrl.startsWith('blob:')) {
-                    try {
-                      console.log('将重新生成的封面转换为 Base64');
-                      book.cover = await blobToBase64(coverUrl);
-                      console.log('封面重新生成并转换成功:', book.id);
-                      URL.revokeObjectURL(coverUrl);
-                    } catch (e) {
-                      console.warn('封面转换 Base64 失败:', e);
-                    }
-                  } else {
-                    book.cover = coverUrl;
-                    console.log('封面重新生成成功:', book.id);
-                  }
-                }
-              }
-            } catch (e) {
-              console.warn('封面重新生成失败:', book.id, e);
-            }
+      // 为缺少封面的 EPUB 书籍从后端文件重新生成封面（并行处理），生成后写回后端书库
+      await Promise.all(books.value.map(async (book) => {
+        if (book.format !== 'epub' || (book.cover && !book.cover.startsWith('blob:'))) {
+          return;
+        }
+        try {
+          console.log('为书籍重新生成封面:', book.id);
+          const { cover } = await readEpubMetadata(wails.bookURL(book.id));
+          if (cover) {
+            await updateBook(book.id, { cover });
+            console.log('封面重新生成成功:', book.id);
           }
-        }));
-        
-        // 验证加载的数据
-        if (books.value.length > 0) {
-          console.log('加载的书籍示例:', {
-            id: books.value[0].id,
-            title: books.value[0].title,
-            author: books.value[0].author,
-            cover: books.value[0].cover,
-            storageType: books.value[0].storageType
-          });
+        } catch (e) {
+          console.warn('封面重新生成失败:', book.id, e);
         }
-      } else {
-        console.log('未找到保存的书籍列表，初始化为空数组');
-        books.value = [];
-      }
+      }));
     } catch (error) {
       console.error('加载电子书列表失败:', error);
       if (error instanceof Error) {
@@ -256,82 +259,16 @@ export const useEbookStore = defineStore('ebook', () => {
     }
   };
 
-  const saveBooks = async () => {
-    try {
-      // 保存书籍列表，确保数据可序列化
-      const booksToSave = books.value.map(book => {
-        // 创建可序列化的书籍对象
-        const serializableBook: EbookMetadata = {
-          id: book.id,
-          title: book.title,
-          author: book.author,
-          cover: book.cover || '', // 确保封面字段存在，如果是blob URL会在加载时重新生成
-          path: book.path,
-          format: book.format,
-          size: book.size,
-          lastRead: book.lastRead,
-          totalChapters: book.totalChapters,
-          readingProgress: book.readingProgress,
-          storageType: book.storageType,
-          baidupanPath: book.baidupanPath,
-          categoryId: book.categoryId,
-          addedAt: book.addedAt
-        };
-        
-        return serializableBook;
-      });
-      
-      console.log('正在保存书籍列表，书籍数量:', booksToSave.length);
-      
-      await localforage.setItem('books', booksToSave);
-      console.log('书籍列表保存成功');
-    } catch (error) {
-      console.error('保存电子书列表失败:', error);
-      if (error instanceof Error) {
-        console.error('错误详情:', error.message);
-        console.error('错误堆栈:', error.stack);
-      }
-    }
-  };
-
-  // 加载分类列表
+  // 加载分类列表，后端没有分类时创建默认分类
   const loadCategories = async () => {
     try {
       console.log('开始加载分类列表...');
-      const savedCategories = await localforage.getItem<BookCategory[]>('categories');
-      
-      if (savedCategories && Array.isArray(savedCategories) && savedCategories.length > 0) {
-        console.log('成功加载分类列表，分类数量:', savedCategories.length);
-        // 确保数据是干净的纯对象
-        categories.value = savedCategories.map(category => ({
-          id: category.id || `category_${Date.now()}_${Math.random()}`,
-          name: category.name || '未命名',
-          color: category.color || '#999999',
-          bookIds: Array.isArray(category.bookIds) ? [...category.bookIds] : [],
-          createdAt: category.createdAt || Date.now(),
-          updatedAt: category.updatedAt || Date.now()
-        }));
-      } else {
-        console.log('未找到保存的分类列表或分类为空，创建默认分类');
-        categories.value = [];
-        // 直接设置默认分类，不调用addCategory以避免可能的递归问题
-        const defaultCategory: BookCategory = {
-          id: `category_default_${Date.now()}`,
-          name: '未分类',
-          color: '#999999',
-          bookIds: [],
-          createdAt: Date.now(),
-          updatedAt: Date.now()
-        };
-        categories.value.push(defaultCategory);
-        // 保存到本地存储
-        await localforage.setItem('categories', [defaultCategory]);
-        console.log('默认分类创建成功');
+      categories.value = await wails.getCategories();
+      if (categories.value.length > 0) {
+        console.log('成功加载分类列表，分类数量:', categories.value.length);
+        return;
       }
-    } catch (error) {
-      console.error('加载分类列表失败:', error);
-      // 出错时初始化为默认分类
-      categories.value = [];
+      console.log('未找到分类，创建默认分类');
       const defaultCategory: BookCategory = {
         id: `category_default_${Date.now()}`,
         name: '未分类',
@@ -340,52 +277,33 @@ export const useEbookStore = defineStore('ebook', () => {
         createdAt: Date.now(),
         updatedAt: Date.now()
       };
-      categories.value.push(defaultCategory);
-      try {
-        await localforage.setItem('categories', [defaultCategory]);
-      } catch (e) {
-        console.error('保存默认分类失败:', e);
-      }
+      categories.value = [defaultCategory];
+      await putCategory(defaultCategory);
+      console.log('默认分类创建成功');
+    } catch (error) {
+      console.error('加载分类列表失败:', error);
     }
   };
 
-  // 保存分类列表
-  const saveCategories = async () => {
-    try {
-      console.log('正在保存分类列表，分类数量:', categories.value.length);
-      console.log('分类列表内容:', JSON.stringify(categories.value));
-      
-      // 确保数据是可序列化的
-      const categoriesToSave = categories.value.map(category => ({
-        id: category.id,
-        name: category.name,
-        color: category.color,
-        bookIds: Array.isArray(category.bookIds) ? [...category.bookIds] : [],
-        createdAt: category.createdAt,
-        updatedAt: category.updatedAt
-      }));
-      
-      console.log('准备保存的分类数据:', JSON.stringify(categoriesToSave));
-      
-      await localforage.setItem('categories', categoriesToSave);
-      
-      // 验证保存是否成功
-      const savedData = await localforage.getItem('categories');
-      console.log('验证保存结果:', savedData);
-      
-      if (savedData && Array.isArray(savedData) && savedData.length === categoriesToSave.length) {
-        console.log('分类列表保存成功，验证通过');
-      } else {
-        console.error('分类列表保存验证失败');
-      }
-    } catch (error) {
-      console.error('保存分类列表失败:', error);
-      if (error instanceof Error) {
-        console.error('错误详情:', error.message);
-        console.error('错误堆栈:', error.stack);
-      }
-      throw error;
+  // 写入后端书库，后端返回错误时抛出
+  const writeLibrary = async (request: Promise<string>) => {
+    const data = JSON.parse(await request);
+    if (data.error) {
+      throw new Error(data.error);
     }
+    return data;
+  };
+
+  // 把单个分类写入后端，由后端记录变更时间用于三方合并
+  const putCategory = (category: BookCategory) => {
+    return writeLibrary(wails.putCategory({
+      id: category.id,
+      name: category.name,
+      color: category.color,
+      bookIds: Array.isArray(category.bookIds) ? [...category.bookIds] : [],
+      createdAt: category.createdAt,
+      updatedAt: category.updatedAt
+    }));
   };
 
   // 添加分类
@@ -409,7 +327,7 @@ export const useEbookStore = defineStore('ebook', () => {
       console.log('分类已添加到内存，当前分类数量:', categories.value.length);
       console.log('准备保存分类到本地存储...');
       
-      await saveCategories();
+      await putCategory(newCategory);
       
       console.log('分类添加成功:', newCategory.name);
       return newCategory;
@@ -433,7 +351,7 @@ export const useEbookStore = defineStore('ebook', () => {
           ...updates,
           updatedAt: Date.now()
         };
-        await saveCategories();
+        await putCategory(categories.value[index]);
         console.log('分类更新成功:', categories.value[index].name);
         return true;
       }
@@ -455,16 +373,12 @@ export const useEbookStore = defineStore('ebook', () => {
         const uncategorized = categories.value.find(cat => cat.name === '未分类');
         if (uncategorized) {
           for (const bookId of categories.value[index].bookIds) {
-            const bookIndex = books.value.findIndex(book => book.id === bookId);
-            if (bookIndex !== -1) {
-              books.value[bookIndex].categoryId = uncategorized.id;
-            }
+            await updateBook(bookId, { categoryId: uncategorized.id });
           }
-          await saveBooks();
         }
         
         categories.value.splice(index, 1);
-        await saveCategories();
+        await writeLibrary(wails.deleteCategory(categoryId));
         
         console.log('分类删除成功:', categoryName);
         return true;
@@ -488,21 +402,20 @@ export const useEbookStore = defineStore('ebook', () => {
           if (oldCategoryIndex !== -1) {
             categories.value[oldCategoryIndex].bookIds = categories.value[oldCategoryIndex].bookIds.filter(id => id !== bookId);
             categories.value[oldCategoryIndex].updatedAt = Date.now();
+            await putCategory(categories.value[oldCategoryIndex]);
           }
         }
         
         // 添加到新分类
-        books.value[bookIndex].categoryId = categoryId;
+        await updateBook(bookId, { categoryId });
         
         const categoryIndex = categories.value.findIndex(cat => cat.id === categoryId);
         if (categoryIndex !== -1 && !categories.value[categoryIndex].bookIds.includes(bookId)) {
           categories.value[categoryIndex].bookIds.push(bookId);
           categories.value[categoryIndex].updatedAt = Date.now();
+          await putCategory(categories.value[categoryIndex]);
         }
         
-        await saveBooks();
-        await saveCategories();
-        
         console.log('书籍添加到分类成功:', bookId, '->', categoryId);
         return true;
       }
@@ -525,13 +438,11 @@ export const useEbookStore = defineStore('ebook', () => {
         if (categoryIndex !== -1) {
           categories.value[categoryIndex].bookIds = categories.value[categoryIndex].bookIds.filter(id => id !== bookId);
           categories.value[categoryIndex].updatedAt = Date.now();
+          await putCategory(categories.value[categoryIndex]);
         }
         
         // 移除书籍的分类ID
-        books.value[bookIndex].categoryId = undefined;
-        
-        await saveBooks();
-        await saveCategories();
+        await updateBook(bookId, { categoryId: undefined });
         
         console.log('书籍从分类中移除成功:', bookId);
         return true;
@@ -632,8 +543,8 @@ export const useEbookStore = defineStore('ebook', () => {
       console.log('添加书籍到列表:', book.title);
       books.value.push(book);
       
-      // 立即保存到持久化存储
-      await saveBooks();
+      // 立即写入后端书库
+      await writeLibrary(wails.addBook(JSON.parse(JSON.stringify(book))));
       
       console.log('书籍添加并保存成功');
     } catch (error) {
@@ -646,11 +557,20 @@ export const useEbookStore = defineStore('ebook', () => {
     }
   };
 
+  // 只把修改的字段发给后端，不会用本地较旧的副本覆盖同步合并进来的其他字段
   const updateBook = async (bookId: string, updates: Partial<EbookMetadata>) => {
     const index = books.value.findIndex(book => book.id === bookId);
     if (index !== -1) {
       books.value[index] = { ...books.value[index], ...updates };
-      await saveBooks();
+      try {
+        const updated = await writeLibrary(wails.updateBook(bookId, updates));
+        const current = books.value.findIndex(book => book.id === bookId);
+        if (current !== -1) {
+          books.value[current] = { ...books.value[current], ...updated };
+        }
+      } catch (error) {
+        console.error('更新书籍失败:', bookId, error);
+      }
     }
   };
 
@@ -666,7 +586,9 @@ export const useEbookStore = defineStore('ebook', () => {
       books.value.splice(index, 1);
       
       // 3. 异步执行持久化清理，不阻塞 UI 响应
-      saveBooks(); 
+      writeLibrary(wails.deleteBook(bookId)).catch(error => {
+        console.error('从后端书库删除书籍失败:', bookId, error);
+      });
 
       if (actualStorageType === 'local') {
         localforage.removeItem(`ebook_content_${bookId}`);
@@ -704,10 +626,15 @@ export const useEbookStore = defineStore('ebook', () => {
     }
   };
 
-  const saveReadingProgress = async (progress: ReadingProgress) => {
+  // explicit 表示用户主动跳转（目录、进度条等），后端合并时允许进度后退
+  const saveReadingProgress = async (progress: ReadingProgress, explicit = false) => {
     try {
       readingProgress.value = progress;
       await localforage.setItem(`progress_${progress.ebookId}`, progress);
+      // 写入后端进度日志，由 Go 同步引擎定时上传
+      wails.saveReadingProgress(JSON.parse(JSON.stringify(progress)), explicit).catch(error => {
+        console.warn('写入后端阅读进度失败:', error);
+      });
       
       // 更新电子书的阅读进度
       await updateBook(progress.ebookId, {
@@ -752,11 +679,29 @@ export const useEbookStore = defineStore('ebook', () => {
       const serializableConfig = JSON.parse(JSON.stringify(userConfig.value));
       await localforage.setItem('userConfig', serializableConfig);
       await localforage.setItem('userConfigTimestamp', Date.now());
+      await wails.setUserConfig(serializableConfig);
     } catch (error) {
       console.error('保存用户配置失败:', error);
     }
   };
 
+  // 采用后端刷新得到的百度网盘令牌，只更新本地缓存；
+  // 百度的 refresh token 只能使用一次，继续使用本地的旧令牌会导致刷新失败
+  const applyBaidupanToken = async (token: any) => {
+    const current = userConfig.value.storage.baidupan;
+    if (!token?.accessToken || !current || (current.expiration || 0) >= (token.expiration || 0)) {
+      return;
+    }
+    userConfig.value.storage.baidupan = {
+      ...current,
+      accessToken: token.accessToken,
+      refreshToken: token.refreshToken,
+      expiration: token.expiration
+    };
+    await localforage.setItem('userConfig', JSON.parse(JSON.stringify(userConfig.value)));
+    console.log('已采用后端刷新的百度网盘令牌');
+  };
+
   const updateUserConfig = async (updates: Partial<UserConfig>, skipSync = false) => {
     userConfig.value = { ...userConfig.value, ...updates };
     await saveUserConfig();
@@ -1000,9 +945,15 @@ export const useEbookStore = defineStore('ebook', () => {
         throw new Error('百度网盘令牌无效，请先在设置中授权');
       }
       
-      // 从 IndexedDB 获取文件内容
-      console.log('尝试从 IndexedDB 获取文件内容，键名:', `ebook_content_${book.id}`);
-      const fileContent = await localforage.getItem<ArrayBuffer>(`ebook_content_${book.id}`);
+      // 优先读取后端保存的文件，旧版本导入的书籍只在 IndexedDB 中
+      let fileContent: ArrayBuffer | null = null;
+      const response = await fetch(wails.bookURL(book.id)).catch(() => null);
+      if (response?.ok) {
+        fileContent = await response.arrayBuffer();
+      } else {
+        console.log('尝试从 IndexedDB 获取文件内容，键名:', `ebook_content_${book.id}`);
+        fileContent = await localforage.getItem<ArrayBuffer>(`ebook_content_${book.id}`);
+      }
       if (!fileContent) {
         console.error('无法获取书籍文件内容');
         throw new Error('无法获取书籍文件内容，可能文件已损坏');
@@ -1410,14 +1361,13 @@ export const useEbookStore = defineStore('ebook', () => {
               addedAt: Date.now()
             };
             
-            books.value.push(newBook);
+            await addBook(newBook);
             console.log('添加云端书籍:', newBook.title);
           } else {
             console.log('跳过已存在的书籍:', title, '存储类型:', existingBook.storageType);
           }
         }
         
-        await saveBooks();
         console.log('百度网盘书籍加载完成，总数:', books.value.length);
       }
     } catch (error) {
@@ -1471,49 +1421,16 @@ export const useEbookStore = defineStore('ebook', () => {
       
       console.log('开始同步阅读进度，书籍总数:', books.value.length);
       
-      // 1. 上传书籍列表
-      const booksData = {
-        ebooks: books.value,
-        timestamp: Date.now(),
-        deviceId: deviceInfo.value.id,
-        deviceName: deviceInfo.value.name
-      };
-      const booksFile = new File([JSON.stringify(booksData)], 'books.json', { type: 'application/json' });
-      await uploadToBaidupanNew(booksFile, '/sync');
-      
-      // 2. 上传分类列表
-      const categoriesData = {
-        categories: categories.value,
-        timestamp: Date.now(),
-        deviceId: deviceInfo.value.id
-      };
-      const categoriesFile = new File([JSON.stringify(categoriesData)], 'categories.json', { type: 'application/json' });
-      await uploadToBaidupanNew(categoriesFile, '/sync');
-      console.log('分类列表已同步到百度网盘');
-      
-      // 3. 批量上传进度文件（每本书一个文件）
-      let syncedCount = 0;
-      const batchSize = 10; // 每批处理10本书
-      
-      for (let i = 0; i < books.value.length; i += batchSize) {
-        const batch = books.value.slice(i, i + batchSize);
-        const batchPromises = batch.map(async (book) => {
-          try {
-            const progress = await localforage.getItem<ReadingProgress>(`progress_${book.id}`);
-            if (progress) {
-              const progressFile = new File([JSON.stringify(progress)], `${book.id}.json`, { type: 'application/json' });
-              await uploadToBaidupanNew(progressFile, `/sync/progress`);
-              syncedCount++;
-            }
-          } catch (error) {
-            console.error(`同步书籍进度失败: ${book.id}`, error);
-          }
-        });
-        
-        await Promise.all(batchPromises);
+      // 书籍、分类和阅读进度在修改时已写入后端，由 Go 同步引擎三方合并后写入同步清单
+      const status = await wails.syncNow();
+      if (status.lastError) {
+        console.error('同步阅读进度失败:', status.lastError);
+        return false;
       }
+      await loadLibraryFromBackend();
+      const syncedCount = status.changed;
       
-      console.log(`同步阅读进度到百度网盘成功，同步了 ${syncedCount} 本书的进度`);
+      console.log(`同步阅读进度到百度网盘成功，合并了 ${syncedCount} 本书的进度`);
       return true;
     } catch (error) {
       console.error('同步阅读进度到百度网盘失败:', error);
@@ -1526,18 +1443,56 @@ export const useEbookStore = defineStore('ebook', () => {
     console.log('异步同步当前书籍进度到百度网盘:', ebookId);
     
     // 异步执行，不等待响应
-    (async () => {
-      try {
-        const progress = await localforage.getItem<ReadingProgress>(`progress_${ebookId}`);
-        if (progress) {
-          const progressFile = new File([JSON.stringify(progress)], `${ebookId}.json`, { type: 'application/json' });
-          await uploadToBaidupanNew(progressFile, `/sync/progress`);
-          console.log('当前书籍进度同步成功:', ebookId);
+    wails.syncNow().then(status => {
+      if (status.lastError) {
+        console.warn('同步当前书籍进度失败:', status.lastError);
+      } else {
+        console.log('当前书籍进度同步成功:', ebookId);
+      }
+    }).catch(error => {
+      console.warn('同步当前书籍进度失败:', error);
+    });
+  };
+
+  // 从后端读取合并后的书籍和分类列表
+  const loadLibraryFromBackend = async () => {
+    try {
+      const [mergedBooks, mergedCategories] = await Promise.all([
+        wails.getBooks(),
+        wails.getCategories()
+      ]);
+      const existing = new Map(books.value.map(book => [book.id, book]));
+      books.value = mergedBooks.map(book => ({ ...existing.get(book.id), ...book }));
+      categories.value = mergedCategories;
+      console.log('已加载合并后的书库，书籍总数:', books.value.length, '分类总数:', categories.value.length);
+    } catch (error) {
+      console.error('加载合并后的书库失败:', error);
+    }
+  };
+
+  // 从后端文件存储重新读取书籍文件，替换 IndexedDB 中的副本
+  const cacheBookContent = async (ebookId: string) => {
+    const response = await fetch(wails.bookURL(ebookId));
+    if (!response.ok) {
+      throw new Error(`读取书籍文件失败: HTTP ${response.status}`);
+    }
+    await localforage.setItem(`ebook_content_${ebookId}`, await response.arrayBuffer());
+  };
+
+  // 同步引擎合并了远端进度后更新本地进度缓存
+  const loadProgressFromBackend = async (ebookIds: string[]) => {
+    try {
+      for (const ebookId of ebookIds || []) {
+        const progress = await wails.getReadingProgress(ebookId);
+        if (!progress) continue;
+        await localforage.setItem(`progress_${ebookId}`, progress);
+        if (ebookId === readingProgress.value?.ebookId) {
+          readingProgress.value = progress;
         }
-      } catch (error) {
-        console.warn('同步当前书籍进度失败:', error);
       }
-    })();
+    } catch (error) {
+      console.error('加载合并后的阅读进度失败:', error);
+    }
   };
 
   // 从百度网盘同步阅读进度
@@ -1551,48 +1506,24 @@ export const useEbookStore = defineStore('ebook', () => {
       
       console.log('开始从百度网盘同步阅读进度');
       
-      // 1. 下载书籍列表
-      const booksBlob = await downloadBlobFromBaidupan('/sync/books.json');
-      if (booksBlob) {
-        const booksText = await booksBlob.text();
-        const booksData = JSON.parse(booksText);
-        if (booksData.ebooks) {
-          books.value = booksData.ebooks;
-          await saveBooks();
-          console.log('同步书籍列表成功，书籍总数:', books.value.length);
-        }
-      }
-      
-      // 2. 下载分类列表
-      const categoriesBlob = await downloadBlobFromBaidupan('/sync/categories.json');
-      if (categoriesBlob) {
-        const categoriesText = await categoriesBlob.text();
-        const categoriesData = JSON.parse(categoriesText);
-        if (categoriesData.categories) {
-          categories.value = categoriesData.categories;
-          await saveCategories();
-          console.log('同步分类列表成功，分类总数:', categories.value.length);
-        }
+      // 1. 通过 Go 同步引擎合并书库和进度，再写回本地缓存
+      const status = await wails.syncNow();
+      if (status.lastError) {
+        console.error('同步阅读进度失败:', status.lastError);
       }
-      
-      // 3. 下载并同步每本书的进度
+      await loadLibraryFromBackend();
+      const allProgress = await wails.getAllReadingProgress();
       let syncedCount = 0;
       
       for (const book of books.value) {
-        try {
-          const progressBlob = await downloadBlobFromBaidupan(`/sync/progress/${book.id}.json`);
-          if (progressBlob) {
-            const progressText = await progressBlob.text();
-            const progress = JSON.parse(progressText);
-            await localforage.setItem(`progress_${book.id}`, progress);
-            // 如果是当前书籍，更新内存中的进度
-            if (book.id === readingProgress.value?.ebookId) {
-              readingProgress.value = progress;
-            }
-            syncedCount++;
+        const progress = allProgress[book.id];
+        if (progress) {
+          await localforage.setItem(`progress_${book.id}`, progress);
+          // 如果是当前书籍，更新内存中的进度
+          if (book.id === readingProgress.value?.ebookId) {
+            readingProgress.value = progress;
           }
-        } catch (error) {
-          console.error(`同步书籍进度失败: ${book.id}`, error);
+          syncedCount++;
         }
       }
       
@@ -1604,230 +1535,228 @@ export const useEbookStore = defineStore('ebook', () => {
     }
   };
 
-  // 导入 EPUB 文件
-  const importEpubFile = async (file: File): Promise<EbookMetadata | null> => {
+  // 读取 EPUB 的标题、作者和封面，source 为后端的书籍地址或文件内容
+  const readEpubMetadata = async (source: string | ArrayBuffer) => {
+    const info: { title?: string; author?: string; cover?: string } = {};
+    const book = typeof source === 'string' ? ePub(source, { openAs: 'epub' }) : ePub(source);
     try {
-      console.log('开始导入 EPUB 文件:', file.name);
-      
-      // 生成唯一 ID
-      const id = `epub_${uuidv4()}`;
+      // 等待书籍加载完成
+      await new Promise((resolve, reject) => {
+        book.ready.then(resolve).catch(reject);
+      });
       
-      // 将文件转换为 ArrayBuffer
-      const arrayBuffer = await file.arrayBuffer();
+      // 提取书籍元数据
+      const metadata = await book.loaded.metadata;
+      console.log('EPUB 元数据:', metadata);
       
-      // 保存文件内容到 IndexedDB
-      console.log('保存文件内容到 IndexedDB，键名:', `ebook_content_${id}`);
-      await localforage.setItem(`ebook_content_${id}`, arrayBuffer);
+      // 提取作者
+      if (metadata.creator) {
+        if (Array.isArray(metadata.creator)) {
+          info.author = metadata.creator.join(', ');
+        } else {
+          info.author = metadata.creator;
+        }
+      }
       
-      // 提取元数据（封面、作者、标题等）
-      let coverData = '';
-      let authorData = '未知作者';
-      let titleData = file.name.replace('.epub', '');
+      // 提取标题
+      if (metadata.title) {
+        info.title = metadata.title;
+      }
       
-      try {
-        const book = ePub(arrayBuffer as ArrayBuffer);
-        // 等待书籍加载完成
-        await new Promise((resolve, reject) => {
-          book.ready.then(resolve).catch(reject);
-        });
-        
-        // 提取书籍元数据
-        const metadata = await book.loaded.metadata;
-        console.log('EPUB 元数据:', metadata);
-        
-        // 提取作者
-        if (metadata.creator) {
-          if (Array.isArray(metadata.creator)) {
-            authorData = metadata.creator.join(', ');
-          } else {
-            authorData = metadata.creator;
-          }
-        }
-        
-        // 提取标题
-        if (metadata.title) {
-          titleData = metadata.title;
-        }
-        
-        // 获取封面 URL
-        const coverUrl = await book.coverUrl();
-        console.log('封面 URL:', coverUrl);
-        if (coverUrl) {
-          // 如果是 blob URL，转换为 Base64 持久化存储
-          if (typeof coverUrl === 'string' && coverUrl.startsWith('blob:')) {
-            try {
-              console.log('将 Blob URL 转换为 Base64');
-              coverData = await blobToBase64(coverUrl);
-              console.log('封面转换成功，Base64 长度:', coverData.length);
-              // 释放原有的 Blob 内存
-              URL.revokeObjectURL(coverUrl);
-            } catch (e) {
-              console.warn('封面转换 Base64 失败:', e);
-              coverData = '';
-            }
-          } else {
-            // 对于相对路径或其他格式，直接使用
-            coverData = coverUrl;
+      // 获取封面 URL
+      const coverUrl = await book.coverUrl();
+      console.log('封面 URL:', coverUrl);
+      if (coverUrl) {
+        // 如果是 blob URL，转换为 Base64 持久化存储
+        if (typeof coverUrl === 'string' && coverUrl.startsWith('blob:')) {
+          try {
+            console.log('将 Blob URL 转换为 Base64');
+            info.cover = await blobToBase64(coverUrl);
+            console.log('封面转换成功，Base64 长度:', info.cover.length);
+            // 释放原有的 Blob 内存
+            URL.revokeObjectURL(coverUrl);
+          } catch (e) {
+            console.warn('封面转换 Base64 失败:', e);
           }
+        } else {
+          // 对于相对路径或其他格式，直接使用
+          info.cover = coverUrl;
         }
-      } catch (e) {
-        console.warn('元数据提取失败:', e);
+      }
+    } catch (e) {
+      console.warn('元数据提取失败:', e);
+    } finally {
+      book.destroy();
+    }
+    return info;
+  };
+
+  // 导入电子书文件：由后端按路径读取、检查并保存文件，前端只读取元数据，
+  // 阅读器通过 bookURL 读取保存后的文件
+  const importEbookPath = async (filePath: string): Promise<EbookMetadata | null> => {
+    try {
+      const fileName = filePath.split(/[\\/]/).pop() || filePath;
+      const format = fileName.split('.').pop()?.toLowerCase() || '';
+      if (!['epub', 'pdf', 'txt'].includes(format)) {
+        console.error('不支持的文件格式:', format);
+        throw new Error(`不支持的文件格式: ${format}`);
+      }
+      console.log('开始导入电子书文件:', filePath);
+      
+      // 生成唯一 ID
+      const id = `${format}_${uuidv4()}`;
+      
+      // 先由后端检查并修复，结构损坏的 EPUB 会让 epubjs 崩溃
+      const stored = JSON.parse(await wails.storeBookFile(id, filePath));
+      if (stored.error) {
+        throw new Error(stored.error);
       }
       
       // 创建电子书元数据
       const ebookMetadata: EbookMetadata = {
         id,
-        title: titleData,
-        author: authorData,
-        cover: coverData,
+        title: fileName.slice(0, -(format.length + 1)),
+        author: '未知作者',
+        cover: '',
         path: id, // 使用 ID 作为路径，后续通过 ID 获取文件内容
-        format: 'epub',
-        size: file.size,
+        format,
+        size: stored.size,
         lastRead: Date.now(),
-        totalChapters: 0,
+        totalChapters: format === 'txt' ? 1 : 0,
         readingProgress: 0,
         storageType: 'local',
         addedAt: Date.now()
       };
+      if (format === 'epub') {
+        const info = await readEpubMetadata(wails.bookURL(id));
+        ebookMetadata.title = info.title || ebookMetadata.title;
+        ebookMetadata.author = info.author || ebookMetadata.author;
+        ebookMetadata.cover = info.cover || '';
+      }
       
       console.log('创建电子书元数据:', {
         id: ebookMetadata.id,
         title: ebookMetadata.title,
         author: ebookMetadata.author,
-        cover: ebookMetadata.cover,
+        format: ebookMetadata.format,
         storageType: ebookMetadata.storageType
       });
       
-      // 保存到本地存储
-      await addBook(ebookMetadata);
+      // 写入书库，失败时删除已保存的文件
+      try {
+        await addBook(ebookMetadata);
+      } catch (error) {
+        books.value = books.value.filter(book => book.id !== id);
+        wails.removeStoredBook(id);
+        throw error;
+      }
       
-      console.log('EPUB 文件导入成功');
+      console.log('电子书文件导入成功');
       return ebookMetadata;
     } catch (error) {
-      console.error('导入 EPUB 文件失败:', error);
+      console.error('导入电子书文件失败:', error);
       if (error instanceof Error) {
         console.error('错误详情:', error.message);
         console.error('错误堆栈:', error.stack);
       }
       return null;
     }
-  }
-
-  // 导入 PDF 文件
-  const importPdfFile = async (file: File): Promise<EbookMetadata | null> => {
-    try {
-      // 生成唯一 ID
-      const id = `pdf_${uuidv4()}`;
-      
-      // 将文件转换为 ArrayBuffer
-      const arrayBuffer = await file.arrayBuffer();
-      
-      // 保存文件内容到 IndexedDB
-      await localforage.setItem(`ebook_content_${id}`, arrayBuffer);
-      
-      // 创建电子书元数据
-      const ebookMetadata: EbookMetadata = {
-        id,
-        title: file.name.replace('.pdf', ''),
-        author: '未知作者',
-        cover: '',
-        path: id, // 使用 ID 作为路径，后续通过 ID 获取文件内容
-        format: 'pdf',
-        size: file.size,
-        lastRead: Date.now(),
-        totalChapters: 0,
-        readingProgress: 0,
-        storageType: 'local',
-        addedAt: Date.now()
-      };
-      
-      // 保存到本地存储
-      await addBook(ebookMetadata);
-      
-      return ebookMetadata;
-    } catch (error) {
-      console.error('导入 PDF 文件失败:', error);
-      return null;
-    }
-  }
+  };
 
-  // 导入 TXT 文件
-  const importTxtFile = async (file: File): Promise<EbookMetadata | null> => {
-    try {
-      // 生成唯一 ID
-      const id = `txt_${uuidv4()}`;
-      
-      // 将文件转换为 ArrayBuffer
-      const arrayBuffer = await file.arrayBuffer();
-      
-      // 保存文件内容到 IndexedDB
-      await localforage.setItem(`ebook_content_${id}`, arrayBuffer);
-      
-      // 创建电子书元数据
-      const ebookMetadata: EbookMetadata = {
-        id,
-        title: file.name.replace('.txt', ''),
-        author: '未知作者',
-        cover: '',
-        path: id, // 使用 ID 作为路径，后续通过 ID 获取文件内容
-        format: 'txt',
-        size: file.size,
-        lastRead: Date.now(),
-        totalChapters: 1,
-        readingProgress: 0,
-        storageType: 'local',
-        addedAt: Date.now()
-      };
-      
-      // 保存到本地存储
-      await addBook(ebookMetadata);
-      
-      return ebookMetadata;
-    } catch (error) {
-      console.error('导入 TXT 文件失败:', error);
-      return null;
+  // 一次性把 localforage 中的书籍、分类和阅读进度导入后端数据库，之后只从后端读取
+  const migrateLocalforageToBackend = async () => {
+    if (await localforage.getItem<boolean>('libraryMigrated')) {
+      return;
     }
-  }
-
-  // 导入电子书文件
-  const importEbookFile = async (file: File): Promise<EbookMetadata | null> => {
     try {
-      const fileExtension = file.name.split('.').pop()?.toLowerCase();
-      
-      if (!fileExtension) {
-        console.error('无法获取文件扩展名');
-        throw new Error('无法获取文件扩展名');
-      }
-      
-      switch (fileExtension) {
-        case 'epub':
-          return await importEpubFile(file);
-        case 'pdf':
-          return await importPdfFile(file);
-        case 'txt':
-          return await importTxtFile(file);
-        default:
-          console.error('不支持的文件格式:', fileExtension);
-          throw new Error(`不支持的文件格式: ${fileExtension}`);
+      const savedBooks = await localforage.getItem<EbookMetadata[]>('books') || [];
+      const savedCategories = await localforage.getItem<BookCategory[]>('categories') || [];
+      const progress: Record<string, ReadingProgress> = {};
+      await localforage.iterate<ReadingProgress, void>((value, key) => {
+        if (key.startsWith('progress_') && value) {
+          progress[key.slice('progress_'.length)] = value;
+        }
+      });
+      const result = JSON.parse(await wails.migrateLocalforage({
+        books: savedBooks,
+        categories: savedCategories,
+        progress
+      }));
+      if (result.error) {
+        throw new Error(result.error);
       }
+      await localforage.setItem('libraryMigrated', true);
+      await localforage.removeItem('books');
+      await localforage.removeItem('categories');
+      console.log('已把本地书库导入后端数据库:', result);
     } catch (error) {
-      console.error('导入电子书文件失败:', error);
-      if (error instanceof Error) {
-        console.error('错误详情:', error.message);
-        console.error('错误堆栈:', error.stack);
-      }
-      return null;
+      console.warn('导入本地书库到后端数据库失败:', error);
     }
   };
 
+  let unsubscribeLibraryEvents: Array<() => void> = [];
+
   // 初始化函数
   const initialize = async () => {
+    // 先把 localforage 中的旧书库导入后端数据库，书库以后端为准
+    await migrateLocalforageToBackend();
     await Promise.all([
       loadBooks(),
       loadUserConfig(),
       loadCategories()
     ]);
     
+    // 把配置交给后端同步引擎，并使用后端生成的设备信息；
+    // 后端在前端关闭期间可能刷新过令牌，先采用较新的令牌再推送配置
+    try {
+      const backendConfig = await wails.getUserConfig();
+      await applyBaidupanToken(backendConfig?.storage?.baidupan);
+      await wails.setUserConfig(JSON.parse(JSON.stringify(userConfig.value)));
+      deviceInfo.value = await wails.getDeviceInfo();
+    } catch (error) {
+      console.warn('初始化后端同步引擎失败:', error);
+    }
+
+    // 监视文件夹导入、移动书籍或同步引擎合并远端修改后重新加载书库和进度
+    if (unsubscribeLibraryEvents.length === 0) {
+      unsubscribeLibraryEvents = [
+        wails.onEvent('library:changed', () => {
+          loadLibraryFromBackend();
+        }),
+        wails.onEvent('sync:library-updated', () => {
+          loadLibraryFromBackend();
+        }),
+        // OPDS 等后端下载的书籍只保存在 BookStore 中，阅读器通过 bookURL 读取
+        wails.onEvent('library:book-added', (book: EbookMetadata) => {
+          if (book?.id && !books.value.some(item => item.id === book.id)) {
+            books.value.unshift(book);
+          }
+        }),
+        // 后端删除的书籍（如合并重复书籍）同时清除 IndexedDB 中的文件和封面
+        wails.onEvent('library:book-removed', (ebookId: string) => {
+          localforage.removeItem(`ebook_content_${ebookId}`);
+          localforage.removeItem(`ebook_cover_${ebookId}`);
+        }),
+        // 后端替换了书籍文件，IndexedDB 中已有的副本同步更新
+        wails.onEvent('library:book-file-changed', async (ebookId: string) => {
+          try {
+            if ((await localforage.keys()).includes(`ebook_content_${ebookId}`)) {
+              await cacheBookContent(ebookId);
+            }
+          } catch (error) {
+            console.error('更新书籍文件缓存失败:', error);
+          }
+        }),
+        wails.onEvent('sync:progress-updated', async (ebookIds: string[]) => {
+          await loadProgressFromBackend(ebookIds);
+          await loadLibraryFromBackend();
+        }),
+        wails.onEvent('config:baidupan-token', (token: any) => {
+          applyBaidupanToken(token);
+        })
+      ];
+    }
+    
     // 尝试从百度网盘同步配置和书籍
     try {
       if (await ensureBaidupanToken()) {
@@ -1881,7 +1810,6 @@ export const useEbookStore = defineStore('ebook', () => {
     
     // 方法
     loadBooks,
-    saveBooks,
     addBook,
     updateBook,
     removeBook,
@@ -1893,7 +1821,6 @@ export const useEbookStore = defineStore('ebook', () => {
     saveUserConfig,
     updateUserConfig,
     loadCategories,
-    saveCategories,
     addCategory,
     updateCategory,
     deleteCategory,
@@ -1902,10 +1829,9 @@ export const useEbookStore = defineStore('ebook', () => {
     searchBooks,
     syncReadingProgress,
     syncReadingProgressFromBaidupan,
-    importEpubFile,
-    importPdfFile,
-    importTxtFile,
-    importEbookFile,
+    loadLibraryFromBackend,
+    cacheBookContent,
+    importEbookPath,
     uploadLocalBookToBaidupan,
     downloadBlobFromBaidupan,
     downloadFromBaidupan,
@@ -4,6 +4,366 @@ interface DownloadResult {
   error?: string;
 }
 
+export interface SyncStatus {
+  running: boolean;
+  lastSync: number;
+  lastError?: string;
+  changed: number;
+}
+
+export interface SyncConflict {
+  id: string;
+  kind: 'book' | 'category';
+  itemId: string;
+  title: string;
+  fields: string[];
+  local: any;
+  remote: any;
+  resolved: 'local' | 'remote';
+  detectedAt: number;
+}
+
+export interface DeviceRecord {
+  id: string;
+  name: string;
+  type: 'desktop' | 'mobile' | 'tablet';
+  platform: string;
+  lastSync: number;
+  revoked?: boolean;
+  updatedAt: number;
+}
+
+export interface ContinueHint {
+  deviceId: string;
+  deviceName: string;
+  platform: string;
+  chapterIndex: number;
+  chapterTitle: string;
+  position: number;
+  cfi: string;
+  updatedAt: number;
+}
+
+// 导出的标注中 neatreader://book/{id} 链接解析后的结果
+export interface DeepLink {
+  ebookId: string;
+  cfi?: string;
+  page?: number;
+}
+
+export interface Annotation {
+  id: string;
+  ebookId: string;
+  chapterIndex: number;
+  chapterTitle?: string;
+  cfiRange?: string;
+  page?: number;
+  quads?: number[][];
+  text: string;
+  note?: string;
+  color: string;
+  deviceId?: string;
+  createdAt: number;
+  updatedAt: number;
+}
+
+export type AnnotationExportFormat = 'markdown' | 'html' | 'anki';
+
+export interface Bookmark {
+  id: string;
+  ebookId: string;
+  label: string;
+  cfi?: string;
+  page?: number;
+  chapterIndex: number;
+  chapterTitle?: string;
+  position: number;
+  snippet?: string;
+  deviceId?: string;
+  createdAt: number;
+  updatedAt: number;
+}
+
+export interface OPDSCatalog {
+  id: string;
+  name: string;
+  url: string;
+  username?: string;
+  password?: string;
+}
+
+export interface OPDSLink {
+  href: string;
+  rel?: string;
+  type?: string;
+  title?: string;
+  facetGroup?: string;
+  active?: boolean;
+  count?: number;
+}
+
+export interface OPDSEntry {
+  id: string;
+  title: string;
+  authors: string[];
+  summary?: string;
+  language?: string;
+  publisher?: string;
+  published?: string;
+  categories?: string[];
+  cover?: string;
+  thumbnail?: string;
+  acquisitions?: OPDSLink[];
+  navigation?: string;
+}
+
+export interface OPDSFeed {
+  url: string;
+  title: string;
+  entries: OPDSEntry[];
+  navigation: OPDSLink[];
+  facets: { title: string; links: OPDSLink[] }[];
+  next?: string;
+  previous?: string;
+  first?: string;
+  last?: string;
+  search?: string;
+}
+
+export interface OPDSServerConfig {
+  enabled: boolean;
+  address: string;
+  username?: string;
+  password?: string;
+}
+
+export interface WebDAVConfig {
+  url: string;
+  username: string;
+  password: string;
+  rootPath: string;
+  namingStrategy: string;
+}
+
+export interface AlistConfig {
+  url: string;
+  username: string;
+  password: string;
+  token?: string;
+  rootPath: string;
+  namingStrategy: string;
+}
+
+export interface S3Config {
+  endpoint: string;
+  region: string;
+  bucket: string;
+  accessKeyId: string;
+  secretAccessKey: string;
+  prefix: string;
+  virtualHostStyle?: boolean;
+  namingStrategy: string;
+}
+
+export interface RemoteFile {
+  path: string;
+  name: string;
+  size: number;
+  isDir: boolean;
+  modified: number;
+  etag?: string;
+}
+
+export interface StorageInfo {
+  name: string;
+  configured: boolean;
+  sync: boolean;
+  library: boolean;
+}
+
+export interface StorageQuota {
+  total: number;
+  used: number;
+}
+
+export interface FolderSyncAction {
+  op: 'upload' | 'download' | 'delete-local' | 'delete-remote' | 'conflict';
+  path: string;
+  size: number;
+  reason: string;
+  error?: string;
+}
+
+export interface FolderSyncPlan {
+  localPath: string;
+  storage: string;
+  actions: FolderSyncAction[] | null;
+  deletesBlocked: boolean;
+  dryRun: boolean;
+  failed: number;
+}
+
+export interface DuplicateBook {
+  id: string;
+  title: string;
+  author: string;
+  format: string;
+  size: number;
+  readingProgress: number;
+  remotePath?: string;
+  baidupanPath?: string;
+  md5?: string;
+  isbn?: string;
+  hasLocal: boolean;
+  readingTime: number;
+  annotations: number;
+  bookmarks: number;
+}
+
+export interface DuplicateGroup {
+  id: string;
+  reason: 'hash' | 'isbn' | 'title';
+  keepId: string;
+  books: DuplicateBook[];
+}
+
+export interface WatchedFolder {
+  id: string;
+  path: string;
+  addedAt: number;
+}
+
+export interface WatchScanResult {
+  imported: number;
+  updated: number;
+  moved: number;
+  missing: number;
+}
+
+export interface BookQuery {
+  search?: string;
+  format?: string;
+  categoryId?: string;
+  tag?: string;
+  series?: string;
+  status?: 'unread' | 'reading' | 'finished';
+  sort?: 'title' | 'author' | 'addedAt' | 'lastRead' | 'progress' | 'size' | 'seriesIndex';
+  desc?: boolean;
+  offset?: number;
+  limit?: number;
+}
+
+export interface BookQueryResult {
+  books: any[];
+  total: number;
+}
+
+export interface IndexCount {
+  name: string;
+  count: number;
+}
+
+export interface SmartRule {
+  field: 'title' | 'author' | 'format' | 'tag' | 'series' | 'category' | 'storageType' | 'status' | 'progress' | 'addedAt' | 'lastRead';
+  op: 'eq' | 'ne' | 'contains' | 'gt' | 'gte' | 'lt' | 'lte';
+  value: string;
+}
+
+export interface SmartCollection {
+  id: string;
+  name: string;
+  color?: string;
+  match: 'all' | 'any';
+  rules: SmartRule[];
+  sort?: BookQuery['sort'];
+  desc?: boolean;
+  createdAt: number;
+  updatedAt: number;
+  bookIds: string[];
+}
+
+export interface MetadataQuery {
+  isbn: string;
+  title: string;
+  author: string;
+}
+
+export interface MetadataCandidate {
+  provider: string;
+  sourceId: string;
+  sourceUrl?: string;
+  title: string;
+  author: string;
+  publisher?: string;
+  publishedDate?: string;
+  isbn?: string;
+  description?: string;
+  coverUrl?: string;
+  tags?: string[];
+  series?: string;
+  score: number;
+}
+
+export interface MetadataSearchResult {
+  query?: MetadataQuery;
+  candidates: MetadataCandidate[];
+  errors: Record<string, string>;
+}
+
+export interface MetadataSettings {
+  providers: string[];
+  googleApiKey?: string;
+  doubanUrl?: string;
+}
+
+export interface ConvertOptions {
+  title?: string;
+  author?: string;
+  language?: string;
+  theme?: string;
+  css?: string;
+}
+
+export interface ConvertTheme {
+  id: string;
+  name: string;
+}
+
+// 简繁转换方式，id 为 s2t、s2tw 或 t2s
+export interface ChineseConversion {
+  id: string;
+  name: string;
+  language: string;
+}
+
+// EPUB 检查发现的问题，kind 为 mimetype、container、manifest、spine、encoding、xhtml 或 toc
+export interface EpubIssue {
+  kind: string;
+  path?: string;
+  message: string;
+  fixed: boolean;
+}
+
+export interface EpubCheckReport {
+  issues: EpubIssue[];
+  repaired: boolean;
+}
+
+export type MetadataField = 'title' | 'author' | 'publisher' | 'publishedDate' | 'isbn' | 'description' | 'tags' | 'series' | 'cover';
+
+export interface LocalforageData {
+  books: any[];
+  categories: any[];
+  progress: Record<string, any>;
+}
+
+export interface HighlightImportReport {
+  imported: number;
+  duplicates: number;
+  unanchored: number;
+  unmatched: string[];
+}
+
 interface WailsAPI {
   GetHealth(): Promise<string>;
   GetConfig(): Promise<{ Port: number }>;
@@ -19,6 +379,99 @@ interface WailsAPI {
   OpenDirectory(): Promise<string>;
   ReadFile(path: string): Promise<number[]>;
   SelectFile(): Promise<string>;
+  SelectBookFiles(): Promise<string>;
+  StoreBookFile(id: string, filePath: string): Promise<string>;
+  RemoveStoredBook(id: string): Promise<string>;
+  SetUserConfig(config: any): Promise<string>;
+  GetUserConfig(): Promise<any>;
+  TakeDeepLink(): Promise<DeepLink | null>;
+  GetDeviceInfo(): Promise<any>;
+  SaveReadingProgress(progress: any, explicit: boolean): Promise<string>;
+  GetReadingProgress(ebookId: string): Promise<any>;
+  GetAllReadingProgress(): Promise<Record<string, any>>;
+  SyncNow(): Promise<SyncStatus>;
+  GetSyncStatus(): Promise<SyncStatus>;
+  AddBook(book: any): Promise<string>;
+  UpdateBook(ebookId: string, updates: Record<string, any>): Promise<string>;
+  DeleteBook(ebookId: string): Promise<string>;
+  PutCategory(category: any): Promise<string>;
+  DeleteCategory(categoryId: string): Promise<string>;
+  GetBooks(): Promise<any[]>;
+  GetCategories(): Promise<any[]>;
+  GetSyncConflicts(): Promise<SyncConflict[]>;
+  ResolveSyncConflict(conflictId: string, choice: 'local' | 'remote' | 'merged'): Promise<string>;
+  ListDevices(): Promise<DeviceRecord[]>;
+  RenameDevice(deviceId: string, name: string): Promise<string>;
+  RevokeDevice(deviceId: string): Promise<string>;
+  RestoreDevice(deviceId: string): Promise<string>;
+  GetContinueReading(ebookId: string): Promise<ContinueHint[]>;
+  GetReadingStats(): Promise<any>;
+  GetBookStats(ebookId: string): Promise<any>;
+  EndReadingSession(ebookId: string): Promise<string>;
+  SaveAnnotation(annotation: Partial<Annotation>): Promise<string>;
+  DeleteAnnotation(id: string): Promise<string>;
+  GetAnnotation(id: string): Promise<Annotation | null>;
+  ListAnnotations(ebookId: string): Promise<Annotation[]>;
+  ExportAnnotations(ebookId: string, format: AnnotationExportFormat): Promise<string>;
+  UploadAnnotationsExport(ebookId: string, format: AnnotationExportFormat): Promise<string>;
+  ImportKindleClippings(path: string): Promise<string>;
+  ImportKOReaderHighlights(path: string): Promise<string>;
+  AddBookmark(bookmark: Partial<Bookmark>): Promise<string>;
+  RenameBookmark(id: string, label: string): Promise<string>;
+  DeleteBookmark(id: string): Promise<string>;
+  ListBookmarks(ebookId: string): Promise<Bookmark[]>;
+  JumpToBookmark(id: string): Promise<string>;
+  ListOPDSCatalogs(): Promise<OPDSCatalog[]>;
+  SaveOPDSCatalog(catalog: Partial<OPDSCatalog>): Promise<string>;
+  RemoveOPDSCatalog(id: string): Promise<string>;
+  BrowseOPDS(catalogId: string, feedUrl: string): Promise<string>;
+  SearchOPDS(catalogId: string, searchTemplate: string, query: string): Promise<string>;
+  DownloadOPDSBook(catalogId: string, entry: OPDSEntry, link: Partial<OPDSLink>): Promise<string>;
+  GetOPDSServerConfig(): Promise<OPDSServerConfig>;
+  SetOPDSServerConfig(config: OPDSServerConfig): Promise<string>;
+  GetOPDSServerStatus(): Promise<string>;
+  VerifyWebDAV(config: WebDAVConfig): Promise<string>;
+  WebDAVList(dir: string): Promise<string>;
+  WebDAVUploadBook(ebookId: string): Promise<string>;
+  WebDAVDownloadBook(remotePath: string): Promise<string>;
+  ListStorages(): Promise<StorageInfo[]>;
+  GetStorageQuota(name: string): Promise<string>;
+  StorageList(name: string, dir: string): Promise<string>;
+  StorageUploadBook(name: string, ebookId: string): Promise<string>;
+  StorageDownloadBook(name: string, remotePath: string): Promise<string>;
+  VerifyAlist(config: AlistConfig): Promise<string>;
+  VerifyS3(config: S3Config): Promise<string>;
+  GetWatchedFolders(): Promise<WatchedFolder[]>;
+  AddWatchedFolder(path: string): Promise<string>;
+  RemoveWatchedFolder(id: string): Promise<string>;
+  RescanWatchedFolders(): Promise<string>;
+  PlanFolderSync(): Promise<string>;
+  RunFolderSync(force: boolean): Promise<string>;
+  FindDuplicates(): Promise<string>;
+  MergeDuplicates(keepId: string, removeIds: string[], deleteRemote: boolean): Promise<string>;
+  DeleteDuplicate(ebookId: string, deleteRemote: boolean): Promise<string>;
+  QueryBooks(query: BookQuery): Promise<string>;
+  ListTags(): Promise<string>;
+  ListSeries(): Promise<string>;
+  MigrateLocalforage(data: LocalforageData): Promise<string>;
+  ListSmartCollections(): Promise<string>;
+  SaveSmartCollection(collection: Partial<SmartCollection>): Promise<string>;
+  DeleteSmartCollection(id: string): Promise<string>;
+  PreviewSmartCollection(collection: Partial<SmartCollection>): Promise<string>;
+  SetBookTags(ebookId: string, tags: string[]): Promise<string>;
+  SetBookSeries(ebookId: string, series: string, index: number): Promise<string>;
+  FetchMetadata(ebookId: string): Promise<string>;
+  SearchMetadata(query: MetadataQuery): Promise<string>;
+  ApplyMetadata(ebookId: string, candidate: MetadataCandidate, fields: MetadataField[]): Promise<string>;
+  GetMetadataCover(coverUrl: string): Promise<string>;
+  GetMetadataSettings(): Promise<MetadataSettings>;
+  SetMetadataSettings(settings: MetadataSettings): Promise<string>;
+  WriteEpubMetadata(ebookId: string, upload: boolean): Promise<string>;
+  CheckEpub(ebookId: string, repair: boolean): Promise<string>;
+  GetConvertThemes(): Promise<ConvertTheme[]>;
+  ConvertToEpub(path: string, options: ConvertOptions): Promise<string>;
+  GetChineseConversions(): Promise<ChineseConversion[]>;
+  ConvertChineseBook(ebookId: string, mode: string): Promise<string>;
 }
 
 declare global {
@@ -28,6 +481,9 @@ declare global {
         App: WailsAPI;
       };
     };
+    runtime?: {
+      EventsOn(eventName: string, callback: (...data: any[]) => void): () => void;
+    };
   }
 }
 
@@ -117,5 +573,479 @@ export const wails = {
   },
   selectFile(): Promise<string> {
     return this.call<string>('SelectFile');
+  },
+  selectBookFiles(): Promise<string> {
+    return this.call<string>('SelectBookFiles');
+  },
+  // 由后端按路径读取文件，避免把整本书作为数组传过桥接层
+  storeBookFile(id: string, filePath: string): Promise<string> {
+    return this.call<string>('StoreBookFile', id, filePath);
+  },
+  removeStoredBook(id: string): Promise<string> {
+    return this.call<string>('RemoveStoredBook', id);
+  },
+  setUserConfig(config: any): Promise<string> {
+    return this.call<string>('SetUserConfig', config);
+  },
+  getUserConfig(): Promise<any> {
+    return this.call<any>('GetUserConfig');
+  },
+  // 取出等待处理的 neatreader:// 链接，收到 app:open-link 事件或启动时调用
+  takeDeepLink(): Promise<DeepLink | null> {
+    return this.call<DeepLink | null>('TakeDeepLink');
+  },
+  getDeviceInfo(): Promise<any> {
+    return this.call<any>('GetDeviceInfo');
+  },
+  saveReadingProgress(progress: any, explicit = false): Promise<string> {
+    return this.call<string>('SaveReadingProgress', progress, explicit);
+  },
+  getReadingProgress(ebookId: string): Promise<any> {
+    return this.call<any>('GetReadingProgress', ebookId);
+  },
+  getAllReadingProgress(): Promise<Record<string, any>> {
+    return this.call<Record<string, any>>('GetAllReadingProgress');
+  },
+  syncNow(): Promise<SyncStatus> {
+    return this.call<SyncStatus>('SyncNow');
+  },
+  getSyncStatus(): Promise<SyncStatus> {
+    return this.call<SyncStatus>('GetSyncStatus');
+  },
+  addBook(book: any): Promise<string> {
+    return this.call<string>('AddBook', book);
+  },
+  // 值为 undefined 的字段转为 null，后端据此清除该字段
+  updateBook(ebookId: string, updates: Record<string, any>): Promise<string> {
+    const fields = Object.fromEntries(Object.entries(updates).map(([k, v]) => [k, v === undefined ? null : v]));
+    return this.call<string>('UpdateBook', ebookId, fields);
+  },
+  deleteBook(ebookId: string): Promise<string> {
+    return this.call<string>('DeleteBook', ebookId);
+  },
+  putCategory(category: any): Promise<string> {
+    return this.call<string>('PutCategory', category);
+  },
+  deleteCategory(categoryId: string): Promise<string> {
+    return this.call<string>('DeleteCategory', categoryId);
+  },
+  getBooks(): Promise<any[]> {
+    return this.call<any[]>('GetBooks');
+  },
+  getCategories(): Promise<any[]> {
+    return this.call<any[]>('GetCategories');
+  },
+  getSyncConflicts(): Promise<SyncConflict[]> {
+    return this.call<SyncConflict[]>('GetSyncConflicts');
+  },
+  resolveSyncConflict(conflictId: string, choice: 'local' | 'remote' | 'merged'): Promise<string> {
+    return this.call<string>('ResolveSyncConflict', conflictId, choice);
+  },
+  listDevices(): Promise<DeviceRecord[]> {
+    return this.call<DeviceRecord[]>('ListDevices');
+  },
+  renameDevice(deviceId: string, name: string): Promise<string> {
+    return this.call<string>('RenameDevice', deviceId, name);
+  },
+  revokeDevice(deviceId: string): Promise<string> {
+    return this.call<string>('RevokeDevice', deviceId);
+  },
+  restoreDevice(deviceId: string): Promise<string> {
+    return this.call<string>('RestoreDevice', deviceId);
+  },
+  getContinueReading(ebookId: string): Promise<ContinueHint[]> {
+    return this.call<ContinueHint[]>('GetContinueReading', ebookId);
+  },
+  getReadingStats(): Promise<any> {
+    return this.call<any>('GetReadingStats');
+  },
+  getBookStats(ebookId: string): Promise<any> {
+    return this.call<any>('GetBookStats', ebookId);
+  },
+  endReadingSession(ebookId: string): Promise<string> {
+    return this.call<string>('EndReadingSession', ebookId);
+  },
+  saveAnnotation(annotation: Partial<Annotation>): Promise<Annotation> {
+    return this.call<string>('SaveAnnotation', annotation).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data as Annotation;
+    });
+  },
+  deleteAnnotation(id: string): Promise<string> {
+    return this.call<string>('DeleteAnnotation', id);
+  },
+  getAnnotation(id: string): Promise<Annotation | null> {
+    return this.call<Annotation | null>('GetAnnotation', id);
+  },
+  listAnnotations(ebookId: string): Promise<Annotation[]> {
+    return this.call<Annotation[]>('ListAnnotations', ebookId);
+  },
+  exportAnnotations(ebookId: string, format: AnnotationExportFormat): Promise<string> {
+    return this.call<string>('ExportAnnotations', ebookId, format);
+  },
+  uploadAnnotationsExport(ebookId: string, format: AnnotationExportFormat): Promise<string> {
+    return this.call<string>('UploadAnnotationsExport', ebookId, format);
+  },
+  // path 为空时由 Go 端弹出选择框
+  importKindleClippings(path = ''): Promise<string> {
+    return this.call<string>('ImportKindleClippings', path);
+  },
+  importKOReaderHighlights(path = ''): Promise<string> {
+    return this.call<string>('ImportKOReaderHighlights', path);
+  },
+  addBookmark(bookmark: Partial<Bookmark>): Promise<Bookmark> {
+    return this.call<string>('AddBookmark', bookmark).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data as Bookmark;
+    });
+  },
+  renameBookmark(id: string, label: string): Promise<string> {
+    return this.call<string>('RenameBookmark', id, label);
+  },
+  deleteBookmark(id: string): Promise<string> {
+    return this.call<string>('DeleteBookmark', id);
+  },
+  listBookmarks(ebookId: string): Promise<Bookmark[]> {
+    return this.call<Bookmark[]>('ListBookmarks', ebookId);
+  },
+  // 返回跳转目标的阅读进度，前端据此定位
+  jumpToBookmark(id: string): Promise<any> {
+    return this.call<string>('JumpToBookmark', id).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data;
+    });
+  },
+  listOPDSCatalogs(): Promise<OPDSCatalog[]> {
+    return this.call<OPDSCatalog[]>('ListOPDSCatalogs');
+  },
+  saveOPDSCatalog(catalog: Partial<OPDSCatalog>): Promise<string> {
+    return this.call<string>('SaveOPDSCatalog', catalog);
+  },
+  removeOPDSCatalog(id: string): Promise<string> {
+    return this.call<string>('RemoveOPDSCatalog', id);
+  },
+  // feedUrl 为空时读取书库根目录
+  browseOPDS(catalogId: string, feedUrl = ''): Promise<OPDSFeed> {
+    return this.call<string>('BrowseOPDS', catalogId, feedUrl).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data as OPDSFeed;
+    });
+  },
+  searchOPDS(catalogId: string, searchTemplate: string, query: string): Promise<OPDSFeed> {
+    return this.call<string>('SearchOPDS', catalogId, searchTemplate, query).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data as OPDSFeed;
+    });
+  },
+  downloadOPDSBook(catalogId: string, entry: OPDSEntry, link: Partial<OPDSLink> = {}): Promise<string> {
+    return this.call<string>('DownloadOPDSBook', catalogId, entry, link);
+  },
+  getOPDSServerConfig(): Promise<OPDSServerConfig> {
+    return this.call<OPDSServerConfig>('GetOPDSServerConfig');
+  },
+  setOPDSServerConfig(config: OPDSServerConfig): Promise<string> {
+    return this.call<string>('SetOPDSServerConfig', config);
+  },
+  getOPDSServerStatus(): Promise<{ running: boolean; address: string }> {
+    return this.call<string>('GetOPDSServerStatus').then(result => JSON.parse(result));
+  },
+  verifyWebDAV(config: WebDAVConfig): Promise<string> {
+    return this.call<string>('VerifyWebDAV', config);
+  },
+  webdavList(dir = ''): Promise<RemoteFile[]> {
+    return this.call<string>('WebDAVList', dir).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return (data.list || []) as RemoteFile[];
+    });
+  },
+  webdavUploadBook(ebookId: string): Promise<string> {
+    return this.call<string>('WebDAVUploadBook', ebookId);
+  },
+  webdavDownloadBook(remotePath: string): Promise<string> {
+    return this.call<string>('WebDAVDownloadBook', remotePath);
+  },
+  listStorages(): Promise<StorageInfo[]> {
+    return this.call<StorageInfo[]>('ListStorages');
+  },
+  getStorageQuota(name: string): Promise<StorageQuota> {
+    return this.call<string>('GetStorageQuota', name).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data as StorageQuota;
+    });
+  },
+  storageList(name: string, dir = ''): Promise<RemoteFile[]> {
+    return this.call<string>('StorageList', name, dir).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return (data.list || []) as RemoteFile[];
+    });
+  },
+  // name 为空时上传到 storage.library 指定的存储，进度通过 storage:upload-progress 事件通知
+  storageUploadBook(name: string, ebookId: string): Promise<string> {
+    return this.call<string>('StorageUploadBook', name, ebookId);
+  },
+  storageDownloadBook(name: string, remotePath: string): Promise<string> {
+    return this.call<string>('StorageDownloadBook', name, remotePath);
+  },
+  verifyAlist(config: AlistConfig): Promise<string> {
+    return this.call<string>('VerifyAlist', config);
+  },
+  verifyS3(config: S3Config): Promise<string> {
+    return this.call<string>('VerifyS3', config);
+  },
+  getWatchedFolders(): Promise<WatchedFolder[]> {
+    return this.call<WatchedFolder[]>('GetWatchedFolders');
+  },
+  addWatchedFolder(path: string): Promise<WatchedFolder> {
+    return this.call<string>('AddWatchedFolder', path).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data as WatchedFolder;
+    });
+  },
+  removeWatchedFolder(id: string): Promise<string> {
+    return this.call<string>('RemoveWatchedFolder', id);
+  },
+  rescanWatchedFolders(): Promise<WatchScanResult> {
+    return this.call<string>('RescanWatchedFolders').then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data as WatchScanResult;
+    });
+  },
+  // 预览本地书库目录与存储 books 目录的同步操作，不做任何修改
+  planFolderSync(): Promise<FolderSyncPlan> {
+    return this.call<string>('PlanFolderSync').then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data as FolderSyncPlan;
+    });
+  },
+  // force 为 true 时忽略删除安全阈值
+  runFolderSync(force: boolean): Promise<FolderSyncPlan> {
+    return this.call<string>('RunFolderSync', force).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data as FolderSyncPlan;
+    });
+  },
+  findDuplicates(): Promise<DuplicateGroup[]> {
+    return this.call<string>('FindDuplicates').then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data.groups as DuplicateGroup[];
+    });
+  },
+  // 保留 keepId，删除其余副本；阅读进度和标注取自阅读最多的副本
+  mergeDuplicates(keepId: string, removeIds: string[], deleteRemote: boolean): Promise<string> {
+    return this.call<string>('MergeDuplicates', keepId, removeIds, deleteRemote);
+  },
+  deleteDuplicate(ebookId: string, deleteRemote: boolean): Promise<string> {
+    return this.call<string>('DeleteDuplicate', ebookId, deleteRemote);
+  },
+  // 按条件查询书库，支持筛选、排序和分页
+  queryBooks(query: BookQuery): Promise<BookQueryResult> {
+    return this.call<string>('QueryBooks', query).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data as BookQueryResult;
+    });
+  },
+  listTags(): Promise<IndexCount[]> {
+    return this.call<string>('ListTags').then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data.tags as IndexCount[];
+    });
+  },
+  listSeries(): Promise<IndexCount[]> {
+    return this.call<string>('ListSeries').then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data.series as IndexCount[];
+    });
+  },
+  // 把 localforage 中的书库导入后端数据库，后端只执行一次
+  migrateLocalforage(data: LocalforageData): Promise<string> {
+    return this.call<string>('MigrateLocalforage', data);
+  },
+  // 智能书单由后端按规则计算，bookIds 是当前包含的书籍
+  listSmartCollections(): Promise<SmartCollection[]> {
+    return this.call<string>('ListSmartCollections').then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data.collections as SmartCollection[];
+    });
+  },
+  saveSmartCollection(collection: Partial<SmartCollection>): Promise<SmartCollection> {
+    return this.call<string>('SaveSmartCollection', collection).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data as SmartCollection;
+    });
+  },
+  deleteSmartCollection(id: string): Promise<string> {
+    return this.call<string>('DeleteSmartCollection', id);
+  },
+  previewSmartCollection(collection: Partial<SmartCollection>): Promise<string[]> {
+    return this.call<string>('PreviewSmartCollection', collection).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data.bookIds as string[];
+    });
+  },
+  setBookTags(ebookId: string, tags: string[]): Promise<string> {
+    return this.call<string>('SetBookTags', ebookId, tags);
+  },
+  setBookSeries(ebookId: string, series: string, index: number): Promise<string> {
+    return this.call<string>('SetBookSeries', ebookId, series, index);
+  },
+  // 按书籍当前的 ISBN、书名和作者在线查询元数据，候选按匹配程度排序
+  fetchMetadata(ebookId: string): Promise<MetadataSearchResult> {
+    return this.call<string>('FetchMetadata', ebookId).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data as MetadataSearchResult;
+    });
+  },
+  searchMetadata(query: MetadataQuery): Promise<MetadataSearchResult> {
+    return this.call<string>('SearchMetadata', query).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data as MetadataSearchResult;
+    });
+  },
+  // 只写入 fields 中选择的字段，返回更新后的书籍
+  applyMetadata(ebookId: string, candidate: MetadataCandidate, fields: MetadataField[]): Promise<any> {
+    return this.call<string>('ApplyMetadata', ebookId, candidate, fields).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data;
+    });
+  },
+  // 封面经后端下载并缓存，返回 data URL
+  getMetadataCover(coverUrl: string): Promise<string> {
+    return this.call<string>('GetMetadataCover', coverUrl).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data.cover as string;
+    });
+  },
+  getMetadataSettings(): Promise<MetadataSettings> {
+    return this.call<MetadataSettings>('GetMetadataSettings');
+  },
+  setMetadataSettings(settings: MetadataSettings): Promise<string> {
+    return this.call<string>('SetMetadataSettings', settings);
+  },
+  // 把书库中的元数据和封面写回 EPUB 文件，upload 为 true 时再上传到百度网盘
+  writeEpubMetadata(ebookId: string, upload: boolean): Promise<any> {
+    return this.call<string>('WriteEpubMetadata', ebookId, upload).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data;
+    });
+  },
+  // 检查书库中的 EPUB，repair 为 true 时保存修复后的文件
+  checkEpub(ebookId: string, repair: boolean): Promise<EpubCheckReport> {
+    return this.call<string>('CheckEpub', ebookId, repair).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data as EpubCheckReport;
+    });
+  },
+  getConvertThemes(): Promise<ConvertTheme[]> {
+    return this.call<ConvertTheme[]>('GetConvertThemes');
+  },
+  // 把 TXT、Markdown 或 HTML 文件转换为 EPUB 并加入书库，返回新书
+  convertToEpub(path: string, options: ConvertOptions): Promise<any> {
+    return this.call<string>('ConvertToEpub', path, options).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data;
+    });
+  },
+  getChineseConversions(): Promise<ChineseConversion[]> {
+    return this.call<ChineseConversion[]>('GetChineseConversions');
+  },
+  // 对 EPUB 或 TXT 做简繁转换，另存为一本新书，返回新书
+  convertChineseBook(ebookId: string, mode: string): Promise<any> {
+    return this.call<string>('ConvertChineseBook', ebookId, mode).then(result => {
+      const data = JSON.parse(result);
+      if (data.error) {
+        throw new Error(data.error);
+      }
+      return data;
+    });
+  },
+  // 订阅后端事件，返回取消订阅的函数；不在 Wails 中运行时不做任何事
+  onEvent(eventName: string, callback: (...data: any[]) => void): () => void {
+    if (!window.runtime) {
+      return () => {};
+    }
+    return window.runtime.EventsOn(eventName, callback);
+  },
+  // 书籍资源地址，epubjs/pdfjs 可以直接按 Range 读取；zh 为简繁转换方式时返回转换后的内容
+  bookURL(id: string, zh?: string): string {
+    const url = `/books/${encodeURIComponent(id)}`;
+    return zh ? `${url}?zh=${encodeURIComponent(zh)}` : url;
   }
 };
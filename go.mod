@@ -2,7 +2,14 @@ module neat-reader
 
 go 1.25.6
 
-require github.com/wailsapp/wails/v2 v2.11.0
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/wailsapp/wails/v2 v2.11.0
+	github.com/yuin/goldmark v1.7.4
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/net v0.35.0
+	golang.org/x/text v0.22.0
+)
 
 require (
 	github.com/bep/debounce v1.2.1 // indirect
@@ -29,7 +36,5 @@ require (
 	github.com/wailsapp/go-webview2 v1.0.22 // indirect
 	github.com/wailsapp/mimetype v1.4.1 // indirect
 	golang.org/x/crypto v0.33.0 // indirect
-	golang.org/x/net v0.35.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
-	golang.org/x/text v0.22.0 // indirect
 )
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// 书名匹配的最低得分
+const bookMatchThreshold = 0.75
+
+// HighlightImportReport 是一次导入的结果
+type HighlightImportReport struct {
+	Imported   int      `json:"imported"`
+	Duplicates int      `json:"duplicates"`
+	Unanchored int      `json:"unanchored"`
+	Unmatched  []string `json:"unmatched"`
+}
+
+var bracketedRe = regexp.MustCompile(`[（(【\[][^）)】\]]*[）)】\]]`)
+
+// normalizeTitle 去掉括号内的副标题、标点和空白，用于模糊比较
+func normalizeTitle(s string) []rune {
+	s = bracketedRe.ReplaceAllString(s, "")
+	if i := strings.IndexAny(s, ":：—"); i > 0 {
+		s = s[:i]
+	}
+	var runes []rune
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			runes = append(runes, r)
+		}
+	}
+	return runes
+}
+
+// diceSimilarity 计算字符二元组的 Dice 系数，对中英文都适用
+func diceSimilarity(a, b []rune) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	if string(a) == string(b) {
+		return 1
+	}
+	if len(a) == 1 || len(b) == 1 {
+		return 0
+	}
+	grams := map[string]int{}
+	for i := 0; i+1 < len(a); i++ {
+		grams[string(a[i:i+2])]++
+	}
+	overlap := 0
+	for i := 0; i+1 < len(b); i++ {
+		g := string(b[i : i+2])
+		if grams[g] > 0 {
+			grams[g]--
+			overlap++
+		}
+	}
+	return 2 * float64(overlap) / float64(len(a)+len(b)-2)
+}
+
+// bookMatchScore 按书名和作者给候选书打分，作者只作为加权参考
+func bookMatchScore(book EbookMetadata, title, author string) float64 {
+	bookTitle, wantTitle := normalizeTitle(book.Title), normalizeTitle(title)
+	score := diceSimilarity(bookTitle, wantTitle)
+	// 一方包含另一方（常见于带丛书名或版本信息的书名）
+	if len(bookTitle) >= 4 && len(wantTitle) >= 4 &&
+		(strings.Contains(string(bookTitle), string(wantTitle)) || strings.Contains(string(wantTitle), string(bookTitle))) {
+		score = max(score, 0.9)
+	}
+	bookAuthor, wantAuthor := normalizeTitle(book.Author), normalizeTitle(author)
+	if len(bookAuthor) > 0 && len(wantAuthor) > 0 {
+		score = 0.8*score + 0.2*diceSimilarity(bookAuthor, wantAuthor)
+	}
+	return score
+}
+
+// matchBook 在书库中找出与书名、作者最接近的书
+func matchBook(books []EbookMetadata, title, author string) (EbookMetadata, bool) {
+	var best EbookMetadata
+	bestScore := 0.0
+	for _, book := range books {
+		if score := bookMatchScore(book, title, author); score > bestScore {
+			best, bestScore = book, score
+		}
+	}
+	return best, bestScore >= bookMatchThreshold
+}
+
+// importedAnnotationID 由书和高亮内容生成稳定的 ID，重复导入时不会产生副本
+func importedAnnotationID(ebookID string, h ImportedHighlight) string {
+	sum := sha1.Sum([]byte(strings.Join([]string{ebookID, h.Text, h.Note, h.Location, fmt.Sprint(h.Page)}, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// bookFilePath 返回书籍的本地文件，优先使用应用内保存的副本
+func (a *App) bookFilePath(book EbookMetadata) string {
+	if path, err := a.store.Path(book.ID); err == nil {
+		return path
+	}
+	if book.Path != "" {
+		if _, err := os.Stat(book.Path); err == nil {
+			return book.Path
+		}
+	}
+	return ""
+}
+
+// importHighlights 把解析出的高亮匹配到书库并定位后保存为标注。
+// EPUB 通过搜索正文生成 CFI；PDF 无法检索文字，使用来源提供的页码
+func (a *App) importHighlights(source string, highlights []ImportedHighlight) HighlightImportReport {
+	report := HighlightImportReport{Unmatched: []string{}}
+	books := a.library.Books()
+	deviceID := a.settings.Device().ID
+	now := time.Now().UnixMilli()
+
+	type bookGroup struct {
+		book       EbookMetadata
+		highlights []ImportedHighlight
+	}
+	groups := map[string]*bookGroup{}
+	var order []string
+	unmatched := map[string]bool{}
+	for _, h := range highlights {
+		book, ok := matchBook(books, h.Title, h.Author)
+		if !ok {
+			if !unmatched[h.Title] {
+				unmatched[h.Title] = true
+				report.Unmatched = append(report.Unmatched, h.Title)
+			}
+			continue
+		}
+		if groups[book.ID] == nil {
+			groups[book.ID] = &bookGroup{book: book}
+			order = append(order, book.ID)
+		}
+		groups[book.ID].highlights = append(groups[book.ID].highlights, h)
+	}
+
+	for _, id := range order {
+		group := groups[id]
+		var locator *epubLocator
+		if path := a.bookFilePath(group.book); strings.EqualFold(filepath.Ext(path), ".epub") {
+			if zr, err := zip.OpenReader(path); err == nil {
+				locator, err = newEpubLocator(&zr.Reader)
+				if err != nil {
+					log.Printf("[Import] 解析 EPUB 失败: %s, %v", group.book.Title, err)
+				}
+				zr.Close()
+			}
+		}
+
+		for _, h := range group.highlights {
+			annotationID := importedAnnotationID(id, h)
+			if _, exists := a.annotations.Get(annotationID); exists {
+				report.Duplicates++
+				continue
+			}
+
+			annotation := Annotation{
+				ID:           annotationID,
+				EbookID:      id,
+				ChapterTitle: h.Chapter,
+				Text:         h.Text,
+				Note:         h.Note,
+				Color:        defaultAnnotationColor,
+				DeviceID:     deviceID,
+				CreatedAt:    h.CreatedAt,
+				UpdatedAt:    now,
+			}
+			if annotation.CreatedAt == 0 {
+				annotation.CreatedAt = now
+			}
+			if strings.HasPrefix(h.Color, "#") {
+				annotation.Color = h.Color
+			}
+
+			switch {
+			case locator != nil && h.Text != "":
+				loc, ok := locator.Locate(h.Text)
+				if !ok {
+					report.Unanchored++
+					continue
+				}
+				annotation.CFIRange = loc.CFIRange
+				annotation.ChapterIndex = loc.SpineIndex
+				if annotation.ChapterTitle == "" {
+					annotation.ChapterTitle = loc.ChapterTitle
+				}
+			case group.book.Format == "pdf" && h.Page > 0:
+				annotation.Page = h.Page
+				annotation.ChapterIndex = h.Page
+			default:
+				report.Unanchored++
+				continue
+			}
+
+			if err := a.annotations.Put(annotation.ID, &annotation); err != nil {
+				log.Printf("[Import] 保存标注失败: %v", err)
+				continue
+			}
+			report.Imported++
+		}
+	}
+
+	log.Printf("[Import] %s 导入完成: 新增 %d, 重复 %d, 未定位 %d, 未匹配书籍 %d",
+		source, report.Imported, report.Duplicates, report.Unanchored, len(report.Unmatched))
+	if report.Imported > 0 {
+		a.emit("sync:annotations-updated")
+	}
+	return report
+}
+
+// ImportKindleClippings 导入 Kindle 的 My Clippings.txt，path 为空时弹出文件选择框
+func (a *App) ImportKindleClippings(path string) string {
+	if path == "" {
+		var err error
+		path, err = runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+			Title:   "选择 My Clippings.txt",
+			Filters: []runtime.FileFilter{{DisplayName: "Kindle 标注 (*.txt)", Pattern: "*.txt"}},
+		})
+		if err != nil {
+			return jsonResult(map[string]string{"error": err.Error()})
+		}
+		if path == "" {
+			return `{"path": ""}`
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	defer f.Close()
+	highlights, err := ParseKindleClippings(f)
+	if err != nil {
+		log.Printf("[Import] 解析 Kindle 标注失败: %v", err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(a.importHighlights("Kindle", highlights))
+}
+
+// ImportKOReaderHighlights 导入 KOReader 的 sidecar，path 可以是 metadata.*.lua 文件、
+// .sdr 目录或包含多本书的目录；为空时弹出目录选择框
+func (a *App) ImportKOReaderHighlights(path string) string {
+	if path == "" {
+		var err error
+		path, err = runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+			Title: "选择 KOReader 书籍目录",
+		})
+		if err != nil {
+			return jsonResult(map[string]string{"error": err.Error()})
+		}
+		if path == "" {
+			return `{"path": ""}`
+		}
+	}
+
+	var highlights []ImportedHighlight
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := d.Name()
+		if !strings.HasPrefix(name, "metadata.") || !strings.HasSuffix(name, ".lua") {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		list, err := ParseKOReaderSidecar(string(data))
+		if err != nil {
+			log.Printf("[Import] 解析 KOReader sidecar 失败: %s, %v", p, err)
+			return nil
+		}
+		// 没有 doc_props 时用 <书名>.sdr 目录名作为书名
+		fallback := strings.TrimSuffix(filepath.Base(filepath.Dir(p)), ".sdr")
+		for i := range list {
+			if list[i].Title == "" {
+				list[i].Title = fallback
+			}
+		}
+		highlights = append(highlights, list...)
+		return nil
+	})
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(a.importHighlights("KOReader", highlights))
+}
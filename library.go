@@ -0,0 +1,590 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EbookMetadata 对应前端的 EbookMetadata，增加了同步用的 updatedAt 和删除标记
+type EbookMetadata struct {
+	ID              string   `json:"id"`
+	Title           string   `json:"title"`
+	Author          string   `json:"author"`
+	Cover           string   `json:"cover"`
+	Path            string   `json:"path"`
+	Format          string   `json:"format"`
+	Size            int64    `json:"size"`
+	LastRead        int64    `json:"lastRead"`
+	TotalChapters   int      `json:"totalChapters"`
+	ReadingProgress float64  `json:"readingProgress"`
+	StorageType     string   `json:"storageType"`
+	BaidupanPath    string   `json:"baidupanPath,omitempty"`
+	RemotePath      string   `json:"remotePath,omitempty"`
+	RemoteStorage   string   `json:"remoteStorage,omitempty"` // RemotePath 所在的存储
+	SourcePath      string   `json:"sourcePath,omitempty"`    // 从监视目录导入时的原始文件
+	Missing         bool     `json:"missing,omitempty"`       // 原始文件已不在监视目录中
+	CategoryID      string   `json:"categoryId,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+	Series          string   `json:"series,omitempty"`
+	SeriesIndex     float64  `json:"seriesIndex,omitempty"` // 在系列中的序号，可以是 1.5 这样的外传
+	ISBN            string   `json:"isbn,omitempty"`
+	Publisher       string   `json:"publisher,omitempty"`
+	PublishedDate   string   `json:"publishedDate,omitempty"`
+	Description     string   `json:"description,omitempty"`
+	AddedAt         int64    `json:"addedAt"`
+	UpdatedAt       int64    `json:"updatedAt"`
+	Deleted         bool     `json:"deleted,omitempty"`
+}
+
+// BookCategory 对应前端的 BookCategory
+type BookCategory struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Color     string   `json:"color"`
+	BookIDs   []string `json:"bookIds"`
+	CreatedAt int64    `json:"createdAt"`
+	UpdatedAt int64    `json:"updatedAt"`
+	Deleted   bool     `json:"deleted,omitempty"`
+}
+
+// LibraryState 是书库的完整状态，删除的条目以墓碑形式保留
+type LibraryState struct {
+	Books      map[string]*EbookMetadata `json:"books"`
+	Categories map[string]*BookCategory  `json:"categories"`
+}
+
+func newLibraryState() LibraryState {
+	return LibraryState{
+		Books:      map[string]*EbookMetadata{},
+		Categories: map[string]*BookCategory{},
+	}
+}
+
+// 墓碑保留时间，超过后在双方都已删除时清理
+const tombstoneTTL = 90 * 24 * time.Hour
+
+// Library 保存后端的书库状态、上次同步的基线和未处理的冲突
+type Library struct {
+	mu         sync.RWMutex
+	dir        string
+	books      *dbTable
+	categories *dbTable
+	state      LibraryState
+	base       LibraryState
+	conflicts  []SyncConflict
+	// onChange 在书库保存后调用，不能阻塞或回调 Library
+	onChange func()
+}
+
+func NewLibrary(dir string, db *LibraryDB) *Library {
+	l := &Library{
+		dir:        dir,
+		books:      newDBTable(db, dbBooks),
+		categories: newDBTable(db, dbCategories),
+		state:      newLibraryState(),
+		base:       newLibraryState(),
+	}
+	l.books.index = indexBook
+	if err := loadTable(l.books, l.state.Books); err != nil {
+		log.Printf("[Library] 读取书籍失败: %v", err)
+	}
+	if err := loadTable(l.categories, l.state.Categories); err != nil {
+		log.Printf("[Library] 读取分类失败: %v", err)
+	}
+	if l.books.empty() && l.categories.empty() {
+		migrateLegacyFile(l.books, l.statePath(), func() error {
+			return readJSONFile(l.statePath(), &l.state)
+		}, func() error {
+			l.state = normalizeLibraryState(l.state)
+			return l.saveLocked()
+		})
+	}
+	if err := readJSONFile(l.basePath(), &l.base); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Library] 读取同步基线失败: %v", err)
+	}
+	if err := readJSONFile(l.conflictsPath(), &l.conflicts); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Library] 读取同步冲突失败: %v", err)
+	}
+	l.state = normalizeLibraryState(l.state)
+	l.base = normalizeLibraryState(l.base)
+	return l
+}
+
+func normalizeLibraryState(s LibraryState) LibraryState {
+	if s.Books == nil {
+		s.Books = map[string]*EbookMetadata{}
+	}
+	if s.Categories == nil {
+		s.Categories = map[string]*BookCategory{}
+	}
+	return s
+}
+
+// statePath 是迁移到数据库之前的书库文件
+func (l *Library) statePath() string {
+	return filepath.Join(l.dir, "library.json")
+}
+
+func (l *Library) basePath() string {
+	return filepath.Join(l.dir, "sync", "base.json")
+}
+
+func (l *Library) conflictsPath() string {
+	return filepath.Join(l.dir, "sync", "conflicts.json")
+}
+
+func (l *Library) saveLocked() error {
+	if err := saveTable(l.books, l.state.Books); err != nil {
+		return err
+	}
+	if err := saveTable(l.categories, l.state.Categories); err != nil {
+		return err
+	}
+	if l.onChange != nil {
+		l.onChange()
+	}
+	return nil
+}
+
+// Books 返回未删除的书籍，按添加时间倒序
+func (l *Library) Books() []EbookMetadata {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	books := make([]EbookMetadata, 0, len(l.state.Books))
+	for _, b := range l.state.Books {
+		if !b.Deleted {
+			books = append(books, *b)
+		}
+	}
+	sort.Slice(books, func(i, j int) bool {
+		if books[i].AddedAt != books[j].AddedAt {
+			return books[i].AddedAt > books[j].AddedAt
+		}
+		return books[i].ID < books[j].ID
+	})
+	return books
+}
+
+func (l *Library) Book(id string) (EbookMetadata, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	b := l.state.Books[id]
+	if b == nil || b.Deleted {
+		return EbookMetadata{}, false
+	}
+	return *b, true
+}
+
+// Categories 返回未删除的分类，按创建时间排序
+func (l *Library) Categories() []BookCategory {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	categories := make([]BookCategory, 0, len(l.state.Categories))
+	for _, c := range l.state.Categories {
+		if !c.Deleted {
+			categories = append(categories, *c)
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].CreatedAt != categories[j].CreatedAt {
+			return categories[i].CreatedAt < categories[j].CreatedAt
+		}
+		return categories[i].ID < categories[j].ID
+	})
+	return categories
+}
+
+// UpdateBook 把前端修改的字段合并到书库中的当前版本，值为 null 的字段被清除，
+// 内容没有变化时不更新 updatedAt
+func (l *Library) UpdateBook(id string, updates map[string]json.RawMessage) (EbookMetadata, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cur := l.state.Books[id]
+	if cur == nil || cur.Deleted {
+		return EbookMetadata{}, fmt.Errorf("book not found")
+	}
+	fields, err := recordFields(cur)
+	if err != nil {
+		return EbookMetadata{}, err
+	}
+	for k, v := range updates {
+		switch {
+		case k == "id" || k == "updatedAt" || k == "deleted":
+			continue
+		case string(v) == "null":
+			delete(fields, k)
+		default:
+			fields[k] = v
+		}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return EbookMetadata{}, err
+	}
+	var b EbookMetadata
+	if err := json.Unmarshal(data, &b); err != nil {
+		return EbookMetadata{}, err
+	}
+	b.Tags = normalizeTags(b.Tags)
+	if sameRecord(cur, &b) {
+		return *cur, nil
+	}
+	b.UpdatedAt = time.Now().UnixMilli()
+	l.state.Books[id] = &b
+	return b, l.saveLocked()
+}
+
+// PutBook 添加或更新单本书，用于 Go 端直接导入的书籍
+func (l *Library) PutBook(book EbookMetadata) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	book.Deleted = false
+	book.Tags = normalizeTags(book.Tags)
+	book.UpdatedAt = time.Now().UnixMilli()
+	l.state.Books[book.ID] = &book
+	return l.saveLocked()
+}
+
+// DeleteBook 把书籍记为墓碑
+func (l *Library) DeleteBook(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.state.Books[id]
+	if b == nil || b.Deleted {
+		return nil
+	}
+	b.Deleted = true
+	b.UpdatedAt = time.Now().UnixMilli()
+	return l.saveLocked()
+}
+
+// ImportMissing 导入书库中还没有的书籍和分类，已有的条目（包括墓碑）保持不变
+func (l *Library) ImportMissing(books []EbookMetadata, categories []BookCategory) (int, int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	bookCount, categoryCount := 0, 0
+	for i := range books {
+		b := books[i]
+		if b.ID == "" || l.state.Books[b.ID] != nil {
+			continue
+		}
+		b.Deleted = false
+		b.Tags = normalizeTags(b.Tags)
+		b.UpdatedAt = now
+		l.state.Books[b.ID] = &b
+		bookCount++
+	}
+	for i := range categories {
+		c := categories[i]
+		if c.ID == "" || l.state.Categories[c.ID] != nil {
+			continue
+		}
+		c.Deleted = false
+		c.UpdatedAt = now
+		l.state.Categories[c.ID] = &c
+		categoryCount++
+	}
+	if bookCount == 0 && categoryCount == 0 {
+		return 0, 0, nil
+	}
+	return bookCount, categoryCount, l.saveLocked()
+}
+
+// PutCategory 添加或更新分类，内容没有变化时不更新 updatedAt
+func (l *Library) PutCategory(category BookCategory) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cur := l.state.Categories[category.ID]; cur != nil && !cur.Deleted && sameRecord(cur, &category) {
+		return nil
+	}
+	category.Deleted = false
+	category.UpdatedAt = time.Now().UnixMilli()
+	l.state.Categories[category.ID] = &category
+	return l.saveLocked()
+}
+
+// DeleteCategory 把分类记为墓碑
+func (l *Library) DeleteCategory(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := l.state.Categories[id]
+	if c == nil || c.Deleted {
+		return nil
+	}
+	c.Deleted = true
+	c.UpdatedAt = time.Now().UnixMilli()
+	return l.saveLocked()
+}
+
+// sameRecord 比较两条记录的内容，忽略 updatedAt 和删除标记
+func sameRecord(a, b interface{}) bool {
+	ra, err := recordFields(a)
+	if err != nil {
+		return false
+	}
+	rb, err := recordFields(b)
+	if err != nil {
+		return false
+	}
+	delete(ra, "updatedAt")
+	delete(rb, "updatedAt")
+	delete(ra, "deleted")
+	delete(rb, "deleted")
+	if len(ra) != len(rb) {
+		return false
+	}
+	for k, v := range ra {
+		if !rawEqual(v, rb[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Snapshot 返回包含墓碑的完整状态副本
+func (l *Library) Snapshot() LibraryState {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return copyLibraryState(l.state)
+}
+
+func copyLibraryState(s LibraryState) LibraryState {
+	cp := newLibraryState()
+	for id, b := range s.Books {
+		bb := *b
+		cp.Books[id] = &bb
+	}
+	for id, c := range s.Categories {
+		cc := *c
+		cc.BookIDs = append([]string(nil), c.BookIDs...)
+		cp.Categories[id] = &cc
+	}
+	return cp
+}
+
+// MergeRemote 以上次同步的基线对本地和远端状态做三方合并，返回本地是否变化
+func (l *Library) MergeRemote(remote LibraryState) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	remote = normalizeLibraryState(remote)
+	now := time.Now()
+
+	books, bookConflicts, err := mergeRecordSets("book", l.base.Books, l.state.Books, remote.Books)
+	if err != nil {
+		return false, err
+	}
+	categories, categoryConflicts, err := mergeRecordSets("category", l.base.Categories, l.state.Categories, remote.Categories)
+	if err != nil {
+		return false, err
+	}
+
+	merged := LibraryState{Books: books, Categories: categories}
+	for id, b := range merged.Books {
+		// 其他设备或旧版本写入的标签可能有空值或大小写重复。记录可能与本地状态共用，修改前先复制
+		if tags := normalizeTags(b.Tags); !slices.Equal(tags, b.Tags) {
+			normalized := *b
+			normalized.Tags = tags
+			merged.Books[id] = &normalized
+			b = &normalized
+		}
+		if b.Deleted && now.Sub(time.UnixMilli(b.UpdatedAt)) > tombstoneTTL {
+			if base := l.base.Books[id]; base != nil && base.Deleted {
+				delete(merged.Books, id)
+			}
+		}
+	}
+	for id, c := range merged.Categories {
+		if c.Deleted && now.Sub(time.UnixMilli(c.UpdatedAt)) > tombstoneTTL {
+			if base := l.base.Categories[id]; base != nil && base.Deleted {
+				delete(merged.Categories, id)
+			}
+		}
+	}
+
+	changed := !jsonEqual(l.state, merged)
+	l.state = merged
+	l.addConflictsLocked(append(bookConflicts, categoryConflicts...))
+
+	if changed {
+		if err := l.saveLocked(); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// CommitBase 在同步成功后把已上传到远端的状态记为新的基线
+func (l *Library) CommitBase(uploaded LibraryState) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.base = copyLibraryState(normalizeLibraryState(uploaded))
+	return writeJSONFile(l.basePath(), l.base)
+}
+
+func (l *Library) addConflictsLocked(conflicts []SyncConflict) {
+	if len(conflicts) == 0 {
+		return
+	}
+	byID := make(map[string]int, len(l.conflicts))
+	for i, c := range l.conflicts {
+		byID[c.ID] = i
+	}
+	for _, c := range conflicts {
+		if i, ok := byID[c.ID]; ok {
+			l.conflicts[i] = c
+		} else {
+			l.conflicts = append(l.conflicts, c)
+		}
+	}
+	if err := writeJSONFile(l.conflictsPath(), l.conflicts); err != nil {
+		log.Printf("[Library] 保存同步冲突失败: %v", err)
+	}
+}
+
+func (l *Library) Conflicts() []SyncConflict {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]SyncConflict(nil), l.conflicts...)
+}
+
+// ResolveConflict 按用户的选择应用冲突某一方的版本，并更新 updatedAt 使其在下次同步时生效
+func (l *Library) ResolveConflict(conflictID, choice string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	idx := -1
+	for i, c := range l.conflicts {
+		if c.ID == conflictID {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return fmt.Errorf("conflict %s not found", conflictID)
+	}
+	conflict := l.conflicts[idx]
+
+	var raw json.RawMessage
+	switch choice {
+	case "local":
+		raw = conflict.Local
+	case "remote":
+		raw = conflict.Remote
+	case "merged":
+		// 保留自动合并的结果
+	default:
+		return fmt.Errorf("unknown choice %q", choice)
+	}
+
+	if raw != nil {
+		now := time.Now().UnixMilli()
+		switch conflict.Kind {
+		case "book":
+			var b EbookMetadata
+			if err := json.Unmarshal(raw, &b); err != nil {
+				return err
+			}
+			b.UpdatedAt = now
+			l.state.Books[b.ID] = &b
+		case "category":
+			var c BookCategory
+			if err := json.Unmarshal(raw, &c); err != nil {
+				return err
+			}
+			c.UpdatedAt = now
+			l.state.Categories[c.ID] = &c
+		}
+		if err := l.saveLocked(); err != nil {
+			return err
+		}
+	}
+
+	l.conflicts = append(l.conflicts[:idx], l.conflicts[idx+1:]...)
+	return writeJSONFile(l.conflictsPath(), l.conflicts)
+}
+
+// AddBook 添加前端导入的书籍
+func (a *App) AddBook(book EbookMetadata) string {
+	if book.ID == "" {
+		return `{"error": "missing book id"}`
+	}
+	if err := a.library.PutBook(book); err != nil {
+		log.Printf("[Library] 添加书籍失败: %s, %v", book.ID, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
+
+// UpdateBook 只更新前端修改的字段，避免用前端较旧的副本覆盖同步或后台任务写入的其他字段
+func (a *App) UpdateBook(ebookId string, updates map[string]json.RawMessage) string {
+	book, err := a.library.UpdateBook(ebookId, updates)
+	if err != nil {
+		log.Printf("[Library] 更新书籍失败: %s, %v", ebookId, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(book)
+}
+
+// DeleteBook 从书库删除书籍和本地保存的文件，云端文件保持不变
+func (a *App) DeleteBook(ebookId string) string {
+	if err := a.store.Remove(ebookId); err != nil && !os.IsNotExist(err) {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if err := a.library.DeleteBook(ebookId); err != nil {
+		log.Printf("[Library] 删除书籍失败: %s, %v", ebookId, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
+
+// PutCategory 添加或更新分类
+func (a *App) PutCategory(category BookCategory) string {
+	if category.ID == "" {
+		return `{"error": "missing category id"}`
+	}
+	if err := a.library.PutCategory(category); err != nil {
+		log.Printf("[Library] 保存分类失败: %s, %v", category.ID, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
+
+func (a *App) DeleteCategory(categoryId string) string {
+	if err := a.library.DeleteCategory(categoryId); err != nil {
+		log.Printf("[Library] 删除分类失败: %s, %v", categoryId, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
+
+func (a *App) GetBooks() []EbookMetadata {
+	return a.library.Books()
+}
+
+func (a *App) GetCategories() []BookCategory {
+	return a.library.Categories()
+}
+
+func (a *App) GetSyncConflicts() []SyncConflict {
+	return a.library.Conflicts()
+}
+
+// ResolveSyncConflict 处理同步冲突，choice 为 local、remote 或 merged（保留自动合并结果）
+func (a *App) ResolveSyncConflict(conflictId string, choice string) string {
+	if err := a.library.ResolveConflict(conflictId, choice); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	a.emit("sync:library-updated")
+	return `{"success": true}`
+}
@@ -0,0 +1,577 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// 书库数据库中的 bucket，每条记录以 ID 为键、JSON 为值。
+// tags 和 series 是书籍的二级索引：tags/<小写标签>/<书籍 ID> = 标签原文、series/<系列>/<书籍 ID> = 系列序号
+const (
+	dbBooks       = "books"
+	dbCategories  = "categories"
+	dbTags        = "tags"
+	dbSeries      = "series"
+	dbProgress    = "progress"
+	dbAnnotations = "annotations"
+	dbBookmarks   = "bookmarks"
+	dbCollections = "collections"
+	dbMeta        = "meta"
+)
+
+// LibraryDB 是书库的嵌入式数据库，替代原来整体重写的 JSON 文件
+type LibraryDB struct {
+	db *bolt.DB
+}
+
+func OpenLibraryDB(path string) (*LibraryDB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{dbBooks, dbCategories, dbTags, dbSeries, dbProgress, dbAnnotations, dbBookmarks, dbCollections, dbMeta} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return reindexTags(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &LibraryDB{db: db}, nil
+}
+
+// 标签索引改为不区分大小写后的版本，旧数据库打开时按书籍重建一次
+const (
+	metaTagIndex        = "tagIndex"
+	metaTagIndexVersion = "2"
+)
+
+// tagIndexKey 是标签在索引中的键，与 normalizeTags 和智能书单一样不区分大小写
+func tagIndexKey(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// reindexTags 在索引版本过旧时按书籍重建标签索引
+func reindexTags(tx *bolt.Tx) error {
+	meta := tx.Bucket([]byte(dbMeta))
+	if string(meta.Get([]byte(metaTagIndex))) == metaTagIndexVersion {
+		return nil
+	}
+	if err := tx.DeleteBucket([]byte(dbTags)); err != nil {
+		return err
+	}
+	if _, err := tx.CreateBucket([]byte(dbTags)); err != nil {
+		return err
+	}
+	books := tx.Bucket([]byte(dbBooks))
+	var ids [][]byte
+	books.ForEach(func(k, _ []byte) error {
+		ids = append(ids, k)
+		return nil
+	})
+	for _, id := range ids {
+		var book EbookMetadata
+		if json.Unmarshal(books.Get(id), &book) != nil || book.Deleted {
+			continue
+		}
+		if err := indexTags(tx.Bucket([]byte(dbTags)), string(id), book.Tags); err != nil {
+			return err
+		}
+	}
+	return meta.Put([]byte(metaTagIndex), []byte(metaTagIndexVersion))
+}
+
+// indexTags 把书籍加入各个标签的索引，空标签不建立索引
+func indexTags(tags *bolt.Bucket, id string, bookTags []string) error {
+	for _, tag := range bookTags {
+		key := tagIndexKey(tag)
+		if key == "" {
+			continue
+		}
+		b, err := tags.CreateBucketIfNotExists([]byte(key))
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(id), []byte(strings.TrimSpace(tag))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *LibraryDB) Close() error {
+	return d.db.Close()
+}
+
+func (d *LibraryDB) Meta(key string) string {
+	var value string
+	d.db.View(func(tx *bolt.Tx) error {
+		value = string(tx.Bucket([]byte(dbMeta)).Get([]byte(key)))
+		return nil
+	})
+	return value
+}
+
+func (d *LibraryDB) SetMeta(key, value string) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(dbMeta)).Put([]byte(key), []byte(value))
+	})
+}
+
+// dbTable 是一个 bucket 的读写封装，记住上次写入的 JSON，保存时只写入变化的记录
+type dbTable struct {
+	db     *LibraryDB
+	bucket string
+	saved  map[string][]byte
+	// index 在同一事务中维护二级索引，old 或 data 为 nil 表示新增或删除
+	index func(tx *bolt.Tx, id string, old, data []byte) error
+}
+
+func newDBTable(db *LibraryDB, bucket string) *dbTable {
+	return &dbTable{db: db, bucket: bucket, saved: map[string][]byte{}}
+}
+
+func (t *dbTable) empty() bool {
+	return len(t.saved) == 0
+}
+
+// loadTable 读取 bucket 中的全部记录
+func loadTable[T any](t *dbTable, into map[string]*T) error {
+	return t.db.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(t.bucket)).ForEach(func(k, v []byte) error {
+			item := new(T)
+			if err := json.Unmarshal(v, item); err != nil {
+				log.Printf("[LibraryDB] 跳过无法解析的 %s 记录 %s: %v", t.bucket, k, err)
+				return nil
+			}
+			into[string(k)] = item
+			t.saved[string(k)] = append([]byte(nil), v...)
+			return nil
+		})
+	})
+}
+
+// saveTable 把 items 与上次写入的内容比较，在一个事务中写入变化的记录并删除不再存在的记录
+func saveTable[T any](t *dbTable, items map[string]*T) error {
+	changed := map[string][]byte{}
+	for id, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(t.saved[id], data) {
+			changed[id] = data
+		}
+	}
+	for id := range t.saved {
+		if _, ok := items[id]; !ok {
+			changed[id] = nil
+		}
+	}
+	return t.write(changed)
+}
+
+// putRecord 只写入一条记录
+func putRecord[T any](t *dbTable, id string, item *T) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(t.saved[id], data) {
+		return nil
+	}
+	return t.write(map[string][]byte{id: data})
+}
+
+// write 写入变化的记录，值为 nil 表示删除
+func (t *dbTable) write(changed map[string][]byte) error {
+	if len(changed) == 0 {
+		return nil
+	}
+	err := t.db.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(t.bucket))
+		for id, data := range changed {
+			if t.index != nil {
+				if err := t.index(tx, id, t.saved[id], data); err != nil {
+					return err
+				}
+			}
+			var err error
+			if data == nil {
+				err = b.Delete([]byte(id))
+			} else {
+				err = b.Put([]byte(id), data)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for id, data := range changed {
+		if data == nil {
+			delete(t.saved, id)
+		} else {
+			t.saved[id] = data
+		}
+	}
+	return nil
+}
+
+// migrateLegacyFile 在表为空时从旧的 JSON 文件导入，导入后把文件改名为 .migrated
+func migrateLegacyFile(t *dbTable, path string, load func() error, save func() error) {
+	if !t.empty() {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	if err := load(); err != nil {
+		log.Printf("[LibraryDB] 读取旧数据失败: %s, %v", path, err)
+		return
+	}
+	if err := save(); err != nil {
+		log.Printf("[LibraryDB] 迁移旧数据失败: %s, %v", path, err)
+		return
+	}
+	if err := os.Rename(path, path+".migrated"); err != nil {
+		log.Printf("[LibraryDB] 重命名旧数据失败: %s, %v", path, err)
+	}
+	log.Printf("[LibraryDB] 已迁移 %s", path)
+}
+
+// indexBook 维护书籍的标签和系列索引。墓碑不进入索引
+func indexBook(tx *bolt.Tx, id string, old, data []byte) error {
+	var before, after EbookMetadata
+	if old != nil {
+		json.Unmarshal(old, &before)
+	}
+	if data != nil {
+		json.Unmarshal(data, &after)
+	}
+	tags, series := tx.Bucket([]byte(dbTags)), tx.Bucket([]byte(dbSeries))
+	if old != nil && !before.Deleted {
+		for _, tag := range before.Tags {
+			key := []byte(tagIndexKey(tag))
+			if len(key) == 0 {
+				continue
+			}
+			if b := tags.Bucket(key); b != nil {
+				if err := b.Delete([]byte(id)); err != nil {
+					return err
+				}
+				if k, _ := b.Cursor().First(); k == nil {
+					tags.DeleteBucket(key)
+				}
+			}
+		}
+		if before.Series != "" {
+			if b := series.Bucket([]byte(before.Series)); b != nil {
+				if err := b.Delete([]byte(id)); err != nil {
+					return err
+				}
+				if k, _ := b.Cursor().First(); k == nil {
+					series.DeleteBucket([]byte(before.Series))
+				}
+			}
+		}
+	}
+	if data != nil && !after.Deleted {
+		if err := indexTags(tags, id, after.Tags); err != nil {
+			return err
+		}
+		if after.Series != "" {
+			b, err := series.CreateBucketIfNotExists([]byte(after.Series))
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(id), []byte(strconv.FormatFloat(after.SeriesIndex, 'f', -1, 64))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// BookQuery 是书籍查询条件，空字段表示不限制
+type BookQuery struct {
+	Search     string `json:"search"` // 书名或作者包含，不区分大小写
+	Format     string `json:"format"`
+	CategoryID string `json:"categoryId"`
+	Tag        string `json:"tag"`
+	Series     string `json:"series"`
+	Status     string `json:"status"` // unread、reading 或 finished
+	Sort       string `json:"sort"`   // title、author、addedAt、lastRead、progress、size、seriesIndex，默认 addedAt
+	Desc       bool   `json:"desc"`
+	Offset     int    `json:"offset"`
+	Limit      int    `json:"limit"` // 0 表示不分页
+}
+
+type BookQueryResult struct {
+	Books []EbookMetadata `json:"books"`
+	Total int             `json:"total"`
+}
+
+// QueryBooks 在数据库中查询书籍。指定标签或系列时先通过索引缩小范围
+func (d *LibraryDB) QueryBooks(q BookQuery) (BookQueryResult, error) {
+	var books []EbookMetadata
+	err := d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(dbBooks))
+		var candidates map[string]bool
+		restrict := func(index, key string) {
+			ids := map[string]bool{}
+			if b := tx.Bucket([]byte(index)).Bucket([]byte(key)); b != nil {
+				b.ForEach(func(k, _ []byte) error {
+					if candidates == nil || candidates[string(k)] {
+						ids[string(k)] = true
+					}
+					return nil
+				})
+			}
+			candidates = ids
+		}
+		if q.Tag != "" {
+			restrict(dbTags, tagIndexKey(q.Tag))
+		}
+		if q.Series != "" {
+			restrict(dbSeries, q.Series)
+		}
+		var category *BookCategory
+		if q.CategoryID != "" {
+			if data := tx.Bucket([]byte(dbCategories)).Get([]byte(q.CategoryID)); data != nil {
+				category = &BookCategory{}
+				json.Unmarshal(data, category)
+			}
+		}
+
+		match := func(data []byte) error {
+			var book EbookMetadata
+			if err := json.Unmarshal(data, &book); err != nil || book.Deleted {
+				return nil
+			}
+			if q.matches(book, category) {
+				books = append(books, book)
+			}
+			return nil
+		}
+		if candidates != nil {
+			for id := range candidates {
+				if data := bucket.Get([]byte(id)); data != nil {
+					match(data)
+				}
+			}
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error { return match(v) })
+	})
+	if err != nil {
+		return BookQueryResult{}, err
+	}
+
+	sortBooks(books, q.Sort, q.Desc)
+	result := BookQueryResult{Total: len(books), Books: []EbookMetadata{}}
+	start := min(max(q.Offset, 0), len(books))
+	end := len(books)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, len(books))
+	}
+	result.Books = append(result.Books, books[start:end]...)
+	return result, nil
+}
+
+func (q BookQuery) matches(book EbookMetadata, category *BookCategory) bool {
+	if q.Search != "" {
+		search := strings.ToLower(q.Search)
+		if !strings.Contains(strings.ToLower(book.Title), search) && !strings.Contains(strings.ToLower(book.Author), search) {
+			return false
+		}
+	}
+	if q.Format != "" && !strings.EqualFold(book.Format, q.Format) {
+		return false
+	}
+	if q.CategoryID != "" && book.CategoryID != q.CategoryID {
+		if category == nil || !containsString(category.BookIDs, book.ID) {
+			return false
+		}
+	}
+	return q.Status == "" || bookStatus(&book) == q.Status
+}
+
+// bookStatus 按阅读进度（百分比）返回 unread、reading 或 finished
+func bookStatus(book *EbookMetadata) string {
+	switch {
+	case book.ReadingProgress <= 0:
+		return "unread"
+	case book.ReadingProgress >= 100:
+		return "finished"
+	}
+	return "reading"
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sortBooks 按字段排序，值相同时按 ID 保证分页结果稳定
+func sortBooks(books []EbookMetadata, field string, desc bool) {
+	less := func(a, b *EbookMetadata) int {
+		switch field {
+		case "title":
+			return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+		case "author":
+			return strings.Compare(strings.ToLower(a.Author), strings.ToLower(b.Author))
+		case "lastRead":
+			return compareNumbers(a.LastRead, b.LastRead)
+		case "progress":
+			return compareNumbers(a.ReadingProgress, b.ReadingProgress)
+		case "size":
+			return compareNumbers(a.Size, b.Size)
+		case "seriesIndex":
+			if c := strings.Compare(a.Series, b.Series); c != 0 {
+				return c
+			}
+			return compareNumbers(a.SeriesIndex, b.SeriesIndex)
+		default:
+			return compareNumbers(a.AddedAt, b.AddedAt)
+		}
+	}
+	sort.Slice(books, func(i, j int) bool {
+		c := less(&books[i], &books[j])
+		if desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+		return books[i].ID < books[j].ID
+	})
+}
+
+func compareNumbers[T int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// QueryBooks 按条件查询书籍，支持筛选、排序和分页
+func (a *App) QueryBooks(query BookQuery) string {
+	result, err := a.db.QueryBooks(query)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(result)
+}
+
+// ListTags 返回全部标签及其书籍数量
+func (a *App) ListTags() string {
+	counts, err := a.db.indexCounts(dbTags)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(map[string]interface{}{"tags": counts})
+}
+
+// ListSeries 返回全部系列及其书籍数量
+func (a *App) ListSeries() string {
+	counts, err := a.db.indexCounts(dbSeries)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(map[string]interface{}{"series": counts})
+}
+
+type indexCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func (d *LibraryDB) indexCounts(index string) ([]indexCount, error) {
+	counts := []indexCount{}
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(index)).ForEachBucket(func(k []byte) error {
+			b := tx.Bucket([]byte(index)).Bucket(k)
+			name := string(k)
+			// 标签索引的键是小写形式，显示时使用第一本书中的写法
+			if index == dbTags {
+				if _, v := b.Cursor().First(); len(v) > 0 {
+					name = string(v)
+				}
+			}
+			counts = append(counts, indexCount{Name: name, Count: b.Stats().KeyN})
+			return nil
+		})
+	})
+	return counts, err
+}
+
+// LocalforageData 是前端 localforage 中的书库数据，progress 以书籍 ID 为键
+type LocalforageData struct {
+	Books      []EbookMetadata             `json:"books"`
+	Categories []BookCategory              `json:"categories"`
+	Progress   map[string]*ReadingProgress `json:"progress"`
+}
+
+// 标记 localforage 数据已经导入的 meta 键
+const metaLocalforageMigrated = "localforageMigrated"
+
+// MigrateLocalforage 把前端 localforage 中的书籍、分类和阅读进度导入数据库，只执行一次。
+// 已有的书籍和分类保持不变，进度按 mergeProgress 合并
+func (a *App) MigrateLocalforage(data LocalforageData) string {
+	if a.db.Meta(metaLocalforageMigrated) != "" {
+		return jsonResult(map[string]interface{}{"skipped": true})
+	}
+	books, categories, err := a.library.ImportMissing(data.Books, data.Categories)
+	if err != nil {
+		log.Printf("[LibraryDB] 导入 localforage 书库失败: %v", err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	progress := make(map[string]*ReadingProgress, len(data.Progress))
+	for id, p := range data.Progress {
+		if p != nil && p.EbookID == "" {
+			p.EbookID = id
+		}
+		progress[id] = p
+	}
+	changed, err := a.progress.Merge(progress)
+	if err != nil {
+		log.Printf("[LibraryDB] 导入 localforage 阅读进度失败: %v", err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if err := a.db.SetMeta(metaLocalforageMigrated, strconv.FormatInt(time.Now().UnixMilli(), 10)); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	log.Printf("[LibraryDB] 已导入 localforage 数据: %d 本书, %d 个分类, %d 条进度", books, categories, len(changed))
+	return jsonResult(map[string]interface{}{
+		"books":      books,
+		"categories": categories,
+		"progress":   len(changed),
+	})
+}
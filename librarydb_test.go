@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestLibraryTagIndex(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenLibraryDB(filepath.Join(dir, "library.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	library := NewLibrary(dir, db)
+
+	// 空标签不会让写入失败，大小写不同的标签合并为一个
+	if err := library.PutBook(EbookMetadata{ID: "a", Title: "A", Tags: []string{"", "SF", " sf ", "Fantasy"}}); err != nil {
+		t.Fatalf("put book: %v", err)
+	}
+	if book, _ := library.Book("a"); len(book.Tags) != 2 || book.Tags[0] != "SF" || book.Tags[1] != "Fantasy" {
+		t.Fatalf("tags = %q", book.Tags)
+	}
+	if err := library.PutBook(EbookMetadata{ID: "b", Title: "B", Tags: []string{"sf"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := library.UpdateBook("b", map[string]json.RawMessage{"tags": json.RawMessage(`["", "Sf", "Horror"]`)}); err != nil {
+		t.Fatalf("update book: %v", err)
+	}
+
+	result, err := db.QueryBooks(BookQuery{Tag: "Sf"})
+	if err != nil || result.Total != 2 {
+		t.Fatalf("query by tag = %+v, %v", result, err)
+	}
+	counts, err := db.indexCounts(dbTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int{}
+	for _, c := range counts {
+		got[c.Name] = c.Count
+	}
+	if len(got) != 3 || got["SF"] != 2 || got["Fantasy"] != 1 || got["Horror"] != 1 {
+		t.Fatalf("tag counts = %+v", counts)
+	}
+
+	// 从其他设备合并来的空标签同样被忽略
+	if err := library.CommitBase(library.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	remote := library.Snapshot()
+	c := *remote.Books["a"]
+	c.Tags = []string{"", "fantasy", "Fantasy"}
+	c.UpdatedAt++
+	remote.Books["a"] = &c
+	if _, err := library.MergeRemote(remote); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if book, _ := library.Book("a"); len(book.Tags) != 1 || book.Tags[0] != "fantasy" {
+		t.Fatalf("merged tags = %q", book.Tags)
+	}
+	if result, _ := db.QueryBooks(BookQuery{Tag: "sf"}); result.Total != 1 {
+		t.Fatalf("query after merge = %+v", result)
+	}
+}
+
+func TestLibraryTagIndexRebuild(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "library.db")
+	db, err := OpenLibraryDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟旧版本按原文建立的索引
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		data, _ := json.Marshal(EbookMetadata{ID: "a", Title: "A", Tags: []string{"SF"}})
+		if err := tx.Bucket([]byte(dbBooks)).Put([]byte("a"), data); err != nil {
+			return err
+		}
+		b, err := tx.Bucket([]byte(dbTags)).CreateBucket([]byte("SF"))
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("a"), nil); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(dbMeta)).Delete([]byte(metaTagIndex))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = OpenLibraryDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if result, err := db.QueryBooks(BookQuery{Tag: "sf"}); err != nil || result.Total != 1 {
+		t.Fatalf("query after rebuild = %+v, %v", result, err)
+	}
+	if counts, _ := db.indexCounts(dbTags); len(counts) != 1 || counts[0].Name != "SF" {
+		t.Fatalf("tag counts after rebuild = %+v", counts)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// SyncConflict 记录三方合并中双方都修改了同一字段的情况。
+// 合并时已按 updatedAt 自动选择了一方，用户可以在之后改选
+type SyncConflict struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"` // book | category
+	ItemID     string          `json:"itemId"`
+	Title      string          `json:"title"`
+	Fields     []string        `json:"fields"`
+	Local      json.RawMessage `json:"local"`
+	Remote     json.RawMessage `json:"remote"`
+	Resolved   string          `json:"resolved"` // 自动选择的一方：local | remote
+	DetectedAt int64           `json:"detectedAt"`
+}
+
+// recordFields 把记录展开为字段到原始 JSON 的映射
+func recordFields(v interface{}) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// jsonEqual 按 JSON 编码比较两个值
+func jsonEqual(a, b interface{}) bool {
+	da, errA := json.Marshal(a)
+	db, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(da, db)
+}
+
+func rawEqual(a, b json.RawMessage) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	var ca, cb bytes.Buffer
+	if json.Compact(&ca, a) != nil || json.Compact(&cb, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
+}
+
+func rawInt64(raw json.RawMessage) int64 {
+	var n int64
+	json.Unmarshal(raw, &n)
+	return n
+}
+
+func rawString(raw json.RawMessage) string {
+	var s string
+	json.Unmarshal(raw, &s)
+	return s
+}
+
+// mergeStringSets 对字符串数组做集合三方合并：双方的新增和删除都保留
+func mergeStringSets(base, local, remote json.RawMessage) (json.RawMessage, bool) {
+	var b, l, r []string
+	if base != nil && json.Unmarshal(base, &b) != nil {
+		return nil, false
+	}
+	if json.Unmarshal(local, &l) != nil || json.Unmarshal(remote, &r) != nil {
+		return nil, false
+	}
+
+	inBase := map[string]bool{}
+	for _, s := range b {
+		inBase[s] = true
+	}
+	inLocal := map[string]bool{}
+	for _, s := range l {
+		inLocal[s] = true
+	}
+	inRemote := map[string]bool{}
+	for _, s := range r {
+		inRemote[s] = true
+	}
+
+	merged := []string{}
+	seen := map[string]bool{}
+	for _, list := range [][]string{l, r} {
+		for _, s := range list {
+			if seen[s] {
+				continue
+			}
+			seen[s] = true
+			removed := inBase[s] && (!inLocal[s] || !inRemote[s])
+			if !removed {
+				merged = append(merged, s)
+			}
+		}
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// mergeRecord 对单条记录做字段级三方合并，返回合并结果和冲突字段
+func mergeRecord(base, local, remote map[string]json.RawMessage) (map[string]json.RawMessage, []string) {
+	localNewer := rawInt64(local["updatedAt"]) >= rawInt64(remote["updatedAt"])
+
+	keys := map[string]bool{}
+	for k := range local {
+		keys[k] = true
+	}
+	for k := range remote {
+		keys[k] = true
+	}
+
+	merged := map[string]json.RawMessage{}
+	var conflicts []string
+	for k := range keys {
+		if k == "updatedAt" {
+			continue
+		}
+		lv, rv, bv := local[k], remote[k], base[k]
+		switch {
+		case rawEqual(lv, rv):
+			merged[k] = lv
+		case base != nil && rawEqual(lv, bv):
+			merged[k] = rv
+		case base != nil && rawEqual(rv, bv):
+			merged[k] = lv
+		default:
+			if set, ok := mergeStringSets(bv, lv, rv); ok {
+				merged[k] = set
+				continue
+			}
+			conflicts = append(conflicts, k)
+			if localNewer {
+				merged[k] = lv
+			} else {
+				merged[k] = rv
+			}
+		}
+		if merged[k] == nil {
+			delete(merged, k)
+		}
+	}
+
+	updatedAt := rawInt64(local["updatedAt"])
+	if ru := rawInt64(remote["updatedAt"]); ru > updatedAt {
+		updatedAt = ru
+	}
+	merged["updatedAt"], _ = json.Marshal(updatedAt)
+
+	// 一方删除而另一方修改了其他字段时保留条目，交给用户决定
+	if isDeleted(merged) && isDeleted(local) != isDeleted(remote) {
+		editor := local
+		if isDeleted(local) {
+			editor = remote
+		}
+		if base != nil && changedSince(base, editor) {
+			delete(merged, "deleted")
+			conflicts = append(conflicts, "deleted")
+		}
+	}
+	sort.Strings(conflicts)
+	return merged, conflicts
+}
+
+// mergeRecordSets 对一组以 ID 为键的记录做三方合并
+func mergeRecordSets[T any](kind string, base, local, remote map[string]*T) (map[string]*T, []SyncConflict, error) {
+	ids := map[string]bool{}
+	for id := range local {
+		ids[id] = true
+	}
+	for id := range remote {
+		ids[id] = true
+	}
+
+	result := make(map[string]*T, len(ids))
+	var conflicts []SyncConflict
+	now := time.Now().UnixMilli()
+
+	for id := range ids {
+		l, r, b := local[id], remote[id], base[id]
+
+		var lf, rf, bf map[string]json.RawMessage
+		var err error
+		if l != nil {
+			if lf, err = recordFields(l); err != nil {
+				return nil, nil, err
+			}
+		}
+		if r != nil {
+			if rf, err = recordFields(r); err != nil {
+				return nil, nil, err
+			}
+		}
+		if b != nil {
+			if bf, err = recordFields(b); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		switch {
+		case r == nil && b == nil:
+			// 本地新增
+			result[id] = l
+			continue
+		case l == nil && b == nil:
+			// 远端新增
+			result[id] = r
+			continue
+		case r == nil:
+			// 远端已清理墓碑；本地没有改动时随之移除
+			if !fieldsEqual(lf, bf) {
+				result[id] = l
+			}
+			continue
+		case l == nil:
+			if !fieldsEqual(rf, bf) {
+				result[id] = r
+			}
+			continue
+		}
+
+		merged, fields := mergeRecord(bf, lf, rf)
+		data, err := json.Marshal(merged)
+		if err != nil {
+			return nil, nil, err
+		}
+		item := new(T)
+		if err := json.Unmarshal(data, item); err != nil {
+			return nil, nil, err
+		}
+		result[id] = item
+
+		// 首次同步没有基线，按 updatedAt 合并即可，不报告冲突
+		if len(fields) > 0 && b != nil {
+			localRaw, _ := json.Marshal(l)
+			remoteRaw, _ := json.Marshal(r)
+			title := rawString(lf["title"])
+			if title == "" {
+				title = rawString(lf["name"])
+			}
+			resolved := "remote"
+			if rawInt64(lf["updatedAt"]) >= rawInt64(rf["updatedAt"]) {
+				resolved = "local"
+			}
+			conflicts = append(conflicts, SyncConflict{
+				ID:         kind + ":" + id,
+				Kind:       kind,
+				ItemID:     id,
+				Title:      title,
+				Fields:     fields,
+				Local:      localRaw,
+				Remote:     remoteRaw,
+				Resolved:   resolved,
+				DetectedAt: now,
+			})
+		}
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].ID < conflicts[j].ID })
+	return result, conflicts, nil
+}
+
+func fieldsEqual(a, b map[string]json.RawMessage) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if !rawEqual(v, b[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDeleted(fields map[string]json.RawMessage) bool {
+	var deleted bool
+	json.Unmarshal(fields["deleted"], &deleted)
+	return deleted
+}
+
+// changedSince 判断记录相对基线是否有 updatedAt 以外的修改
+func changedSince(base, fields map[string]json.RawMessage) bool {
+	for k, v := range fields {
+		if k != "updatedAt" && !rawEqual(v, base[k]) {
+			return true
+		}
+	}
+	for k := range base {
+		if _, ok := fields[k]; !ok && k != "updatedAt" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,777 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 在线元数据响应的磁盘缓存有效期
+	metadataCacheTTL = 7 * 24 * time.Hour
+	metadataMaxCover = 5 << 20
+	metadataMaxBody  = 4 << 20
+	// 单个请求的超时，避免一个来源无响应时整个查询一直等待
+	metadataTimeout = 20 * time.Second
+)
+
+// MetadataQuery 是元数据查询条件，有 ISBN 时优先按 ISBN 查询
+type MetadataQuery struct {
+	ISBN   string `json:"isbn"`
+	Title  string `json:"title"`
+	Author string `json:"author"`
+}
+
+// MetadataCandidate 是某个来源返回的一条候选元数据，score 为与查询的匹配程度（0-1）
+type MetadataCandidate struct {
+	Provider      string   `json:"provider"`
+	SourceID      string   `json:"sourceId"`
+	SourceURL     string   `json:"sourceUrl,omitempty"`
+	Title         string   `json:"title"`
+	Author        string   `json:"author"`
+	Publisher     string   `json:"publisher,omitempty"`
+	PublishedDate string   `json:"publishedDate,omitempty"`
+	ISBN          string   `json:"isbn,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	CoverURL      string   `json:"coverUrl,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	Series        string   `json:"series,omitempty"`
+	Score         float64  `json:"score"`
+}
+
+// MetadataProvider 是一个在线元数据来源
+type MetadataProvider interface {
+	Name() string
+	Lookup(q MetadataQuery) ([]MetadataCandidate, error)
+}
+
+// MetadataSettings 是元数据来源的配置。providers 为启用的来源，按顺序查询；
+// Douban 兼容接口需要配置 doubanUrl 才会启用
+type MetadataSettings struct {
+	Providers    []string `json:"providers"`
+	GoogleAPIKey string   `json:"googleApiKey,omitempty"`
+	DoubanURL    string   `json:"doubanUrl,omitempty"`
+}
+
+func defaultMetadataSettings() MetadataSettings {
+	return MetadataSettings{Providers: []string{"openlibrary", "googlebooks", "douban"}}
+}
+
+// metadataFetcher 发送元数据请求，响应和封面缓存在磁盘上。
+// 使用独立的 http.Client，不经过会记录请求和响应内容的 LoggingTransport
+type metadataFetcher struct {
+	client   *http.Client
+	cacheDir string
+	coverDir string
+}
+
+type metadataCacheEntry struct {
+	URL       string `json:"url"`
+	Status    int    `json:"status"`
+	Body      string `json:"body"`
+	FetchedAt int64  `json:"fetchedAt"`
+}
+
+func cacheKey(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// getJSON 请求 JSON 并解析到 v，资源不存在时返回 false。
+// 成功和 404 响应都会缓存，避免重复查询同一本书
+func (f *metadataFetcher) getJSON(rawURL string, v interface{}) (bool, error) {
+	cachePath := filepath.Join(f.cacheDir, cacheKey(rawURL)+".json")
+	var entry metadataCacheEntry
+	if err := readJSONFile(cachePath, &entry); err != nil || time.Since(time.UnixMilli(entry.FetchedAt)) > metadataCacheTTL {
+		entry, err = f.fetch(rawURL)
+		if err != nil {
+			return false, err
+		}
+		if entry.Status == http.StatusOK || entry.Status == http.StatusNotFound {
+			if err := writeJSONFile(cachePath, entry); err != nil {
+				log.Printf("[Metadata] 保存响应缓存失败: %v", err)
+			}
+		}
+	}
+	switch entry.Status {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("%s: HTTP %d", redactURL(rawURL), entry.Status)
+	}
+	if err := json.Unmarshal([]byte(entry.Body), v); err != nil {
+		return false, fmt.Errorf("%s: %w", redactURL(rawURL), err)
+	}
+	return true, nil
+}
+
+// redactURL 隐藏查询参数中的 API key，用于错误信息、日志和缓存
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || !u.Query().Has("key") {
+		return rawURL
+	}
+	query := u.Query()
+	query.Set("key", "REDACTED")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// doRequest 发送请求，网络错误中的地址隐藏 API key
+func (f *metadataFetcher) doRequest(req *http.Request) (*http.Response, error) {
+	resp, err := f.client.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = redactURL(urlErr.URL)
+	}
+	return resp, err
+}
+
+func (f *metadataFetcher) fetch(rawURL string) (metadataCacheEntry, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return metadataCacheEntry{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", AppName+" (metadata)")
+	resp, err := f.doRequest(req)
+	if err != nil {
+		return metadataCacheEntry{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, metadataMaxBody))
+	if err != nil {
+		return metadataCacheEntry{}, err
+	}
+	return metadataCacheEntry{
+		URL:       redactURL(rawURL),
+		Status:    resp.StatusCode,
+		Body:      string(body),
+		FetchedAt: time.Now().UnixMilli(),
+	}, nil
+}
+
+// cover 返回封面图片，优先使用本地缓存
+func (f *metadataFetcher) cover(rawURL string) ([]byte, error) {
+	cachePath := filepath.Join(f.coverDir, cacheKey(rawURL))
+	if data, err := os.ReadFile(cachePath); err == nil {
+		return data, nil
+	}
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "image/*")
+	req.Header.Set("User-Agent", AppName+" (metadata)")
+	resp, err := f.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: HTTP %d", rawURL, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, metadataMaxCover+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > metadataMaxCover {
+		return nil, fmt.Errorf("cover too large")
+	}
+	if !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		return nil, fmt.Errorf("%s: not an image", rawURL)
+	}
+	if err := os.MkdirAll(f.coverDir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(cachePath, data, 0o644); err != nil {
+		log.Printf("[Metadata] 保存封面缓存失败: %v", err)
+	}
+	return data, nil
+}
+
+// coverDataURL 返回封面的 data URL，与前端保存封面的方式一致
+func (f *metadataFetcher) coverDataURL(rawURL string) (string, error) {
+	data, err := f.cover(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return "data:" + http.DetectContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// openLibraryProvider 使用 Open Library 的 Books API 和搜索 API
+type openLibraryProvider struct {
+	fetch   *metadataFetcher
+	baseURL string
+}
+
+func (p *openLibraryProvider) Name() string { return "openlibrary" }
+
+func (p *openLibraryProvider) Lookup(q MetadataQuery) ([]MetadataCandidate, error) {
+	if q.ISBN != "" {
+		var result map[string]struct {
+			Key         string `json:"key"`
+			URL         string `json:"url"`
+			Title       string `json:"title"`
+			Subtitle    string `json:"subtitle"`
+			PublishDate string `json:"publish_date"`
+			Authors     []struct {
+				Name string `json:"name"`
+			} `json:"authors"`
+			Publishers []struct {
+				Name string `json:"name"`
+			} `json:"publishers"`
+			Subjects []struct {
+				Name string `json:"name"`
+			} `json:"subjects"`
+			Cover struct {
+				Large string `json:"large"`
+			} `json:"cover"`
+		}
+		params := url.Values{"bibkeys": {"ISBN:" + q.ISBN}, "format": {"json"}, "jscmd": {"data"}}
+		if _, err := p.fetch.getJSON(p.baseURL+"/api/books?"+params.Encode(), &result); err != nil {
+			return nil, err
+		}
+		var candidates []MetadataCandidate
+		for _, b := range result {
+			c := MetadataCandidate{
+				SourceID:      b.Key,
+				SourceURL:     b.URL,
+				Title:         joinSubtitle(b.Title, b.Subtitle),
+				PublishedDate: b.PublishDate,
+				ISBN:          q.ISBN,
+				CoverURL:      b.Cover.Large,
+			}
+			var authors []string
+			for _, a := range b.Authors {
+				authors = append(authors, a.Name)
+			}
+			c.Author = strings.Join(authors, ", ")
+			if len(b.Publishers) > 0 {
+				c.Publisher = b.Publishers[0].Name
+			}
+			for _, s := range b.Subjects {
+				c.Tags = append(c.Tags, s.Name)
+			}
+			candidates = append(candidates, c)
+		}
+		if len(candidates) > 0 || q.Title == "" {
+			return candidates, nil
+		}
+	}
+	if q.Title == "" {
+		return nil, nil
+	}
+
+	var result struct {
+		Docs []struct {
+			Key              string   `json:"key"`
+			Title            string   `json:"title"`
+			Subtitle         string   `json:"subtitle"`
+			AuthorName       []string `json:"author_name"`
+			Publisher        []string `json:"publisher"`
+			FirstPublishYear int      `json:"first_publish_year"`
+			ISBN             []string `json:"isbn"`
+			CoverID          int      `json:"cover_i"`
+			Subject          []string `json:"subject"`
+		} `json:"docs"`
+	}
+	params := url.Values{
+		"title":  {q.Title},
+		"limit":  {"10"},
+		"fields": {"key,title,subtitle,author_name,publisher,first_publish_year,isbn,cover_i,subject"},
+	}
+	if q.Author != "" {
+		params.Set("author", q.Author)
+	}
+	if _, err := p.fetch.getJSON(p.baseURL+"/search.json?"+params.Encode(), &result); err != nil {
+		return nil, err
+	}
+	var candidates []MetadataCandidate
+	for _, d := range result.Docs {
+		c := MetadataCandidate{
+			SourceID:  d.Key,
+			SourceURL: p.baseURL + d.Key,
+			Title:     joinSubtitle(d.Title, d.Subtitle),
+			Author:    strings.Join(d.AuthorName, ", "),
+		}
+		if len(d.Publisher) > 0 {
+			c.Publisher = d.Publisher[0]
+		}
+		if d.FirstPublishYear > 0 {
+			c.PublishedDate = fmt.Sprint(d.FirstPublishYear)
+		}
+		for _, isbn := range d.ISBN {
+			if n := normalizeISBN(isbn); n != "" {
+				c.ISBN = n
+				break
+			}
+		}
+		if d.CoverID > 0 {
+			c.CoverURL = fmt.Sprintf("https://covers.openlibrary.org/b/id/%d-L.jpg", d.CoverID)
+		}
+		if len(d.Subject) > 5 {
+			d.Subject = d.Subject[:5]
+		}
+		c.Tags = d.Subject
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// googleBooksProvider 使用 Google Books 的 volumes API，apiKey 可以为空
+type googleBooksProvider struct {
+	fetch   *metadataFetcher
+	baseURL string
+	apiKey  string
+}
+
+func (p *googleBooksProvider) Name() string { return "googlebooks" }
+
+func (p *googleBooksProvider) Lookup(q MetadataQuery) ([]MetadataCandidate, error) {
+	if q.ISBN != "" {
+		candidates, err := p.search("isbn:" + q.ISBN)
+		if err != nil || len(candidates) > 0 || q.Title == "" {
+			return candidates, err
+		}
+	}
+	if q.Title == "" {
+		return nil, nil
+	}
+	query := "intitle:" + q.Title
+	if q.Author != "" {
+		query += " inauthor:" + q.Author
+	}
+	return p.search(query)
+}
+
+func (p *googleBooksProvider) search(query string) ([]MetadataCandidate, error) {
+	var result struct {
+		Items []struct {
+			ID         string `json:"id"`
+			VolumeInfo struct {
+				Title               string   `json:"title"`
+				Subtitle            string   `json:"subtitle"`
+				Authors             []string `json:"authors"`
+				Publisher           string   `json:"publisher"`
+				PublishedDate       string   `json:"publishedDate"`
+				Description         string   `json:"description"`
+				Categories          []string `json:"categories"`
+				InfoLink            string   `json:"infoLink"`
+				IndustryIdentifiers []struct {
+					Type       string `json:"type"`
+					Identifier string `json:"identifier"`
+				} `json:"industryIdentifiers"`
+				ImageLinks struct {
+					Thumbnail string `json:"thumbnail"`
+				} `json:"imageLinks"`
+			} `json:"volumeInfo"`
+		} `json:"items"`
+	}
+	params := url.Values{"q": {query}, "maxResults": {"10"}}
+	if p.apiKey != "" {
+		params.Set("key", p.apiKey)
+	}
+	if _, err := p.fetch.getJSON(p.baseURL+"/books/v1/volumes?"+params.Encode(), &result); err != nil {
+		return nil, err
+	}
+	var candidates []MetadataCandidate
+	for _, item := range result.Items {
+		v := item.VolumeInfo
+		c := MetadataCandidate{
+			SourceID:      item.ID,
+			SourceURL:     v.InfoLink,
+			Title:         joinSubtitle(v.Title, v.Subtitle),
+			Author:        strings.Join(v.Authors, ", "),
+			Publisher:     v.Publisher,
+			PublishedDate: v.PublishedDate,
+			Description:   v.Description,
+			Tags:          v.Categories,
+		}
+		for _, id := range v.IndustryIdentifiers {
+			if id.Type == "ISBN_13" || (id.Type == "ISBN_10" && c.ISBN == "") {
+				c.ISBN = normalizeISBN(id.Identifier)
+			}
+		}
+		// 缩略图默认是 http 且带卷角效果
+		if cover := v.ImageLinks.Thumbnail; cover != "" {
+			cover = strings.Replace(cover, "http://", "https://", 1)
+			c.CoverURL = strings.Replace(cover, "&edge=curl", "", 1)
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// doubanProvider 使用与豆瓣 v2 图书接口兼容的服务，通常是自建的代理
+type doubanProvider struct {
+	fetch   *metadataFetcher
+	baseURL string
+}
+
+type doubanBook struct {
+	ID        string   `json:"id"`
+	Title     string   `json:"title"`
+	Subtitle  string   `json:"subtitle"`
+	Author    []string `json:"author"`
+	Publisher string   `json:"publisher"`
+	Pubdate   string   `json:"pubdate"`
+	ISBN13    string   `json:"isbn13"`
+	ISBN10    string   `json:"isbn10"`
+	Summary   string   `json:"summary"`
+	Image     string   `json:"image"`
+	Alt       string   `json:"alt"`
+	Images    struct {
+		Large string `json:"large"`
+	} `json:"images"`
+	Tags []struct {
+		Name string `json:"name"`
+	} `json:"tags"`
+	Series struct {
+		Title string `json:"title"`
+	} `json:"series"`
+}
+
+func (p *doubanProvider) Name() string { return "douban" }
+
+func (p *doubanProvider) Lookup(q MetadataQuery) ([]MetadataCandidate, error) {
+	if q.ISBN != "" {
+		var book doubanBook
+		found, err := p.fetch.getJSON(p.baseURL+"/v2/book/isbn/"+url.PathEscape(q.ISBN), &book)
+		if err != nil {
+			return nil, err
+		}
+		if found && book.Title != "" {
+			return []MetadataCandidate{book.candidate()}, nil
+		}
+		if q.Title == "" {
+			return nil, nil
+		}
+	}
+	if q.Title == "" {
+		return nil, nil
+	}
+	var result struct {
+		Books []doubanBook `json:"books"`
+	}
+	keyword := strings.TrimSpace(q.Title + " " + q.Author)
+	params := url.Values{"q": {keyword}, "count": {"10"}}
+	if _, err := p.fetch.getJSON(p.baseURL+"/v2/book/search?"+params.Encode(), &result); err != nil {
+		return nil, err
+	}
+	var candidates []MetadataCandidate
+	for _, b := range result.Books {
+		candidates = append(candidates, b.candidate())
+	}
+	return candidates, nil
+}
+
+func (b doubanBook) candidate() MetadataCandidate {
+	c := MetadataCandidate{
+		SourceID:      b.ID,
+		SourceURL:     b.Alt,
+		Title:         joinSubtitle(b.Title, b.Subtitle),
+		Author:        strings.Join(b.Author, ", "),
+		Publisher:     b.Publisher,
+		PublishedDate: b.Pubdate,
+		ISBN:          normalizeISBN(b.ISBN13),
+		Description:   b.Summary,
+		CoverURL:      b.Images.Large,
+		Series:        b.Series.Title,
+	}
+	if c.ISBN == "" {
+		c.ISBN = normalizeISBN(b.ISBN10)
+	}
+	if c.CoverURL == "" {
+		c.CoverURL = b.Image
+	}
+	for _, t := range b.Tags {
+		c.Tags = append(c.Tags, t.Name)
+	}
+	return c
+}
+
+func joinSubtitle(title, subtitle string) string {
+	if subtitle == "" {
+		return title
+	}
+	return title + "：" + subtitle
+}
+
+// bigrams 返回规整后文本的字符二元组，单字符文本返回自身
+func bigrams(s string) map[string]int {
+	runes := []rune(normalizeText(s))
+	grams := map[string]int{}
+	if len(runes) == 1 {
+		grams[string(runes)]++
+	}
+	for i := 0; i+1 < len(runes); i++ {
+		grams[string(runes[i:i+2])]++
+	}
+	return grams
+}
+
+// textSimilarity 用字符二元组的 Dice 系数比较两段文本，中英文都适用
+func textSimilarity(a, b string) float64 {
+	ga, gb := bigrams(a), bigrams(b)
+	total := 0
+	for _, n := range ga {
+		total += n
+	}
+	for _, n := range gb {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	common := 0
+	for g, n := range ga {
+		common += min(n, gb[g])
+	}
+	return 2 * float64(common) / float64(total)
+}
+
+// scoreCandidate 计算候选与查询的匹配程度：ISBN 相同直接视为匹配，
+// 否则按书名和作者的相似度加权，没有作者时只比较书名
+func scoreCandidate(q MetadataQuery, c MetadataCandidate) float64 {
+	if q.ISBN != "" && c.ISBN != "" && normalizeISBN(q.ISBN) == normalizeISBN(c.ISBN) {
+		return 1
+	}
+	title := textSimilarity(q.Title, c.Title)
+	// 候选书名带副标题时，只要主标题一致也算匹配
+	if main, _, ok := strings.Cut(c.Title, "："); ok {
+		title = max(title, textSimilarity(q.Title, main))
+	}
+	if q.Author == "" {
+		return title * 0.9
+	}
+	return 0.7*title + 0.2*textSimilarity(q.Author, c.Author)
+}
+
+// MetadataService 管理在线元数据来源和缓存
+type MetadataService struct {
+	app   *App
+	path  string
+	fetch *metadataFetcher
+
+	mu       sync.RWMutex
+	settings MetadataSettings
+}
+
+func NewMetadataService(app *App, dir string) *MetadataService {
+	s := &MetadataService{
+		app:  app,
+		path: filepath.Join(dir, "metadata.json"),
+		fetch: &metadataFetcher{
+			client:   &http.Client{Timeout: metadataTimeout},
+			cacheDir: filepath.Join(dir, "metadata-cache"),
+			coverDir: filepath.Join(dir, "covers"),
+		},
+		settings: defaultMetadataSettings(),
+	}
+	if err := readJSONFile(s.path, &s.settings); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Metadata] 读取元数据设置失败: %v", err)
+	}
+	return s
+}
+
+func (s *MetadataService) Settings() MetadataSettings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settings
+}
+
+func (s *MetadataService) SetSettings(settings MetadataSettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings.DoubanURL = strings.TrimRight(strings.TrimSpace(settings.DoubanURL), "/")
+	s.settings = settings
+	return writeJSONFile(s.path, settings)
+}
+
+// providers 按设置返回启用的来源
+func (s *MetadataService) providers() []MetadataProvider {
+	settings := s.Settings()
+	var providers []MetadataProvider
+	for _, name := range settings.Providers {
+		switch name {
+		case "openlibrary":
+			providers = append(providers, &openLibraryProvider{fetch: s.fetch, baseURL: "https://openlibrary.org"})
+		case "googlebooks":
+			providers = append(providers, &googleBooksProvider{fetch: s.fetch, baseURL: "https://www.googleapis.com", apiKey: settings.GoogleAPIKey})
+		case "douban":
+			if settings.DoubanURL != "" {
+				providers = append(providers, &doubanProvider{fetch: s.fetch, baseURL: settings.DoubanURL})
+			}
+		}
+	}
+	return providers
+}
+
+// Search 并发查询全部来源，返回按匹配程度排序的候选和各来源的错误
+func (s *MetadataService) Search(q MetadataQuery) ([]MetadataCandidate, map[string]string) {
+	q.ISBN = normalizeISBN(q.ISBN)
+	q.Title = strings.TrimSpace(q.Title)
+	if isUnknownAuthor(q.Author) {
+		q.Author = ""
+	}
+	providers := s.providers()
+	results := make([][]MetadataCandidate, len(providers))
+	errs := map[string]string{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p MetadataProvider) {
+			defer wg.Done()
+			candidates, err := p.Lookup(q)
+			if err != nil {
+				log.Printf("[Metadata] %s 查询失败: %v", p.Name(), err)
+				mu.Lock()
+				errs[p.Name()] = err.Error()
+				mu.Unlock()
+				return
+			}
+			for j := range candidates {
+				candidates[j].Provider = p.Name()
+				candidates[j].Score = scoreCandidate(q, candidates[j])
+			}
+			results[i] = candidates
+		}(i, p)
+	}
+	wg.Wait()
+
+	candidates := []MetadataCandidate{}
+	for _, r := range results {
+		candidates = append(candidates, r...)
+	}
+	// 分数相同时保持来源的配置顺序
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+	return candidates, errs
+}
+
+// bookQuery 根据书籍生成查询条件，本地 EPUB 从文件中读取 ISBN
+func (s *MetadataService) bookQuery(book EbookMetadata) MetadataQuery {
+	q := MetadataQuery{ISBN: book.ISBN, Title: book.Title, Author: book.Author}
+	if q.ISBN == "" && strings.EqualFold(book.Format, "epub") {
+		if p, err := s.app.store.Path(book.ID); err == nil {
+			q.ISBN = epubISBN(p)
+		}
+	}
+	return q
+}
+
+// applyCandidate 把候选中用户选择的字段写入书籍
+func (s *MetadataService) applyCandidate(book *EbookMetadata, c MetadataCandidate, fields []string) error {
+	for _, field := range fields {
+		switch field {
+		case "title":
+			book.Title = c.Title
+		case "author":
+			book.Author = c.Author
+		case "publisher":
+			book.Publisher = c.Publisher
+		case "publishedDate":
+			book.PublishedDate = c.PublishedDate
+		case "isbn":
+			book.ISBN = c.ISBN
+		case "description":
+			book.Description = c.Description
+		case "tags":
+			book.Tags = normalizeTags(append(book.Tags, c.Tags...))
+		case "series":
+			book.Series = c.Series
+		case "cover":
+			if c.CoverURL == "" {
+				continue
+			}
+			cover, err := s.fetch.coverDataURL(c.CoverURL)
+			if err != nil {
+				return fmt.Errorf("download cover: %w", err)
+			}
+			book.Cover = cover
+		default:
+			return fmt.Errorf("unknown field %q", field)
+		}
+	}
+	return nil
+}
+
+// FetchMetadata 按书籍当前的 ISBN、书名和作者在线查询元数据候选
+func (a *App) FetchMetadata(ebookId string) string {
+	book, ok := a.library.Book(ebookId)
+	if !ok {
+		return `{"error": "book not found"}`
+	}
+	q := a.metadata.bookQuery(book)
+	candidates, errs := a.metadata.Search(q)
+	return jsonResult(map[string]interface{}{
+		"query":      q,
+		"candidates": candidates,
+		"errors":     errs,
+	})
+}
+
+// SearchMetadata 按用户输入的条件查询元数据候选
+func (a *App) SearchMetadata(query MetadataQuery) string {
+	if query.ISBN == "" && strings.TrimSpace(query.Title) == "" {
+		return `{"error": "isbn or title is required"}`
+	}
+	candidates, errs := a.metadata.Search(query)
+	return jsonResult(map[string]interface{}{
+		"candidates": candidates,
+		"errors":     errs,
+	})
+}
+
+// ApplyMetadata 把候选中的指定字段写入书籍，fields 可以是 title、author、publisher、
+// publishedDate、isbn、description、tags、series、cover；返回更新后的书籍
+func (a *App) ApplyMetadata(ebookId string, candidate MetadataCandidate, fields []string) string {
+	book, ok := a.library.Book(ebookId)
+	if !ok {
+		return `{"error": "book not found"}`
+	}
+	if err := a.metadata.applyCandidate(&book, candidate, fields); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if err := a.library.PutBook(book); err != nil {
+		log.Printf("[Metadata] 保存书籍失败: %v", err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	a.emit("library:changed")
+	return jsonResult(book)
+}
+
+// GetMetadataCover 返回候选封面的 data URL，封面会缓存在本地
+func (a *App) GetMetadataCover(coverUrl string) string {
+	cover, err := a.metadata.fetch.coverDataURL(coverUrl)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(map[string]string{"cover": cover})
+}
+
+func (a *App) GetMetadataSettings() MetadataSettings {
+	return a.metadata.Settings()
+}
+
+func (a *App) SetMetadataSettings(settings MetadataSettings) string {
+	if err := a.metadata.SetSettings(settings); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 以下响应按各服务的真实返回精简而来，只保留解析用到的字段
+
+const testOpenLibraryBooks = `{
+  "ISBN:9787536692930": {
+    "url": "https://openlibrary.org/books/OL26286361M/San_ti",
+    "key": "/books/OL26286361M",
+    "title": "三体",
+    "authors": [{"url": "https://openlibrary.org/authors/OL7360424A/Liu_Cixin", "name": "刘慈欣"}],
+    "publishers": [{"name": "重庆出版社"}],
+    "publish_date": "2008",
+    "subjects": [{"name": "Science fiction", "url": "https://openlibrary.org/subjects/science_fiction"}],
+    "cover": {
+      "small": "https://covers.openlibrary.org/b/id/8295221-S.jpg",
+      "large": "https://covers.openlibrary.org/b/id/8295221-L.jpg"
+    }
+  }
+}`
+
+const testOpenLibrarySearch = `{
+  "numFound": 1,
+  "start": 0,
+  "docs": [
+    {
+      "key": "/works/OL17267881W",
+      "title": "The Three-Body Problem",
+      "author_name": ["Cixin Liu"],
+      "publisher": ["Tor Books", "Head of Zeus"],
+      "first_publish_year": 2008,
+      "isbn": ["not-an-isbn", "0765377067", "9780765377067"],
+      "cover_i": 8295221,
+      "subject": ["Science fiction", "Aliens", "China", "Physics", "Nanotechnology", "Cultural Revolution"]
+    }
+  ]
+}`
+
+const testGoogleBooksEmpty = `{"kind": "books#volumes", "totalItems": 0}`
+
+const testGoogleBooksVolumes = `{
+  "kind": "books#volumes",
+  "totalItems": 1,
+  "items": [
+    {
+      "kind": "books#volume",
+      "id": "ZrNzAwAAQBAJ",
+      "volumeInfo": {
+        "title": "The Three-Body Problem",
+        "subtitle": "Remembrance of Earth's Past",
+        "authors": ["Cixin Liu"],
+        "publisher": "Tor Books",
+        "publishedDate": "2014-11-11",
+        "description": "Set against the backdrop of China's Cultural Revolution...",
+        "industryIdentifiers": [
+          {"type": "ISBN_10", "identifier": "0765377063"},
+          {"type": "ISBN_13", "identifier": "9780765377067"}
+        ],
+        "categories": ["Fiction"],
+        "imageLinks": {
+          "smallThumbnail": "http://books.google.com/books/content?id=ZrNzAwAAQBAJ&printsec=frontcover&img=1&zoom=5&edge=curl&source=gbs_api",
+          "thumbnail": "http://books.google.com/books/content?id=ZrNzAwAAQBAJ&printsec=frontcover&img=1&zoom=1&edge=curl&source=gbs_api"
+        },
+        "infoLink": "https://books.google.com/books?id=ZrNzAwAAQBAJ"
+      }
+    }
+  ]
+}`
+
+const testDoubanNotFound = `{"msg": "book_not_found", "code": 6000, "request": "GET /v2/book/isbn/9780000000002"}`
+
+const testDoubanSearch = `{
+  "count": 1,
+  "start": 0,
+  "total": 1,
+  "books": [
+    {
+      "id": "2567698",
+      "title": "三体",
+      "subtitle": "",
+      "author": ["刘慈欣"],
+      "publisher": "重庆出版社",
+      "pubdate": "2008-1",
+      "isbn10": "7536692935",
+      "isbn13": "",
+      "summary": "文化大革命如火如荼进行的同时……",
+      "image": "https://img9.doubanio.com/view/subject/m/public/s2768378.jpg",
+      "images": {"large": "https://img9.doubanio.com/view/subject/l/public/s2768378.jpg"},
+      "alt": "https://book.douban.com/subject/2567698/",
+      "tags": [{"count": 1000, "name": "科幻"}, {"count": 800, "name": "刘慈欣"}],
+      "series": {"id": "6628", "title": "中国科幻基石丛书"}
+    }
+  ]
+}`
+
+// testPNG 只需要文件头就能被识别为图片
+const testPNG = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00"
+
+// metadataFixtureServer 按路径返回录制的响应，并记录每个路径被请求的次数和查询参数
+type metadataFixtureServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	hits    map[string]int
+	queries map[string][]string
+}
+
+func newMetadataFixtureServer(t *testing.T) *metadataFixtureServer {
+	t.Helper()
+	s := &metadataFixtureServer{hits: map[string]int{}, queries: map[string][]string{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.hits[r.URL.Path]++
+		s.queries[r.URL.Path] = append(s.queries[r.URL.Path], r.URL.RawQuery)
+		s.mu.Unlock()
+
+		query := r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/books":
+			if query.Get("bibkeys") == "ISBN:9787536692930" {
+				w.Write([]byte(testOpenLibraryBooks))
+			} else {
+				w.Write([]byte(`{}`))
+			}
+		case "/search.json":
+			w.Write([]byte(testOpenLibrarySearch))
+		case "/books/v1/volumes":
+			if strings.HasPrefix(query.Get("q"), "isbn:") {
+				w.Write([]byte(testGoogleBooksEmpty))
+			} else {
+				w.Write([]byte(testGoogleBooksVolumes))
+			}
+		case "/v2/book/search":
+			w.Write([]byte(testDoubanSearch))
+		case "/covers/1.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(testPNG))
+		case "/covers/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>not found</body></html>"))
+		case "/slow":
+			<-r.Context().Done()
+		default:
+			if strings.HasPrefix(r.URL.Path, "/v2/book/isbn/") {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(testDoubanNotFound))
+				return
+			}
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *metadataFixtureServer) hitCount(p string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[p]
+}
+
+func (s *metadataFixtureServer) query(p string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries[p]...)
+}
+
+func newTestMetadataFetcher(t *testing.T, timeout time.Duration) *metadataFetcher {
+	t.Helper()
+	dir := t.TempDir()
+	return &metadataFetcher{
+		client:   &http.Client{Timeout: timeout},
+		cacheDir: filepath.Join(dir, "metadata-cache"),
+		coverDir: filepath.Join(dir, "covers"),
+	}
+}
+
+func TestOpenLibraryLookup(t *testing.T) {
+	server := newMetadataFixtureServer(t)
+	p := &openLibraryProvider{fetch: newTestMetadataFetcher(t, time.Second), baseURL: server.URL}
+
+	candidates, err := p.Lookup(MetadataQuery{ISBN: "9787536692930", Title: "三体"})
+	if err != nil || len(candidates) != 1 {
+		t.Fatalf("lookup by isbn = %+v, %v", candidates, err)
+	}
+	c := candidates[0]
+	if c.Title != "三体" || c.Author != "刘慈欣" || c.Publisher != "重庆出版社" || c.PublishedDate != "2008" ||
+		c.ISBN != "9787536692930" || c.CoverURL != "https://covers.openlibrary.org/b/id/8295221-L.jpg" ||
+		len(c.Tags) != 1 || c.Tags[0] != "Science fiction" {
+		t.Fatalf("isbn candidate = %+v", c)
+	}
+	if server.hitCount("/search.json") != 0 {
+		t.Fatal("title search should be skipped when the isbn matches")
+	}
+
+	candidates, err = p.Lookup(MetadataQuery{Title: "The Three-Body Problem", Author: "Cixin Liu"})
+	if err != nil || len(candidates) != 1 {
+		t.Fatalf("lookup by title = %+v, %v", candidates, err)
+	}
+	c = candidates[0]
+	if c.SourceURL != server.URL+"/works/OL17267881W" || c.Publisher != "Tor Books" || c.PublishedDate != "2008" ||
+		c.ISBN != "9780765377067" || c.CoverURL != "https://covers.openlibrary.org/b/id/8295221-L.jpg" || len(c.Tags) != 5 {
+		t.Fatalf("title candidate = %+v", c)
+	}
+	if q := server.query("/search.json")[0]; !strings.Contains(q, "author=Cixin+Liu") || !strings.Contains(q, "title=The+Three-Body+Problem") {
+		t.Fatalf("search query = %s", q)
+	}
+}
+
+func TestGoogleBooksLookup(t *testing.T) {
+	server := newMetadataFixtureServer(t)
+	p := &googleBooksProvider{fetch: newTestMetadataFetcher(t, time.Second), baseURL: server.URL, apiKey: "test-key"}
+
+	// ISBN 没有结果时改用书名和作者查询
+	candidates, err := p.Lookup(MetadataQuery{ISBN: "9780765377067", Title: "The Three-Body Problem", Author: "Cixin Liu"})
+	if err != nil || len(candidates) != 1 {
+		t.Fatalf("lookup = %+v, %v", candidates, err)
+	}
+	c := candidates[0]
+	if c.Title != "The Three-Body Problem：Remembrance of Earth's Past" || c.ISBN != "9780765377067" ||
+		c.PublishedDate != "2014-11-11" || c.SourceURL != "https://books.google.com/books?id=ZrNzAwAAQBAJ" {
+		t.Fatalf("candidate = %+v", c)
+	}
+	if want := "https://books.google.com/books/content?id=ZrNzAwAAQBAJ&printsec=frontcover&img=1&zoom=1&source=gbs_api"; c.CoverURL != want {
+		t.Fatalf("cover = %s, want %s", c.CoverURL, want)
+	}
+	queries := server.query("/books/v1/volumes")
+	if len(queries) != 2 || !strings.Contains(queries[0], "q=isbn%3A9780765377067") ||
+		!strings.Contains(queries[1], "intitle%3AThe+Three-Body+Problem+inauthor%3ACixin+Liu") {
+		t.Fatalf("queries = %v", queries)
+	}
+	for _, q := range queries {
+		if !strings.Contains(q, "key=test-key") {
+			t.Fatalf("api key missing from %s", q)
+		}
+	}
+}
+
+func TestDoubanLookup(t *testing.T) {
+	server := newMetadataFixtureServer(t)
+	p := &doubanProvider{fetch: newTestMetadataFetcher(t, time.Second), baseURL: server.URL}
+	q := MetadataQuery{ISBN: "9780000000002", Title: "三体", Author: "刘慈欣"}
+
+	for i := 0; i < 2; i++ {
+		candidates, err := p.Lookup(q)
+		if err != nil || len(candidates) != 1 {
+			t.Fatalf("lookup = %+v, %v", candidates, err)
+		}
+		c := candidates[0]
+		if c.ISBN != "9787536692930" || c.Series != "中国科幻基石丛书" || c.SourceURL != "https://book.douban.com/subject/2567698/" ||
+			c.CoverURL != "https://img9.doubanio.com/view/subject/l/public/s2768378.jpg" || len(c.Tags) != 2 {
+			t.Fatalf("candidate = %+v", c)
+		}
+	}
+	// 404 和成功的响应都已缓存，第二次查询不再请求
+	if n := server.hitCount("/v2/book/isbn/9780000000002"); n != 1 {
+		t.Fatalf("isbn requests = %d, want 1", n)
+	}
+	if n := server.hitCount("/v2/book/search"); n != 1 {
+		t.Fatalf("search requests = %d, want 1", n)
+	}
+}
+
+func TestMetadataCover(t *testing.T) {
+	server := newMetadataFixtureServer(t)
+	f := newTestMetadataFetcher(t, time.Second)
+
+	for i := 0; i < 2; i++ {
+		cover, err := f.coverDataURL(server.URL + "/covers/1.png")
+		if err != nil || !strings.HasPrefix(cover, "data:image/png;base64,") {
+			t.Fatalf("cover = %.40s, %v", cover, err)
+		}
+	}
+	if n := server.hitCount("/covers/1.png"); n != 1 {
+		t.Fatalf("cover requests = %d, want 1", n)
+	}
+	if _, err := f.cover(server.URL + "/covers/page.html"); err == nil || !strings.Contains(err.Error(), "not an image") {
+		t.Fatalf("html cover: %v, want not an image", err)
+	}
+}
+
+func TestMetadataTimeoutHidesAPIKey(t *testing.T) {
+	server := newMetadataFixtureServer(t)
+	f := newTestMetadataFetcher(t, 100*time.Millisecond)
+
+	var v struct{}
+	start := time.Now()
+	_, err := f.getJSON(server.URL+"/slow?q=x&key=secret-key", &v)
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("request was not cut off by the timeout")
+	}
+	if strings.Contains(err.Error(), "secret-key") {
+		t.Fatalf("error leaks the api key: %v", err)
+	}
+}
+
+func TestMetadataServiceClient(t *testing.T) {
+	app := &App{client: &http.Client{}}
+	s := NewMetadataService(app, t.TempDir())
+	if s.fetch.client == app.client || s.fetch.client.Timeout <= 0 {
+		t.Fatalf("metadata requests must use a dedicated client with a timeout")
+	}
+}
@@ -0,0 +1,982 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	opdsAcceptHeader = "application/atom+xml;profile=opds-catalog, application/opds+json, application/atom+xml;q=0.9, application/json;q=0.8, */*;q=0.5"
+	opdsMaxFeedSize  = 16 << 20
+	opdsMaxCoverSize = 2 << 20
+	opdsMaxBookSize  = 1 << 30
+	// opdsDownloadIdleTimeout 下载书籍时允许连续多久收不到数据
+	opdsDownloadIdleTimeout = 60 * time.Second
+)
+
+// OPDSCatalog 是用户添加的一个 OPDS 书库
+type OPDSCatalog struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// OPDSLink 是 OPDS 1.2 和 2.0 共用的链接描述
+type OPDSLink struct {
+	Href       string `json:"href"`
+	Rel        string `json:"rel,omitempty"`
+	Type       string `json:"type,omitempty"`
+	Title      string `json:"title,omitempty"`
+	FacetGroup string `json:"facetGroup,omitempty"`
+	Active     bool   `json:"active,omitempty"`
+	Count      int    `json:"count,omitempty"`
+}
+
+// OPDSEntry 是一本书（或一个导航条目）
+type OPDSEntry struct {
+	ID           string     `json:"id"`
+	Title        string     `json:"title"`
+	Authors      []string   `json:"authors"`
+	Summary      string     `json:"summary,omitempty"`
+	Language     string     `json:"language,omitempty"`
+	Publisher    string     `json:"publisher,omitempty"`
+	Published    string     `json:"published,omitempty"`
+	Categories   []string   `json:"categories,omitempty"`
+	Cover        string     `json:"cover,omitempty"`
+	Thumbnail    string     `json:"thumbnail,omitempty"`
+	Acquisitions []OPDSLink `json:"acquisitions,omitempty"`
+	// Navigation 不为空时条目指向另一个目录
+	Navigation string `json:"navigation,omitempty"`
+}
+
+// OPDSFacetGroup 是一组互斥的筛选条件
+type OPDSFacetGroup struct {
+	Title string     `json:"title"`
+	Links []OPDSLink `json:"links"`
+}
+
+// OPDSFeed 是解析后的目录页，所有链接都已转为绝对地址
+type OPDSFeed struct {
+	URL        string           `json:"url"`
+	Title      string           `json:"title"`
+	Entries    []OPDSEntry      `json:"entries"`
+	Navigation []OPDSLink       `json:"navigation"`
+	Facets     []OPDSFacetGroup `json:"facets"`
+	Next       string           `json:"next,omitempty"`
+	Previous   string           `json:"previous,omitempty"`
+	First      string           `json:"first,omitempty"`
+	Last       string           `json:"last,omitempty"`
+	// Search 是搜索模板，{searchTerms} 处填入关键字
+	Search string `json:"search,omitempty"`
+
+	// 只提供 OpenSearch 描述文件时先记下，由 Fetch 解析出模板
+	searchDescription string
+}
+
+// OPDSClient 访问单个 OPDS 书库，只向书库所在主机发送认证信息
+type OPDSClient struct {
+	catalog OPDSCatalog
+	http    *http.Client
+	// download 用于下载书籍，不设总超时，由 Download 在长时间没有数据时中止
+	download *http.Client
+}
+
+func NewOPDSClient(catalog OPDSCatalog) *OPDSClient {
+	return &OPDSClient{catalog: catalog, http: &http.Client{Timeout: 60 * time.Second}, download: &http.Client{}}
+}
+
+func (c *OPDSClient) resolve(base, href string) string {
+	if href == "" {
+		return ""
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return href
+	}
+	// 模板中的 { } 会被 url.Parse 转义，先替换掉再还原
+	ref, err := url.Parse(strings.NewReplacer("{", "%7B", "}", "%7D").Replace(href))
+	if err != nil {
+		return href
+	}
+	return strings.NewReplacer("%7B", "{", "%7D", "}").Replace(b.ResolveReference(ref).String())
+}
+
+func (c *OPDSClient) get(rawURL, accept string) (*http.Response, error) {
+	return c.send(context.Background(), c.http, rawURL, accept)
+}
+
+func (c *OPDSClient) send(ctx context.Context, client *http.Client, rawURL, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", "NeatReader")
+	if c.catalog.Username != "" {
+		root, _ := url.Parse(c.catalog.URL)
+		if root != nil && strings.EqualFold(root.Host, req.URL.Host) {
+			req.SetBasicAuth(c.catalog.Username, c.catalog.Password)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		return nil, fmt.Errorf("authentication required")
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: HTTP %d", rawURL, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// Fetch 读取并解析一页目录，根据内容类型自动识别 OPDS 1.2 (Atom) 和 2.0 (JSON)
+func (c *OPDSClient) Fetch(rawURL string) (*OPDSFeed, error) {
+	resp, err := c.get(rawURL, opdsAcceptHeader)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, opdsMaxFeedSize))
+	if err != nil {
+		return nil, err
+	}
+
+	feedURL := resp.Request.URL.String()
+	contentType := resp.Header.Get("Content-Type")
+	var feed *OPDSFeed
+	if strings.Contains(contentType, "json") || bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		feed, err = c.parseJSONFeed(feedURL, data)
+	} else {
+		feed, err = c.parseAtomFeed(feedURL, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if feed.Search == "" && feed.searchDescription != "" {
+		feed.Search = c.openSearchTemplate(feed.searchDescription)
+	}
+	return feed, nil
+}
+
+// atomFeed 是 OPDS 1.2 中用到的 Atom 字段
+type atomFeed struct {
+	Title   string      `xml:"title"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href       string `xml:"href,attr"`
+	Rel        string `xml:"rel,attr"`
+	Type       string `xml:"type,attr"`
+	Title      string `xml:"title,attr"`
+	FacetGroup string `xml:"http://opds-spec.org/2010/catalog facetGroup,attr"`
+	Active     string `xml:"http://opds-spec.org/2010/catalog activeFacet,attr"`
+	Count      int    `xml:"http://purl.org/syndication/thread/1.0 count,attr"`
+}
+
+type atomEntry struct {
+	ID      string `xml:"id"`
+	Title   string `xml:"title"`
+	Authors []struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Summary    string `xml:"summary"`
+	Content    string `xml:"content"`
+	Language   string `xml:"http://purl.org/dc/terms/ language"`
+	Publisher  string `xml:"http://purl.org/dc/terms/ publisher"`
+	Issued     string `xml:"http://purl.org/dc/terms/ issued"`
+	Published  string `xml:"published"`
+	Categories []struct {
+		Term  string `xml:"term,attr"`
+		Label string `xml:"label,attr"`
+	} `xml:"category"`
+	Links []atomLink `xml:"link"`
+}
+
+func (c *OPDSClient) atomLink(base string, l atomLink) OPDSLink {
+	return OPDSLink{
+		Href:       c.resolve(base, l.Href),
+		Rel:        l.Rel,
+		Type:       l.Type,
+		Title:      l.Title,
+		FacetGroup: l.FacetGroup,
+		Active:     l.Active == "true",
+		Count:      l.Count,
+	}
+}
+
+func isAcquisitionRel(rel string) bool {
+	return strings.HasPrefix(rel, "http://opds-spec.org/acquisition")
+}
+
+func isNavigationType(t string) bool {
+	return strings.Contains(t, "kind=navigation") || strings.Contains(t, "profile=opds-catalog") ||
+		strings.HasPrefix(t, "application/atom+xml") || strings.HasPrefix(t, "application/opds+json")
+}
+
+// collectFeedLinks 处理目录级链接：分页、搜索、筛选和普通导航
+func (c *OPDSClient) collectFeedLinks(feed *OPDSFeed, links []OPDSLink) {
+	facets := map[string]int{}
+	for _, l := range links {
+		switch {
+		case l.Rel == "next":
+			feed.Next = l.Href
+		case l.Rel == "previous" || l.Rel == "prev":
+			feed.Previous = l.Href
+		case l.Rel == "first":
+			feed.First = l.Href
+		case l.Rel == "last":
+			feed.Last = l.Href
+		case l.Rel == "search":
+			if strings.Contains(l.Href, "{") {
+				feed.Search = l.Href
+			} else if strings.Contains(l.Type, "opensearchdescription") {
+				feed.searchDescription = l.Href
+			}
+		case l.Rel == "http://opds-spec.org/facet":
+			group := l.FacetGroup
+			i, ok := facets[group]
+			if !ok {
+				i = len(feed.Facets)
+				facets[group] = i
+				feed.Facets = append(feed.Facets, OPDSFacetGroup{Title: group})
+			}
+			feed.Facets[i].Links = append(feed.Facets[i].Links, l)
+		}
+	}
+}
+
+func (c *OPDSClient) parseAtomFeed(base string, data []byte) (*OPDSFeed, error) {
+	var af atomFeed
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	if err := d.Decode(&af); err != nil {
+		return nil, fmt.Errorf("parse atom feed: %w", err)
+	}
+
+	feed := &OPDSFeed{URL: base, Title: strings.TrimSpace(af.Title), Entries: []OPDSEntry{}, Navigation: []OPDSLink{}}
+	links := make([]OPDSLink, 0, len(af.Links))
+	for _, l := range af.Links {
+		links = append(links, c.atomLink(base, l))
+	}
+	c.collectFeedLinks(feed, links)
+
+	for _, e := range af.Entries {
+		entry := OPDSEntry{
+			ID:        e.ID,
+			Title:     strings.TrimSpace(e.Title),
+			Authors:   []string{},
+			Summary:   strings.TrimSpace(e.Summary),
+			Language:  e.Language,
+			Publisher: e.Publisher,
+			Published: e.Issued,
+		}
+		if entry.Summary == "" {
+			entry.Summary = strings.TrimSpace(e.Content)
+		}
+		if entry.Published == "" {
+			entry.Published = e.Published
+		}
+		for _, a := range e.Authors {
+			if name := strings.TrimSpace(a.Name); name != "" {
+				entry.Authors = append(entry.Authors, name)
+			}
+		}
+		for _, cat := range e.Categories {
+			if cat.Label != "" {
+				entry.Categories = append(entry.Categories, cat.Label)
+			} else if cat.Term != "" {
+				entry.Categories = append(entry.Categories, cat.Term)
+			}
+		}
+		for _, l := range e.Links {
+			link := c.atomLink(base, l)
+			switch {
+			case isAcquisitionRel(l.Rel):
+				entry.Acquisitions = append(entry.Acquisitions, link)
+			case l.Rel == "http://opds-spec.org/image" || l.Rel == "http://opds-spec.org/cover":
+				entry.Cover = link.Href
+			case l.Rel == "http://opds-spec.org/image/thumbnail" || l.Rel == "http://opds-spec.org/thumbnail":
+				entry.Thumbnail = link.Href
+			case entry.Navigation == "" && isNavigationType(l.Type) && l.Rel != "alternate":
+				entry.Navigation = link.Href
+			}
+		}
+		if len(entry.Acquisitions) > 0 {
+			entry.Navigation = ""
+		}
+		// 纯导航条目同时放进 Navigation 列表，便于前端渲染为目录
+		if entry.Navigation != "" {
+			feed.Navigation = append(feed.Navigation, OPDSLink{Href: entry.Navigation, Title: entry.Title, Rel: "subsection"})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed, nil
+}
+
+// opds2Link 对应 OPDS 2.0 的 Link Object，rel 可能是字符串或数组
+type opds2Link struct {
+	Href       string          `json:"href"`
+	Rel        json.RawMessage `json:"rel"`
+	Type       string          `json:"type"`
+	Title      string          `json:"title"`
+	Templated  bool            `json:"templated"`
+	Properties struct {
+		NumberOfItems int `json:"numberOfItems"`
+	} `json:"properties"`
+}
+
+type opds2Publication struct {
+	Metadata struct {
+		Identifier  string          `json:"identifier"`
+		Title       json.RawMessage `json:"title"`
+		Author      json.RawMessage `json:"author"`
+		Description string          `json:"description"`
+		Language    json.RawMessage `json:"language"`
+		Publisher   json.RawMessage `json:"publisher"`
+		Published   string          `json:"published"`
+		Subject     json.RawMessage `json:"subject"`
+	} `json:"metadata"`
+	Links  []opds2Link `json:"links"`
+	Images []opds2Link `json:"images"`
+}
+
+type opds2Feed struct {
+	Metadata struct {
+		Title string `json:"title"`
+	} `json:"metadata"`
+	Links        []opds2Link        `json:"links"`
+	Navigation   []opds2Link        `json:"navigation"`
+	Publications []opds2Publication `json:"publications"`
+	Facets       []struct {
+		Metadata struct {
+			Title string `json:"title"`
+		} `json:"metadata"`
+		Links []opds2Link `json:"links"`
+	} `json:"facets"`
+	Groups []struct {
+		Navigation   []opds2Link        `json:"navigation"`
+		Publications []opds2Publication `json:"publications"`
+	} `json:"groups"`
+}
+
+// jsonNames 读取 OPDS 2.0 中可能是字符串、对象或数组的名称字段
+func jsonNames(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		if s == "" {
+			return nil
+		}
+		return []string{s}
+	}
+	var obj struct {
+		Name json.RawMessage `json:"name"`
+	}
+	if json.Unmarshal(raw, &obj) == nil && len(obj.Name) > 0 {
+		if names := jsonNames(obj.Name); len(names) > 0 {
+			return names
+		}
+		// 多语言名称：{"en": "...", "zh": "..."}
+		var langs map[string]string
+		if json.Unmarshal(obj.Name, &langs) == nil {
+			for _, v := range langs {
+				return []string{v}
+			}
+		}
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) == nil {
+		var names []string
+		for _, item := range list {
+			names = append(names, jsonNames(item)...)
+		}
+		return names
+	}
+	var langs map[string]string
+	if json.Unmarshal(raw, &langs) == nil {
+		for _, v := range langs {
+			return []string{v}
+		}
+	}
+	return nil
+}
+
+func (l opds2Link) rels() []string {
+	return jsonNames(l.Rel)
+}
+
+func (l opds2Link) hasRel(rel string) bool {
+	for _, r := range l.rels() {
+		if r == rel {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *OPDSClient) opds2Link(base string, l opds2Link) OPDSLink {
+	href := c.resolve(base, l.Href)
+	if l.Templated {
+		href = expandOPDS2Template(href)
+	}
+	return OPDSLink{
+		Href:  href,
+		Rel:   strings.Join(l.rels(), " "),
+		Type:  l.Type,
+		Title: l.Title,
+		Count: l.Properties.NumberOfItems,
+	}
+}
+
+var uriTemplateQueryRe = regexp.MustCompile(`\{\?([^}]*)\}`)
+
+// expandOPDS2Template 把 URI 模板 {?query,...} 转为与 OPDS 1.2 一致的 {searchTerms} 形式
+func expandOPDS2Template(href string) string {
+	if m := uriTemplateQueryRe.FindStringSubmatchIndex(href); m != nil {
+		param := ""
+		for _, name := range strings.Split(href[m[2]:m[3]], ",") {
+			if name == "query" || name == "q" || name == "title" {
+				sep := "?"
+				if strings.Contains(href[:m[0]], "?") {
+					sep = "&"
+				}
+				param = sep + name + "={searchTerms}"
+				break
+			}
+		}
+		href = href[:m[0]] + param + href[m[1]:]
+	}
+	return strings.NewReplacer("{query}", "{searchTerms}", "{q}", "{searchTerms}").Replace(href)
+}
+
+func (c *OPDSClient) opds2Entry(base string, p opds2Publication) OPDSEntry {
+	entry := OPDSEntry{
+		ID:        p.Metadata.Identifier,
+		Authors:   jsonNames(p.Metadata.Author),
+		Summary:   p.Metadata.Description,
+		Published: p.Metadata.Published,
+	}
+	if titles := jsonNames(p.Metadata.Title); len(titles) > 0 {
+		entry.Title = titles[0]
+	}
+	if entry.Authors == nil {
+		entry.Authors = []string{}
+	}
+	if langs := jsonNames(p.Metadata.Language); len(langs) > 0 {
+		entry.Language = langs[0]
+	}
+	if publishers := jsonNames(p.Metadata.Publisher); len(publishers) > 0 {
+		entry.Publisher = publishers[0]
+	}
+	entry.Categories = jsonNames(p.Metadata.Subject)
+	for _, l := range p.Links {
+		for _, rel := range l.rels() {
+			if isAcquisitionRel(rel) {
+				entry.Acquisitions = append(entry.Acquisitions, c.opds2Link(base, l))
+				break
+			}
+		}
+	}
+	for i, img := range p.Images {
+		href := c.resolve(base, img.Href)
+		if i == 0 || entry.Cover == "" {
+			entry.Cover = href
+		}
+		if entry.Thumbnail == "" || strings.Contains(img.Href, "thumb") {
+			entry.Thumbnail = href
+		}
+	}
+	return entry
+}
+
+func (c *OPDSClient) parseJSONFeed(base string, data []byte) (*OPDSFeed, error) {
+	var jf opds2Feed
+	if err := json.Unmarshal(data, &jf); err != nil {
+		return nil, fmt.Errorf("parse opds2 feed: %w", err)
+	}
+
+	feed := &OPDSFeed{URL: base, Title: jf.Metadata.Title, Entries: []OPDSEntry{}, Navigation: []OPDSLink{}}
+	links := make([]OPDSLink, 0, len(jf.Links))
+	for _, l := range jf.Links {
+		link := c.opds2Link(base, l)
+		// 2.0 中 rel 可能有多个值，分页和搜索按单独的 rel 处理
+		for _, rel := range l.rels() {
+			link.Rel = rel
+			links = append(links, link)
+		}
+	}
+	c.collectFeedLinks(feed, links)
+
+	navigation := jf.Navigation
+	publications := jf.Publications
+	for _, g := range jf.Groups {
+		navigation = append(navigation, g.Navigation...)
+		publications = append(publications, g.Publications...)
+	}
+	for _, l := range navigation {
+		feed.Navigation = append(feed.Navigation, c.opds2Link(base, l))
+	}
+	for _, f := range jf.Facets {
+		group := OPDSFacetGroup{Title: f.Metadata.Title}
+		for _, l := range f.Links {
+			link := c.opds2Link(base, l)
+			link.FacetGroup = f.Metadata.Title
+			link.Active = l.hasRel("self")
+			group.Links = append(group.Links, link)
+		}
+		feed.Facets = append(feed.Facets, group)
+	}
+	for _, p := range publications {
+		feed.Entries = append(feed.Entries, c.opds2Entry(base, p))
+	}
+	return feed, nil
+}
+
+// openSearchTemplate 读取 OpenSearch 描述文件，返回 Atom 结果的 URL 模板
+func (c *OPDSClient) openSearchTemplate(descriptionURL string) string {
+	resp, err := c.get(descriptionURL, "application/opensearchdescription+xml, */*;q=0.5")
+	if err != nil {
+		log.Printf("[OPDS] 读取 OpenSearch 描述失败: %v", err)
+		return ""
+	}
+	defer resp.Body.Close()
+
+	var desc struct {
+		URLs []struct {
+			Type     string `xml:"type,attr"`
+			Template string `xml:"template,attr"`
+		} `xml:"Url"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, opdsMaxFeedSize)).Decode(&desc); err != nil {
+		log.Printf("[OPDS] 解析 OpenSearch 描述失败: %v", err)
+		return ""
+	}
+	template := ""
+	for _, u := range desc.URLs {
+		if strings.Contains(u.Type, "atom") || strings.Contains(u.Type, "opds") {
+			template = u.Template
+			break
+		}
+		if template == "" {
+			template = u.Template
+		}
+	}
+	return c.resolve(descriptionURL, template)
+}
+
+var openSearchParamRe = regexp.MustCompile(`\{[^}]*\}`)
+
+// SearchURL 把关键字填入搜索模板，其余可选参数置空
+func SearchURL(template, query string) string {
+	escaped := url.QueryEscape(query)
+	return openSearchParamRe.ReplaceAllStringFunc(template, func(p string) string {
+		switch strings.TrimSuffix(strings.Trim(p, "{}"), "?") {
+		case "searchTerms":
+			return escaped
+		case "startPage":
+			return "1"
+		case "startIndex":
+			return "0"
+		}
+		return ""
+	})
+}
+
+// Search 使用目录提供的搜索模板执行查询
+func (c *OPDSClient) Search(feed *OPDSFeed, query string) (*OPDSFeed, error) {
+	if feed.Search == "" {
+		return nil, fmt.Errorf("catalog does not support search")
+	}
+	return c.Fetch(SearchURL(feed.Search, query))
+}
+
+// opdsFormats 是获取链接的 MIME 类型与书库格式的对应关系
+var opdsFormats = map[string]string{
+	"application/epub+zip":           "epub",
+	"application/pdf":                "pdf",
+	"text/plain":                     "txt",
+	"application/x-mobipocket-ebook": "mobi",
+	"application/vnd.amazon.ebook":   "azw3",
+	"application/x-mobi8-ebook":      "azw3",
+	"application/vnd.comicbook+zip":  "cbz",
+	"application/x-cbz":              "cbz",
+	"application/fb2+zip":            "fb2",
+	"application/x-fictionbook+xml":  "fb2",
+}
+
+// opdsDownloadFormat 依次根据 MIME 类型、Content-Disposition 和 URL 推断格式
+func opdsDownloadFormat(linkType string, resp *http.Response) string {
+	for _, t := range []string{linkType, resp.Header.Get("Content-Type")} {
+		mediaType, _, _ := mime.ParseMediaType(t)
+		if format, ok := opdsFormats[mediaType]; ok {
+			return format
+		}
+	}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(params["filename"])), "."); ext != "" {
+			return ext
+		}
+	}
+	if ext := strings.TrimPrefix(strings.ToLower(path.Ext(resp.Request.URL.Path)), "."); ext != "" {
+		return ext
+	}
+	return "epub"
+}
+
+// idleReader 每次读到数据时推迟 timer，timer 触发时取消请求
+type idleReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+// Download 把获取链接指向的文件写入 dir 下的临时文件，返回临时文件路径和格式。
+// PDF、CBZ 可能很大，不限制总时长，只在超过 opdsDownloadIdleTimeout 没有数据时中止
+func (c *OPDSClient) Download(link OPDSLink, dir string) (string, string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	timer := time.AfterFunc(opdsDownloadIdleTimeout, cancel)
+	defer timer.Stop()
+
+	resp, err := c.send(ctx, c.download, link.Href, "*/*")
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength > opdsMaxBookSize {
+		return "", "", fmt.Errorf("book is larger than %d MB", opdsMaxBookSize>>20)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", err
+	}
+	// .tmp 结尾的文件不会被 BookStore.Path 当作书籍
+	f, err := os.CreateTemp(dir, ".opds-*.tmp")
+	if err != nil {
+		return "", "", err
+	}
+	body := &idleReader{r: resp.Body, timer: timer, timeout: opdsDownloadIdleTimeout}
+	n, err := io.Copy(f, io.LimitReader(body, opdsMaxBookSize+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > opdsMaxBookSize {
+		err = fmt.Errorf("book is larger than %d MB", opdsMaxBookSize>>20)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", "", err
+	}
+	return f.Name(), opdsDownloadFormat(link.Type, resp), nil
+}
+
+// coverDataURL 下载封面并转为 data URL，与前端保存封面的方式一致
+func (c *OPDSClient) coverDataURL(href string) string {
+	resp, err := c.get(href, "image/*")
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, opdsMaxCoverSize+1))
+	if err != nil || len(data) > opdsMaxCoverSize {
+		return ""
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(data)
+	}
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// preferredAcquisition 优先选择能直接阅读的格式
+func preferredAcquisition(links []OPDSLink) (OPDSLink, bool) {
+	best, bestRank := OPDSLink{}, -1
+	for _, l := range links {
+		if l.Rel != "" && l.Rel != "http://opds-spec.org/acquisition" && l.Rel != "http://opds-spec.org/acquisition/open-access" {
+			continue
+		}
+		mediaType, _, _ := mime.ParseMediaType(l.Type)
+		rank := 0
+		switch opdsFormats[mediaType] {
+		case "epub":
+			rank = 3
+		case "pdf":
+			rank = 2
+		case "txt":
+			rank = 1
+		}
+		if rank > bestRank {
+			best, bestRank = l, rank
+		}
+	}
+	return best, bestRank >= 0
+}
+
+// OPDSCatalogStore 保存用户添加的 OPDS 书库
+type OPDSCatalogStore struct {
+	mu       sync.RWMutex
+	path     string
+	catalogs []OPDSCatalog
+}
+
+func NewOPDSCatalogStore(path string) *OPDSCatalogStore {
+	s := &OPDSCatalogStore{path: path}
+	if err := readJSONFile(path, &s.catalogs); err != nil && !os.IsNotExist(err) {
+		log.Printf("[OPDS] 读取书库列表失败: %v", err)
+	}
+	return s
+}
+
+func (s *OPDSCatalogStore) List() []OPDSCatalog {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]OPDSCatalog{}, s.catalogs...)
+}
+
+func (s *OPDSCatalogStore) Get(id string) (OPDSCatalog, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range s.catalogs {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return OPDSCatalog{}, false
+}
+
+func (s *OPDSCatalogStore) Put(catalog OPDSCatalog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.catalogs {
+		if c.ID == catalog.ID {
+			s.catalogs[i] = catalog
+			return writeJSONFile(s.path, s.catalogs)
+		}
+	}
+	s.catalogs = append(s.catalogs, catalog)
+	return writeJSONFile(s.path, s.catalogs)
+}
+
+func (s *OPDSCatalogStore) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.catalogs {
+		if c.ID == id {
+			s.catalogs = append(s.catalogs[:i], s.catalogs[i+1:]...)
+			return writeJSONFile(s.path, s.catalogs)
+		}
+	}
+	return nil
+}
+
+func (a *App) opdsClient(catalogID string) (*OPDSClient, error) {
+	catalog, ok := a.opds.Get(catalogID)
+	if !ok {
+		return nil, fmt.Errorf("catalog %s not found", catalogID)
+	}
+	return NewOPDSClient(catalog), nil
+}
+
+// ListOPDSCatalogs 返回已添加的书库，不返回密码
+func (a *App) ListOPDSCatalogs() []OPDSCatalog {
+	list := a.opds.List()
+	for i := range list {
+		list[i].Password = ""
+	}
+	return list
+}
+
+// SaveOPDSCatalog 添加或更新书库，更新时密码留空表示不修改
+func (a *App) SaveOPDSCatalog(catalog OPDSCatalog) string {
+	u, err := url.Parse(catalog.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return `{"error": "invalid catalog url"}`
+	}
+	if catalog.ID == "" {
+		catalog.ID = newID()
+	} else if old, ok := a.opds.Get(catalog.ID); ok && catalog.Password == "" {
+		catalog.Password = old.Password
+	}
+	if catalog.Name == "" {
+		catalog.Name = u.Host
+	}
+	if err := a.opds.Put(catalog); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(map[string]string{"id": catalog.ID})
+}
+
+func (a *App) RemoveOPDSCatalog(id string) string {
+	if err := a.opds.Remove(id); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
+
+// BrowseOPDS 读取书库中的一页目录，feedUrl 为空时读取根目录
+func (a *App) BrowseOPDS(catalogId string, feedUrl string) string {
+	client, err := a.opdsClient(catalogId)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if feedUrl == "" {
+		feedUrl = client.catalog.URL
+	}
+	feed, err := client.Fetch(feedUrl)
+	if err != nil {
+		log.Printf("[OPDS] 读取目录失败: %s, %v", feedUrl, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(feed)
+}
+
+// SearchOPDS 在书库中搜索，searchTemplate 取自目录的 search 字段，为空时使用根目录的搜索
+func (a *App) SearchOPDS(catalogId string, searchTemplate string, query string) string {
+	client, err := a.opdsClient(catalogId)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	feed := &OPDSFeed{Search: searchTemplate}
+	if feed.Search == "" {
+		if feed, err = client.Fetch(client.catalog.URL); err != nil {
+			return jsonResult(map[string]string{"error": err.Error()})
+		}
+	}
+	result, err := client.Search(feed, query)
+	if err != nil {
+		log.Printf("[OPDS] 搜索失败: %s, %v", query, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(result)
+}
+
+// DownloadOPDSBook 下载条目并加入本地书库，书名、作者、简介、出版信息、分类和封面取自目录条目；
+// link 为空时自动选择格式
+func (a *App) DownloadOPDSBook(catalogId string, entry OPDSEntry, link OPDSLink) string {
+	client, err := a.opdsClient(catalogId)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if link.Href == "" {
+		var ok bool
+		if link, ok = preferredAcquisition(entry.Acquisitions); !ok {
+			return `{"error": "entry has no acquisition link"}`
+		}
+	}
+
+	tmpPath, format, err := client.Download(link, a.store.Dir())
+	if err != nil {
+		log.Printf("[OPDS] 下载失败: %s, %v", link.Href, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	// 保存成功后临时文件已被移走，这里只清理失败时留下的文件
+	defer os.Remove(tmpPath)
+	id := newID()
+	fileName := sanitizeFileName(entry.Title) + "." + format
+	size, err := a.saveOPDSDownload(id, fileName, tmpPath)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+
+	now := time.Now().UnixMilli()
+	book := EbookMetadata{
+		ID:            id,
+		Title:         entry.Title,
+		Author:        strings.Join(entry.Authors, ", "),
+		Path:          id,
+		Format:        format,
+		Size:          size,
+		StorageType:   "local",
+		AddedAt:       now,
+		Publisher:     strings.TrimSpace(entry.Publisher),
+		PublishedDate: opdsDate(entry.Published),
+		Description:   strings.TrimSpace(entry.Summary),
+		Tags:          normalizeTags(entry.Categories),
+	}
+	if book.Title == "" {
+		book.Title = "未命名"
+	}
+	if book.Author == "" {
+		book.Author = "未知作者"
+	}
+	if cover := entry.Cover; cover != "" || entry.Thumbnail != "" {
+		if cover == "" {
+			cover = entry.Thumbnail
+		}
+		book.Cover = client.coverDataURL(cover)
+	}
+
+	if err := a.library.PutBook(book); err != nil {
+		a.store.Remove(id)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	log.Printf("[OPDS] 已下载: %s (%s, %d bytes)", book.Title, format, size)
+	a.emit("library:book-added", book)
+	return jsonResult(book)
+}
+
+// saveOPDSDownload 把下载的临时文件存入 BookStore，返回文件大小。
+// 只有 EPUB 需要读入内存检查和修复，其他格式直接移动临时文件
+func (a *App) saveOPDSDownload(id, fileName, tmpPath string) (int64, error) {
+	if !strings.EqualFold(filepath.Ext(fileName), ".epub") {
+		info, err := os.Stat(tmpPath)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := a.store.SaveFile(id, fileName, tmpPath); err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	data, err := os.ReadFile(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	if data, _, err = a.checkBookFile(id, fileName, data); err != nil {
+		return 0, err
+	}
+	if _, err := a.store.Save(id, fileName, data); err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+// opdsDate 只保留日期部分，Atom 的 published 是完整的时间戳
+func opdsDate(s string) string {
+	date, _, _ := strings.Cut(strings.TrimSpace(s), "T")
+	return date
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	opdsServerPageSize = 50
+	opdsRecentLimit    = 50
+	opdsNavigationType = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	opdsAcquireType    = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+)
+
+// OPDSServerConfig 是内置 OPDS 服务的设置，单独保存，避免被前端的 UserConfig 覆盖
+type OPDSServerConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Address  string `json:"address"` // 监听地址，如 0.0.0.0:8089
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+func defaultOPDSServerConfig() OPDSServerConfig {
+	return OPDSServerConfig{Address: ":8089"}
+}
+
+// 书库格式对应的 MIME 类型
+var formatMimeTypes = map[string]string{
+	"epub": "application/epub+zip",
+	"pdf":  "application/pdf",
+	"txt":  "text/plain; charset=utf-8",
+	"mobi": "application/x-mobipocket-ebook",
+	"azw3": "application/vnd.amazon.ebook",
+	"cbz":  "application/vnd.comicbook+zip",
+	"fb2":  "application/x-fictionbook+xml",
+}
+
+func formatMimeType(format string) string {
+	if t, ok := formatMimeTypes[strings.ToLower(format)]; ok {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// OPDSServer 以 OPDS 1.2 目录发布书库，供 KOReader、Moon+ 等阅读器访问
+type OPDSServer struct {
+	app  *App
+	path string
+
+	mu       sync.Mutex
+	config   OPDSServerConfig
+	server   *http.Server
+	listener net.Listener
+}
+
+func NewOPDSServer(app *App, path string) *OPDSServer {
+	s := &OPDSServer{app: app, path: path, config: defaultOPDSServerConfig()}
+	if err := readJSONFile(path, &s.config); err != nil && !os.IsNotExist(err) {
+		log.Printf("[OPDS Server] 读取设置失败: %v", err)
+	}
+	return s
+}
+
+func (s *OPDSServer) Config() OPDSServerConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.config
+}
+
+// SetConfig 保存设置并按新设置重启服务
+func (s *OPDSServer) SetConfig(config OPDSServerConfig) error {
+	if config.Address == "" {
+		config.Address = defaultOPDSServerConfig().Address
+	}
+	if _, _, err := net.SplitHostPort(config.Address); err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+	s.mu.Lock()
+	s.config = config
+	err := writeJSONFile(s.path, config)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.Stop()
+	if config.Enabled {
+		return s.Start()
+	}
+	return nil
+}
+
+// Start 按当前设置开始监听，未启用时不做任何事
+func (s *OPDSServer) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.config.Enabled || s.server != nil {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", s.config.Address)
+	if err != nil {
+		return err
+	}
+	s.listener = ln
+	s.server = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go func(srv *http.Server) {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[OPDS Server] 服务异常退出: %v", err)
+		}
+	}(s.server)
+	log.Printf("[OPDS Server] 已启动: http://%s/opds", ln.Addr())
+	return nil
+}
+
+func (s *OPDSServer) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.server == nil {
+		return
+	}
+	if err := s.server.Close(); err != nil {
+		log.Printf("[OPDS Server] 关闭失败: %v", err)
+	}
+	s.server, s.listener = nil, nil
+	log.Printf("[OPDS Server] 已停止")
+}
+
+// Addr 返回实际监听地址，未运行时为空
+func (s *OPDSServer) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+func (s *OPDSServer) authorized(r *http.Request) bool {
+	config := s.Config()
+	if config.Username == "" {
+		return true
+	}
+	user, pass, ok := r.BasicAuth()
+	return ok &&
+		subtle.ConstantTimeCompare([]byte(user), []byte(config.Username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(pass), []byte(config.Password)) == 1
+}
+
+func (s *OPDSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Neat Reader"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/" && r.URL.Path != "/opds" && !strings.HasPrefix(r.URL.Path, "/opds/") {
+		http.NotFound(w, r)
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/opds"), "/")
+	parts := strings.SplitN(rest, "/", 3)
+	switch {
+	case rest == "":
+		s.serveRoot(w, r)
+	case rest == "recent":
+		books := s.app.library.Books()
+		s.serveBooks(w, r, "recent", "最近添加", books[:min(len(books), opdsRecentLimit)])
+	case rest == "all":
+		books := s.app.library.Books()
+		sortBooksByTitle(books)
+		s.serveBooks(w, r, "all", "全部书籍", books)
+	case rest == "authors":
+		s.serveAuthors(w, r)
+	case parts[0] == "authors" && len(parts) == 2:
+		s.serveAuthor(w, r, parts[1])
+	case rest == "categories":
+		s.serveCategories(w, r)
+	case parts[0] == "categories" && len(parts) == 2:
+		s.serveCategory(w, r, parts[1])
+	case rest == "search":
+		s.serveSearch(w, r)
+	case rest == "opensearch.xml":
+		s.serveOpenSearch(w, r)
+	case parts[0] == "books" && len(parts) == 3 && parts[2] == "file":
+		s.serveFile(w, r, parts[1])
+	case parts[0] == "books" && len(parts) == 3 && parts[2] == "cover":
+		s.serveCover(w, r, parts[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// 输出用的 Atom 结构
+type opdsOutFeed struct {
+	XMLName  xml.Name       `xml:"feed"`
+	Xmlns    string         `xml:"xmlns,attr"`
+	XmlnsOS  string         `xml:"xmlns:opensearch,attr"`
+	XmlnsOPD string         `xml:"xmlns:opds,attr"`
+	XmlnsThr string         `xml:"xmlns:thr,attr"`
+	ID       string         `xml:"id"`
+	Title    string         `xml:"title"`
+	Updated  string         `xml:"updated"`
+	Author   *opdsOutAuthor `xml:"author,omitempty"`
+	Total    int            `xml:"opensearch:totalResults,omitempty"`
+	Links    []opdsOutLink  `xml:"link"`
+	Entries  []opdsOutEntry `xml:"entry"`
+}
+
+type opdsOutAuthor struct {
+	Name string `xml:"name"`
+}
+
+type opdsOutLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+	Count int    `xml:"thr:count,attr,omitempty"`
+}
+
+type opdsOutEntry struct {
+	ID      string         `xml:"id"`
+	Title   string         `xml:"title"`
+	Updated string         `xml:"updated"`
+	Author  *opdsOutAuthor `xml:"author,omitempty"`
+	Content *opdsOutText   `xml:"content,omitempty"`
+	Links   []opdsOutLink  `xml:"link"`
+}
+
+type opdsOutText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+func opdsTime(ms int64) string {
+	if ms == 0 {
+		return time.Now().UTC().Format(time.RFC3339)
+	}
+	return time.UnixMilli(ms).UTC().Format(time.RFC3339)
+}
+
+func newOPDSOutFeed(id, title string, self string, kind string) *opdsOutFeed {
+	return &opdsOutFeed{
+		Xmlns:    "http://www.w3.org/2005/Atom",
+		XmlnsOS:  "http://a9.com/-/spec/opensearch/1.1/",
+		XmlnsOPD: "http://opds-spec.org/2010/catalog",
+		XmlnsThr: "http://purl.org/syndication/thread/1.0",
+		ID:       "urn:neat-reader:" + id,
+		Title:    title,
+		Updated:  opdsTime(0),
+		Author:   &opdsOutAuthor{Name: AppName},
+		Links: []opdsOutLink{
+			{Rel: "self", Href: self, Type: kind},
+			{Rel: "start", Href: "/opds", Type: opdsNavigationType},
+			{Rel: "search", Href: "/opds/opensearch.xml", Type: "application/opensearchdescription+xml"},
+		},
+	}
+}
+
+func writeOPDSFeed(w http.ResponseWriter, feed *opdsOutFeed, kind string) {
+	w.Header().Set("Content-Type", kind+"; charset=utf-8")
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		log.Printf("[OPDS Server] 输出目录失败: %v", err)
+	}
+}
+
+// navigationEntry 生成指向子目录的条目，kind 为子目录的类型
+func navigationEntry(id, title, href, kind, summary string, count int) opdsOutEntry {
+	entry := opdsOutEntry{
+		ID:      "urn:neat-reader:" + id,
+		Title:   title,
+		Updated: opdsTime(0),
+		Links:   []opdsOutLink{{Rel: "subsection", Href: href, Type: kind, Count: count}},
+	}
+	if summary != "" {
+		entry.Content = &opdsOutText{Type: "text", Text: summary}
+	}
+	return entry
+}
+
+func (s *OPDSServer) serveRoot(w http.ResponseWriter, r *http.Request) {
+	books := s.app.library.Books()
+	feed := newOPDSOutFeed("root", AppName, "/opds", opdsNavigationType)
+	feed.Entries = []opdsOutEntry{
+		navigationEntry("recent", "最近添加", "/opds/recent", opdsAcquireType, "", min(len(books), opdsRecentLimit)),
+		navigationEntry("all", "全部书籍", "/opds/all", opdsAcquireType, "", len(books)),
+		navigationEntry("authors", "作者", "/opds/authors", opdsNavigationType, "", 0),
+		navigationEntry("categories", "分类", "/opds/categories", opdsNavigationType, "", len(s.app.library.Categories())),
+	}
+	writeOPDSFeed(w, feed, opdsNavigationType)
+}
+
+func (s *OPDSServer) bookEntry(book EbookMetadata) opdsOutEntry {
+	id := url.PathEscape(book.ID)
+	entry := opdsOutEntry{
+		ID:      "urn:neat-reader:book:" + book.ID,
+		Title:   book.Title,
+		Updated: opdsTime(book.UpdatedAt),
+		Links: []opdsOutLink{{
+			Rel:   "http://opds-spec.org/acquisition",
+			Href:  "/opds/books/" + id + "/file",
+			Type:  formatMimeType(book.Format),
+			Title: strings.ToUpper(book.Format),
+		}},
+	}
+	if book.Author != "" {
+		entry.Author = &opdsOutAuthor{Name: book.Author}
+	}
+	if strings.HasPrefix(book.Cover, "data:") {
+		entry.Links = append(entry.Links,
+			opdsOutLink{Rel: "http://opds-spec.org/image", Href: "/opds/books/" + id + "/cover", Type: coverMimeType(book.Cover)},
+			opdsOutLink{Rel: "http://opds-spec.org/image/thumbnail", Href: "/opds/books/" + id + "/cover", Type: coverMimeType(book.Cover)})
+	}
+	return entry
+}
+
+// serveBooks 输出分页的获取目录，page 参数从 1 开始
+func (s *OPDSServer) serveBooks(w http.ResponseWriter, r *http.Request, id, title string, books []EbookMetadata) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page = max(page, 1)
+	pages := max((len(books)+opdsServerPageSize-1)/opdsServerPageSize, 1)
+
+	pageURL := func(p int) string {
+		q := r.URL.Query()
+		q.Set("page", strconv.Itoa(p))
+		return r.URL.Path + "?" + q.Encode()
+	}
+	feed := newOPDSOutFeed(id, title, pageURL(page), opdsAcquireType)
+	feed.Total = len(books)
+	if page > 1 {
+		feed.Links = append(feed.Links,
+			opdsOutLink{Rel: "first", Href: pageURL(1), Type: opdsAcquireType},
+			opdsOutLink{Rel: "previous", Href: pageURL(page - 1), Type: opdsAcquireType})
+	}
+	if page < pages {
+		feed.Links = append(feed.Links,
+			opdsOutLink{Rel: "next", Href: pageURL(page + 1), Type: opdsAcquireType},
+			opdsOutLink{Rel: "last", Href: pageURL(pages), Type: opdsAcquireType})
+	}
+
+	start := min((page-1)*opdsServerPageSize, len(books))
+	end := min(start+opdsServerPageSize, len(books))
+	for _, book := range books[start:end] {
+		feed.Entries = append(feed.Entries, s.bookEntry(book))
+	}
+	writeOPDSFeed(w, feed, opdsAcquireType)
+}
+
+func sortBooksByTitle(books []EbookMetadata) {
+	sort.SliceStable(books, func(i, j int) bool {
+		return strings.ToLower(books[i].Title) < strings.ToLower(books[j].Title)
+	})
+}
+
+func (s *OPDSServer) serveAuthors(w http.ResponseWriter, r *http.Request) {
+	counts := map[string]int{}
+	for _, book := range s.app.library.Books() {
+		counts[book.Author]++
+	}
+	authors := make([]string, 0, len(counts))
+	for author := range counts {
+		authors = append(authors, author)
+	}
+	sort.Strings(authors)
+
+	feed := newOPDSOutFeed("authors", "作者", "/opds/authors", opdsNavigationType)
+	for _, author := range authors {
+		name := author
+		if name == "" {
+			name = "未知作者"
+		}
+		feed.Entries = append(feed.Entries, navigationEntry("author:"+author, name, "/opds/authors/"+url.PathEscape(author),
+			opdsAcquireType, fmt.Sprintf("%d 本书", counts[author]), counts[author]))
+	}
+	writeOPDSFeed(w, feed, opdsNavigationType)
+}
+
+func (s *OPDSServer) serveAuthor(w http.ResponseWriter, r *http.Request, escaped string) {
+	author, err := url.PathUnescape(escaped)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	var books []EbookMetadata
+	for _, book := range s.app.library.Books() {
+		if book.Author == author {
+			books = append(books, book)
+		}
+	}
+	sortBooksByTitle(books)
+	s.serveBooks(w, r, "author:"+author, author, books)
+}
+
+func (s *OPDSServer) serveCategories(w http.ResponseWriter, r *http.Request) {
+	feed := newOPDSOutFeed("categories", "分类", "/opds/categories", opdsNavigationType)
+	for _, c := range s.app.library.Categories() {
+		feed.Entries = append(feed.Entries, navigationEntry("category:"+c.ID, c.Name, "/opds/categories/"+url.PathEscape(c.ID),
+			opdsAcquireType, fmt.Sprintf("%d 本书", len(c.BookIDs)), len(c.BookIDs)))
+	}
+	writeOPDSFeed(w, feed, opdsNavigationType)
+}
+
+func (s *OPDSServer) serveCategory(w http.ResponseWriter, r *http.Request, escaped string) {
+	id, err := url.PathUnescape(escaped)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	for _, c := range s.app.library.Categories() {
+		if c.ID != id {
+			continue
+		}
+		var books []EbookMetadata
+		for _, bookID := range c.BookIDs {
+			if book, ok := s.app.library.Book(bookID); ok {
+				books = append(books, book)
+			}
+		}
+		sortBooksByTitle(books)
+		s.serveBooks(w, r, "category:"+id, c.Name, books)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (s *OPDSServer) serveSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	var books []EbookMetadata
+	if query != "" {
+		for _, book := range s.app.library.Books() {
+			if strings.Contains(strings.ToLower(book.Title), query) || strings.Contains(strings.ToLower(book.Author), query) {
+				books = append(books, book)
+			}
+		}
+	}
+	sortBooksByTitle(books)
+	s.serveBooks(w, r, "search", "搜索："+query, books)
+}
+
+func (s *OPDSServer) serveOpenSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/opensearchdescription+xml; charset=utf-8")
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/">
+  <ShortName>%s</ShortName>
+  <Description>搜索书名或作者</Description>
+  <InputEncoding>UTF-8</InputEncoding>
+  <OutputEncoding>UTF-8</OutputEncoding>
+  <Url type="%s" template="/opds/search?q={searchTerms}"/>
+</OpenSearchDescription>
+`, AppName, opdsAcquireType)
+}
+
+// serveFile 输出书籍文件：本地副本直接读取（支持 Range），只在网盘中的书代理下载
+func (s *OPDSServer) serveFile(w http.ResponseWriter, r *http.Request, escaped string) {
+	id, err := url.PathUnescape(escaped)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	book, ok := s.app.library.Book(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	fileName := sanitizeFileName(book.Title) + "." + book.Format
+	w.Header().Set("Content-Disposition", mimeAttachment(fileName))
+
+	if path := s.app.bookFilePath(book); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", formatMimeType(book.Format))
+		http.ServeContent(w, r, filepath.Base(path), info.ModTime(), f)
+		return
+	}
+
+	if book.RemotePath != "" {
+		s.serveRemoteFile(w, r, book)
+		return
+	}
+	if book.BaidupanPath == "" {
+		http.NotFound(w, r)
+		return
+	}
+	token, err := s.app.ensureBaiduToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	resp, err := s.app.baiduOpen(token, book.BaidupanPath, r.Header.Get("Range"))
+	if err != nil {
+		log.Printf("[OPDS Server] 代理网盘下载失败: %s, %v", book.BaidupanPath, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for _, h := range []string{"Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified"} {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	w.Header().Set("Content-Type", formatMimeType(book.Format))
+	w.WriteHeader(resp.StatusCode)
+	if r.Method != http.MethodHead {
+		io.Copy(w, resp.Body)
+	}
+}
+
+// serveRemoteFile 代理存储中的书籍文件，Range 由 http.ServeContent 处理
+func (s *OPDSServer) serveRemoteFile(w http.ResponseWriter, r *http.Request, book EbookMetadata) {
+	storage, err := s.app.storageProvider(bookStorageName(book))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	info, err := storage.Stat(book.RemotePath)
+	if err != nil {
+		log.Printf("[OPDS Server] 代理 %s 下载失败: %s, %v", storage.Name(), book.RemotePath, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	content := &remoteReadSeeker{storage: storage, path: book.RemotePath, size: info.Size}
+	defer content.Close()
+	w.Header().Set("Content-Type", formatMimeType(book.Format))
+	http.ServeContent(w, r, info.Name, info.ModTime(), content)
+}
+
+// mimeAttachment 生成同时兼容旧客户端的 Content-Disposition
+func mimeAttachment(fileName string) string {
+	ascii := strings.Map(func(r rune) rune {
+		if r > 126 || r < 32 || r == '"' {
+			return '_'
+		}
+		return r
+	}, fileName)
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, ascii, url.PathEscape(fileName))
+}
+
+func coverMimeType(dataURL string) string {
+	header, _, _ := strings.Cut(strings.TrimPrefix(dataURL, "data:"), ",")
+	mediaType, _, _ := strings.Cut(header, ";")
+	if mediaType == "" {
+		return "image/jpeg"
+	}
+	return mediaType
+}
+
+// serveCover 输出书库中以 data URL 保存的封面
+func (s *OPDSServer) serveCover(w http.ResponseWriter, r *http.Request, escaped string) {
+	id, err := url.PathUnescape(escaped)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	book, ok := s.app.library.Book(id)
+	if !ok || !strings.HasPrefix(book.Cover, "data:") {
+		http.NotFound(w, r)
+		return
+	}
+	header, payload, _ := strings.Cut(book.Cover, ",")
+	var data []byte
+	if strings.HasSuffix(header, ";base64") {
+		if data, err = base64.StdEncoding.DecodeString(payload); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		unescaped, err := url.PathUnescape(payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data = []byte(unescaped)
+	}
+	w.Header().Set("Content-Type", coverMimeType(book.Cover))
+	w.Header().Set("Cache-Control", "max-age=86400")
+	w.Write(data)
+}
+
+func (a *App) GetOPDSServerConfig() OPDSServerConfig {
+	config := a.opdsServer.Config()
+	config.Password = ""
+	return config
+}
+
+// SetOPDSServerConfig 保存内置 OPDS 服务设置并重启服务，密码留空表示不修改
+func (a *App) SetOPDSServerConfig(config OPDSServerConfig) string {
+	if config.Password == "" && config.Username != "" {
+		config.Password = a.opdsServer.Config().Password
+	}
+	if err := a.opdsServer.SetConfig(config); err != nil {
+		log.Printf("[OPDS Server] 启动失败: %v", err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(map[string]string{"address": a.opdsServer.Addr()})
+}
+
+// GetOPDSServerStatus 返回服务是否运行以及实际监听地址
+func (a *App) GetOPDSServerStatus() string {
+	addr := a.opdsServer.Addr()
+	return jsonResult(map[string]interface{}{"running": addr != "", "address": addr})
+}
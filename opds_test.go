@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testAtomRoot = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:dc="http://purl.org/dc/terms/"
+      xmlns:opds="http://opds-spec.org/2010/catalog" xmlns:thr="http://purl.org/syndication/thread/1.0">
+  <title>测试书库</title>
+  <link rel="search" type="application/opensearchdescription+xml" href="/opensearch.xml"/>
+  <link rel="next" type="application/atom+xml;profile=opds-catalog" href="?page=2"/>
+  <link rel="http://opds-spec.org/facet" href="/opds?sort=new" title="最新" opds:facetGroup="排序" opds:activeFacet="true" thr:count="12"/>
+  <link rel="http://opds-spec.org/facet" href="/opds?sort=title" title="书名" opds:facetGroup="排序"/>
+  <entry>
+    <id>urn:nav:new</id>
+    <title>新书</title>
+    <link rel="subsection" type="application/atom+xml;profile=opds-catalog;kind=navigation" href="/new"/>
+  </entry>
+  <entry>
+    <id>urn:book:1</id>
+    <title>  三体  </title>
+    <author><name>刘慈欣</name></author>
+    <author><name> </name></author>
+    <dc:issued>2008</dc:issued>
+    <dc:publisher>重庆出版社</dc:publisher>
+    <category term="sf" label="科幻"/>
+    <content type="text">地球往事三部曲第一部</content>
+    <link rel="http://opds-spec.org/acquisition" type="application/pdf" href="/download/1.pdf"/>
+    <link rel="http://opds-spec.org/acquisition/open-access" type="application/epub+zip" href="/download/1.epub"/>
+    <link rel="http://opds-spec.org/image" type="image/png" href="covers/1.png"/>
+    <link rel="http://opds-spec.org/image/thumbnail" type="image/png" href="covers/1-thumb.png"/>
+  </entry>
+</feed>`
+
+const testOpenSearch = `<?xml version="1.0" encoding="UTF-8"?>
+<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/">
+  <Url type="text/html" template="/html-search?q={searchTerms}"/>
+  <Url type="application/atom+xml;profile=opds-catalog" template="/search?q={searchTerms}&amp;page={startPage?}"/>
+</OpenSearchDescription>`
+
+const testOPDS2Feed = `{
+  "metadata": {"title": "OPDS 2"},
+  "links": [
+    {"rel": ["self", "first"], "href": "/v2", "type": "application/opds+json"},
+    {"rel": "search", "href": "/v2/search{?query,page}", "type": "application/opds+json", "templated": true}
+  ],
+  "navigation": [
+    {"href": "new", "title": "新书", "type": "application/opds+json", "properties": {"numberOfItems": 3}}
+  ],
+  "facets": [
+    {"metadata": {"title": "语言"}, "links": [
+      {"rel": "self", "href": "?lang=zh", "title": "中文"},
+      {"href": "?lang=en", "title": "English"}
+    ]}
+  ],
+  "groups": [
+    {"publications": [
+      {
+        "metadata": {
+          "identifier": "urn:isbn:9787536692930",
+          "title": "三体",
+          "author": [{"name": "刘慈欣"}, "Ken Liu"],
+          "language": ["zh"],
+          "publisher": {"name": {"zh": "重庆出版社"}},
+          "subject": [{"name": "科幻"}]
+        },
+        "links": [
+          {"rel": "http://opds-spec.org/acquisition/open-access", "href": "/books/1.epub", "type": "application/epub+zip"},
+          {"rel": "alternate", "href": "/books/1.html", "type": "text/html"}
+        ],
+        "images": [
+          {"href": "/covers/1.jpg", "type": "image/jpeg"},
+          {"href": "/covers/1-thumb.jpg", "type": "image/jpeg"}
+        ]
+      }
+    ]}
+  ]
+}`
+
+// newOPDSFixtureServer 提供 Atom 和 OPDS 2.0 两种目录，username 不为空时要求 Basic 认证
+func newOPDSFixtureServer(t *testing.T, username, password string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/opds", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml;profile=opds-catalog")
+		w.Write([]byte(testAtomRoot))
+	})
+	mux.HandleFunc("/opensearch.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/opensearchdescription+xml")
+		w.Write([]byte(testOpenSearch))
+	})
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml")
+		title := r.URL.Query().Get("q")
+		w.Write([]byte(`<feed xmlns="http://www.w3.org/2005/Atom"><title>搜索</title><entry><id>s</id><title>` + title + `</title></entry></feed>`))
+	})
+	mux.HandleFunc("/v2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/opds+json")
+		w.Write([]byte(testOPDS2Feed))
+	})
+	mux.HandleFunc("/download/1.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-1.4 test"))
+	})
+	mux.HandleFunc("/download/1.epub", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	})
+	mux.HandleFunc("/covers/1.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\ncover"))
+	})
+	var handler http.Handler = mux
+	if username != "" {
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if u, p, ok := r.BasicAuth(); !ok || u != username || p != password {
+				w.Header().Set("WWW-Authenticate", `Basic realm="opds"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			mux.ServeHTTP(w, r)
+		})
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOPDSFetchAtomFeed(t *testing.T) {
+	srv := newOPDSFixtureServer(t, "", "")
+	client := NewOPDSClient(OPDSCatalog{URL: srv.URL + "/opds"})
+
+	feed, err := client.Fetch(srv.URL + "/opds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "测试书库" {
+		t.Errorf("title = %q", feed.Title)
+	}
+	if want := srv.URL + "/opds?page=2"; feed.Next != want {
+		t.Errorf("next = %q, want %q", feed.Next, want)
+	}
+	if want := srv.URL + "/search?q={searchTerms}&page={startPage?}"; feed.Search != want {
+		t.Errorf("search = %q, want %q", feed.Search, want)
+	}
+	if len(feed.Facets) != 1 || len(feed.Facets[0].Links) != 2 {
+		t.Fatalf("facets = %+v", feed.Facets)
+	}
+	if f := feed.Facets[0].Links[0]; f.FacetGroup != "排序" || !f.Active || f.Count != 12 {
+		t.Errorf("facet = %+v", f)
+	}
+	if len(feed.Navigation) != 1 || feed.Navigation[0].Href != srv.URL+"/new" {
+		t.Errorf("navigation = %+v", feed.Navigation)
+	}
+
+	if len(feed.Entries) != 2 {
+		t.Fatalf("entries = %d", len(feed.Entries))
+	}
+	book := feed.Entries[1]
+	if book.Title != "三体" || book.Navigation != "" {
+		t.Errorf("entry = %+v", book)
+	}
+	if len(book.Authors) != 1 || book.Authors[0] != "刘慈欣" {
+		t.Errorf("authors = %q", book.Authors)
+	}
+	if book.Summary != "地球往事三部曲第一部" || book.Published != "2008" || book.Publisher != "重庆出版社" {
+		t.Errorf("metadata = %+v", book)
+	}
+	if len(book.Categories) != 1 || book.Categories[0] != "科幻" {
+		t.Errorf("categories = %q", book.Categories)
+	}
+	if book.Cover != srv.URL+"/covers/1.png" || book.Thumbnail != srv.URL+"/covers/1-thumb.png" {
+		t.Errorf("cover = %q, thumbnail = %q", book.Cover, book.Thumbnail)
+	}
+	link, ok := preferredAcquisition(book.Acquisitions)
+	if !ok || link.Href != srv.URL+"/download/1.epub" {
+		t.Errorf("preferred acquisition = %+v", link)
+	}
+}
+
+func TestOPDSSearch(t *testing.T) {
+	srv := newOPDSFixtureServer(t, "", "")
+	client := NewOPDSClient(OPDSCatalog{URL: srv.URL + "/opds"})
+	feed, err := client.Fetch(srv.URL + "/opds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.Search(feed, "三体 死神永生")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].Title != "三体 死神永生" {
+		t.Errorf("search entries = %+v", result.Entries)
+	}
+	if _, err := client.Search(&OPDSFeed{}, "x"); err == nil {
+		t.Error("search without template should fail")
+	}
+}
+
+func TestOPDSFetchJSONFeed(t *testing.T) {
+	srv := newOPDSFixtureServer(t, "", "")
+	client := NewOPDSClient(OPDSCatalog{URL: srv.URL + "/v2"})
+
+	feed, err := client.Fetch(srv.URL + "/v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "OPDS 2" || feed.First != srv.URL+"/v2" {
+		t.Errorf("feed = %+v", feed)
+	}
+	if want := srv.URL + "/v2/search?query={searchTerms}"; feed.Search != want {
+		t.Errorf("search = %q, want %q", feed.Search, want)
+	}
+	if len(feed.Navigation) != 1 || feed.Navigation[0].Href != srv.URL+"/new" || feed.Navigation[0].Count != 3 {
+		t.Errorf("navigation = %+v", feed.Navigation)
+	}
+	if len(feed.Facets) != 1 || feed.Facets[0].Title != "语言" || !feed.Facets[0].Links[0].Active || feed.Facets[0].Links[1].Active {
+		t.Errorf("facets = %+v", feed.Facets)
+	}
+	if len(feed.Entries) != 1 {
+		t.Fatalf("entries = %d", len(feed.Entries))
+	}
+	book := feed.Entries[0]
+	if book.Title != "三体" || strings.Join(book.Authors, ",") != "刘慈欣,Ken Liu" {
+		t.Errorf("entry = %+v", book)
+	}
+	if book.Language != "zh" || book.Publisher != "重庆出版社" || len(book.Categories) != 1 {
+		t.Errorf("metadata = %+v", book)
+	}
+	if len(book.Acquisitions) != 1 || book.Acquisitions[0].Href != srv.URL+"/books/1.epub" {
+		t.Errorf("acquisitions = %+v", book.Acquisitions)
+	}
+	if book.Cover != srv.URL+"/covers/1.jpg" || book.Thumbnail != srv.URL+"/covers/1-thumb.jpg" {
+		t.Errorf("cover = %q, thumbnail = %q", book.Cover, book.Thumbnail)
+	}
+}
+
+func TestOPDSAuthOnlySentToCatalogHost(t *testing.T) {
+	srv := newOPDSFixtureServer(t, "reader", "secret")
+	var leaked bool
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			leaked = true
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\n"))
+	}))
+	defer other.Close()
+
+	if _, err := NewOPDSClient(OPDSCatalog{URL: srv.URL + "/opds"}).Fetch(srv.URL + "/opds"); err == nil || !strings.Contains(err.Error(), "authentication required") {
+		t.Errorf("fetch without credentials: %v", err)
+	}
+
+	client := NewOPDSClient(OPDSCatalog{URL: srv.URL + "/opds", Username: "reader", Password: "secret"})
+	if _, err := client.Fetch(srv.URL + "/opds"); err != nil {
+		t.Fatal(err)
+	}
+	if cover := client.coverDataURL(other.URL + "/cover.png"); !strings.HasPrefix(cover, "data:image/png;base64,") {
+		t.Errorf("cover = %q", cover)
+	}
+	if leaked {
+		t.Error("credentials were sent to another host")
+	}
+}
+
+func TestDownloadOPDSBook(t *testing.T) {
+	srv := newOPDSFixtureServer(t, "", "")
+	app := newTestApp(t)
+	catalog := OPDSCatalog{ID: "fixture", Name: "fixture", URL: srv.URL + "/opds"}
+	if err := app.opds.Put(catalog); err != nil {
+		t.Fatal(err)
+	}
+	feed, err := NewOPDSClient(catalog).Fetch(catalog.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := feed.Entries[1]
+
+	// 首选的 EPUB 链接返回 410 时下载失败，书库保持不变
+	if result := app.DownloadOPDSBook(catalog.ID, entry, OPDSLink{}); !strings.Contains(result, "410") {
+		t.Errorf("download of missing file = %s", result)
+	}
+	if books := app.library.Books(); len(books) != 0 {
+		t.Fatalf("library after failed download = %+v", books)
+	}
+
+	var book EbookMetadata
+	decodeResult(t, app.DownloadOPDSBook(catalog.ID, entry, entry.Acquisitions[0]), &book)
+	if book.Title != "三体" || book.Author != "刘慈欣" || book.Format != "pdf" || book.StorageType != "local" ||
+		book.Size != int64(len("%PDF-1.4 test")) {
+		t.Errorf("book = %+v", book)
+	}
+	if book.Description != "地球往事三部曲第一部" || book.Publisher != "重庆出版社" || book.PublishedDate != "2008" ||
+		len(book.Tags) != 1 || book.Tags[0] != "科幻" {
+		t.Errorf("book metadata = %+v", book)
+	}
+	if !strings.HasPrefix(book.Cover, "data:image/png;base64,") {
+		t.Errorf("cover = %q", book.Cover)
+	}
+	if _, ok := app.library.Book(book.ID); !ok {
+		t.Error("book was not added to the library")
+	}
+	// 阅读器通过 /books/{id} 读取 BookStore 中的文件
+	p, err := app.store.Path(book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(p)
+	if err != nil || string(data) != "%PDF-1.4 test" {
+		t.Errorf("stored file = %q, %v", data, err)
+	}
+
+	if result := app.DownloadOPDSBook("missing", entry, OPDSLink{}); !strings.Contains(result, "not found") {
+		t.Errorf("unknown catalog = %s", result)
+	}
+	// 下载用的临时文件不会留在书库目录中
+	if tmp, _ := filepath.Glob(filepath.Join(app.store.Dir(), "*.tmp")); len(tmp) != 0 {
+		t.Errorf("temporary files left behind: %v", tmp)
+	}
+}
+
+func TestOPDSErrorsAreValidJSON(t *testing.T) {
+	app := newTestApp(t)
+	catalog := OPDSCatalog{ID: "bad", Name: "bad", URL: "http://127.0.0.1:1/opds"}
+	if err := app.opds.Put(catalog); err != nil {
+		t.Fatal(err)
+	}
+	// net/http 的错误形如 Get "http://…": dial tcp …，带有引号
+	for _, result := range []string{
+		app.BrowseOPDS(catalog.ID, ""),
+		app.SearchOPDS(catalog.ID, "", "三体"),
+		app.DownloadOPDSBook(catalog.ID, OPDSEntry{Title: "三体"}, OPDSLink{Href: catalog.URL + "/1.epub"}),
+	} {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(result), &e); err != nil || !strings.Contains(e.Error, `"http://127.0.0.1:1/`) {
+			t.Errorf("result = %s, %v", result, err)
+		}
+	}
+}
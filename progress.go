@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ReadingProgress 对应前端的 ReadingProgress
+type ReadingProgress struct {
+	EbookID      string  `json:"ebookId"`
+	ChapterIndex int     `json:"chapterIndex"`
+	ChapterTitle string  `json:"chapterTitle"`
+	Position     float64 `json:"position"`
+	CFI          string  `json:"cfi"`
+	Timestamp    int64   `json:"timestamp"`
+	DeviceID     string  `json:"deviceId"`
+	DeviceName   string  `json:"deviceName"`
+	ReadingTime  int64   `json:"readingTime"`
+	// Explicit 表示用户主动跳回了较早的位置，此时允许进度在设备间回退
+	Explicit bool `json:"explicit,omitempty"`
+}
+
+// aheadOf 判断 p 的阅读位置是否在 q 之后
+func (p *ReadingProgress) aheadOf(q *ReadingProgress) bool {
+	if p.ChapterIndex != q.ChapterIndex {
+		return p.ChapterIndex > q.ChapterIndex
+	}
+	return p.Position > q.Position
+}
+
+// newerThan 按时间戳比较，时间戳相同时用设备 ID 保证各端结果一致
+func (p *ReadingProgress) newerThan(q *ReadingProgress) bool {
+	if p.Timestamp != q.Timestamp {
+		return p.Timestamp > q.Timestamp
+	}
+	return p.DeviceID > q.DeviceID
+}
+
+// mergeProgress 合并同一本书的两条进度：按 timestamp 后写者胜，
+// 但来自其他设备的较新记录如果位置更靠前且不是用户主动回退，则保留原进度
+func mergeProgress(local, remote *ReadingProgress) *ReadingProgress {
+	if local == nil {
+		return remote
+	}
+	if remote == nil {
+		return local
+	}
+
+	newer, older := local, remote
+	if remote.newerThan(local) {
+		newer, older = remote, local
+	}
+
+	if newer.DeviceID != older.DeviceID && !newer.Explicit && older.aheadOf(newer) {
+		return older
+	}
+	return newer
+}
+
+// ProgressJournal 保存本地的阅读进度，每本书一条记录，写入数据库的 progress 表。
+// 早期版本使用追加写入的 jsonl 日志，首次启动时回放导入
+type ProgressJournal struct {
+	mu      sync.RWMutex
+	table   *dbTable
+	entries map[string]*ReadingProgress
+}
+
+func NewProgressJournal(db *LibraryDB, legacyPath string) *ProgressJournal {
+	j := &ProgressJournal{
+		table:   newDBTable(db, dbProgress),
+		entries: make(map[string]*ReadingProgress),
+	}
+	if err := loadTable(j.table, j.entries); err != nil {
+		log.Printf("[Progress] 读取进度失败: %v", err)
+	}
+	migrateLegacyFile(j.table, legacyPath, func() error {
+		return j.loadJournal(legacyPath)
+	}, func() error {
+		return saveTable(j.table, j.entries)
+	})
+	return j
+}
+
+// loadJournal 回放旧的进度日志
+func (j *ProgressJournal) loadJournal(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var p ReadingProgress
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil || p.EbookID == "" {
+			continue
+		}
+		// 日志按写入顺序回放，后写入的行就是合并后的结果
+		j.entries[p.EbookID] = &p
+	}
+	return scanner.Err()
+}
+
+// Record 记录本机产生的进度，本机记录总是覆盖本机旧记录
+func (j *ProgressJournal) Record(p ReadingProgress) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries[p.EbookID] = &p
+	return putRecord(j.table, p.EbookID, &p)
+}
+
+// Merge 合并远端进度，返回本地发生变化的书籍 ID
+func (j *ProgressJournal) Merge(remote map[string]*ReadingProgress) ([]string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var changed []string
+	for id, rp := range remote {
+		if rp == nil {
+			continue
+		}
+		local := j.entries[id]
+		merged := mergeProgress(local, rp)
+		if merged == local {
+			continue
+		}
+		cp := *merged
+		j.entries[id] = &cp
+		if err := putRecord(j.table, id, &cp); err != nil {
+			return changed, err
+		}
+		changed = append(changed, id)
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+func (j *ProgressJournal) Get(ebookID string) *ReadingProgress {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if p := j.entries[ebookID]; p != nil {
+		cp := *p
+		return &cp
+	}
+	return nil
+}
+
+// Snapshot 返回全部书籍的当前进度副本
+func (j *ProgressJournal) Snapshot() map[string]*ReadingProgress {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	snapshot := make(map[string]*ReadingProgress, len(j.entries))
+	for id, p := range j.entries {
+		cp := *p
+		snapshot[id] = &cp
+	}
+	return snapshot
+}
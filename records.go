@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// RecordSet 是一组以 ID 为键、通过同步清单三方合并的记录，
+// 删除以墓碑（deleted 字段）表示
+type RecordSet[T any] struct {
+	mu       sync.RWMutex
+	kind     string
+	table    *dbTable
+	basePath string
+	items    map[string]*T
+	base     map[string]*T
+}
+
+// NewRecordSet 从数据库的 table 读取记录，table 为空时导入旧版本的 JSON 文件 legacyPath。
+// 同步基线仍然保存在 basePath
+func NewRecordSet[T any](kind string, table *dbTable, legacyPath, basePath string) *RecordSet[T] {
+	s := &RecordSet[T]{
+		kind:     kind,
+		table:    table,
+		basePath: basePath,
+		items:    map[string]*T{},
+		base:     map[string]*T{},
+	}
+	if err := loadTable(table, s.items); err != nil {
+		log.Printf("[Records] 读取 %s 失败: %v", kind, err)
+	}
+	migrateLegacyFile(table, legacyPath, func() error {
+		return readJSONFile(legacyPath, &s.items)
+	}, func() error {
+		if s.items == nil {
+			s.items = map[string]*T{}
+		}
+		return s.saveLocked()
+	})
+	if err := readJSONFile(basePath, &s.base); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Records] 读取 %s 同步基线失败: %v", kind, err)
+	}
+	if s.items == nil {
+		s.items = map[string]*T{}
+	}
+	if s.base == nil {
+		s.base = map[string]*T{}
+	}
+	return s
+}
+
+// copyRecord 通过 JSON 深拷贝记录，避免调用方修改内部的切片和映射
+func copyRecord[T any](item *T) *T {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil
+	}
+	cp := new(T)
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil
+	}
+	return cp
+}
+
+func copyRecords[T any](items map[string]*T) map[string]*T {
+	cp := make(map[string]*T, len(items))
+	for id, item := range items {
+		cp[id] = copyRecord(item)
+	}
+	return cp
+}
+
+func (s *RecordSet[T]) saveLocked() error {
+	return saveTable(s.table, s.items)
+}
+
+// Get 返回记录副本，包括墓碑
+func (s *RecordSet[T]) Get(id string) (*T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	item := s.items[id]
+	if item == nil {
+		return nil, false
+	}
+	return copyRecord(item), true
+}
+
+func (s *RecordSet[T]) Put(id string, item *T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[id] = copyRecord(item)
+	return putRecord(s.table, id, s.items[id])
+}
+
+// Filter 返回满足条件的记录副本
+func (s *RecordSet[T]) Filter(fn func(item *T) bool) []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []T
+	for _, item := range s.items {
+		if fn(item) {
+			list = append(list, *copyRecord(item))
+		}
+	}
+	return list
+}
+
+func (s *RecordSet[T]) Snapshot() map[string]*T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copyRecords(s.items)
+}
+
+// Merge 与远端记录做三方合并并清理过期墓碑，返回本地是否变化
+func (s *RecordSet[T]) Merge(remote map[string]*T) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if remote == nil {
+		remote = map[string]*T{}
+	}
+	merged, _, err := mergeRecordSets(s.kind, s.base, s.items, remote)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	for id, item := range merged {
+		fields, err := recordFields(item)
+		if err != nil || !isDeleted(fields) {
+			continue
+		}
+		if now.Sub(time.UnixMilli(rawInt64(fields["updatedAt"]))) <= tombstoneTTL {
+			continue
+		}
+		if base := s.base[id]; base != nil {
+			if baseFields, err := recordFields(base); err == nil && isDeleted(baseFields) {
+				delete(merged, id)
+			}
+		}
+	}
+
+	changed := !jsonEqual(s.items, merged)
+	s.items = merged
+	if changed {
+		return true, s.saveLocked()
+	}
+	return false, nil
+}
+
+// CommitBase 把已上传到远端的记录记为新的基线
+func (s *RecordSet[T]) CommitBase(uploaded map[string]*T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.base = copyRecords(uploaded)
+	return writeJSONFile(s.basePath, s.base)
+}
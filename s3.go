@@ -0,0 +1,670 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// 超过该大小使用分片上传
+	s3MultipartThreshold = 16 << 20
+	s3MinPartSize        = 8 << 20
+	s3MaxParts           = 10000
+	s3UnsignedPayload    = "UNSIGNED-PAYLOAD"
+	s3EmptyPayloadHash   = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3Config 对应前端 UserConfig.storage.s3，适用于 AWS S3、MinIO、Cloudflare R2 等兼容服务。
+// 默认使用路径风格（endpoint/bucket/key），MinIO 本地部署通常只支持这种方式
+type S3Config struct {
+	Endpoint         string `json:"endpoint"`
+	Region           string `json:"region"`
+	Bucket           string `json:"bucket"`
+	AccessKeyID      string `json:"accessKeyId"`
+	SecretAccessKey  string `json:"secretAccessKey"`
+	Prefix           string `json:"prefix"`
+	VirtualHostStyle bool   `json:"virtualHostStyle,omitempty"`
+	NamingStrategy   string `json:"namingStrategy"`
+}
+
+func init() {
+	RegisterStorage("s3", func(a *App, config StorageConfig) (StorageProvider, error) {
+		if config.S3 == nil || config.S3.Endpoint == "" || config.S3.Bucket == "" {
+			return nil, fmt.Errorf("s3: %w", errStorageNotConfigured)
+		}
+		return NewS3Storage(*config.S3)
+	})
+}
+
+// S3Storage 用 SigV4 签名访问 S3 兼容的对象存储。对象存储没有目录，
+// 以 “/” 分隔的前缀模拟目录，Mkdir 创建以 “/” 结尾的空对象作为占位
+type S3Storage struct {
+	config   S3Config
+	endpoint *url.URL
+	region   string
+	prefix   string
+	http     *http.Client
+	now      func() time.Time
+}
+
+func NewS3Storage(config S3Config) (*S3Storage, error) {
+	endpoint, err := url.Parse(strings.TrimRight(config.Endpoint, "/"))
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint: %q", config.Endpoint)
+	}
+	region := config.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	prefix := config.Prefix
+	if prefix == "" {
+		prefix = AppName
+	}
+	return &S3Storage{
+		config:   config,
+		endpoint: endpoint,
+		region:   region,
+		prefix:   strings.Trim(prefix, "/"),
+		http:     &http.Client{Timeout: 30 * time.Minute},
+		now:      time.Now,
+	}, nil
+}
+
+func (s *S3Storage) Name() string {
+	return "s3"
+}
+
+// key 把相对路径转为对象键
+func (s *S3Storage) key(p string) string {
+	clean := cleanRemotePath(p)
+	if s.prefix == "" {
+		return clean
+	}
+	if clean == "" {
+		return s.prefix
+	}
+	return s.prefix + "/" + clean
+}
+
+// dirKey 返回目录对应的前缀（以 / 结尾，根目录且无前缀时为空）
+func (s *S3Storage) dirKey(dir string) string {
+	if key := s.key(dir); key != "" {
+		return key + "/"
+	}
+	return ""
+}
+
+// relative 把对象键转回相对路径
+func (s *S3Storage) relative(key string) string {
+	key = strings.TrimSuffix(key, "/")
+	if s.prefix == "" {
+		return key
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(key, s.prefix), "/")
+}
+
+// s3Escape 按 SigV4 规则转义，只保留 A-Za-z0-9-._~，keepSlash 时保留路径分隔符
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', keepSlash && c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// objectURL 返回对象的地址，key 为空时为 bucket 本身
+func (s *S3Storage) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	rawPath := strings.TrimSuffix(u.Path, "/")
+	if s.config.VirtualHostStyle {
+		u.Host = s.config.Bucket + "." + u.Host
+	} else {
+		rawPath += "/" + s3Escape(s.config.Bucket, false)
+	}
+	rawPath += "/" + s3Escape(key, true)
+	u.RawPath = rawPath
+	u.Path, _ = url.PathUnescape(rawPath)
+	u.RawQuery = s3CanonicalQuery(query)
+	return &u
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sign 为请求添加 SigV4 签名。payloadHash 为请求体的 SHA256，流式上传时使用 UNSIGNED-PAYLOAD
+func (s *S3Storage) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// 签名 host 以及所有 x-amz-* 头
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lower := strings.ToLower(k)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "content-md5" {
+			headers[lower] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// do 发送签名请求。body 为 []byte 时计算负载哈希，为 io.Reader 时按 size 流式发送并使用 UNSIGNED-PAYLOAD
+func (s *S3Storage) do(method, key string, query url.Values, headers map[string]string, body interface{}, size int64) (*http.Response, error) {
+	var reader io.Reader
+	payloadHash := s3EmptyPayloadHash
+	switch b := body.(type) {
+	case []byte:
+		reader = bytes.NewReader(b)
+		payloadHash = sha256Hex(b)
+		size = int64(len(b))
+	case io.Reader:
+		reader = b
+		payloadHash = s3UnsignedPayload
+		if size == 0 {
+			reader = http.NoBody
+		}
+	}
+	req, err := http.NewRequest(method, s.objectURL(key, query).String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if reader != nil {
+		req.ContentLength = size
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	s.sign(req, payloadHash)
+	return s.http.Do(req)
+}
+
+// s3Error 把错误响应转为错误，404 对应 os.ErrNotExist，412 对应 os.ErrExist
+func s3Error(op, p string, resp *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	xml.Unmarshal(data, &body)
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("s3 %s %s: %w", op, p, os.ErrNotExist)
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("s3 %s %s: %w", op, p, os.ErrExist)
+	}
+	if body.Code != "" {
+		return fmt.Errorf("s3 %s %s: %s: %s (HTTP %d)", op, p, body.Code, body.Message, resp.StatusCode)
+	}
+	return fmt.Errorf("s3 %s %s: HTTP %d", op, p, resp.StatusCode)
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string `xml:"Key"`
+		Size         int64  `xml:"Size"`
+		LastModified string `xml:"LastModified"`
+		ETag         string `xml:"ETag"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// listObjects 调用 ListObjectsV2 并自动翻页；delimiter 为空时递归列出，limit 大于 0 时最多取一页
+func (s *S3Storage) listObjects(prefix, delimiter string, limit int, fn func(*s3ListResult)) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if limit > 0 {
+			query.Set("max-keys", strconv.Itoa(limit))
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do("GET", "", query, nil, nil, 0)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return s3Error("list", prefix, resp)
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("parse list response: %w", err)
+		}
+		fn(&result)
+		if !result.IsTruncated || result.NextContinuationToken == "" || limit > 0 {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *S3Storage) List(dir string) ([]RemoteFile, error) {
+	prefix := s.dirKey(dir)
+	var list []RemoteFile
+	found := false
+	err := s.listObjects(prefix, "/", 0, func(result *s3ListResult) {
+		for _, cp := range result.CommonPrefixes {
+			found = true
+			rel := s.relative(cp.Prefix)
+			list = append(list, RemoteFile{Path: rel, Name: path.Base(rel), IsDir: true})
+		}
+		for _, obj := range result.Contents {
+			found = true
+			// 跳过目录占位对象
+			if obj.Key == prefix {
+				continue
+			}
+			rel := s.relative(obj.Key)
+			f := RemoteFile{Path: rel, Name: path.Base(rel), Size: obj.Size, ETag: strings.Trim(obj.ETag, `"`)}
+			if t, err := time.Parse(time.RFC3339, obj.LastModified); err == nil {
+				f.Modified = t.UnixMilli()
+			}
+			list = append(list, f)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found && cleanRemotePath(dir) != "" {
+		return nil, fmt.Errorf("s3 list %s: %w", dir, os.ErrNotExist)
+	}
+	if list == nil {
+		list = []RemoteFile{}
+	}
+	return list, nil
+}
+
+// Stat 先按对象查找，不存在时再看是否为目录前缀
+func (s *S3Storage) Stat(p string) (RemoteFile, error) {
+	rel := cleanRemotePath(p)
+	if rel == "" {
+		return RemoteFile{IsDir: true}, nil
+	}
+	resp, err := s.do("HEAD", s.key(rel), nil, nil, nil, 0)
+	if err != nil {
+		return RemoteFile{}, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		f := RemoteFile{Path: rel, Name: path.Base(rel), Size: resp.ContentLength, ETag: strings.Trim(resp.Header.Get("ETag"), `"`)}
+		if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+			f.Modified = t.UnixMilli()
+		}
+		return f, nil
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		return RemoteFile{}, s3Error("stat", p, resp)
+	}
+
+	isDir := false
+	err = s.listObjects(s.dirKey(rel), "/", 1, func(result *s3ListResult) {
+		isDir = len(result.Contents) > 0 || len(result.CommonPrefixes) > 0
+	})
+	if err != nil {
+		return RemoteFile{}, err
+	}
+	if !isDir {
+		return RemoteFile{}, fmt.Errorf("s3 stat %s: %w", p, os.ErrNotExist)
+	}
+	return RemoteFile{Path: rel, Name: path.Base(rel), IsDir: true}, nil
+}
+
+func (s *S3Storage) Open(p string, offset, length int64) (io.ReadCloser, error) {
+	headers := map[string]string{}
+	if rangeHeader := byteRange(offset, length); rangeHeader != "" {
+		headers["Range"] = rangeHeader
+	}
+	resp, err := s.do("GET", s.key(p), nil, headers, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		defer resp.Body.Close()
+		return nil, s3Error("get", p, resp)
+	}
+	return rangeBody(resp, offset, length)
+}
+
+// Put 小文件直接 PUT，大文件使用分片上传；对象存储不需要预先创建父目录
+func (s *S3Storage) Put(p string, r io.ReadSeeker, policy UploadPolicy, progress ProgressFunc) (string, error) {
+	target := cleanRemotePath(p)
+	switch policy {
+	case UploadRename:
+		var err error
+		if target, err = freeRemoteName(s.Stat, target); err != nil {
+			return "", err
+		}
+	case UploadFail:
+		if _, err := s.Stat(target); err == nil {
+			return "", fmt.Errorf("s3 put %s: %w", p, os.ErrExist)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	size, err := seekerSize(r)
+	if err != nil {
+		return "", err
+	}
+	reader := newProgressReader(r, size, progress)
+	if size > s3MultipartThreshold {
+		return target, s.putMultipart(s.key(target), reader, size)
+	}
+
+	resp, err := s.do("PUT", s.key(target), nil, map[string]string{"Content-Type": "application/octet-stream"}, reader, size)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", s3Error("put", p, resp)
+	}
+	return target, nil
+}
+
+// PutIfMatch 用 If-Match / If-None-Match 条件写入小文件，远端已变化时返回 errRemoteChanged。
+// 不支持条件写入的兼容服务会忽略这两个头，相当于普通覆盖
+func (s *S3Storage) PutIfMatch(p string, data []byte, etag string) error {
+	headers := map[string]string{"Content-Type": "application/octet-stream", "If-None-Match": "*"}
+	if etag != "" {
+		delete(headers, "If-None-Match")
+		headers["If-Match"] = `"` + etag + `"`
+	}
+	resp, err := s.do("PUT", s.key(p), nil, headers, data, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		// 409 是并发的条件写入正在进行
+		return fmt.Errorf("s3 put %s: %w", p, errRemoteChanged)
+	}
+	return s3Error("put", p, resp)
+}
+
+// putMultipart 按顺序上传分片，失败时中止上传以免留下未完成的分片
+func (s *S3Storage) putMultipart(key string, r io.Reader, size int64) error {
+	resp, err := s.do("POST", key, url.Values{"uploads": {""}}, map[string]string{"Content-Type": "application/octet-stream"}, nil, 0)
+	if err != nil {
+		return err
+	}
+	var initiate struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return s3Error("create multipart upload", key, resp)
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiate)
+	resp.Body.Close()
+	if err != nil || initiate.UploadID == "" {
+		return fmt.Errorf("s3 create multipart upload %s: invalid response", key)
+	}
+
+	if err := s.uploadParts(key, initiate.UploadID, r, size); err != nil {
+		abort, abortErr := s.do("DELETE", key, url.Values{"uploadId": {initiate.UploadID}}, nil, nil, 0)
+		if abortErr == nil {
+			abort.Body.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (s *S3Storage) uploadParts(key, uploadID string, r io.Reader, size int64) error {
+	partSize := max(int64(s3MinPartSize), (size+s3MaxParts-1)/s3MaxParts)
+	buf := make([]byte, partSize)
+	var parts []s3CompletedPart
+	for number := 1; int64(number-1)*partSize < size; number++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := s.do("PUT", key, query, nil, buf[:n], 0)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return s3Error("upload part", key, resp)
+		}
+		parts = append(parts, s3CompletedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+		Parts   []s3CompletedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err := s.do("POST", key, url.Values{"uploadId": {uploadID}}, map[string]string{"Content-Type": "application/xml"}, body, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// 完成请求可能在 200 响应中返回错误
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || bytes.Contains(data, []byte("<Error>")) {
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		return s3Error("complete multipart upload", key, resp)
+	}
+	return nil
+}
+
+// Mkdir 创建目录占位对象，使空目录也能列出
+func (s *S3Storage) Mkdir(dir string) error {
+	key := s.dirKey(dir)
+	if key == "" {
+		return nil
+	}
+	resp, err := s.do("PUT", key, nil, nil, []byte{}, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("mkdir", dir, resp)
+	}
+	return nil
+}
+
+// keysUnder 返回路径对应的全部对象键：文件为自身，目录为前缀下的所有对象
+func (s *S3Storage) keysUnder(p string) ([]string, error) {
+	info, err := s.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir {
+		return []string{s.key(p)}, nil
+	}
+	var keys []string
+	err = s.listObjects(s.dirKey(p), "", 0, func(result *s3ListResult) {
+		for _, obj := range result.Contents {
+			keys = append(keys, obj.Key)
+		}
+	})
+	return keys, err
+}
+
+// Move 以 CopyObject 加删除实现，目录会逐个复制其下的对象
+func (s *S3Storage) Move(from, to string, overwrite bool) error {
+	if !overwrite {
+		if _, err := s.Stat(to); err == nil {
+			return fmt.Errorf("s3 move %s: %w", from, os.ErrExist)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	keys, err := s.keysUnder(from)
+	if err != nil {
+		return err
+	}
+	fromKey, toKey := s.key(from), s.key(to)
+	for _, key := range keys {
+		dest := toKey + strings.TrimPrefix(key, fromKey)
+		source := "/" + s.config.Bucket + "/" + key
+		resp, err := s.do("PUT", dest, nil, map[string]string{"X-Amz-Copy-Source": s3Escape(source, true)}, nil, 0)
+		if err != nil {
+			return err
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || bytes.Contains(data, []byte("<Error>")) {
+			resp.Body = io.NopCloser(bytes.NewReader(data))
+			return s3Error("copy", key, resp)
+		}
+	}
+	for _, key := range keys {
+		if err := s.deleteKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3Storage) deleteKey(key string) error {
+	resp, err := s.do("DELETE", key, nil, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error("delete", key, resp)
+	}
+	return nil
+}
+
+func (s *S3Storage) Delete(p string) error {
+	if cleanRemotePath(p) == "" {
+		return errors.New("refusing to delete storage root")
+	}
+	keys, err := s.keysUnder(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := s.deleteKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Quota 对象存储没有容量上限
+func (s *S3Storage) Quota() (StorageQuota, error) {
+	return StorageQuota{}, nil
+}
+
+// VerifyS3 检查凭据和 bucket 是否可用
+func (a *App) VerifyS3(config S3Config) string {
+	s, err := NewS3Storage(config)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if err := s.listObjects(s.dirKey(""), "/", 1, func(*s3ListResult) {}); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReadingSession 是统计日志中的一次阅读会话
+type ReadingSession struct {
+	ID            string  `json:"id"`
+	DeviceID      string  `json:"deviceId"`
+	EbookID       string  `json:"ebookId"`
+	Format        string  `json:"format,omitempty"`
+	StartedAt     int64   `json:"startedAt"`
+	EndedAt       int64   `json:"endedAt"`
+	StartPosition float64 `json:"startPosition"`
+	EndPosition   float64 `json:"endPosition"`
+	StartChapter  int     `json:"startChapter"`
+	EndChapter    int     `json:"endChapter"`
+	// PDF 的 chapterIndex 就是页码，EPUB 只能统计章节
+	PagesAdvanced    int `json:"pagesAdvanced"`
+	ChaptersAdvanced int `json:"chaptersAdvanced"`
+}
+
+func (s *ReadingSession) Duration() time.Duration {
+	return time.Duration(s.EndedAt-s.StartedAt) * time.Millisecond
+}
+
+// StatsLog 管理阅读会话日志：本机会话追加写入 stats/<deviceId>.jsonl，
+// 其他设备的日志在同步时下载到同一目录
+type StatsLog struct {
+	mu       sync.RWMutex
+	dir      string
+	deviceID string
+	sessions map[string]*ReadingSession
+	open     map[string]*ReadingSession
+}
+
+func NewStatsLog(dir, deviceID string) *StatsLog {
+	s := &StatsLog{
+		dir:      dir,
+		deviceID: deviceID,
+		sessions: map[string]*ReadingSession{},
+		open:     map[string]*ReadingSession{},
+	}
+	if err := s.reload(); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Stats] 读取阅读统计失败: %v", err)
+	}
+	return s
+}
+
+func (s *StatsLog) logPath(deviceID string) string {
+	return filepath.Join(s.dir, deviceID+".jsonl")
+}
+
+func (s *StatsLog) ownLogPath() string {
+	return s.logPath(s.deviceID)
+}
+
+// reload 重新读取目录下全部设备的日志
+func (s *StatsLog) reload() error {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.jsonl"))
+	if err != nil {
+		return err
+	}
+	sessions := map[string]*ReadingSession{}
+	for _, path := range files {
+		if err := readSessionLog(path, sessions); err != nil {
+			log.Printf("[Stats] 读取日志失败: %s, %v", path, err)
+		}
+	}
+	s.mu.Lock()
+	s.sessions = sessions
+	s.mu.Unlock()
+	return nil
+}
+
+func readSessionLog(path string, into map[string]*ReadingSession) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var session ReadingSession
+		if err := json.Unmarshal(scanner.Bytes(), &session); err != nil || session.ID == "" {
+			continue
+		}
+		into[session.ID] = &session
+	}
+	return scanner.Err()
+}
+
+// Track 根据本机的进度记录延续或开启会话；间隔过长或换了一本书时结束之前的会话
+func (s *StatsLog) Track(p ReadingProgress, format string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts := p.Timestamp
+	if ts == 0 {
+		ts = time.Now().UnixMilli()
+	}
+
+	for id, open := range s.open {
+		if id != p.EbookID || time.Duration(ts-open.EndedAt)*time.Millisecond > sessionGap {
+			if err := s.closeLocked(id); err != nil {
+				return err
+			}
+		}
+	}
+
+	open := s.open[p.EbookID]
+	if open == nil {
+		s.open[p.EbookID] = &ReadingSession{
+			ID:            newID(),
+			DeviceID:      s.deviceID,
+			EbookID:       p.EbookID,
+			Format:        format,
+			StartedAt:     ts,
+			EndedAt:       ts,
+			StartPosition: p.Position,
+			EndPosition:   p.Position,
+			StartChapter:  p.ChapterIndex,
+			EndChapter:    p.ChapterIndex,
+		}
+		return nil
+	}
+	open.EndedAt = ts
+	open.EndPosition = p.Position
+	open.EndChapter = p.ChapterIndex
+	return nil
+}
+
+// End 结束某本书的会话，ebookID 为空时结束全部会话
+func (s *StatsLog) End(ebookID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.open {
+		if ebookID == "" || id == ebookID {
+			if err := s.closeLocked(id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *StatsLog) closeLocked(ebookID string) error {
+	session := s.open[ebookID]
+	delete(s.open, ebookID)
+	if session == nil || session.EndedAt <= session.StartedAt {
+		return nil
+	}
+
+	advanced := session.EndChapter - session.StartChapter
+	if advanced < 0 {
+		advanced = 0
+	}
+	if session.Format == "pdf" {
+		session.PagesAdvanced = advanced
+	} else {
+		session.ChaptersAdvanced = advanced
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.ownLogPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.sessions[session.ID] = session
+	return nil
+}
+
+// Sessions 返回全部设备已结束的会话，按开始时间排序
+func (s *StatsLog) Sessions() []ReadingSession {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]ReadingSession, 0, len(s.sessions)+len(s.open))
+	for _, session := range s.sessions {
+		list = append(list, *session)
+	}
+	for _, session := range s.open {
+		list = append(list, *session)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt < list[j].StartedAt })
+	return list
+}
+
+// PeriodTotal 是某一天、周或月的阅读汇总
+type PeriodTotal struct {
+	Start    int64  `json:"start"`
+	Label    string `json:"label"`
+	Seconds  int64  `json:"seconds"`
+	Sessions int    `json:"sessions"`
+	Pages    int    `json:"pages"`
+	Chapters int    `json:"chapters"`
+	Books    int    `json:"books"`
+}
+
+type FinishPrediction struct {
+	HoursRemaining  float64 `json:"hoursRemaining"`
+	EstimatedFinish int64   `json:"estimatedFinish"`
+}
+
+type BookStats struct {
+	EbookID      string            `json:"ebookId"`
+	Title        string            `json:"title"`
+	Seconds      int64             `json:"seconds"`
+	Sessions     int               `json:"sessions"`
+	Pages        int               `json:"pages"`
+	Chapters     int               `json:"chapters"`
+	LastReadAt   int64             `json:"lastReadAt"`
+	Progress     float64           `json:"progress"`
+	PagesPerHour float64           `json:"pagesPerHour"`
+	Prediction   *FinishPrediction `json:"prediction,omitempty"`
+}
+
+type ReadingStats struct {
+	TotalSeconds  int64         `json:"totalSeconds"`
+	TotalSessions int           `json:"totalSessions"`
+	CurrentStreak int           `json:"currentStreak"`
+	LongestStreak int           `json:"longestStreak"`
+	PagesPerHour  float64       `json:"pagesPerHour"`
+	Daily         []PeriodTotal `json:"daily"`
+	Weekly        []PeriodTotal `json:"weekly"`
+	Monthly       []PeriodTotal `json:"monthly"`
+	Books         []BookStats   `json:"books"`
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek 以周一为一周的开始
+func startOfWeek(t time.Time) time.Time {
+	day := startOfDay(t)
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+func startOfMonth(t time.Time) time.Time {
+	y, m, _ := t.Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+}
+
+// periodTotals 汇总最近 count 个周期，start 求周期起点，next 求下一个周期
+func periodTotals(sessions []ReadingSession, now time.Time, count int, start func(time.Time) time.Time, step func(time.Time, int) time.Time, layout string) []PeriodTotal {
+	current := start(now)
+	first := step(current, -(count - 1))
+
+	totals := make([]PeriodTotal, count)
+	books := make([]map[string]bool, count)
+	for i := range totals {
+		p := step(first, i)
+		totals[i] = PeriodTotal{Start: p.UnixMilli(), Label: p.Format(layout)}
+		books[i] = map[string]bool{}
+	}
+
+	for _, session := range sessions {
+		t := start(time.UnixMilli(session.StartedAt).In(now.Location()))
+		if t.Before(first) || t.After(current) {
+			continue
+		}
+		i := 0
+		for i < count-1 && !step(first, i+1).After(t) {
+			i++
+		}
+		totals[i].Seconds += int64(session.Duration() / time.Second)
+		totals[i].Sessions++
+		totals[i].Pages += session.PagesAdvanced
+		totals[i].Chapters += session.ChaptersAdvanced
+		books[i][session.EbookID] = true
+	}
+	for i := range totals {
+		totals[i].Books = len(books[i])
+	}
+	return totals
+}
+
+// readingStreaks 计算连续阅读天数：当前连续（今天还没读时从昨天算起）和历史最长
+func readingStreaks(sessions []ReadingSession, now time.Time) (current, longest int) {
+	days := map[time.Time]bool{}
+	for _, session := range sessions {
+		if session.Duration() >= time.Minute {
+			days[startOfDay(time.UnixMilli(session.StartedAt).In(now.Location()))] = true
+		}
+	}
+	if len(days) == 0 {
+		return 0, 0
+	}
+
+	sorted := make([]time.Time, 0, len(days))
+	for d := range days {
+		sorted = append(sorted, d)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	run := 0
+	for i, d := range sorted {
+		if i > 0 && sorted[i-1].AddDate(0, 0, 1).Equal(d) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+
+	day := startOfDay(now)
+	if !days[day] {
+		day = day.AddDate(0, 0, -1)
+	}
+	for days[day] {
+		current++
+		day = day.AddDate(0, 0, -1)
+	}
+	return current, longest
+}
+
+func pagesPerHour(sessions []ReadingSession) float64 {
+	var pages int
+	var dur time.Duration
+	for _, session := range sessions {
+		if session.Format == "pdf" {
+			pages += session.PagesAdvanced
+			dur += session.Duration()
+		}
+	}
+	if dur <= 0 {
+		return 0
+	}
+	return float64(pages) / dur.Hours()
+}
+
+// predictFinish 根据最近 30 天的阅读速度和每天的阅读时长估算读完时间
+func predictFinish(sessions []ReadingSession, progress float64, now time.Time) *FinishPrediction {
+	if progress >= 1 {
+		return nil
+	}
+	since := now.AddDate(0, 0, -30).UnixMilli()
+
+	var advanced float64
+	var dur time.Duration
+	days := map[time.Time]bool{}
+	for _, session := range sessions {
+		if session.StartedAt < since {
+			continue
+		}
+		if delta := session.EndPosition - session.StartPosition; delta > 0 {
+			advanced += delta
+		}
+		dur += session.Duration()
+		days[startOfDay(time.UnixMilli(session.StartedAt).In(now.Location()))] = true
+	}
+	if advanced <= 0 || dur <= 0 || len(days) == 0 {
+		return nil
+	}
+
+	hoursRemaining := (1 - progress) / (advanced / dur.Hours())
+	hoursPerDay := dur.Hours() / float64(len(days))
+	finish := now.Add(time.Duration(hoursRemaining / hoursPerDay * 24 * float64(time.Hour)))
+	return &FinishPrediction{
+		HoursRemaining:  hoursRemaining,
+		EstimatedFinish: finish.UnixMilli(),
+	}
+}
+
+func (a *App) buildBookStats(ebookID string, sessions []ReadingSession, now time.Time) BookStats {
+	stats := BookStats{EbookID: ebookID}
+	if book, ok := a.library.Book(ebookID); ok {
+		stats.Title = book.Title
+	}
+	for _, session := range sessions {
+		stats.Seconds += int64(session.Duration() / time.Second)
+		stats.Sessions++
+		stats.Pages += session.PagesAdvanced
+		stats.Chapters += session.ChaptersAdvanced
+		if session.EndedAt > stats.LastReadAt {
+			stats.LastReadAt = session.EndedAt
+		}
+	}
+	if p := a.progress.Get(ebookID); p != nil {
+		stats.Progress = p.Position
+	}
+	stats.PagesPerHour = pagesPerHour(sessions)
+	stats.Prediction = predictFinish(sessions, stats.Progress, now)
+	return stats
+}
+
+func (a *App) GetReadingStats() ReadingStats {
+	sessions := a.stats.Sessions()
+	now := time.Now()
+
+	stats := ReadingStats{
+		Daily:        periodTotals(sessions, now, 30, startOfDay, func(t time.Time, n int) time.Time { return t.AddDate(0, 0, n) }, "01-02"),
+		Weekly:       periodTotals(sessions, now, 12, startOfWeek, func(t time.Time, n int) time.Time { return t.AddDate(0, 0, 7*n) }, "01-02"),
+		Monthly:      periodTotals(sessions, now, 12, startOfMonth, func(t time.Time, n int) time.Time { return t.AddDate(0, n, 0) }, "2006-01"),
+		PagesPerHour: pagesPerHour(sessions),
+	}
+	stats.CurrentStreak, stats.LongestStreak = readingStreaks(sessions, now)
+
+	byBook := map[string][]ReadingSession{}
+	for _, session := range sessions {
+		stats.TotalSeconds += int64(session.Duration() / time.Second)
+		stats.TotalSessions++
+		byBook[session.EbookID] = append(byBook[session.EbookID], session)
+	}
+	for id, list := range byBook {
+		stats.Books = append(stats.Books, a.buildBookStats(id, list, now))
+	}
+	sort.Slice(stats.Books, func(i, j int) bool { return stats.Books[i].Seconds > stats.Books[j].Seconds })
+	return stats
+}
+
+func (a *App) GetBookStats(ebookId string) BookStats {
+	var sessions []ReadingSession
+	for _, session := range a.stats.Sessions() {
+		if session.EbookID == ebookId {
+			sessions = append(sessions, session)
+		}
+	}
+	return a.buildBookStats(ebookId, sessions, time.Now())
+}
+
+// EndReadingSession 在离开阅读页时结束当前会话
+func (a *App) EndReadingSession(ebookId string) string {
+	if err := a.stats.End(ebookId); err != nil {
+		log.Printf("[Stats] 结束阅读会话失败: %v", err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
+
+// syncStats 上传本机的会话日志并下载其他设备的日志；每台设备只写自己的文件，不会冲突
+func (e *SyncEngine) syncStats(storage StorageProvider) error {
+	stats := e.app.stats
+
+	remoteFiles, err := storage.List("sync/stats")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	changed := false
+	for _, f := range remoteFiles {
+		if f.IsDir || !strings.HasSuffix(f.Name, ".jsonl") {
+			continue
+		}
+		deviceID := strings.TrimSuffix(f.Name, ".jsonl")
+		if deviceID == stats.deviceID || !validBookID(deviceID) {
+			continue
+		}
+		rel := "sync/stats/" + f.Name
+		// 有 ETag 时按 ETag 判断是否变化，否则比较大小
+		if info, err := os.Stat(stats.logPath(deviceID)); err == nil {
+			if f.ETag != "" && f.ETag == e.etags[rel] || f.ETag == "" && info.Size() == f.Size {
+				continue
+			}
+		}
+		data, err := readRemoteFile(storage, rel)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(stats.dir, 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(stats.logPath(deviceID), data, 0o644); err != nil {
+			return err
+		}
+		e.rememberETag(rel, f.ETag)
+		changed = true
+	}
+	if changed {
+		if err := writeJSONFile(e.etagsPath(), e.etags); err != nil {
+			log.Printf("[Sync] 保存 ETag 记录失败: %v", err)
+		}
+		if err := stats.reload(); err != nil {
+			return err
+		}
+		e.app.emit("sync:stats-updated")
+	}
+
+	info, err := os.Stat(stats.ownLogPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, f := range remoteFiles {
+		if f.Name == stats.deviceID+".jsonl" && f.Size == info.Size() {
+			return nil
+		}
+	}
+	data, err := os.ReadFile(stats.ownLogPath())
+	if err != nil {
+		return err
+	}
+	return writeRemoteFile(storage, "sync/stats/"+stats.deviceID+".jsonl", data)
+}
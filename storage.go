@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RemoteFile 是存储中的一个文件或目录，Path 相对于存储根目录
+type RemoteFile struct {
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	IsDir    bool   `json:"isDir"`
+	Modified int64  `json:"modified"`
+	ETag     string `json:"etag,omitempty"`
+}
+
+// ModTime 返回修改时间，存储未提供时返回零值
+func (f RemoteFile) ModTime() time.Time {
+	if f.Modified <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(f.Modified)
+}
+
+// StorageQuota 是存储空间用量，单位字节；不支持查询时均为 0
+type StorageQuota struct {
+	Total int64 `json:"total"`
+	Used  int64 `json:"used"`
+}
+
+// UploadPolicy 决定上传时目标已存在的处理方式
+type UploadPolicy int
+
+const (
+	UploadOverwrite UploadPolicy = iota
+	UploadRename
+	UploadFail
+)
+
+// uploadPolicyFromNaming 把前端的 namingStrategy（0 不重命名, 1 重命名, 2 条件重命名, 3 覆盖）转为上传策略，
+// 条件重命名按重命名处理
+func uploadPolicyFromNaming(strategy string) UploadPolicy {
+	switch strategy {
+	case "0":
+		return UploadFail
+	case "1", "2":
+		return UploadRename
+	}
+	return UploadOverwrite
+}
+
+// ProgressFunc 报告上传进度
+type ProgressFunc func(written, total int64)
+
+// StorageProvider 是云存储的统一接口。路径都相对于该存储为本应用分配的根目录，
+// 文件不存在时返回 os.ErrNotExist，UploadFail 策略下目标已存在时返回 os.ErrExist
+type StorageProvider interface {
+	Name() string
+	List(dir string) ([]RemoteFile, error)
+	Stat(p string) (RemoteFile, error)
+	// Open 从 offset 开始读取，length 小于 0 时读到文件末尾
+	Open(p string, offset, length int64) (io.ReadCloser, error)
+	// Put 按策略上传，返回实际写入的路径；父目录不存在时自动创建
+	Put(p string, r io.ReadSeeker, policy UploadPolicy, progress ProgressFunc) (string, error)
+	Mkdir(dir string) error
+	// Move 移动或重命名，overwrite 为 false 且目标已存在时返回 os.ErrExist
+	Move(from, to string, overwrite bool) error
+	// Delete 删除文件或目录，不存在时不报错
+	Delete(p string) error
+	Quota() (StorageQuota, error)
+}
+
+// StorageFactory 根据用户配置创建存储，未配置时返回 errStorageNotConfigured
+type StorageFactory func(a *App, config StorageConfig) (StorageProvider, error)
+
+var errStorageNotConfigured = errors.New("storage is not configured")
+
+var (
+	storageMu        sync.RWMutex
+	storageFactories = map[string]StorageFactory{}
+)
+
+// RegisterStorage 按名称注册存储，名称对应 UserConfig.storage.default 的取值
+func RegisterStorage(name string, factory StorageFactory) {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+	if _, exists := storageFactories[name]; exists {
+		panic("storage registered twice: " + name)
+	}
+	storageFactories[name] = factory
+}
+
+func storageNames() []string {
+	storageMu.RLock()
+	defer storageMu.RUnlock()
+	names := make([]string, 0, len(storageFactories))
+	for name := range storageFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// storageProvider 按名称创建存储，"local" 表示不使用云存储
+func (a *App) storageProvider(name string) (StorageProvider, error) {
+	if name == "" || name == "local" {
+		return nil, fmt.Errorf("%w: %q", errStorageNotConfigured, name)
+	}
+	storageMu.RLock()
+	factory, ok := storageFactories[name]
+	storageMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage: %q", name)
+	}
+	return factory(a, a.settings.Config().Storage)
+}
+
+// syncStorageName 返回同步数据使用的存储，未单独指定时使用 storage.default
+func (c StorageConfig) syncStorageName() string {
+	if c.Sync != "" {
+		return c.Sync
+	}
+	return c.Default
+}
+
+// libraryStorageName 返回上传书籍使用的存储，未单独指定时使用 storage.default
+func (c StorageConfig) libraryStorageName() string {
+	if c.Library != "" {
+		return c.Library
+	}
+	return c.Default
+}
+
+func (a *App) syncStorage() (StorageProvider, error) {
+	return a.storageProvider(a.settings.Config().Storage.syncStorageName())
+}
+
+// bookStorageName 返回书籍 RemotePath 所在的存储，兼容只记录了路径的旧数据
+func bookStorageName(book EbookMetadata) string {
+	if book.RemoteStorage != "" {
+		return book.RemoteStorage
+	}
+	return "webdav"
+}
+
+// readRemoteFile 读取整个文件
+func readRemoteFile(storage StorageProvider, p string) ([]byte, error) {
+	rc, err := storage.Open(p, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// writeRemoteFile 写入整个文件，已存在时覆盖
+func writeRemoteFile(storage StorageProvider, p string, data []byte) error {
+	_, err := storage.Put(p, bytes.NewReader(data), UploadOverwrite, nil)
+	return err
+}
+
+// errRemoteChanged 表示条件写入时远端文件已不是读取时的版本
+var errRemoteChanged = errors.New("remote file changed")
+
+// conditionalPutter 由支持条件写入的存储实现：etag 为空时要求目标不存在，
+// 否则要求远端 ETag 未变化，不满足时返回 errRemoteChanged
+type conditionalPutter interface {
+	PutIfMatch(p string, data []byte, etag string) error
+}
+
+// sameRemoteVersion 比较同一文件的两次 Stat 结果，没有 ETag 时比较大小和修改时间
+func sameRemoteVersion(a, b RemoteFile) bool {
+	if a.ETag != "" || b.ETag != "" {
+		return a.ETag == b.ETag
+	}
+	return a.Size == b.Size && a.Modified == b.Modified
+}
+
+// writeRemoteFileIfUnchanged 只在远端文件仍是 prev 对应的版本时写入，prev 为 nil 表示读取时文件不存在。
+// 存储支持条件写入且有强 ETag 时由服务器判断，否则写入前再 Stat 比较一次
+func writeRemoteFileIfUnchanged(storage StorageProvider, p string, data []byte, prev *RemoteFile) error {
+	if cp, ok := storage.(conditionalPutter); ok && (prev == nil || (prev.ETag != "" && !strings.HasPrefix(prev.ETag, "W/"))) {
+		etag := ""
+		if prev != nil {
+			etag = prev.ETag
+		}
+		return cp.PutIfMatch(p, data, etag)
+	}
+	cur, err := storage.Stat(p)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if prev != nil {
+			return errRemoteChanged
+		}
+	case err != nil:
+		return err
+	case prev == nil || !sameRemoteVersion(*prev, cur):
+		return errRemoteChanged
+	}
+	return writeRemoteFile(storage, p, data)
+}
+
+// cleanRemotePath 规范化相对路径，防止通过 .. 跳出根目录
+func cleanRemotePath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// renamedPath 生成 “name (n).ext” 形式的候选名
+func renamedPath(p string, n int) string {
+	ext := path.Ext(p)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(p, ext), n, ext)
+}
+
+// freeRemoteName 在文件已存在时依次尝试 “name (1).ext” 等名字
+func freeRemoteName(stat func(string) (RemoteFile, error), p string) (string, error) {
+	candidate := p
+	for i := 1; i < 1000; i++ {
+		_, err := stat(candidate)
+		if errors.Is(err, os.ErrNotExist) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = renamedPath(p, i)
+	}
+	return "", fmt.Errorf("no free name for %s", p)
+}
+
+// seekerSize 返回剩余长度并回到原位置
+func seekerSize(r io.ReadSeeker) (int64, error) {
+	current, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(current, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return end - current, nil
+}
+
+// byteRange 生成 HTTP Range 头，读取整个文件时返回空
+func byteRange(offset, length int64) string {
+	switch {
+	case offset <= 0 && length < 0:
+		return ""
+	case length < 0:
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+max(length, 1)-1)
+}
+
+// rangeBody 返回请求范围内的响应体，服务器忽略 Range 返回 200 时自行跳过和截断
+func rangeBody(resp *http.Response, offset, length int64) (io.ReadCloser, error) {
+	if resp.StatusCode == http.StatusOK && offset > 0 {
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	if length < 0 {
+		return resp.Body, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, length), resp.Body}, nil
+}
+
+// progressReader 在读取时回调上传进度
+type progressReader struct {
+	r        io.Reader
+	total    int64
+	written  int64
+	progress ProgressFunc
+}
+
+func newProgressReader(r io.Reader, total int64, progress ProgressFunc) io.Reader {
+	if progress == nil {
+		return r
+	}
+	return &progressReader{r: r, total: total, progress: progress}
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.written += int64(n)
+		pr.progress(pr.written, pr.total)
+	}
+	return n, err
+}
+
+// remoteReadSeeker 按需从存储的指定位置打开文件，使 http.ServeContent 可以处理 Range
+type remoteReadSeeker struct {
+	storage StorageProvider
+	path    string
+	size    int64
+	offset  int64
+	rc      io.ReadCloser
+}
+
+func (r *remoteReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("seek %s: negative position", r.path)
+	}
+	if offset != r.offset && r.rc != nil {
+		r.rc.Close()
+		r.rc = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *remoteReadSeeker) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.rc == nil {
+		rc, err := r.storage.Open(r.path, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.rc = rc
+	}
+	n, err := r.rc.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *remoteReadSeeker) Close() error {
+	if r.rc != nil {
+		return r.rc.Close()
+	}
+	return nil
+}
+
+// StorageInfo 描述一个已注册的存储
+type StorageInfo struct {
+	Name       string `json:"name"`
+	Configured bool   `json:"configured"`
+	Sync       bool   `json:"sync"`
+	Library    bool   `json:"library"`
+}
+
+// ListStorages 列出已注册的存储及其用途
+func (a *App) ListStorages() []StorageInfo {
+	config := a.settings.Config().Storage
+	var list []StorageInfo
+	for _, name := range storageNames() {
+		_, err := a.storageProvider(name)
+		list = append(list, StorageInfo{
+			Name:       name,
+			Configured: err == nil,
+			Sync:       config.syncStorageName() == name,
+			Library:    config.libraryStorageName() == name,
+		})
+	}
+	return list
+}
+
+func (a *App) GetStorageQuota(name string) string {
+	storage, err := a.storageProvider(name)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	quota, err := storage.Quota()
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(quota)
+}
+
+// StorageList 列出存储中的目录内容
+func (a *App) StorageList(name string, dir string) string {
+	storage, err := a.storageProvider(name)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	files, err := storage.List(dir)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(map[string]interface{}{"list": files})
+}
+
+// StorageUploadBook 把本地保存的书上传到存储的 books 目录，按 namingStrategy 处理重名；
+// name 为空时使用 storage.library
+func (a *App) StorageUploadBook(name string, ebookId string) string {
+	config := a.settings.Config().Storage
+	if name == "" {
+		name = config.libraryStorageName()
+	}
+	storage, err := a.storageProvider(name)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	book, ok := a.library.Book(ebookId)
+	if !ok {
+		return `{"error": "book not found"}`
+	}
+	localPath := a.bookFilePath(book)
+	if localPath == "" {
+		return `{"error": "book file not found"}`
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	defer f.Close()
+
+	lastEmit := time.Time{}
+	progress := func(written, total int64) {
+		if time.Since(lastEmit) < 200*time.Millisecond && written < total {
+			return
+		}
+		lastEmit = time.Now()
+		a.emit("storage:upload-progress", map[string]interface{}{
+			"ebookId": ebookId, "written": written, "total": total,
+		})
+	}
+	remotePath, err := storage.Put("books/"+sanitizeFileName(book.Title)+"."+book.Format, f,
+		uploadPolicyFromNaming(config.namingStrategy(name)), progress)
+	if err != nil {
+		log.Printf("[Storage] 上传书籍到 %s 失败: %s, %v", name, book.Title, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	book.RemoteStorage = name
+	book.RemotePath = remotePath
+	if err := a.library.PutBook(book); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(map[string]string{"storage": name, "path": remotePath})
+}
+
+// StorageDownloadBook 下载存储中的书并加入书库，已在书库中的同一文件只更新本地副本
+func (a *App) StorageDownloadBook(name string, remotePath string) string {
+	storage, err := a.storageProvider(name)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	data, err := readRemoteFile(storage, remotePath)
+	if err != nil {
+		log.Printf("[Storage] 从 %s 下载书籍失败: %s, %v", name, remotePath, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+
+	var book EbookMetadata
+	for _, b := range a.library.Books() {
+		if b.RemotePath == remotePath && bookStorageName(b) == name {
+			book = b
+			break
+		}
+	}
+	fileName := path.Base("/" + remotePath)
+	if book.ID == "" {
+		book = EbookMetadata{
+			ID:            newID(),
+			Title:         strings.TrimSuffix(fileName, path.Ext(fileName)),
+			Author:        "未知作者",
+			Format:        strings.TrimPrefix(strings.ToLower(path.Ext(fileName)), "."),
+			StorageType:   name,
+			RemoteStorage: name,
+			RemotePath:    remotePath,
+			AddedAt:       time.Now().UnixMilli(),
+		}
+		book.Path = book.ID
+	}
+	if data, _, err = a.checkBookFile(book.ID, fileName, data); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if _, err := a.store.Save(book.ID, fileName, data); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	book.Size = int64(len(data))
+	if err := a.library.PutBook(book); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	a.emit("library:book-added", book)
+	a.emit("library:changed")
+	return jsonResult(book)
+}
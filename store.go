@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// appDataDir 返回应用数据目录，失败时退回到系统临时目录
+func appDataDir() string {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		log.Printf("[Store] 获取用户配置目录失败: %v", err)
+		base = os.TempDir()
+	}
+	return filepath.Join(base, AppName)
+}
+
+// BookStore 以 <id><ext> 的形式在本地保存书籍文件
+type BookStore struct {
+	dir string
+}
+
+func NewBookStore(dir string) *BookStore {
+	return &BookStore{dir: dir}
+}
+
+func validBookID(id string) bool {
+	return id != "" && id != "." && id != ".." && !strings.ContainsAny(id, `/\`)
+}
+
+func (s *BookStore) Dir() string {
+	return s.dir
+}
+
+// Path 返回书籍文件的本地路径
+func (s *BookStore) Path(id string) (string, error) {
+	if !validBookID(id) {
+		return "", fmt.Errorf("invalid book id: %q", id)
+	}
+	// 不用 filepath.Glob：id 中可能有 [ * ? 等通配符，没有扩展名的文件也匹配不到
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return "", err
+	}
+	match := ""
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		if name == id {
+			return filepath.Join(s.dir, name), nil
+		}
+		if match == "" && strings.TrimSuffix(name, filepath.Ext(name)) == id {
+			match = name
+		}
+	}
+	if match == "" {
+		return "", os.ErrNotExist
+	}
+	return filepath.Join(s.dir, match), nil
+}
+
+// Save 写入书籍文件，扩展名取自原始文件名
+func (s *BookStore) Save(id, fileName string, data []byte) (string, error) {
+	if !validBookID(id) {
+		return "", fmt.Errorf("invalid book id: %q", id)
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return "", err
+	}
+	if err := s.Remove(id); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	path := filepath.Join(s.dir, id+strings.ToLower(filepath.Ext(fileName)))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path, nil
+}
+
+// SaveFile 把已写好的文件移动为书籍文件，用于边下载边写入的大文件；src 应位于书库目录中
+func (s *BookStore) SaveFile(id, fileName, src string) (string, error) {
+	if !validBookID(id) {
+		return "", fmt.Errorf("invalid book id: %q", id)
+	}
+	if err := s.Remove(id); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	path := filepath.Join(s.dir, id+strings.ToLower(filepath.Ext(fileName)))
+	if err := os.Rename(src, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (s *BookStore) Remove(id string) error {
+	path, err := s.Path(id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// readJSONFile 读取 JSON 文件，文件不存在时返回 os.ErrNotExist
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSONFile 先写临时文件再重命名，避免写到一半时崩溃损坏数据
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// newID 生成随机的 32 位十六进制标识
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBookStorePath(t *testing.T) {
+	store := NewBookStore(filepath.Join(t.TempDir(), "books"))
+	if _, err := store.Path("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("path before any save: %v, want ErrNotExist", err)
+	}
+
+	// 没有扩展名的文件和包含通配符的 id 都能找到
+	for _, c := range []struct{ id, fileName string }{
+		{"plain", "README"},
+		{"[draft]1", "book.EPUB"},
+		{"abc", "abc.pdf"},
+	} {
+		saved, err := store.Save(c.id, c.fileName, []byte(c.id))
+		if err != nil {
+			t.Fatalf("save %s: %v", c.id, err)
+		}
+		got, err := store.Path(c.id)
+		if err != nil || got != saved {
+			t.Fatalf("path %s = %q, %v, want %q", c.id, got, err, saved)
+		}
+	}
+	if filepath.Ext(mustPath(t, store, "[draft]1")) != ".epub" {
+		t.Fatal("extension should be lower-cased")
+	}
+
+	// 重新保存时替换旧文件
+	if _, err := store.Save("abc", "abc.epub", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if p := mustPath(t, store, "abc"); filepath.Ext(p) != ".epub" {
+		t.Fatalf("path after resave = %s", p)
+	}
+	if err := store.Remove("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Path("abc"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("path after remove: %v, want ErrNotExist", err)
+	}
+}
+
+func mustPath(t *testing.T, store *BookStore, id string) string {
+	t.Helper()
+	p, err := store.Path(id)
+	if err != nil {
+		t.Fatalf("path %s: %v", id, err)
+	}
+	return p
+}
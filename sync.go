@@ -0,0 +1,512 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 所有设备共用的同步清单，替代以前每本书一个 progress_<id> 文件
+const syncManifestPath = "sync/manifest.json"
+
+const syncManifestVersion = 1
+
+type SyncManifest struct {
+	Version   int                         `json:"version"`
+	UpdatedAt int64                       `json:"updatedAt"`
+	DeviceID  string                      `json:"deviceId"`
+	Progress  map[string]*ReadingProgress `json:"progress"`
+
+	Books       map[string]*EbookMetadata   `json:"books,omitempty"`
+	Categories  map[string]*BookCategory    `json:"categories,omitempty"`
+	Devices     map[string]*DeviceRecord    `json:"devices,omitempty"`
+	Annotations map[string]*Annotation      `json:"annotations,omitempty"`
+	Bookmarks   map[string]*Bookmark        `json:"bookmarks,omitempty"`
+	Collections map[string]*SmartCollection `json:"collections,omitempty"`
+}
+
+type SyncStatus struct {
+	Running   bool   `json:"running"`
+	LastSync  int64  `json:"lastSync"`
+	LastError string `json:"lastError,omitempty"`
+	Changed   int    `json:"changed"`
+}
+
+// SyncEngine 按 UserConfig.storage.syncInterval 定时与云存储同步，
+// 不依赖前端页面是否打开
+type SyncEngine struct {
+	app *App
+	dir string
+
+	// etags 记录上次同步时远端文件的 ETag，未变化的文件不必重新下载；只在 runMu 内访问
+	etags map[string]string
+
+	runMu    sync.Mutex
+	statusMu sync.RWMutex
+	status   SyncStatus
+
+	reset chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func NewSyncEngine(app *App, dir string) *SyncEngine {
+	e := &SyncEngine{
+		app:   app,
+		dir:   dir,
+		etags: map[string]string{},
+		reset: make(chan struct{}, 1),
+	}
+	if err := readJSONFile(e.etagsPath(), &e.etags); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Sync] 读取 ETag 记录失败: %v", err)
+	}
+	return e
+}
+
+func (e *SyncEngine) etagsPath() string {
+	return filepath.Join(e.dir, "etags.json")
+}
+
+// manifestCachePath 是与 etags 中清单 ETag 对应的本地副本
+func (e *SyncEngine) manifestCachePath() string {
+	return filepath.Join(e.dir, "manifest-cache.json")
+}
+
+// rememberETag 记录远端文件的 ETag，存储不提供 ETag 时清除记录
+func (e *SyncEngine) rememberETag(rel, etag string) {
+	if etag == "" {
+		delete(e.etags, rel)
+		return
+	}
+	e.etags[rel] = etag
+}
+
+func (e *SyncEngine) Start() {
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	go e.loop()
+}
+
+func (e *SyncEngine) Stop() {
+	if e.stop == nil {
+		return
+	}
+	close(e.stop)
+	<-e.done
+	e.stop = nil
+}
+
+// ResetTimer 在同步间隔等配置变化后重新计时
+func (e *SyncEngine) ResetTimer() {
+	select {
+	case e.reset <- struct{}{}:
+	default:
+	}
+}
+
+func (e *SyncEngine) loop() {
+	defer close(e.done)
+
+	// 启动后稍等片刻先同步一次
+	timer := time.NewTimer(30 * time.Second)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-e.reset:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(e.app.settings.SyncInterval())
+			continue
+		case <-timer.C:
+		}
+
+		config := e.app.settings.Config()
+		if _, err := e.app.syncStorage(); config.Storage.AutoSync && err == nil {
+			if _, err := e.Run(); err != nil {
+				log.Printf("[Sync] 定时同步失败: %v", err)
+			}
+		}
+		timer.Reset(e.app.settings.SyncInterval())
+	}
+}
+
+func (e *SyncEngine) Status() SyncStatus {
+	e.statusMu.RLock()
+	defer e.statusMu.RUnlock()
+	return e.status
+}
+
+func (e *SyncEngine) setStatus(fn func(s *SyncStatus)) {
+	e.statusMu.Lock()
+	fn(&e.status)
+	status := e.status
+	e.statusMu.Unlock()
+	e.app.emit("sync:status", status)
+}
+
+// Run 执行一次完整同步：下载清单、合并到本地、必要时上传合并结果
+func (e *SyncEngine) Run() (SyncStatus, error) {
+	e.runMu.Lock()
+	defer e.runMu.Unlock()
+
+	e.setStatus(func(s *SyncStatus) { s.Running = true })
+	changed, err := e.run()
+	e.setStatus(func(s *SyncStatus) {
+		s.Running = false
+		s.Changed = changed
+		if err != nil {
+			s.LastError = err.Error()
+			return
+		}
+		s.LastError = ""
+		s.LastSync = time.Now().UnixMilli()
+	})
+	if err == nil {
+		e.app.settings.UpdateDevice(func(d *DeviceInfo) { d.LastSync = time.Now().UnixMilli() })
+	}
+	return e.Status(), err
+}
+
+// 上传清单时发现远端已被其他设备更新，重新合并的最多次数
+const maxSyncAttempts = 3
+
+func (e *SyncEngine) run() (int, error) {
+	storage, err := e.app.syncStorage()
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for attempt := 1; ; attempt++ {
+		changed, err := e.runOnce(storage)
+		total += changed
+		if errors.Is(err, errRemoteChanged) && attempt < maxSyncAttempts {
+			log.Printf("[Sync] 同步期间远端清单已被其他设备更新，重新合并")
+			continue
+		}
+		return total, err
+	}
+}
+
+// runOnce 下载清单并合并，只在远端仍是下载时的版本时上传合并结果，
+// 否则返回 errRemoteChanged，由调用方重新合并
+func (e *SyncEngine) runOnce(storage StorageProvider) (int, error) {
+	remote, remoteInfo, err := e.fetchManifest(storage)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := e.syncDevices(remote); err != nil {
+		return 0, err
+	}
+
+	changed, err := e.app.progress.Merge(remote.Progress)
+	if err != nil {
+		return len(changed), fmt.Errorf("merge progress: %w", err)
+	}
+	if len(changed) > 0 {
+		log.Printf("[Sync] 从远端合并了 %d 本书的进度", len(changed))
+		e.app.emit("sync:progress-updated", changed)
+	}
+
+	// 统计日志同步失败不影响清单同步
+	if err := e.syncStats(storage); err != nil {
+		log.Printf("[Sync] 同步阅读统计失败: %v", err)
+	}
+
+	if remote.Books == nil && remote.Categories == nil {
+		e.importLegacyLibrary(storage, remote)
+	}
+	libraryChanged, err := e.app.library.MergeRemote(LibraryState{Books: remote.Books, Categories: remote.Categories})
+	if err != nil {
+		return len(changed), fmt.Errorf("merge library: %w", err)
+	}
+	if libraryChanged {
+		log.Printf("[Sync] 书库已与远端合并")
+		e.app.emit("sync:library-updated")
+	}
+
+	annotationsChanged, err := e.app.annotations.Merge(remote.Annotations)
+	if err != nil {
+		return len(changed), fmt.Errorf("merge annotations: %w", err)
+	}
+	if annotationsChanged {
+		e.app.emit("sync:annotations-updated")
+	}
+
+	bookmarksChanged, err := e.app.bookmarks.Merge(remote.Bookmarks)
+	if err != nil {
+		return len(changed), fmt.Errorf("merge bookmarks: %w", err)
+	}
+	if bookmarksChanged {
+		e.app.emit("sync:bookmarks-updated")
+	}
+
+	collectionsChanged, err := e.app.collections.set.Merge(remote.Collections)
+	if err != nil {
+		return len(changed), fmt.Errorf("merge collections: %w", err)
+	}
+	if collectionsChanged {
+		e.app.collections.invalidate()
+	}
+
+	library := e.app.library.Snapshot()
+	local := &SyncManifest{
+		Version:     syncManifestVersion,
+		DeviceID:    e.app.settings.Device().ID,
+		Progress:    e.app.progress.Snapshot(),
+		Books:       library.Books,
+		Categories:  library.Categories,
+		Devices:     e.app.devices.Snapshot(),
+		Annotations: e.app.annotations.Snapshot(),
+		Bookmarks:   e.app.bookmarks.Snapshot(),
+		Collections: e.app.collections.set.Snapshot(),
+	}
+	if !manifestEqual(local, remote) {
+		local.UpdatedAt = time.Now().UnixMilli()
+		data, err := json.Marshal(local)
+		if err != nil {
+			return len(changed), err
+		}
+		if err := writeRemoteFileIfUnchanged(storage, syncManifestPath, data, remoteInfo); err != nil {
+			if errors.Is(err, errRemoteChanged) {
+				return len(changed), err
+			}
+			return len(changed), fmt.Errorf("upload manifest: %w", err)
+		}
+		e.cacheManifest(storage, data)
+		log.Printf("[Sync] 同步清单已上传，共 %d 条进度，%d 本书", len(local.Progress), len(local.Books))
+	}
+
+	// 远端现在就是 local 这份快照，把它记为下次三方合并的基线。
+	// 不能用提交时的本地状态：上传期间新增的条目不在远端，下次会被当作远端删除
+	if err := e.app.library.CommitBase(LibraryState{Books: local.Books, Categories: local.Categories}); err != nil {
+		log.Printf("[Sync] 保存同步基线失败: %v", err)
+	}
+	if err := e.app.devices.CommitBase(local.Devices); err != nil {
+		log.Printf("[Sync] 保存设备同步基线失败: %v", err)
+	}
+	if err := e.app.annotations.CommitBase(local.Annotations); err != nil {
+		log.Printf("[Sync] 保存标注同步基线失败: %v", err)
+	}
+	if err := e.app.bookmarks.CommitBase(local.Bookmarks); err != nil {
+		log.Printf("[Sync] 保存书签同步基线失败: %v", err)
+	}
+	if err := e.app.collections.set.CommitBase(local.Collections); err != nil {
+		log.Printf("[Sync] 保存书单同步基线失败: %v", err)
+	}
+	return len(changed), nil
+}
+
+// syncDevices 登记本机并合并远端的设备列表；本机被吊销时停止同步
+func (e *SyncEngine) syncDevices(remote *SyncManifest) error {
+	device := e.app.settings.Device()
+	if err := e.app.devices.Touch(device, time.Now().UnixMilli()); err != nil {
+		return fmt.Errorf("register device: %w", err)
+	}
+
+	changed, err := e.app.devices.MergeRemote(remote.Devices)
+	if err != nil {
+		return fmt.Errorf("merge devices: %w", err)
+	}
+	if changed {
+		e.app.emit("sync:devices-updated")
+	}
+
+	self, _ := e.app.devices.Get(device.ID)
+	if self.Revoked {
+		// 记下基线，其他设备恢复本机后，下次同步能正常合并远端清除的吊销标记
+		e.app.devices.CommitBase(remote.Devices)
+		e.app.emit("sync:device-revoked", device.ID)
+		return errDeviceRevoked
+	}
+	if self.Name != "" && self.Name != device.Name {
+		// 其他设备修改了本机名称
+		e.app.settings.UpdateDevice(func(d *DeviceInfo) { d.Name = self.Name })
+	}
+	return nil
+}
+
+// importLegacyLibrary 读取旧版本上传的 books.json 和 categories.json，
+// 让尚未升级的设备上的书库也能参与合并
+func (e *SyncEngine) importLegacyLibrary(storage StorageProvider, remote *SyncManifest) {
+	var legacyBooks struct {
+		Ebooks    []EbookMetadata `json:"ebooks"`
+		Timestamp int64           `json:"timestamp"`
+	}
+	if data, err := readRemoteFile(storage, "sync/books.json"); err == nil && json.Unmarshal(data, &legacyBooks) == nil {
+		remote.Books = map[string]*EbookMetadata{}
+		for i := range legacyBooks.Ebooks {
+			b := legacyBooks.Ebooks[i]
+			if b.UpdatedAt == 0 {
+				b.UpdatedAt = legacyBooks.Timestamp
+			}
+			remote.Books[b.ID] = &b
+		}
+		log.Printf("[Sync] 导入旧版书籍列表，共 %d 本", len(remote.Books))
+	}
+
+	var legacyCategories struct {
+		Categories []BookCategory `json:"categories"`
+	}
+	if data, err := readRemoteFile(storage, "sync/categories.json"); err == nil && json.Unmarshal(data, &legacyCategories) == nil {
+		remote.Categories = map[string]*BookCategory{}
+		for i := range legacyCategories.Categories {
+			c := legacyCategories.Categories[i]
+			remote.Categories[c.ID] = &c
+		}
+		log.Printf("[Sync] 导入旧版分类列表，共 %d 个", len(remote.Categories))
+	}
+}
+
+// fetchManifest 下载远端清单，同时返回下载时的文件信息，远端还没有清单时为 nil；
+// ETag 与上次同步时相同则直接使用本地副本
+func (e *SyncEngine) fetchManifest(storage StorageProvider) (*SyncManifest, *RemoteFile, error) {
+	manifest := &SyncManifest{Progress: map[string]*ReadingProgress{}}
+
+	info, err := storage.Stat(syncManifestPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("stat manifest: %w", err)
+	}
+	var data []byte
+	if info.ETag != "" && info.ETag == e.etags[syncManifestPath] {
+		data, _ = os.ReadFile(e.manifestCachePath())
+	}
+	if data == nil {
+		data, err = readRemoteFile(storage, syncManifestPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return manifest, nil, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("download manifest: %w", err)
+		}
+		e.saveManifestCache(data, info.ETag)
+	}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	if manifest.Version > syncManifestVersion {
+		return nil, nil, fmt.Errorf("manifest version %d is newer than supported %d", manifest.Version, syncManifestVersion)
+	}
+	if manifest.Progress == nil {
+		manifest.Progress = map[string]*ReadingProgress{}
+	}
+	return manifest, &info, nil
+}
+
+// cacheManifest 在上传清单后记录其 ETag，下次同步时远端未变化就不必下载
+func (e *SyncEngine) cacheManifest(storage StorageProvider, data []byte) {
+	info, err := storage.Stat(syncManifestPath)
+	if err != nil {
+		info.ETag = ""
+	}
+	e.saveManifestCache(data, info.ETag)
+}
+
+func (e *SyncEngine) saveManifestCache(data []byte, etag string) {
+	if etag != "" {
+		if err := os.MkdirAll(e.dir, 0o755); err == nil {
+			if err := os.WriteFile(e.manifestCachePath(), data, 0o644); err != nil {
+				etag = ""
+			}
+		}
+	}
+	e.rememberETag(syncManifestPath, etag)
+	if err := writeJSONFile(e.etagsPath(), e.etags); err != nil {
+		log.Printf("[Sync] 保存 ETag 记录失败: %v", err)
+	}
+}
+
+// manifestEqual 比较两份清单的内容，忽略更新时间和写入设备
+func manifestEqual(a, b *SyncManifest) bool {
+	ca, cb := *a, *b
+	ca.UpdatedAt, cb.UpdatedAt = 0, 0
+	ca.DeviceID, cb.DeviceID = "", ""
+	da, _ := json.Marshal(ca)
+	db, _ := json.Marshal(cb)
+	return string(da) == string(db)
+}
+
+func (a *App) SetUserConfig(config UserConfig) string {
+	old := a.settings.Config()
+	if err := a.settings.SetConfig(config); err != nil {
+		log.Printf("[Config] 保存用户配置失败: %v", err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if old.Storage.SyncInterval != config.Storage.SyncInterval || old.Storage.AutoSync != config.Storage.AutoSync {
+		a.sync.ResetTimer()
+	}
+	return `{"success": true}`
+}
+
+// GetUserConfig 返回后端保存的配置，包含后端刷新后的百度网盘令牌
+func (a *App) GetUserConfig() UserConfig {
+	return a.settings.Config()
+}
+
+func (a *App) GetDeviceInfo() DeviceInfo {
+	return a.settings.Device()
+}
+
+// SaveReadingProgress 记录本机的阅读进度；explicit 为 true 表示用户主动跳回，
+// 允许这条记录在其他设备上覆盖更靠后的进度
+func (a *App) SaveReadingProgress(progress ReadingProgress, explicit bool) string {
+	if progress.EbookID == "" {
+		return `{"error": "ebookId is required"}`
+	}
+	device := a.settings.Device()
+	progress.DeviceID = device.ID
+	progress.DeviceName = device.Name
+	progress.Explicit = explicit
+	if progress.Timestamp == 0 {
+		progress.Timestamp = time.Now().UnixMilli()
+	}
+
+	if err := a.progress.Record(progress); err != nil {
+		log.Printf("[Progress] 保存进度失败: %s, %v", progress.EbookID, err)
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if err := a.devices.RecordSession(device, progress); err != nil {
+		log.Printf("[Devices] 记录阅读会话失败: %s, %v", progress.EbookID, err)
+	}
+	book, _ := a.library.Book(progress.EbookID)
+	if err := a.stats.Track(progress, book.Format); err != nil {
+		log.Printf("[Stats] 记录阅读统计失败: %s, %v", progress.EbookID, err)
+	}
+	return `{"success": true}`
+}
+
+func (a *App) GetReadingProgress(ebookId string) *ReadingProgress {
+	return a.progress.Get(ebookId)
+}
+
+func (a *App) GetAllReadingProgress() map[string]*ReadingProgress {
+	return a.progress.Snapshot()
+}
+
+func (a *App) SyncNow() SyncStatus {
+	status, err := a.sync.Run()
+	if err != nil {
+		log.Printf("[Sync] 同步失败: %v", err)
+	}
+	return status
+}
+
+func (a *App) GetSyncStatus() SyncStatus {
+	return a.sync.Status()
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
 	"github.com/wailsapp/wails/v2/pkg/options/assetserver"
+	"github.com/wailsapp/wails/v2/pkg/options/mac"
 	"github.com/wailsapp/wails/v2/pkg/options/windows"
 )
 
@@ -27,7 +28,8 @@ func main() {
 		MinWidth:  1024,
 		MinHeight: 768,
 		AssetServer: &assetserver.Options{
-			Assets: assets,
+			Assets:  assets,
+			Handler: NewBookAssetHandler(app.store),
 		},
 		BackgroundColour: &options.RGBA{R: 245, G: 247, B: 250, A: 1},
 		OnStartup:        app.startup,
@@ -35,6 +37,14 @@ func main() {
 		Bind: []interface{}{
 			app,
 		},
+		// 通过 neatreader:// 链接启动时把链接转交给已运行的实例
+		SingleInstanceLock: &options.SingleInstanceLock{
+			UniqueId:               "com.neat-reader.desktop",
+			OnSecondInstanceLaunch: app.onSecondInstanceLaunch,
+		},
+		Mac: &mac.Options{
+			OnUrlOpen: app.onURLOpen,
+		},
 		Windows: &windows.Options{
 			WebviewIsTransparent: false,
 			WindowIsTranslucent:  false,
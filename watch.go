@@ -0,0 +1,557 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// 文件变化后等待一段时间再扫描，合并复制大文件时的连续事件
+const watchDebounce = 2 * time.Second
+
+// WatchedFolder 是用户选择自动导入的目录
+type WatchedFolder struct {
+	ID      string `json:"id"`
+	Path    string `json:"path"`
+	AddedAt int64  `json:"addedAt"`
+}
+
+// watchedFile 记录监视目录中已导入的文件，按内容哈希识别重命名和移动
+type watchedFile struct {
+	BookID  string `json:"bookId"`
+	Hash    string `json:"hash"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+	Missing bool   `json:"missing,omitempty"`
+}
+
+type watchState struct {
+	Folders []WatchedFolder         `json:"folders"`
+	Files   map[string]*watchedFile `json:"files"`
+}
+
+// WatchScanResult 是一次扫描的统计
+type WatchScanResult struct {
+	Imported int `json:"imported"`
+	Updated  int `json:"updated"`
+	Moved    int `json:"moved"`
+	Missing  int `json:"missing"`
+}
+
+func (r WatchScanResult) changed() bool {
+	return r.Imported+r.Updated+r.Moved+r.Missing > 0
+}
+
+// FolderWatcher 扫描监视目录导入新书，并通过 fsnotify 持续监听变化
+type FolderWatcher struct {
+	app  *App
+	path string
+
+	mu    sync.Mutex
+	state watchState
+
+	scanMu  sync.Mutex
+	watcher *fsnotify.Watcher
+	timer   *time.Timer
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewFolderWatcher(app *App, path string) *FolderWatcher {
+	w := &FolderWatcher{
+		app:   app,
+		path:  path,
+		state: watchState{Files: map[string]*watchedFile{}},
+	}
+	if err := readJSONFile(path, &w.state); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Watch] 读取监视目录失败: %v", err)
+	}
+	if w.state.Files == nil {
+		w.state.Files = map[string]*watchedFile{}
+	}
+	return w
+}
+
+func (w *FolderWatcher) saveLocked() error {
+	return writeJSONFile(w.path, w.state)
+}
+
+func (w *FolderWatcher) Folders() []WatchedFolder {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]WatchedFolder{}, w.state.Folders...)
+}
+
+// Start 先扫描一次，再开始监听文件变化
+func (w *FolderWatcher) Start() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("[Watch] 创建文件监听失败: %v", err)
+		return
+	}
+	w.watcher = watcher
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	for _, folder := range w.Folders() {
+		w.watchTree(folder.Path)
+	}
+	go w.loop()
+	w.schedule(0)
+}
+
+func (w *FolderWatcher) Stop() {
+	if w.watcher == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.watcher.Close()
+}
+
+func (w *FolderWatcher) loop() {
+	defer close(w.done)
+	for {
+		select {
+		case <-w.stop:
+			w.mu.Lock()
+			if w.timer != nil {
+				w.timer.Stop()
+			}
+			w.mu.Unlock()
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			// fsnotify 不递归监听，新建的子目录需要手动加入
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					w.watchTree(event.Name)
+				}
+			}
+			w.schedule(watchDebounce)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("[Watch] 文件监听出错: %v", err)
+		}
+	}
+}
+
+// schedule 在 delay 后扫描，期间的新事件会推迟扫描
+func (w *FolderWatcher) schedule(delay time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(delay, func() {
+		if _, err := w.Scan(); err != nil {
+			log.Printf("[Watch] 扫描监视目录失败: %v", err)
+		}
+	})
+}
+
+// watchTree 监听目录及其所有子目录
+func (w *FolderWatcher) watchTree(root string) {
+	if w.watcher == nil {
+		return
+	}
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if p != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if err := w.watcher.Add(p); err != nil {
+			log.Printf("[Watch] 监听目录失败: %s, %v", p, err)
+		}
+		return nil
+	})
+}
+
+func (w *FolderWatcher) unwatchTree(root string) {
+	if w.watcher == nil {
+		return
+	}
+	for _, p := range w.watcher.WatchList() {
+		if inFolder(root, p) {
+			w.watcher.Remove(p)
+		}
+	}
+}
+
+func inFolder(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (w *FolderWatcher) Add(dir string) (WatchedFolder, error) {
+	dir = filepath.Clean(dir)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return WatchedFolder{}, err
+	}
+	if !info.IsDir() {
+		return WatchedFolder{}, fmt.Errorf("not a directory: %s", dir)
+	}
+
+	w.mu.Lock()
+	for _, f := range w.state.Folders {
+		if inFolder(f.Path, dir) || inFolder(dir, f.Path) {
+			w.mu.Unlock()
+			return WatchedFolder{}, fmt.Errorf("overlaps watched folder: %s", f.Path)
+		}
+	}
+	folder := WatchedFolder{ID: newID(), Path: dir, AddedAt: time.Now().UnixMilli()}
+	w.state.Folders = append(w.state.Folders, folder)
+	err = w.saveLocked()
+	w.mu.Unlock()
+	if err != nil {
+		return WatchedFolder{}, err
+	}
+
+	w.watchTree(dir)
+	w.schedule(0)
+	return folder, nil
+}
+
+// Remove 停止监视目录，已导入的书籍保留在书库中
+func (w *FolderWatcher) Remove(id string) error {
+	w.scanMu.Lock()
+	defer w.scanMu.Unlock()
+	w.mu.Lock()
+	var removed *WatchedFolder
+	folders := w.state.Folders[:0]
+	for _, f := range w.state.Folders {
+		if f.ID == id {
+			f := f
+			removed = &f
+			continue
+		}
+		folders = append(folders, f)
+	}
+	w.state.Folders = folders
+	if removed == nil {
+		w.mu.Unlock()
+		return os.ErrNotExist
+	}
+	for p := range w.state.Files {
+		if inFolder(removed.Path, p) {
+			delete(w.state.Files, p)
+		}
+	}
+	err := w.saveLocked()
+	w.mu.Unlock()
+
+	w.unwatchTree(removed.Path)
+	return err
+}
+
+// watchCandidate 是扫描时发现的新文件或内容变化的文件
+type watchCandidate struct {
+	path    string
+	hash    string
+	size    int64
+	modTime int64
+}
+
+// Scan 扫描所有监视目录：导入新文件，按内容哈希识别移动，找不到的文件标记为缺失
+func (w *FolderWatcher) Scan() (WatchScanResult, error) {
+	w.scanMu.Lock()
+	defer w.scanMu.Unlock()
+
+	folders := w.Folders()
+	w.mu.Lock()
+	known := make(map[string]watchedFile, len(w.state.Files))
+	for p, f := range w.state.Files {
+		known[p] = *f
+	}
+	w.mu.Unlock()
+
+	var result WatchScanResult
+	seen := map[string]bool{}
+	var candidates []watchCandidate
+	for _, folder := range folders {
+		err := filepath.WalkDir(folder.Path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				log.Printf("[Watch] 读取失败: %s, %v", p, err)
+				return nil
+			}
+			if strings.HasPrefix(d.Name(), ".") && p != folder.Path {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || !watchableFormat(p) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			seen[p] = true
+			f, ok := known[p]
+			if ok && !f.Missing && f.Size == info.Size() && f.ModTime == info.ModTime().UnixMilli() {
+				return nil
+			}
+			hash, err := hashFile(p)
+			if err != nil {
+				log.Printf("[Watch] 计算哈希失败: %s, %v", p, err)
+				return nil
+			}
+			candidates = append(candidates, watchCandidate{p, hash, info.Size(), info.ModTime().UnixMilli()})
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// 消失的文件按哈希索引，用于匹配移动到新位置的文件
+	gone := map[string]string{}
+	for p, f := range known {
+		if !seen[p] && (!f.Missing || gone[f.Hash] == "") {
+			gone[f.Hash] = p
+		}
+	}
+
+	for _, c := range candidates {
+		entry, ok := known[c.path]
+		switch {
+		case ok && entry.Hash == c.hash:
+			// 内容未变，只是修改时间变化或文件重新出现
+			if entry.Missing {
+				w.setBookMissing(entry.BookID, false)
+				result.Moved++
+			}
+		case ok && !entry.Missing:
+			updated, err := w.updateBook(entry.BookID, c.path)
+			if err != nil {
+				log.Printf("[Watch] 更新书籍失败: %s, %v", c.path, err)
+				continue
+			}
+			if updated {
+				result.Updated++
+			}
+		case gone[c.hash] != "":
+			from := gone[c.hash]
+			delete(gone, c.hash)
+			entry = known[from]
+			w.forget(from)
+			delete(known, from)
+			if err := w.moveBook(entry.BookID, c.path); err != nil {
+				log.Printf("[Watch] 更新书籍位置失败: %s, %v", c.path, err)
+			}
+			log.Printf("[Watch] 文件已移动: %s -> %s", from, c.path)
+			result.Moved++
+		default:
+			if bookID := w.bookWithHash(known, c.hash); bookID != "" {
+				// 同一本书的另一份副本，不重复导入
+				entry.BookID = bookID
+				break
+			}
+			book, err := w.importFile(c.path)
+			if err != nil {
+				log.Printf("[Watch] 导入失败: %s, %v", c.path, err)
+				continue
+			}
+			entry.BookID = book.ID
+			log.Printf("[Watch] 已导入: %s -> %s", c.path, book.ID)
+			result.Imported++
+		}
+		entry.Hash, entry.Size, entry.ModTime, entry.Missing = c.hash, c.size, c.modTime, false
+		known[c.path] = entry
+		w.remember(c.path, entry)
+	}
+
+	// 仍未匹配的消失文件标记为缺失，同一本书还有其他副本时不标记
+	for p, f := range known {
+		if seen[p] || f.Missing {
+			continue
+		}
+		f.Missing = true
+		known[p] = f
+		w.remember(p, f)
+		if w.bookWithHash(known, f.Hash) == "" {
+			w.setBookMissing(f.BookID, true)
+			log.Printf("[Watch] 文件已缺失: %s", p)
+			result.Missing++
+		}
+	}
+
+	w.mu.Lock()
+	err := w.saveLocked()
+	w.mu.Unlock()
+	if err != nil {
+		return result, err
+	}
+	if result.changed() {
+		log.Printf("[Watch] 扫描完成: 导入 %d，更新 %d，移动 %d，缺失 %d", result.Imported, result.Updated, result.Moved, result.Missing)
+		w.app.emit("library:changed", result)
+	}
+	return result, nil
+}
+
+func (w *FolderWatcher) remember(p string, f watchedFile) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state.Files[p] = &f
+}
+
+func (w *FolderWatcher) forget(p string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.state.Files, p)
+}
+
+// bookWithHash 返回仍存在的同内容文件对应的书
+func (w *FolderWatcher) bookWithHash(known map[string]watchedFile, hash string) string {
+	for _, f := range known {
+		if f.Hash == hash && !f.Missing {
+			return f.BookID
+		}
+	}
+	return ""
+}
+
+func watchableFormat(p string) bool {
+	_, ok := formatMimeTypes[strings.TrimPrefix(strings.ToLower(filepath.Ext(p)), ".")]
+	return ok
+}
+
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// importFile 把文件复制到书库并添加书籍
+func (w *FolderWatcher) importFile(p string) (EbookMetadata, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return EbookMetadata{}, err
+	}
+	fileName := filepath.Base(p)
+	id := newID()
+	if data, _, err = w.app.checkBookFile(id, fileName, data); err != nil {
+		return EbookMetadata{}, err
+	}
+	book := EbookMetadata{
+		ID:          id,
+		Title:       strings.TrimSuffix(fileName, filepath.Ext(fileName)),
+		Author:      "未知作者",
+		Format:      strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), "."),
+		Size:        int64(len(data)),
+		StorageType: "local",
+		SourcePath:  p,
+		AddedAt:     time.Now().UnixMilli(),
+	}
+	book.Path = book.ID
+	if _, err := w.app.store.Save(book.ID, fileName, data); err != nil {
+		return EbookMetadata{}, err
+	}
+	if err := w.app.library.PutBook(book); err != nil {
+		w.app.store.Remove(book.ID)
+		return EbookMetadata{}, err
+	}
+	w.app.emit("library:book-added", book)
+	return book, nil
+}
+
+// updateBook 用变化后的文件替换书库中的副本，书已被用户删除时返回 false
+func (w *FolderWatcher) updateBook(bookID, p string) (bool, error) {
+	book, ok := w.app.library.Book(bookID)
+	if !ok {
+		return false, nil
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return false, err
+	}
+	if data, _, err = w.app.checkBookFile(book.ID, filepath.Base(p), data); err != nil {
+		return false, err
+	}
+	if _, err := w.app.store.Save(book.ID, filepath.Base(p), data); err != nil {
+		return false, err
+	}
+	book.Size = int64(len(data))
+	book.Missing = false
+	if err := w.app.library.PutBook(book); err != nil {
+		return false, err
+	}
+	// 前端缓存的旧文件需要重新读取
+	w.app.emit("library:book-file-changed", book.ID)
+	return true, nil
+}
+
+func (w *FolderWatcher) moveBook(bookID, p string) error {
+	book, ok := w.app.library.Book(bookID)
+	if !ok {
+		return nil
+	}
+	book.SourcePath = p
+	book.Missing = false
+	return w.app.library.PutBook(book)
+}
+
+// setBookMissing 更新缺失标记，书已被用户删除时忽略
+func (w *FolderWatcher) setBookMissing(bookID string, missing bool) {
+	book, ok := w.app.library.Book(bookID)
+	if !ok || book.Missing == missing {
+		return
+	}
+	book.Missing = missing
+	if err := w.app.library.PutBook(book); err != nil {
+		log.Printf("[Watch] 更新书籍失败: %s, %v", bookID, err)
+	}
+}
+
+func (a *App) GetWatchedFolders() []WatchedFolder {
+	return a.watcher.Folders()
+}
+
+// AddWatchedFolder 添加监视目录并在后台扫描
+func (a *App) AddWatchedFolder(path string) string {
+	folder, err := a.watcher.Add(path)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(folder)
+}
+
+func (a *App) RemoveWatchedFolder(id string) string {
+	if err := a.watcher.Remove(id); err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return `{"success": true}`
+}
+
+// RescanWatchedFolders 立即扫描所有监视目录
+func (a *App) RescanWatchedFolders() string {
+	result, err := a.watcher.Scan()
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	return jsonResult(result)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFolderWatcherScanCountsRealUpdates(t *testing.T) {
+	app := newTestApp(t)
+	dir := t.TempDir()
+	w := NewFolderWatcher(app, filepath.Join(t.TempDir(), "watch.json"))
+	w.state.Folders = []WatchedFolder{{ID: "books", Path: dir}}
+
+	p := filepath.Join(dir, "三体.txt")
+	if err := os.WriteFile(p, []byte("第一章"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := w.Scan()
+	if err != nil || result.Imported != 1 {
+		t.Fatalf("first scan = %+v, %v", result, err)
+	}
+	books := app.library.Books()
+	if len(books) != 1 {
+		t.Fatalf("library = %+v", books)
+	}
+
+	// 文件内容变化时更新书库中的副本
+	writeChanged := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(p, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeChanged("第一章\n第二章")
+	if result, err = w.Scan(); err != nil || result.Updated != 1 {
+		t.Fatalf("scan after edit = %+v, %v", result, err)
+	}
+
+	// 书已从书库删除时不计为更新
+	if err := app.library.DeleteBook(books[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	writeChanged("第一章\n第二章\n第三章")
+	if result, err = w.Scan(); err != nil || result != (WatchScanResult{}) {
+		t.Fatalf("scan after delete = %+v, %v", result, err)
+	}
+}
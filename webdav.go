@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebDAVConfig 对应前端 UserConfig.storage.webdav
+type WebDAVConfig struct {
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	RootPath string `json:"rootPath"`
+	// NamingStrategy 与百度网盘相同：0 不重命名（已存在时失败）, 1 重命名, 2 条件重命名, 3 覆盖
+	NamingStrategy string `json:"namingStrategy"`
+}
+
+// WebDAVClient 访问 Nextcloud、坚果云、群晖等 WebDAV 服务，所有路径都相对于 RootPath
+type WebDAVClient struct {
+	base     *url.URL
+	root     string
+	username string
+	password string
+	http     *http.Client
+}
+
+func init() {
+	RegisterStorage("webdav", func(a *App, config StorageConfig) (StorageProvider, error) {
+		if config.WebDAV == nil || config.WebDAV.URL == "" {
+			return nil, fmt.Errorf("webdav: %w", errStorageNotConfigured)
+		}
+		return NewWebDAVClient(*config.WebDAV)
+	})
+}
+
+func NewWebDAVClient(config WebDAVConfig) (*WebDAVClient, error) {
+	base, err := url.Parse(strings.TrimRight(config.URL, "/") + "/")
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("invalid webdav url: %q", config.URL)
+	}
+	root := config.RootPath
+	if root == "" {
+		root = AppName
+	}
+	return &WebDAVClient{
+		base:     base,
+		root:     strings.Trim(root, "/"),
+		username: config.Username,
+		password: config.Password,
+		http:     &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+func (c *WebDAVClient) Name() string {
+	return "webdav"
+}
+
+// fullPath 把相对路径拼到根目录下
+func (c *WebDAVClient) fullPath(relativePath string) string {
+	clean := cleanRemotePath(relativePath)
+	if c.root == "" {
+		return clean
+	}
+	if clean == "" {
+		return c.root
+	}
+	return c.root + "/" + clean
+}
+
+func (c *WebDAVClient) url(relativePath string, dir bool) string {
+	return c.fullURL(c.fullPath(relativePath), dir)
+}
+
+// fullURL 逐段转义服务器上的完整路径，目录以 / 结尾
+func (c *WebDAVClient) fullURL(full string, dir bool) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSuffix(c.base.EscapedPath(), "/"))
+	for _, segment := range strings.Split(full, "/") {
+		if segment != "" {
+			b.WriteString("/")
+			b.WriteString(url.PathEscape(segment))
+		}
+	}
+	if dir {
+		b.WriteString("/")
+	}
+	u := *c.base
+	u.RawPath = b.String()
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	return u.String()
+}
+
+func (c *WebDAVClient) do(method, rawURL string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return c.http.Do(req)
+}
+
+// webdavError 把 HTTP 状态转为错误，404 对应 os.ErrNotExist，412 对应 os.ErrExist
+func webdavError(method, p string, resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("%s %s: %w", method, p, os.ErrNotExist)
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("%s %s: %w", method, p, os.ErrExist)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%s %s: permission denied (HTTP %d)", method, p, resp.StatusCode)
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s %s: HTTP %d %s", method, p, resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+type davMultistatus struct {
+	Responses []struct {
+		Href  string `xml:"DAV: href"`
+		Props []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ContentLength string `xml:"DAV: getcontentlength"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+				ETag          string `xml:"DAV: getetag"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+const davQuotaBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:quota-available-bytes/><d:quota-used-bytes/></d:prop></d:propfind>`
+
+const davPropfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/><d:getlastmodified/><d:getetag/></d:prop></d:propfind>`
+
+// propfind 执行 PROPFIND，depth 为 0 时只返回自身
+func (c *WebDAVClient) propfind(relativePath string, depth int) ([]RemoteFile, error) {
+	resp, err := c.do("PROPFIND", c.url(relativePath, depth > 0), strings.NewReader(davPropfindBody), map[string]string{
+		"Depth":        strconv.Itoa(depth),
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus && resp.StatusCode != http.StatusOK {
+		return nil, webdavError("PROPFIND", relativePath, resp)
+	}
+
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("parse propfind response: %w", err)
+	}
+
+	rootPath := strings.TrimSuffix(c.base.Path, "/") + "/" + c.root
+	files := make([]RemoteFile, 0, len(ms.Responses))
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		full := strings.TrimSuffix(href.Path, "/")
+		rel := strings.Trim(strings.TrimPrefix(full, strings.TrimSuffix(rootPath, "/")), "/")
+		f := RemoteFile{Path: rel, Name: path.Base("/" + rel)}
+		for _, ps := range r.Props {
+			if ps.Status != "" && !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			p := ps.Prop
+			if p.ResourceType.Collection != nil {
+				f.IsDir = true
+			}
+			if n, err := strconv.ParseInt(p.ContentLength, 10, 64); err == nil {
+				f.Size = n
+			}
+			if t, err := http.ParseTime(p.LastModified); err == nil {
+				f.Modified = t.UnixMilli()
+			}
+			if p.ETag != "" {
+				f.ETag = strings.Trim(p.ETag, `"`)
+			}
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// List 列出目录内容，不包括目录自身
+func (c *WebDAVClient) List(dir string) ([]RemoteFile, error) {
+	files, err := c.propfind(dir, 1)
+	if err != nil {
+		return nil, err
+	}
+	self := strings.Trim(path.Clean("/"+dir), "/")
+	list := files[:0]
+	for _, f := range files {
+		if f.Path != self {
+			list = append(list, f)
+		}
+	}
+	return list, nil
+}
+
+func (c *WebDAVClient) Stat(p string) (RemoteFile, error) {
+	files, err := c.propfind(p, 0)
+	if err != nil {
+		return RemoteFile{}, err
+	}
+	if len(files) == 0 {
+		return RemoteFile{}, fmt.Errorf("stat %s: %w", p, os.ErrNotExist)
+	}
+	return files[0], nil
+}
+
+func (c *WebDAVClient) Open(p string, offset, length int64) (io.ReadCloser, error) {
+	headers := map[string]string{}
+	if rangeHeader := byteRange(offset, length); rangeHeader != "" {
+		headers["Range"] = rangeHeader
+	}
+	resp, err := c.do("GET", c.url(p, false), nil, headers)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		defer resp.Body.Close()
+		return nil, webdavError("GET", p, resp)
+	}
+	return rangeBody(resp, offset, length)
+}
+
+// Mkdir 逐级创建目录（包括根目录），已存在时不报错
+func (c *WebDAVClient) Mkdir(dir string) error {
+	full := ""
+	for _, segment := range strings.Split(c.fullPath(dir), "/") {
+		if segment == "" {
+			continue
+		}
+		full = strings.TrimPrefix(full+"/"+segment, "/")
+		resp, err := c.do("MKCOL", c.fullURL(full, true), nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		// 405 表示目录已存在
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusMethodNotAllowed {
+			return webdavError("MKCOL", full, resp)
+		}
+	}
+	return nil
+}
+
+func (c *WebDAVClient) Put(p string, r io.ReadSeeker, policy UploadPolicy, progress ProgressFunc) (string, error) {
+	target := p
+	switch policy {
+	case UploadRename:
+		var err error
+		if target, err = freeRemoteName(c.Stat, p); err != nil {
+			return "", err
+		}
+	case UploadFail:
+		// 部分服务器不支持 If-None-Match，先检查一次
+		if _, err := c.Stat(p); err == nil {
+			return "", fmt.Errorf("webdav PUT %s: %w", p, os.ErrExist)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	size, err := seekerSize(r)
+	if err != nil {
+		return "", err
+	}
+	start, _ := r.Seek(0, io.SeekCurrent)
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("PUT", c.url(target, false), newProgressReader(r, size, progress))
+		if err != nil {
+			return "", err
+		}
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		if policy != UploadOverwrite {
+			req.Header.Set("If-None-Match", "*")
+		}
+		if c.username != "" {
+			req.SetBasicAuth(c.username, c.password)
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return target, nil
+		case resp.StatusCode == http.StatusConflict && attempt == 0:
+			// 父目录不存在，创建后重新上传
+			if err := c.Mkdir(path.Dir("/" + target)); err != nil {
+				return "", err
+			}
+			if _, err := r.Seek(start, io.SeekStart); err != nil {
+				return "", err
+			}
+			continue
+		}
+		return "", webdavError("PUT", target, resp)
+	}
+}
+
+// PutIfMatch 用 If-Match / If-None-Match 条件写入小文件，远端已变化时返回 errRemoteChanged
+func (c *WebDAVClient) PutIfMatch(p string, data []byte, etag string) error {
+	condition, value := "If-None-Match", "*"
+	if etag != "" {
+		condition, value = "If-Match", `"`+etag+`"`
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := c.do("PUT", c.url(p, false), bytes.NewReader(data), map[string]string{
+			"Content-Type": "application/octet-stream",
+			condition:      value,
+		})
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return nil
+		case resp.StatusCode == http.StatusPreconditionFailed:
+			return fmt.Errorf("webdav PUT %s: %w", p, errRemoteChanged)
+		case resp.StatusCode == http.StatusConflict && attempt == 0:
+			if err := c.Mkdir(path.Dir("/" + p)); err != nil {
+				return err
+			}
+			continue
+		}
+		return webdavError("PUT", p, resp)
+	}
+}
+
+// Move 移动或重命名，overwrite 为 false 时目标已存在会返回 os.ErrExist
+func (c *WebDAVClient) Move(from, to string, overwrite bool) error {
+	flag := "F"
+	if overwrite {
+		flag = "T"
+	}
+	// 目标父目录不存在时各服务器返回 409 或 403，先创建
+	if err := c.Mkdir(path.Dir("/" + to)); err != nil {
+		return err
+	}
+	resp, err := c.do("MOVE", c.url(from, false), nil, map[string]string{
+		"Destination": c.url(to, false),
+		"Overwrite":   flag,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusCreated || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return webdavError("MOVE", from, resp)
+}
+
+func (c *WebDAVClient) Delete(p string) error {
+	resp, err := c.do("DELETE", c.url(p, false), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 || resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return webdavError("DELETE", p, resp)
+}
+
+// Quota 使用 RFC 4331 的 quota-available-bytes/quota-used-bytes，服务器不支持时返回 0
+func (c *WebDAVClient) Quota() (StorageQuota, error) {
+	resp, err := c.do("PROPFIND", c.url("", true), strings.NewReader(davQuotaBody), map[string]string{
+		"Depth":        "0",
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if err != nil {
+		return StorageQuota{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus && resp.StatusCode != http.StatusOK {
+		return StorageQuota{}, webdavError("PROPFIND", "", resp)
+	}
+	var ms struct {
+		Props []struct {
+			Available string `xml:"DAV: quota-available-bytes"`
+			Used      string `xml:"DAV: quota-used-bytes"`
+		} `xml:"DAV: response>propstat>prop"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return StorageQuota{}, fmt.Errorf("parse quota response: %w", err)
+	}
+	var quota StorageQuota
+	for _, p := range ms.Props {
+		available, errA := strconv.ParseInt(p.Available, 10, 64)
+		used, errU := strconv.ParseInt(p.Used, 10, 64)
+		if errU == nil {
+			quota.Used = used
+		}
+		if errA == nil && errU == nil && available >= 0 {
+			quota.Total = used + available
+		}
+	}
+	return quota, nil
+}
+
+// VerifyWebDAV 测试 WebDAV 连接，根目录不存在时自动创建
+func (a *App) VerifyWebDAV(config WebDAVConfig) string {
+	client, err := NewWebDAVClient(config)
+	if err != nil {
+		return jsonResult(map[string]string{"error": err.Error()})
+	}
+	if _, err := client.Stat(""); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[WebDAV] 连接失败: %v", err)
+			return jsonResult(map[string]string{"error": err.Error()})
+		}
+		if err := client.Mkdir(""); err != nil {
+			return jsonResult(map[string]string{"error": err.Error()})
+		}
+	}
+	return `{"success": true}`
+}
+
+// WebDAVList 列出 WebDAV 根目录下的目录内容
+func (a *App) WebDAVList(dir string) string {
+	return a.StorageList("webdav", dir)
+}
+
+func (a *App) WebDAVUploadBook(ebookId string) string {
+	return a.StorageUploadBook("webdav", ebookId)
+}
+
+func (a *App) WebDAVDownloadBook(remotePath string) string {
+	return a.StorageDownloadBook("webdav", remotePath)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+const (
+	davTestUser     = "reader"
+	davTestPassword = "secret"
+)
+
+// newWebDAVTestServer 启动基于 golang.org/x/net/webdav 的本地服务器，挂载在 /dav 下。
+// x/net/webdav 不处理 If-Match / If-None-Match，父目录不存在时 PUT 返回 404，
+// 这里按 RFC 4918 和常见服务器（Nextcloud、坚果云）的行为补上，返回 412 和 409
+func newWebDAVTestServer(t *testing.T) (*httptest.Server, webdav.FileSystem) {
+	t.Helper()
+	fs := webdav.NewMemFS()
+	dav := &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != davTestUser || pass != davTestPassword {
+			w.Header().Set("WWW-Authenticate", `Basic realm="dav"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method == "PUT" {
+			name := strings.TrimPrefix(r.URL.Path, "/dav")
+			if _, err := fs.Stat(r.Context(), path.Dir(name)); err != nil {
+				http.Error(w, "parent missing", http.StatusConflict)
+				return
+			}
+			head := httptest.NewRecorder()
+			dav.ServeHTTP(head, httptest.NewRequest("HEAD", r.URL.String(), nil))
+			exists := head.Code == http.StatusOK
+			if r.Header.Get("If-None-Match") == "*" && exists {
+				http.Error(w, "exists", http.StatusPreconditionFailed)
+				return
+			}
+			if match := r.Header.Get("If-Match"); match != "" && (!exists || match != head.Header().Get("ETag")) {
+				http.Error(w, "etag mismatch", http.StatusPreconditionFailed)
+				return
+			}
+		}
+		dav.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, fs
+}
+
+func newWebDAVTestClient(t *testing.T, serverURL, password string) *WebDAVClient {
+	t.Helper()
+	client, err := NewWebDAVClient(WebDAVConfig{
+		URL:      serverURL + "/dav",
+		Username: davTestUser,
+		Password: password,
+		RootPath: "Neat Reader/书库",
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	return client
+}
+
+func readRemote(t *testing.T, client *WebDAVClient, p string, offset, length int64) string {
+	t.Helper()
+	rc, err := client.Open(p, offset, length)
+	if err != nil {
+		t.Fatalf("open %s: %v", p, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("read %s: %v", p, err)
+	}
+	return string(data)
+}
+
+func TestVerifyWebDAV(t *testing.T) {
+	server, fs := newWebDAVTestServer(t)
+	app := newTestApp(t)
+	config := WebDAVConfig{URL: server.URL + "/dav", Username: davTestUser, Password: davTestPassword, RootPath: "Neat Reader/书库"}
+
+	decodeResult(t, app.VerifyWebDAV(config), nil)
+	info, err := fs.Stat(t.Context(), "/Neat Reader/书库")
+	if err != nil || !info.IsDir() {
+		t.Fatalf("root not created: %v", err)
+	}
+	// 根目录已存在时再次验证也应成功
+	decodeResult(t, app.VerifyWebDAV(config), nil)
+
+	config.Password = "wrong"
+	var result struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(app.VerifyWebDAV(config)), &result); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.Error, "permission denied") {
+		t.Fatalf("error = %q, want permission denied", result.Error)
+	}
+
+	// 错误信息中带引号时结果仍是合法的 JSON
+	config.URL = "ftp://example.com/dav"
+	if err := json.Unmarshal([]byte(app.VerifyWebDAV(config)), &result); err != nil {
+		t.Fatalf("invalid result: %v", err)
+	}
+	if !strings.Contains(result.Error, `"ftp://example.com/dav"`) {
+		t.Fatalf("error = %q", result.Error)
+	}
+}
+
+func TestWebDAVClientFiles(t *testing.T) {
+	server, _ := newWebDAVTestServer(t)
+	client := newWebDAVTestClient(t, server.URL, davTestPassword)
+	if err := client.Mkdir(""); err != nil {
+		t.Fatalf("mkdir root: %v", err)
+	}
+
+	// 父目录不存在时 Put 收到 409，创建目录后重试；文件名包含需要转义的字符
+	name := "books/三体 #1 100%.epub"
+	target, err := client.Put(name, strings.NewReader("0123456789"), UploadFail, nil)
+	if err != nil || target != name {
+		t.Fatalf("put = %q, %v", target, err)
+	}
+	if _, err := client.Put(name, strings.NewReader("x"), UploadFail, nil); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("put existing with UploadFail: %v, want ErrExist", err)
+	}
+	renamed, err := client.Put(name, strings.NewReader("abc"), UploadRename, nil)
+	if err != nil || renamed != "books/三体 #1 100% (1).epub" {
+		t.Fatalf("put with UploadRename = %q, %v", renamed, err)
+	}
+
+	files, err := client.List("books")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	sizes := map[string]int64{}
+	for _, f := range files {
+		if f.IsDir || f.ETag == "" || strings.Contains(f.ETag, `"`) {
+			t.Fatalf("unexpected entry %+v", f)
+		}
+		sizes[f.Path] = f.Size
+	}
+	if len(sizes) != 2 || sizes[name] != 10 || sizes[renamed] != 3 {
+		t.Fatalf("list = %+v", files)
+	}
+
+	info, err := client.Stat(name)
+	if err != nil || info.Name != path.Base(name) || info.Size != 10 || info.Modified == 0 {
+		t.Fatalf("stat = %+v, %v", info, err)
+	}
+	if _, err := client.Stat("books/missing.epub"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("stat missing: %v, want ErrNotExist", err)
+	}
+
+	if got := readRemote(t, client, name, 0, -1); got != "0123456789" {
+		t.Fatalf("open = %q", got)
+	}
+	if got := readRemote(t, client, name, 2, 3); got != "234" {
+		t.Fatalf("open range = %q", got)
+	}
+
+	if _, err := client.Put(name, strings.NewReader("overwritten"), UploadOverwrite, nil); err != nil {
+		t.Fatalf("put with UploadOverwrite: %v", err)
+	}
+	if got := readRemote(t, client, name, 0, -1); got != "overwritten" {
+		t.Fatalf("open after overwrite = %q", got)
+	}
+
+	// 目标父目录不存在时 Move 先创建，Overwrite: F 遇到已存在的目标返回 ErrExist
+	moved := "archive/2024/三体.epub"
+	if err := client.Move(name, moved, false); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	if _, err := client.Stat(name); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("source still exists after move: %v", err)
+	}
+	if err := client.Move(renamed, moved, false); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("move onto existing: %v, want ErrExist", err)
+	}
+	if err := client.Move(renamed, moved, true); err != nil {
+		t.Fatalf("move with overwrite: %v", err)
+	}
+	if got := readRemote(t, client, moved, 0, -1); got != "abc" {
+		t.Fatalf("open moved = %q", got)
+	}
+
+	if err := client.Delete(moved); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := client.Delete(moved); err != nil {
+		t.Fatalf("delete missing: %v", err)
+	}
+	if _, err := client.Quota(); err != nil {
+		t.Fatalf("quota: %v", err)
+	}
+}
+
+func TestWebDAVConditionalWrite(t *testing.T) {
+	server, _ := newWebDAVTestServer(t)
+	client := newWebDAVTestClient(t, server.URL, davTestPassword)
+	const manifest = "sync/manifest.json"
+
+	// 文件不存在时只允许创建，父目录缺失时自动创建
+	if err := writeRemoteFileIfUnchanged(client, manifest, []byte(`{"v":1}`), nil); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := writeRemoteFileIfUnchanged(client, manifest, []byte(`{"v":0}`), nil); !errors.Is(err, errRemoteChanged) {
+		t.Fatalf("create over existing: %v, want errRemoteChanged", err)
+	}
+
+	first, err := client.Stat(manifest)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if err := writeRemoteFileIfUnchanged(client, manifest, []byte(`{"v":2}`), &first); err != nil {
+		t.Fatalf("write with current etag: %v", err)
+	}
+	// 另一台设备已写入，旧 ETag 不再匹配
+	if err := writeRemoteFileIfUnchanged(client, manifest, []byte(`{"v":3}`), &first); !errors.Is(err, errRemoteChanged) {
+		t.Fatalf("write with stale etag: %v, want errRemoteChanged", err)
+	}
+	if got := readRemote(t, client, manifest, 0, -1); got != `{"v":2}` {
+		t.Fatalf("manifest = %s", got)
+	}
+}
+
+func TestWebDAVWrongPassword(t *testing.T) {
+	server, _ := newWebDAVTestServer(t)
+	client := newWebDAVTestClient(t, server.URL, "wrong")
+	if _, err := client.List(""); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("list: %v, want permission denied", err)
+	}
+	if _, err := client.Put("a.epub", bytes.NewReader(nil), UploadOverwrite, nil); err == nil {
+		t.Fatal("put succeeded with wrong password")
+	}
+}